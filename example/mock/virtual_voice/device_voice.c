@@ -14,29 +14,30 @@
 
 
 uint8_t* read_file(const char* filename, size_t* out_len);
-uint16_t crc16_ccitt(const uint8_t *data, size_t len);
+uint16_t crc16_maxim(const uint8_t *data, size_t len);
 
 
-// Simple CRC16-CCITT (0x1021 polynomial, initial 0xFFFF)
-uint16_t crc16_ccitt(const uint8_t *data, size_t len)
+// CRC16-MAXIM (reflected 0x8005 polynomial, initial 0x0000, xorout 0xFFFF)
+// Must match the server side voice.Checksum
+uint16_t crc16_maxim(const uint8_t *data, size_t len)
 {
-    uint16_t crc = 0xFFFF;
+    uint16_t crc = 0x0000;
     for (size_t i = 0; i < len; i++)
     {
-        crc ^= (uint16_t)data[i] << 8;
+        crc ^= (uint16_t)data[i];
         for (int j = 0; j < 8; j++)
         {
-            if (crc & 0x8000)
+            if (crc & 0x0001)
             {
-                crc = (crc << 1) ^ 0x1021;
+                crc = (crc >> 1) ^ 0xA001;
             }
             else
             {
-                crc <<= 1;
+                crc >>= 1;
             }
         }
     }
-    return crc;
+    return crc ^ 0xFFFF;
 }
 
 // 读取文件内容到内存
@@ -140,12 +141,13 @@ int main(int argc, char *argv[])
     header_buf[10] = 0;
     header_buf[11] = 0;
 
-    // Step 2: compute CRC over header + payload
+    // Step 2: compute CRC over header (Ver~PayloadLen) + payload
     size_t total_len = HEADER_SIZE + payload_len;
-    uint8_t *checksum_data = malloc(total_len);
-    memcpy(checksum_data, header_buf, HEADER_SIZE);
-    memcpy(checksum_data + HEADER_SIZE, payload, payload_len);
-    uint16_t computed_crc = crc16_ccitt(checksum_data, total_len);
+    size_t checksum_len = (HEADER_SIZE - 2) + payload_len;
+    uint8_t *checksum_data = malloc(checksum_len);
+    memcpy(checksum_data, header_buf, HEADER_SIZE - 2);
+    memcpy(checksum_data + HEADER_SIZE - 2, payload, payload_len);
+    uint16_t computed_crc = crc16_maxim(checksum_data, checksum_len);
     free(checksum_data);
 
     // Step 3: set CRC and repack
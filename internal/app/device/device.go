@@ -5,13 +5,17 @@ import (
 	"context"
 	"fmt"
 	"yunyez/internal/common/config"
+	routes "yunyez/internal/app/routes"
 	middleware "yunyez/internal/middleware"
 	deviceManage "yunyez/internal/controller/deviceManage"
 	voiceManage "yunyez/internal/controller/voiceManage"
 	logger "yunyez/internal/pkg/logger"
 	mqtt "yunyez/internal/pkg/mqtt"
+	redis "yunyez/internal/pkg/redis"
+	voiceHandler "yunyez/internal/service/voice/handler"
 
 	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 // Start 设备服务入口
@@ -24,6 +28,13 @@ func Start() {
 		return
 	}
 
+	// 创建语音处理流程
+	pipeline, err := voiceHandler.BuildPipeline()
+	if err != nil {
+		fmt.Printf("failed to build voice pipeline: %v\n", err)
+		return
+	}
+
 	// 启动mqtt连接
 	if err := mqtt.StartConnect(); err != nil {
 		logger.Error(context.TODO(), "mqtt.connect error", map[string]interface{}{
@@ -32,7 +43,7 @@ func Start() {
 		return
 	}
 	// 启动http服务
-	HTTPStart()
+	HTTPStart(pipeline)
 
 	select{} // 阻塞主goroutine
 }
@@ -41,7 +52,9 @@ func Start() {
 // 设备服务--http接口
 
 // HTTPStart 启动http服务 设置路由监听端口
-func HTTPStart() {
+// 参数：
+//   - pipeline: 语音处理流程
+func HTTPStart(pipeline *voiceHandler.VoicePipeline) {
 	// 初始化gin路由
 	r := gin.New()
 
@@ -63,8 +76,42 @@ func HTTPStart() {
 		deviceGroup.PUT("/update", deviceManage.UpdateDeviceInfo)     // 更新设备
 	}
 
+	voiceCtrl := voiceManage.NewVoiceController(pipeline)
+	voiceGroup := api.Group("/voice")
+	{
+		voiceGroup.GET("/status", voiceCtrl.FetchStatus) // AI 依赖的健康与熔断状态
+	}
+
+	// 设备对话记录与轮次记录，需登录管理后台；Redis 不可用时不检查 Token 黑名单
+	var redisClient *goredis.Client
+	if client, err := redis.NewClient(); err != nil {
+		logger.Warn(context.TODO(), "redis unavailable, token blacklist is not checked", map[string]any{
+			"error": err.Error(),
+		})
+	} else {
+		redisClient = client.Client
+	}
+	routes.SetupConversationRoutes(r, routes.ConversationDependencies{
+		Pipeline:    pipeline,
+		RedisClient: redisClient,
+		AuthConfig:  routes.DefaultAuthConfig(),
+	})
+
+	// 设备画像，修改仅管理员可操作
+	routes.SetupProfileRoutes(r, routes.ProfileDependencies{
+		RedisClient: redisClient,
+		AuthConfig:  routes.DefaultAuthConfig(),
+	})
+
+	// 提示词模板，修改仅管理员可操作
+	routes.SetupPromptRoutes(r, routes.PromptDependencies{
+		RedisClient: redisClient,
+		AuthConfig:  routes.DefaultAuthConfig(),
+	})
+
 	// 语音路由
-	r.POST("/voice", voiceManage.UploadVoice) // 发送语音
+	r.POST("/voice", voiceCtrl.UploadVoice) // 发送语音
+	r.POST("/cmd", voiceCtrl.DeviceCommand) // 设备控制消息
 
 	// 获取 HTTP 端口号
 	port := ":" + config.GetString("http.port")
@@ -103,6 +103,26 @@ func DefaultAuthConfig() authpkg.AuthConfig {
 	}
 }
 
+// authorizer 创建按角色鉴权的中间件，同一组路由共用 JWT 校验与 Token 黑名单
+// 参数：
+//   - redisClient: Token 黑名单，nil 时不检查黑名单
+//   - authConfig: 认证配置
+//
+// 返回值:
+//   - func(roles ...string) gin.HandlerFunc: 要求登录且具备任一角色的中间件
+func authorizer(redisClient *redis.Client, authConfig authpkg.AuthConfig) func(roles ...string) gin.HandlerFunc {
+	jwtManager := authpkg.NewJWTManager(authConfig.JWT)
+	blacklist := authpkg.NewTokenBlacklist(redisClient, authConfig.Redis)
+	return func(roles ...string) gin.HandlerFunc {
+		return middleware.AuthMiddleware(middleware.AuthMiddlewareConfig{
+			JWTManager:    jwtManager,
+			Blacklist:     blacklist,
+			RedisClient:   redisClient,
+			RequiredRoles: roles,
+		})
+	}
+}
+
 // TokenCleanupTask Token 黑名单清理任务
 // 定期清理过期的 Token (虽然 Redis 会自动过期，但可以做一些额外的清理工作)
 func StartTokenCleanupTask(redisClient *redis.Client) {
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	conversationcontroller "yunyez/internal/controller/conversationManage"
+	tracecontroller "yunyez/internal/controller/traceManage"
+	authpkg "yunyez/internal/pkg/auth"
+	voiceHandler "yunyez/internal/service/voice/handler"
+)
+
+// ConversationDependencies 对话记录路由依赖
+type ConversationDependencies struct {
+	Pipeline    *voiceHandler.VoicePipeline
+	RedisClient *redis.Client // Token 黑名单，nil 时不检查黑名单
+	AuthConfig  authpkg.AuthConfig
+}
+
+// SetupConversationRoutes 注册设备对话记录与语音轮次记录路由
+// 查看对话记录需登录后台，清空对话记录仅管理员可操作；轮次记录含识别文本与回复，与对话记录同样需登录后台
+func SetupConversationRoutes(r *gin.Engine, deps ConversationDependencies) {
+	// 1. 初始化认证组件
+	authorize := authorizer(deps.RedisClient, deps.AuthConfig)
+
+	conversationCtrl := conversationcontroller.NewConversationController(deps.Pipeline)
+
+	// 2. 注册路由
+	conversations := r.Group("/api/device/:sn/conversations")
+	{
+		read := authorize("super_admin", "admin", "operator", "viewer")
+		conversations.GET("", read, conversationCtrl.FetchConversations)    // 会话列表
+		conversations.GET("/turns", read, conversationCtrl.SearchTurns)     // 检索对话
+		conversations.GET("/:id", read, conversationCtrl.FetchConversation) // 会话详情
+
+		// 清空对话记录与 Redis 上下文
+		conversations.DELETE("", authorize("super_admin", "admin"), conversationCtrl.ClearHistory)
+	}
+
+	turns := r.Group("/api/voice/turns", authorize("super_admin", "admin", "operator", "viewer"))
+	{
+		turns.GET("", tracecontroller.FetchTurns)         // 查询轮次记录
+		turns.GET("/:traceId", tracecontroller.FetchTurn) // 查询轮次记录详情
+	}
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	profilecontroller "yunyez/internal/controller/profileManage"
+	authpkg "yunyez/internal/pkg/auth"
+)
+
+// ProfileDependencies 设备画像路由依赖
+type ProfileDependencies struct {
+	RedisClient *redis.Client // Token 黑名单，nil 时不检查黑名单
+	AuthConfig  authpkg.AuthConfig
+}
+
+// SetupProfileRoutes 注册设备画像路由
+// 查看画像需登录后台，修改画像与记住的事实仅管理员可操作
+func SetupProfileRoutes(r *gin.Engine, deps ProfileDependencies) {
+	// 1. 初始化认证组件
+	authorize := authorizer(deps.RedisClient, deps.AuthConfig)
+
+	// 2. 注册路由
+	profile := r.Group("/api/device/profile/:sn")
+	{
+		profile.GET("", authorize("super_admin", "admin", "operator", "viewer"), profilecontroller.FetchProfile) // 获取设备画像
+
+		write := authorize("super_admin", "admin")
+		profile.PUT("", write, profilecontroller.UpdateProfile)            // 更新设备画像
+		profile.PUT("/facts", write, profilecontroller.SaveFacts)          // 保存画像事实
+		profile.DELETE("/facts/:key", write, profilecontroller.DeleteFact) // 删除画像事实
+	}
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	promptcontroller "yunyez/internal/controller/promptManage"
+	authpkg "yunyez/internal/pkg/auth"
+)
+
+// PromptDependencies 提示词模板路由依赖
+type PromptDependencies struct {
+	RedisClient *redis.Client // Token 黑名单，nil 时不检查黑名单
+	AuthConfig  authpkg.AuthConfig
+}
+
+// SetupPromptRoutes 注册提示词模板路由
+// 查看模板需登录后台，保存、删除与重新加载模板仅管理员可操作
+func SetupPromptRoutes(r *gin.Engine, deps PromptDependencies) {
+	// 1. 初始化认证组件
+	authorize := authorizer(deps.RedisClient, deps.AuthConfig)
+
+	// 2. 注册路由
+	templates := r.Group("/api/prompt/templates")
+	{
+		templates.GET("", authorize("super_admin", "admin", "operator", "viewer"), promptcontroller.FetchTemplates) // 获取提示词模板列表
+
+		write := authorize("super_admin", "admin")
+		templates.PUT("", write, promptcontroller.SaveTemplate)            // 保存提示词模板
+		templates.DELETE("/:id", write, promptcontroller.DeleteTemplate)   // 删除提示词模板
+		templates.POST("/reload", write, promptcontroller.ReloadTemplates) // 重新加载提示词模板
+	}
+}
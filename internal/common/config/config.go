@@ -33,6 +33,7 @@ var (
 	cfgHolder = &configHolder{}       // 全局配置持有者
 	watch     = make(map[string]bool) // 配置文件监控列表
 	once      sync.Once
+	initErr   error // 首次加载配置的错误，Init 返回该错误
 
 	commonConfigFiles = []string{
 		"device.yaml", // 设备配置文件
@@ -51,11 +52,10 @@ var (
 
 // Init 初始化配置文件 供外部显示调用
 func Init() error {
-	var err error
 	once.Do(func() {
-		err = initConfig()
+		initErr = initConfig()
 	})
-	return err
+	return initErr
 }
 
 // initConfig 初始化配置文件
@@ -147,9 +147,12 @@ func getViper() *viper.Viper {
     }
 
     // 如果还没初始化，尝试初始化（但要小心）
+    // 未加载到配置文件（如在包目录下运行单元测试）时使用空配置，各配置项取默认值；
+    // 加载错误保留给 Init 返回，服务启动时仍会失败
     once.Do(func() {
-        if err := initConfig(); err != nil {
-            log.Fatalf("Failed to initialize config in getViper: %v", err)
+        if initErr = initConfig(); initErr != nil {
+            log.Printf("config not loaded, using defaults: %v", initErr)
+            cfgHolder.data.Store(viper.New())
         }
     })
     // 再取一次
@@ -216,6 +219,11 @@ func GetBool(key string) bool {
 	return val
 }
 
+// GetStringMap 获取 map 类型配置值，如按名称配置的后端
+func GetStringMap(key string) map[string]interface{} {
+	return getViper().GetStringMap(key)
+}
+
 // GetList 获取字符串列表配置值
 func GetList(key string) []string {
 	return getViper().GetStringSlice(key)
@@ -0,0 +1,217 @@
+package conversation_manage
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	logger "yunyez/internal/pkg/logger"
+	conversationService "yunyez/internal/service/conversation"
+	voiceHandler "yunyez/internal/service/voice/handler"
+	commonType "yunyez/internal/types/common"
+	conversationType "yunyez/internal/types/conversation"
+)
+
+// ConversationController 设备对话记录控制器
+type ConversationController struct {
+	pipeline *voiceHandler.VoicePipeline
+}
+
+// NewConversationController 创建设备对话记录控制器
+// 参数：
+//   - pipeline: 语音处理流程，清空对话记录时一并清空对话记忆
+func NewConversationController(pipeline *voiceHandler.VoicePipeline) *ConversationController {
+	return &ConversationController{pipeline: pipeline}
+}
+
+// FetchConversations 获取设备的会话列表
+// @Summary 获取会话列表
+// @Description 分页获取设备的对话会话，按最近对话时间倒序
+// @Tags 对话记录
+// @Produce json
+// @Security BearerAuth
+// @Param sn path string true "设备序列号"
+// @Param pageNum query int false "页码"
+// @Param pageSize query int false "每页条数"
+// @Success 200 {object} conversationType.ConversationListResponse "成功获取会话列表"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数"
+// @Failure 500 {object} map[string]interface{} "获取会话列表失败"
+// @Router /device/{sn}/conversations [get]
+func (cc *ConversationController) FetchConversations(c *gin.Context) {
+	ctx := c.Request.Context()
+	sn := c.Param("sn")
+
+	var req conversationType.ConversationListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "Invalid request parameter",
+			"Data":    err.Error(),
+		})
+		return
+	}
+
+	conversations, total, err := conversationService.ServiceInstance.ListConversations(ctx, sn, req.Page.PageNum, req.Page.PageSize)
+	if err != nil {
+		logger.Error(ctx, "Failed to list conversations", map[string]any{
+			"error": err.Error(),
+			"sn":    sn,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "list conversations failed",
+			"Data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "Success",
+		"Data": conversationType.ConversationListResponse{
+			Page: commonType.Page{
+				PageNum:  req.Page.PageNum,
+				PageSize: req.Page.PageSize,
+			},
+			Total: int(total),
+			List:  conversations,
+		},
+	})
+}
+
+// SearchTurns 检索设备的对话
+// @Summary 检索对话
+// @Description 分页获取设备听到的内容与回复，按对话时间倒序；q 不为空时按识别文本与回复全文检索
+// @Tags 对话记录
+// @Produce json
+// @Security BearerAuth
+// @Param sn path string true "设备序列号"
+// @Param q query string false "全文检索关键词"
+// @Param pageNum query int false "页码"
+// @Param pageSize query int false "每页条数"
+// @Success 200 {object} conversationType.TurnListResponse "成功检索对话"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数"
+// @Failure 500 {object} map[string]interface{} "检索对话失败"
+// @Router /device/{sn}/conversations/turns [get]
+func (cc *ConversationController) SearchTurns(c *gin.Context) {
+	cc.fetchTurns(c, 0)
+}
+
+// FetchConversation 获取会话的对话
+// @Summary 获取会话详情
+// @Description 分页获取一个会话中的对话，按对话时间倒序；q 不为空时按识别文本与回复全文检索
+// @Tags 对话记录
+// @Produce json
+// @Security BearerAuth
+// @Param sn path string true "设备序列号"
+// @Param id path int true "会话ID"
+// @Param q query string false "全文检索关键词"
+// @Param pageNum query int false "页码"
+// @Param pageSize query int false "每页条数"
+// @Success 200 {object} conversationType.TurnListResponse "成功获取会话详情"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数"
+// @Failure 500 {object} map[string]interface{} "获取会话详情失败"
+// @Router /device/{sn}/conversations/{id} [get]
+func (cc *ConversationController) FetchConversation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid conversation id",
+			"Data":    c.Param("id"),
+		})
+		return
+	}
+	cc.fetchTurns(c, id)
+}
+
+// fetchTurns 分页查询设备的对话，conversationID 为 0 时不限会话
+func (cc *ConversationController) fetchTurns(c *gin.Context, conversationID int64) {
+	ctx := c.Request.Context()
+	sn := c.Param("sn")
+
+	var req conversationType.TurnListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "Invalid request parameter",
+			"Data":    err.Error(),
+		})
+		return
+	}
+
+	filter := conversationService.TurnFilter{
+		ConversationID: conversationID,
+		Query:          req.Query,
+	}
+	turns, total, err := conversationService.ServiceInstance.ListTurns(ctx, sn, filter, req.Page.PageNum, req.Page.PageSize)
+	if err != nil {
+		logger.Error(ctx, "Failed to list conversation turns", map[string]any{
+			"error":          err.Error(),
+			"sn":             sn,
+			"conversationID": conversationID,
+			"q":              req.Query,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "list conversation turns failed",
+			"Data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "Success",
+		"Data": conversationType.TurnListResponse{
+			Page: commonType.Page{
+				PageNum:  req.Page.PageNum,
+				PageSize: req.Page.PageSize,
+			},
+			Total: int(total),
+			List:  turns,
+		},
+	})
+}
+
+// ClearHistory 清空设备的对话记录
+// @Summary 清空对话记录
+// @Description 删除设备的全部会话与对话，清空设备的对话记忆（Redis 上下文），并清除轮次记录中的识别文本与回复
+// @Tags 对话记录
+// @Produce json
+// @Security BearerAuth
+// @Param sn path string true "设备序列号"
+// @Success 200 {object} conversationType.ClearHistoryResponse "成功清空对话记录"
+// @Failure 500 {object} map[string]interface{} "清空对话记录失败"
+// @Router /device/{sn}/conversations [delete]
+func (cc *ConversationController) ClearHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	sn := c.Param("sn")
+
+	deleted, err := cc.pipeline.ClearHistory(ctx, sn)
+	if err != nil {
+		logger.Error(ctx, "Failed to clear conversation history", map[string]any{
+			"error":   err.Error(),
+			"sn":      sn,
+			"deleted": deleted,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "clear conversation history failed",
+			"Data":    nil,
+		})
+		return
+	}
+
+	logger.Info(ctx, "Conversation history cleared", map[string]any{
+		"sn":       sn,
+		"deleted":  deleted,
+		"operator": c.GetString("username"),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "clear conversation history success",
+		"Data":    conversationType.ClearHistoryResponse{Deleted: deleted},
+	})
+}
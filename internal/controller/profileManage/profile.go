@@ -0,0 +1,267 @@
+package profile_manage
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	profileModel "yunyez/internal/model/profile"
+	prompt "yunyez/internal/pkg/agent/prompt"
+	logger "yunyez/internal/pkg/logger"
+	profileService "yunyez/internal/service/profile"
+	profileType "yunyez/internal/types/profile"
+)
+
+// FetchProfile 获取设备画像
+// @Summary 获取设备画像
+// @Description 获取设备与绑定用户的长期画像及需要长期记住的事实
+// @Tags 设备画像
+// @Produce json
+// @Param sn path string true "设备序列号"
+// @Success 200 {object} profileType.ProfileInfo "成功获取设备画像"
+// @Failure 500 {object} map[string]interface{} "获取设备画像失败"
+// @Router /device/profile/{sn} [get]
+func FetchProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	sn := c.Param("sn")
+
+	info := &profileType.ProfileInfo{
+		SN:       sn,
+		Timezone: "Asia/Shanghai",
+		Language: prompt.DefaultLanguage,
+		Facts:    []profileType.FactItem{},
+	}
+	p, err := profileService.ServiceInstance.GetProfile(ctx, sn)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error(ctx, "Failed to get device profile", map[string]any{
+			"error": err.Error(),
+			"sn":    sn,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "get device profile failed",
+			"Data":    nil,
+		})
+		return
+	}
+	if p != nil {
+		info.UserID = p.UserID
+		info.UserName = p.UserName
+		info.DeviceName = p.DeviceName
+		info.Location = p.Location
+		info.Timezone = p.Timezone
+		info.Language = p.Language
+	}
+
+	facts, err := profileService.ServiceInstance.ListFacts(ctx, sn)
+	if err != nil {
+		logger.Error(ctx, "Failed to list profile facts", map[string]any{
+			"error": err.Error(),
+			"sn":    sn,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "list profile facts failed",
+			"Data":    nil,
+		})
+		return
+	}
+	for _, f := range facts {
+		updateTime := f.UpdateTime
+		info.Facts = append(info.Facts, profileType.FactItem{
+			Key:        f.Key,
+			Value:      f.Value,
+			Source:     f.Source,
+			UpdateTime: &updateTime,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "Success",
+		"Data":    info,
+	})
+}
+
+// UpdateProfile 更新设备画像
+// @Summary 更新设备画像
+// @Description 更新用户称呼、设备名称、位置、时区、语言，画像不存在时创建
+// @Tags 设备画像
+// @Accept json
+// @Produce json
+// @Param sn path string true "设备序列号"
+// @Param profile body profileType.ProfileUpdateRequest true "设备画像"
+// @Success 200 {object} map[string]interface{} "成功更新设备画像"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数"
+// @Failure 500 {object} map[string]interface{} "更新设备画像失败"
+// @Router /device/profile/{sn} [put]
+func UpdateProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	sn := c.Param("sn")
+
+	var req profileType.ProfileUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid request body",
+			"Data":    err.Error(),
+		})
+		return
+	}
+	updates := make(map[string]interface{})
+	if req.UserID != nil {
+		updates["user_id"] = *req.UserID
+	}
+	if req.UserName != nil {
+		updates["user_name"] = *req.UserName
+	}
+	if req.DeviceName != nil {
+		updates["device_name"] = *req.DeviceName
+	}
+	if req.Location != nil {
+		updates["location"] = *req.Location
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Code":    http.StatusBadRequest,
+				"Message": "invalid timezone",
+				"Data":    *req.Timezone,
+			})
+			return
+		}
+		updates["timezone"] = *req.Timezone
+	}
+	if req.Language != nil {
+		updates["language"] = *req.Language
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "no update fields provided",
+			"Data":    nil,
+		})
+		return
+	}
+
+	if err := profileService.ServiceInstance.SaveProfile(ctx, sn, updates); err != nil {
+		logger.Error(ctx, "Failed to save device profile", map[string]any{
+			"error": err.Error(),
+			"sn":    sn,
+			"req":   req,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "update device profile failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "update device profile success",
+	})
+}
+
+// SaveFacts 保存需要长期记住的事实
+// @Summary 保存画像事实
+// @Description 保存设备需要长期记住的事实，同一键覆盖旧值
+// @Tags 设备画像
+// @Accept json
+// @Produce json
+// @Param sn path string true "设备序列号"
+// @Param facts body profileType.FactSaveRequest true "事实"
+// @Success 200 {object} map[string]interface{} "成功保存事实"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数"
+// @Failure 500 {object} map[string]interface{} "保存事实失败"
+// @Router /device/profile/{sn}/facts [put]
+func SaveFacts(c *gin.Context) {
+	ctx := c.Request.Context()
+	sn := c.Param("sn")
+
+	var req profileType.FactSaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid request body",
+			"Data":    err.Error(),
+		})
+		return
+	}
+	facts := make([]prompt.Fact, 0, len(req.Facts))
+	for _, item := range req.Facts {
+		f := prompt.Fact{Key: item.Key, Value: item.Value}
+		if !prompt.ValidFact(f) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Code":    http.StatusBadRequest,
+				"Message": "invalid fact",
+				"Data":    item,
+			})
+			return
+		}
+		facts = append(facts, f)
+	}
+
+	if err := profileService.ServiceInstance.SaveFacts(ctx, sn, facts, profileModel.SourceAdmin); err != nil {
+		logger.Error(ctx, "Failed to save profile facts", map[string]any{
+			"error": err.Error(),
+			"sn":    sn,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "save profile facts failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "save profile facts success",
+	})
+}
+
+// DeleteFact 删除需要长期记住的事实
+// @Summary 删除画像事实
+// @Description 删除设备的一条事实
+// @Tags 设备画像
+// @Produce json
+// @Param sn path string true "设备序列号"
+// @Param key path string true "事实键"
+// @Success 200 {object} map[string]interface{} "成功删除事实"
+// @Failure 404 {object} map[string]interface{} "事实不存在"
+// @Failure 500 {object} map[string]interface{} "删除事实失败"
+// @Router /device/profile/{sn}/facts/{key} [delete]
+func DeleteFact(c *gin.Context) {
+	ctx := c.Request.Context()
+	sn, key := c.Param("sn"), c.Param("key")
+
+	err := profileService.ServiceInstance.DeleteFact(ctx, sn, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"Code":    http.StatusNotFound,
+			"Message": "fact not found",
+			"Data":    nil,
+		})
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete profile fact", map[string]any{
+			"error": err.Error(),
+			"sn":    sn,
+			"key":   key,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "delete profile fact failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "delete profile fact success",
+	})
+}
@@ -0,0 +1,184 @@
+package prompt_manage
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	promptModel "yunyez/internal/model/prompt"
+	prompt "yunyez/internal/pkg/agent/prompt"
+	logger "yunyez/internal/pkg/logger"
+	promptService "yunyez/internal/service/prompt"
+	promptType "yunyez/internal/types/prompt"
+)
+
+// FetchTemplates 获取提示词模板列表
+// @Summary 获取提示词模板列表
+// @Description 获取所有系统提示词覆盖模板，包括未启用的模板
+// @Tags 提示词模板
+// @Produce json
+// @Success 200 {object} []promptModel.PromptTemplate "成功获取提示词模板列表"
+// @Failure 500 {object} map[string]interface{} "获取提示词模板列表失败"
+// @Router /prompt/templates [get]
+func FetchTemplates(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	templates, err := promptService.ServiceInstance.ListTemplates(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to list prompt templates", map[string]any{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "list prompt templates failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "Success",
+		"Data":    templates,
+	})
+}
+
+// SaveTemplate 保存提示词模板
+// @Summary 保存提示词模板
+// @Description 创建或更新厂商、设备类型或单台设备的系统提示词覆盖模板，保存后立即生效
+// @Tags 提示词模板
+// @Accept json
+// @Produce json
+// @Param template body promptType.TemplateSaveRequest true "提示词模板"
+// @Success 200 {object} map[string]interface{} "成功保存提示词模板"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数或模板语法错误"
+// @Failure 500 {object} map[string]interface{} "保存提示词模板失败"
+// @Router /prompt/templates [put]
+func SaveTemplate(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req promptType.TemplateSaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid request body",
+			"Data":    err.Error(),
+		})
+		return
+	}
+	t := &promptModel.PromptTemplate{
+		Scope:   req.Scope,
+		Target:  req.Target,
+		Content: req.Content,
+		Enabled: req.Enabled == nil || *req.Enabled,
+		Remark:  req.Remark,
+	}
+	// 语法错误在保存前检查，避免不可用的模板入库
+	if _, err := prompt.Parse(t.Scope+":"+t.Target, t.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid prompt template",
+			"Data":    err.Error(),
+		})
+		return
+	}
+
+	if err := promptService.ServiceInstance.SaveTemplate(ctx, t); err != nil {
+		logger.Error(ctx, "Failed to save prompt template", map[string]any{
+			"error":  err.Error(),
+			"scope":  t.Scope,
+			"target": t.Target,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "save prompt template failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "save prompt template success",
+	})
+}
+
+// DeleteTemplate 删除提示词模板
+// @Summary 删除提示词模板
+// @Description 删除系统提示词覆盖模板，删除后立即生效
+// @Tags 提示词模板
+// @Produce json
+// @Param id path int true "模板ID"
+// @Success 200 {object} map[string]interface{} "成功删除提示词模板"
+// @Failure 400 {object} map[string]interface{} "无效的模板ID"
+// @Failure 404 {object} map[string]interface{} "提示词模板不存在"
+// @Failure 500 {object} map[string]interface{} "删除提示词模板失败"
+// @Router /prompt/templates/{id} [delete]
+func DeleteTemplate(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid template id",
+			"Data":    c.Param("id"),
+		})
+		return
+	}
+
+	err = promptService.ServiceInstance.DeleteTemplate(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"Code":    http.StatusNotFound,
+			"Message": "prompt template not found",
+			"Data":    nil,
+		})
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete prompt template", map[string]any{
+			"error": err.Error(),
+			"id":    id,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "delete prompt template failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "delete prompt template success",
+	})
+}
+
+// ReloadTemplates 重新加载提示词模板
+// @Summary 重新加载提示词模板
+// @Description 立即从数据库重新加载系统提示词覆盖模板，用于直接修改数据库后使模板生效
+// @Tags 提示词模板
+// @Produce json
+// @Success 200 {object} map[string]interface{} "成功重新加载提示词模板"
+// @Failure 500 {object} map[string]interface{} "重新加载提示词模板失败"
+// @Router /prompt/templates/reload [post]
+func ReloadTemplates(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if err := promptService.ServiceInstance.Reload(ctx); err != nil {
+		logger.Error(ctx, "Failed to reload prompt templates", map[string]any{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "reload prompt templates failed",
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "reload prompt templates success",
+	})
+}
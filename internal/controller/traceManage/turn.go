@@ -0,0 +1,131 @@
+package trace_manage
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	logger "yunyez/internal/pkg/logger"
+	traceService "yunyez/internal/service/trace"
+	commonType "yunyez/internal/types/common"
+	traceType "yunyez/internal/types/trace"
+)
+
+// FetchTurns 查询语音处理流程的轮次记录
+// @Summary 查询轮次记录
+// @Description 按设备与时间范围查询每轮语音处理各阶段的完成时间、识别文本、意图、回复与出错阶段，按开始时间倒序
+// @Tags 语音链路
+// @Produce json
+// @Security BearerAuth
+// @Param sn query string false "设备序列号"
+// @Param start query string false "开始时间不早于（RFC3339）"
+// @Param end query string false "开始时间早于（RFC3339）"
+// @Param minLatencyMs query int false "首个合成音频的最小毫秒数"
+// @Param errorOnly query bool false "只查询出错的轮次"
+// @Param pageNum query int false "页码"
+// @Param pageSize query int false "每页条数"
+// @Success 200 {object} traceType.TurnListResponse "成功查询轮次记录"
+// @Failure 400 {object} map[string]interface{} "无效的请求参数"
+// @Failure 500 {object} map[string]interface{} "查询轮次记录失败"
+// @Router /voice/turns [get]
+func FetchTurns(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req traceType.TurnListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "Invalid request parameter",
+			"Data":    err.Error(),
+		})
+		return
+	}
+	if !req.Start.IsZero() && !req.End.IsZero() && !req.Start.Before(req.End) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "start must be before end",
+			"Data":    nil,
+		})
+		return
+	}
+
+	filter := traceService.TurnFilter{
+		SN:           req.SN,
+		Start:        req.Start,
+		End:          req.End,
+		MinLatencyMS: req.MinLatencyMS,
+		ErrorOnly:    req.ErrorOnly,
+	}
+	records, total, err := traceService.ServiceInstance.ListTurns(ctx, filter, req.Page.PageNum, req.Page.PageSize)
+	if err != nil {
+		logger.Error(ctx, "Failed to list turn records", map[string]any{
+			"error": err.Error(),
+			"req":   req,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "list turn records failed",
+			"Data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "Success",
+		"Data": traceType.TurnListResponse{
+			Page: commonType.Page{
+				PageNum:  req.Page.PageNum,
+				PageSize: req.Page.PageSize,
+			},
+			Total: int(total),
+			List:  records,
+		},
+	})
+}
+
+// FetchTurn 查询一轮语音处理的记录
+// @Summary 查询轮次记录详情
+// @Description 根据链路ID查询一轮语音处理的记录
+// @Tags 语音链路
+// @Produce json
+// @Security BearerAuth
+// @Param traceId path string true "链路ID"
+// @Success 200 {object} map[string]interface{} "成功查询轮次记录"
+// @Failure 404 {object} map[string]interface{} "轮次记录不存在"
+// @Failure 500 {object} map[string]interface{} "查询轮次记录失败"
+// @Router /voice/turns/{traceId} [get]
+func FetchTurn(c *gin.Context) {
+	ctx := c.Request.Context()
+	traceID := c.Param("traceId")
+
+	record, err := traceService.ServiceInstance.GetTurn(ctx, traceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"Code":    http.StatusNotFound,
+			"Message": "turn record not found",
+			"Data":    nil,
+		})
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get turn record", map[string]any{
+			"error":   err.Error(),
+			"traceID": traceID,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Code":    http.StatusInternalServerError,
+			"Message": "get turn record failed",
+			"Data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "Success",
+		"Data":    record,
+	})
+}
@@ -0,0 +1,46 @@
+package voicemanager
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"yunyez/internal/pkg/logger"
+)
+
+// DeviceCommand device control message
+// @Summary 设备控制消息
+// @Description 接收来自MQTT转发的设备控制消息（如取消当前回复）
+// @Tags 语音管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} gin.H{"message": "ok"}
+// @Failure 400 {object} gin.H{"error": "读取请求体失败"}
+// @Router /cmd [post]
+func (vc *VoiceController) DeviceCommand(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
+	clientID := c.GetHeader("ClientID")
+	if err := vc.pipeline.ProcessCommand(c.Request.Context(), clientID, body); err != nil {
+		logger.Error(c.Request.Context(), "voiceHandler.ProcessCommand failed", map[string]any{
+			"error":    err.Error(),
+			"topic":    c.GetHeader("Topic"),
+			"ClientID": clientID,
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": err.Error(),
+			"Data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "ok",
+		"Data":    nil,
+	})
+}
@@ -0,0 +1,17 @@
+package voicemanager
+
+import (
+	voiceHandler "yunyez/internal/service/voice/handler"
+)
+
+// VoiceController 语音接口，处理流程由调用方创建后注入
+type VoiceController struct {
+	pipeline *voiceHandler.VoicePipeline
+}
+
+// NewVoiceController 创建语音接口
+// 参数：
+//   - pipeline: 语音处理流程
+func NewVoiceController(pipeline *voiceHandler.VoicePipeline) *VoiceController {
+	return &VoiceController{pipeline: pipeline}
+}
@@ -0,0 +1,22 @@
+package voicemanager
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FetchStatus AI dependency status
+// @Summary AI 依赖状态
+// @Description 查询 ASR、NLU、LLM、TTS 各提供方的健康检查与熔断状态，按降级顺序排列
+// @Tags 语音管理
+// @Produce json
+// @Success 200 {object} gin.H{"Code": 200, "Message": "ok", "Data": []resilience.ChainStatus}
+// @Router /voice/status [get]
+func (vc *VoiceController) FetchStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"Code":    http.StatusOK,
+		"Message": "ok",
+		"Data":    vc.pipeline.Status(),
+	})
+}
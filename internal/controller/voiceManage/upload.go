@@ -9,7 +9,6 @@ import (
 
 	"yunyez/internal/pkg/logger"
 	mqttCommon "yunyez/internal/pkg/mqtt/common"
-	voiceHandler "yunyez/internal/service/voice/handler"
 	mqttVoice "yunyez/internal/pkg/mqtt/protocol/voice"
 )
 
@@ -23,45 +22,52 @@ import (
 // @Success 200 {object} gin.H{"message": "语音处理成功"}
 // @Failure 400 {object} gin.H{"error": "读取请求体失败"}
 // @Router /voice/upload [post]
-func UploadVoice(c *gin.Context) {
+func (vc *VoiceController) UploadVoice(c *gin.Context) {
 	// 读取请求字节
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
 		return
 	}
-	// 解析消息音频头/音频载荷
-	var header mqttVoice.Header // 音频协议头 固定12字节
-	// 解析音频协议头
-	if err := header.UnmarshalHeader(body[:mqttVoice.HeaderSize]); err != nil {
-		logger.Error(c.Request.Context(), "mqtt.voice.Header.UnmarshalHeader failed", map[string]interface{}{
-			"error": err.Error(),
-			"topic": c.GetHeader("Topic"),
-			"payload_len": len(body[mqttVoice.HeaderSize:]),
-			"ClientID": c.GetHeader("ClientID"),
+	clientID := c.GetHeader("ClientID")
+	// 解析并校验音频头/音频载荷（长度、版本、载荷长度、CRC16）
+	header, payload, err := mqttVoice.Decode(body)
+	if err != nil {
+		reason := mqttVoice.Rejects.Record(clientID, err)
+		logger.Error(c.Request.Context(), "mqtt.voice.Decode failed", map[string]interface{}{
+			"error":    err.Error(),
+			"reason":   reason,
+			"rejected": mqttVoice.Rejects.Total(clientID),
+			"topic":    c.GetHeader("Topic"),
+			"body_len": len(body),
+			"ClientID": clientID,
+		})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code":    http.StatusBadRequest,
+			"Message": "invalid voice frame: " + reason,
+			"Data":    nil,
 		})
 		return
 	}
 
-	clientID := c.GetHeader("ClientID")
 	// 音频数据处理
 	switch header.F {
 	case mqttCommon.VoiceFrameFull: // 完整帧
-		if err := voiceHandler.ProcessFull(c.Request.Context(), clientID, &header, body[mqttVoice.HeaderSize:]); err != nil {
+		if err := vc.pipeline.ProcessFull(c.Request.Context(), clientID, header, payload); err != nil {
 			logger.Error(c.Request.Context(), "voiceHandler.ProcessFull failed", map[string]any{
 				"error": err.Error(),
 				"topic": c.GetHeader("Topic"),
-				"payload_len": len(body[mqttVoice.HeaderSize:]),
+				"payload_len": len(payload),
 				"ClientID": c.GetHeader("ClientID"),
 			})
 			return
 		}
 	case mqttCommon.VoiceFrameFragment, mqttCommon.VoiceFrameLast: // 分片帧, 最后一帧
-		if err := voiceHandler.ProcessFragment(c.Request.Context(), clientID, &header, body[mqttVoice.HeaderSize:]); err != nil {
+		if err := vc.pipeline.ProcessFragment(c.Request.Context(), clientID, header, payload); err != nil {
 			logger.Error(c.Request.Context(), "voiceHandler.ProcessFragment failed", map[string]any{
 				"error": err.Error(),
 				"topic": c.GetHeader("Topic"),
-				"payload_len": len(body[mqttVoice.HeaderSize:]),
+				"payload_len": len(payload),
 				"ClientID": c.GetHeader("ClientID"),
 			})
 			return
@@ -69,7 +75,7 @@ func UploadVoice(c *gin.Context) {
 	default:
 		logger.Error(c.Request.Context(), "voiceManage.UploadVoice unknown frame type", map[string]any{
 			"topic": c.GetHeader("Topic"),
-			"payload_len": len(body[mqttVoice.HeaderSize:]),
+			"payload_len": len(payload),
 			"ClientID": c.GetHeader("ClientID"),
 		})
 		return
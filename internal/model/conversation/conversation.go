@@ -0,0 +1,38 @@
+// Package conversation device conversation history model
+package conversation
+
+import "time"
+
+// Conversation 设备的对话会话，设备在对话记忆有效期内持续对话为同一会话
+type Conversation struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	SN         string    `gorm:"column:device_sn;type:varchar(64);not null" json:"sn"`                    // 设备序列号
+	StartTime  time.Time `gorm:"column:start_time;not null" json:"startTime"`                             // 首轮对话时间
+	LastTime   time.Time `gorm:"column:last_time;not null" json:"lastTime"`                               // 最近一轮对话时间
+	TurnCount  int       `gorm:"column:turn_count;not null;default:0" json:"turnCount"`                   // 对话轮数
+	CreateTime time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"createTime"` // 创建时间
+}
+
+// Turn 会话中的一轮对话
+// 全文检索列 search_vector 由数据库生成，不映射到结构体
+type Turn struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConversationID int64     `gorm:"column:conversation_id;not null" json:"conversationId"`                            // 所属会话
+	SN             string    `gorm:"column:device_sn;type:varchar(64);not null" json:"sn"`                             // 设备序列号
+	TraceID        string    `gorm:"column:trace_id;type:varchar(64);not null;default:''" json:"traceId"`              // 链路ID，对应轮次记录
+	Transcript     string    `gorm:"column:transcript;type:text;not null;default:''" json:"transcript"`                // 用户语音的识别文本
+	Reply          string    `gorm:"column:reply;type:text;not null;default:''" json:"reply"`                          // 助手的回复
+	Intent         string    `gorm:"column:intent;type:varchar(64);not null;default:''" json:"intent,omitempty"`       // 意图
+	AudioRef       string    `gorm:"column:audio_ref;type:varchar(255);not null;default:''" json:"audioRef,omitempty"` // 上行音频的存储位置
+	CreateTime     time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"createTime"`          // 对话时间
+}
+
+// TableName 设置 Conversation 的表名为 `voice_conversation`
+func (Conversation) TableName() string {
+	return "voice_conversation"
+}
+
+// TableName 设置 Turn 的表名为 `voice_conversation_turn`
+func (Turn) TableName() string {
+	return "voice_conversation_turn"
+}
@@ -0,0 +1,50 @@
+// Package profile device and user profile model
+package profile
+
+import (
+	"time"
+
+	gorm "gorm.io/gorm"
+)
+
+// 记忆事实来源
+const (
+	SourceAdmin = "admin" // 管理后台录入
+	SourceLLM   = "llm"   // 对话中由 LLM 提取
+)
+
+// DeviceProfile 设备与绑定用户的长期画像
+type DeviceProfile struct {
+	ID         int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	SN         string         `gorm:"column:device_sn;type:varchar(64);not null;uniqueIndex" json:"device_sn"`         // 设备序列号
+	UserID     *int64         `gorm:"column:user_id;index" json:"user_id,omitempty"`                                   // 绑定用户ID
+	UserName   string         `gorm:"column:user_name;type:varchar(64)" json:"user_name,omitempty"`                    // 用户称呼
+	DeviceName string         `gorm:"column:device_name;type:varchar(64)" json:"device_name,omitempty"`                // 设备名称，即助手的名字
+	Location   string         `gorm:"column:location;type:varchar(128)" json:"location,omitempty"`                     // 设备位置
+	Timezone   string         `gorm:"column:timezone;type:varchar(64);not null;default:Asia/Shanghai" json:"timezone"` // 时区（IANA 名称）
+	Language   string         `gorm:"column:language;type:varchar(16);not null;default:zh-CN" json:"language"`         // 语言
+	CreateTime time.Time      `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"create_time"`        // 创建时间
+	UpdateTime time.Time      `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP" json:"update_time"`        // 更新时间
+	DeletedAt  gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at,omitempty"`                             // 软删除标记
+}
+
+// ProfileFact 需要长期记住的事实（如用户姓名、偏好、习惯），同一设备同一键只保留最新值
+type ProfileFact struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	SN         string    `gorm:"column:device_sn;type:varchar(64);not null;uniqueIndex:uk_profile_fact" json:"device_sn"` // 设备序列号
+	Key        string    `gorm:"column:fact_key;type:varchar(32);not null;uniqueIndex:uk_profile_fact" json:"key"`        // 事实键，如 name、temperature_unit
+	Value      string    `gorm:"column:fact_value;type:varchar(255);not null" json:"value"`                               // 事实内容
+	Source     string    `gorm:"column:source;type:varchar(16);not null;default:admin" json:"source"`                     // 来源：admin / llm
+	CreateTime time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"create_time"`                // 创建时间
+	UpdateTime time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP" json:"update_time"`                // 更新时间
+}
+
+// TableName 设置 DeviceProfile 的表名为 `device_profile`
+func (DeviceProfile) TableName() string {
+	return "device_profile"
+}
+
+// TableName 设置 ProfileFact 的表名为 `device_profile_fact`
+func (ProfileFact) TableName() string {
+	return "device_profile_fact"
+}
@@ -0,0 +1,22 @@
+// Package prompt system prompt template model
+package prompt
+
+import "time"
+
+// PromptTemplate 系统提示词覆盖模板
+// 同一范围同一目标只有一个模板，按 厂商 → 设备类型 → 设备 逐级覆盖
+type PromptTemplate struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope      string    `gorm:"column:scope;type:varchar(16);not null;uniqueIndex:uk_prompt_template" json:"scope"`   // 覆盖范围：vendor / device_type / device
+	Target     string    `gorm:"column:target;type:varchar(64);not null;uniqueIndex:uk_prompt_template" json:"target"` // 覆盖目标：厂商名称、设备类型或设备序列号
+	Content    string    `gorm:"column:content;type:text;not null" json:"content"`                                     // 模板内容（text/template 语法）
+	Enabled    bool      `gorm:"column:enabled;not null;default:true" json:"enabled"`                                  // 是否启用
+	Remark     string    `gorm:"column:remark;type:varchar(255)" json:"remark,omitempty"`                              // 备注
+	CreateTime time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"create_time"`             // 创建时间
+	UpdateTime time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP" json:"update_time"`             // 更新时间
+}
+
+// TableName 设置 PromptTemplate 的表名为 `prompt_template`
+func (PromptTemplate) TableName() string {
+	return "prompt_template"
+}
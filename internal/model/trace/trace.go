@@ -0,0 +1,39 @@
+// Package trace voice pipeline turn record model
+package trace
+
+import "time"
+
+// TurnRecord 语音处理流程一轮的记录
+// 各阶段完成时间为空表示该阶段没有执行
+type TurnRecord struct {
+	ID                int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TraceID           string     `gorm:"column:trace_id;type:varchar(64);not null;index" json:"traceId"`             // 链路ID
+	SN                string     `gorm:"column:device_sn;type:varchar(64);not null" json:"sn"`                       // 设备序列号
+	Transcript        string     `gorm:"column:transcript;type:text;not null;default:''" json:"transcript"`          // 识别文本
+	Intent            string     `gorm:"column:intent;type:varchar(64);not null;default:''" json:"intent,omitempty"` // 意图
+	Handled           bool       `gorm:"column:handled;not null;default:false" json:"handled"`                       // 是否作为命令处理
+	Reply             string     `gorm:"column:reply;type:text;not null;default:''" json:"reply"`                    // 回复文本
+	ModelName         string     `gorm:"column:model_name;type:varchar(64);not null;default:''" json:"modelName,omitempty"`
+	PromptTokens      int        `gorm:"column:prompt_tokens;not null;default:0" json:"promptTokens"`
+	CompletionTokens  int        `gorm:"column:completion_tokens;not null;default:0" json:"completionTokens"`
+	ErrorStage        string     `gorm:"column:error_stage;type:varchar(16);not null;default:''" json:"errorStage,omitempty"` // 首个出错的阶段
+	ErrorMessage      string     `gorm:"column:error_message;type:text;not null;default:''" json:"errorMessage,omitempty"`
+	StartTime         time.Time  `gorm:"column:start_time;not null" json:"startTime"`                             // 收到完整语句的时间
+	UploadTime        *time.Time `gorm:"column:upload_time" json:"uploadTime,omitempty"`                          // 上行音频暂存完成
+	ASRTime           *time.Time `gorm:"column:asr_time" json:"asrTime,omitempty"`                                // 语音识别完成
+	NLUTime           *time.Time `gorm:"column:nlu_time" json:"nluTime,omitempty"`                                // 意图识别完成
+	IntentTime        *time.Time `gorm:"column:intent_time" json:"intentTime,omitempty"`                          // 命令类意图处理完成
+	LLMFirstTokenTime *time.Time `gorm:"column:llm_first_token_time" json:"llmFirstTokenTime,omitempty"`          // 对话模型首个回复片段
+	LLMTime           *time.Time `gorm:"column:llm_time" json:"llmTime,omitempty"`                                // 对话模型回复完成
+	TTSFirstAudioTime *time.Time `gorm:"column:tts_first_audio_time" json:"ttsFirstAudioTime,omitempty"`          // 首个合成音频分块
+	PublishTime       *time.Time `gorm:"column:publish_time" json:"publishTime,omitempty"`                        // 最后一次回复音频下发完成
+	EndTime           time.Time  `gorm:"column:end_time;not null" json:"endTime"`                                 // 处理结束时间
+	FirstAudioMS      int64      `gorm:"column:first_audio_ms;not null;default:0" json:"firstAudioMs"`            // 收到语句到首个合成音频的毫秒数
+	TotalMS           int64      `gorm:"column:total_ms;not null;default:0" json:"totalMs"`                       // 处理总毫秒数
+	CreateTime        time.Time  `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"createTime"` // 创建时间
+}
+
+// TableName 设置 TurnRecord 的表名为 `voice_turn_record`
+func (TurnRecord) TableName() string {
+	return "voice_turn_record"
+}
@@ -11,6 +11,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	pb "yunyez/internal/pkg/types/pb/ai"
+	pbCommon "yunyez/internal/pkg/types/pb/common"
 )
 
 // Protocol 协议类型
@@ -131,7 +132,20 @@ func (c *GRPCClient) Close() error {
 	return nil
 }
 
+// Health 检查 ASR 服务健康状态 - gRPC 方式
+func (c *GRPCClient) Health(ctx context.Context) error {
+	resp, err := c.client.Health(ctx, &pbCommon.HealthRequest{})
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	if resp.Status != "ok" {
+		return fmt.Errorf("unhealthy status: %s", resp.Status)
+	}
+	return nil
+}
+
 // Transfer 语音识别 - gRPC 方式
+// 输入须为 16kHz 单声道 16 位 PCM，设备音频由语音处理流程按协议头转换
 func (c *GRPCClient) Transfer(ctx context.Context, data []byte) (string, error) {
 	resp, err := c.client.Recognize(ctx, &pb.RecognizeRequest{
 		AudioContent: data,
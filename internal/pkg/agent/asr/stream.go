@@ -0,0 +1,181 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	pb "yunyez/internal/pkg/types/pb/ai"
+)
+
+// Result 流式识别结果
+type Result struct {
+	Text       string  // 识别文本
+	Confidence float32 // 置信度 (0-1)
+	IsFinal    bool    // 是否为最终结果
+	Stability  float32 // 稳定性 (0-1)，仅中间结果有效
+}
+
+// StreamConfig 流式识别配置
+type StreamConfig struct {
+	Encoding     string // 音频编码：LINEAR16_PCM, OPUS, AAC
+	SampleRate   int    // 采样率
+	NumChannels  int    // 声道数
+	LanguageCode string // 语言：zh-CN, en-US
+}
+
+// DefaultStreamConfig 默认流式识别配置：16kHz 单声道 16 位 PCM
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		Encoding:     "LINEAR16_PCM",
+		SampleRate:   16000,
+		NumChannels:  1,
+		LanguageCode: "zh-CN",
+	}
+}
+
+// Stream 流式识别会话
+// 音频分片到达时调用 Send，说话结束后调用 CloseSend，
+// 通过 Results 接收中间/最终结果，或通过 Transcript 等待完整识别文本
+type Stream interface {
+	// Send 发送音频分片，非并发安全
+	Send(chunk []byte) error
+	// CloseSend 音频发送完毕
+	CloseSend() error
+	// Results 识别结果通道，会话结束后关闭；读取过慢时结果会被丢弃
+	Results() <-chan Result
+	// Transcript 等待会话结束，返回所有最终结果拼接的文本
+	Transcript(ctx context.Context) (string, error)
+}
+
+// StreamingService 支持流式识别的语音识别服务
+type StreamingService interface {
+	Service
+	// StartStream 开启流式识别会话，ctx 取消时会话终止
+	StartStream(ctx context.Context, cfg StreamConfig) (Stream, error)
+}
+
+// StartStream 开启流式识别会话 - gRPC 方式
+// 首包发送识别配置，之后的 Send 发送音频数据
+func (c *GRPCClient) StartStream(ctx context.Context, cfg StreamConfig) (Stream, error) {
+	stream, err := c.client.StreamingRecognize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open ASR stream: %w", err)
+	}
+	err = stream.Send(&pb.StreamingRecognizeRequest{
+		Request: &pb.StreamingRecognizeRequest_Config{
+			Config: &pb.StreamingRecognizeConfig{
+				Encoding:     cfg.Encoding,
+				SampleRate:   int32(cfg.SampleRate),
+				NumChannels:  int32(cfg.NumChannels),
+				LanguageCode: cfg.LanguageCode,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send ASR stream config: %w", err)
+	}
+
+	s := &grpcStream{
+		stream:  stream,
+		results: make(chan Result, 16),
+		done:    make(chan struct{}),
+	}
+	go s.recv()
+	return s, nil
+}
+
+// grpcStream gRPC 流式识别会话
+type grpcStream struct {
+	stream  pb.ASRService_StreamingRecognizeClient
+	results chan Result
+	done    chan struct{}
+
+	mu     sync.Mutex
+	finals []string
+	err    error
+}
+
+// Send 发送音频分片
+func (s *grpcStream) Send(chunk []byte) error {
+	err := s.stream.Send(&pb.StreamingRecognizeRequest{
+		Request: &pb.StreamingRecognizeRequest_AudioContent{AudioContent: chunk},
+	})
+	if err != nil {
+		return fmt.Errorf("send ASR audio: %w", err)
+	}
+	return nil
+}
+
+// CloseSend 音频发送完毕
+func (s *grpcStream) CloseSend() error {
+	return s.stream.CloseSend()
+}
+
+// Results 识别结果通道
+func (s *grpcStream) Results() <-chan Result {
+	return s.results
+}
+
+// Transcript 等待会话结束，返回最终识别文本
+func (s *grpcStream) Transcript(ctx context.Context) (string, error) {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return "", s.err
+	}
+	return strings.Join(s.finals, ""), nil
+}
+
+// recv 接收识别结果直到服务端结束会话
+func (s *grpcStream) recv() {
+	defer close(s.done)
+	defer close(s.results)
+
+	for {
+		resp, err := s.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			s.setErr(fmt.Errorf("receive ASR result: %w", err))
+			return
+		}
+
+		switch r := resp.Result.(type) {
+		case *pb.StreamingRecognizeResponse_RecognitionResult:
+			res := Result{
+				Text:       r.RecognitionResult.Transcript,
+				Confidence: r.RecognitionResult.Confidence,
+				IsFinal:    r.RecognitionResult.IsFinal,
+				Stability:  r.RecognitionResult.Stability,
+			}
+			if res.IsFinal {
+				s.mu.Lock()
+				s.finals = append(s.finals, res.Text)
+				s.mu.Unlock()
+			}
+			select {
+			case s.results <- res:
+			default: // 读取过慢时丢弃，最终文本已记录，不影响 Transcript
+			}
+		case *pb.StreamingRecognizeResponse_Error:
+			s.setErr(fmt.Errorf("ASR error: %s", r.Error.GetMessage()))
+			return
+		}
+	}
+}
+
+func (s *grpcStream) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
@@ -0,0 +1,114 @@
+package asr
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	pb "yunyez/internal/pkg/types/pb/ai"
+	common "yunyez/internal/pkg/types/pb/common"
+)
+
+// fakeASRClient 模拟 ASR gRPC 客户端，按预设结果响应流式识别
+type fakeASRClient struct {
+	pb.ASRServiceClient
+	stream *fakeStream
+}
+
+func (f *fakeASRClient) StreamingRecognize(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[pb.StreamingRecognizeRequest, pb.StreamingRecognizeResponse], error) {
+	return f.stream, nil
+}
+
+// fakeStream 记录发送的请求，CloseSend 后依次返回预设响应
+type fakeStream struct {
+	grpc.ClientStream
+	sent      []*pb.StreamingRecognizeRequest
+	responses chan *pb.StreamingRecognizeResponse
+}
+
+func (s *fakeStream) Send(req *pb.StreamingRecognizeRequest) error {
+	s.sent = append(s.sent, req)
+	return nil
+}
+
+func (s *fakeStream) CloseSend() error {
+	close(s.responses)
+	return nil
+}
+
+func (s *fakeStream) Recv() (*pb.StreamingRecognizeResponse, error) {
+	resp, ok := <-s.responses
+	if !ok {
+		return nil, io.EOF
+	}
+	return resp, nil
+}
+
+func result(text string, final bool) *pb.StreamingRecognizeResponse {
+	return &pb.StreamingRecognizeResponse{
+		Result: &pb.StreamingRecognizeResponse_RecognitionResult{
+			RecognitionResult: &pb.StreamingRecognitionResult{Transcript: text, IsFinal: final},
+		},
+	}
+}
+
+func TestStreamTranscript(t *testing.T) {
+	fs := &fakeStream{responses: make(chan *pb.StreamingRecognizeResponse, 8)}
+	client := &GRPCClient{client: &fakeASRClient{stream: fs}}
+
+	stream, err := client.StartStream(context.Background(), DefaultStreamConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := fs.sent[0].GetConfig()
+	if cfg == nil || cfg.SampleRate != 16000 || cfg.Encoding != "LINEAR16_PCM" {
+		t.Fatalf("first request is not the config: %v", fs.sent[0])
+	}
+
+	stream.Send([]byte{1, 2})
+	fs.responses <- result("今天", false)
+	fs.responses <- result("今天天气", true)
+	stream.Send([]byte{3, 4})
+	fs.responses <- result("怎么样", true)
+	stream.CloseSend()
+
+	text, err := stream.Transcript(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "今天天气怎么样" {
+		t.Errorf("transcript = %q", text)
+	}
+	if len(fs.sent) != 3 || string(fs.sent[2].GetAudioContent()) != "\x03\x04" {
+		t.Errorf("unexpected requests: %v", fs.sent)
+	}
+
+	var partials, finals int
+	for r := range stream.Results() {
+		if r.IsFinal {
+			finals++
+		} else {
+			partials++
+		}
+	}
+	if partials != 1 || finals != 2 {
+		t.Errorf("partials = %d, finals = %d", partials, finals)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	fs := &fakeStream{responses: make(chan *pb.StreamingRecognizeResponse, 1)}
+	client := &GRPCClient{client: &fakeASRClient{stream: fs}}
+
+	stream, err := client.StartStream(context.Background(), DefaultStreamConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.responses <- &pb.StreamingRecognizeResponse{
+		Result: &pb.StreamingRecognizeResponse_Error{Error: &common.Error{Code: 500, Message: "model busy"}},
+	}
+	if _, err := stream.Transcript(context.Background()); err == nil {
+		t.Error("expected ASR error")
+	}
+}
@@ -4,48 +4,71 @@ package llm
 import (
 	"context"
 	constant "yunyez/internal/common/constant"
+	ollama "yunyez/internal/pkg/agent/llm/ollama"
+	openai "yunyez/internal/pkg/agent/llm/openai"
 	qwen "yunyez/internal/pkg/agent/llm/qwen"
+	memory "yunyez/internal/pkg/agent/memory"
 	metering "yunyez/internal/pkg/agent/metering"
+	tool "yunyez/internal/pkg/agent/tool"
 )
 
 // Agent natural language model agent interface
+// Chat streams the events of one turn: the text deltas, the tool calls, the usage
+// and at last the finish reason or the error, the caller reads until the stream is closed
 type Agent interface {
-	Chat(ctx context.Context, clientID, message string) (<-chan string, <-chan *metering.Usage, error)
+	Chat(ctx context.Context, clientID, message string) (<-chan Event, error)
 }
 
 
+// PromptFunc render the system prompt for the device, empty to use the model default
+type PromptFunc func(ctx context.Context, clientID string) string
+
 // Strategy natural language model agent strategy
 type Strategy struct {
 	Model          Agent
+	Memory         memory.Store              // conversation memory shared by the agents, nil disables multi-turn context
+	Prompt         PromptFunc                // system prompt shared by the agents, nil to use the model default
+	Tools          *tool.Registry            // tools the model may call, nil or empty disables tool calling
+	Backends       map[string]*openai.Client // OpenAI-compatible backends by name
+	Local          *ollama.Client            // local model server, nil if not configured
 }
 
 // SetAgent set the agent model to choose different service
+// - the name of an OpenAI-compatible backend configured in llm.backends
 // - qwen
 // - local
 func (s *Strategy) SetAgent(model string) *Strategy {
+	if c, ok := s.Backends[model]; ok {
+		s.Model = &OpenAIAgent{Client: c, Memory: s.Memory, Prompt: s.Prompt, Tools: s.Tools}
+		return s
+	}
 	switch model {
 	case constant.ModelQwenLLM:
-		s.Model = &QwenAgent{}
+		s.Model = &QwenAgent{Memory: s.Memory, Prompt: s.Prompt, Tools: s.Tools}
 	default:
-		s.Model = &LocalAgent{}
+		s.Model = &LocalAgent{Client: s.Local, Memory: s.Memory, Prompt: s.Prompt, Tools: s.Tools}
 	}
 	return s
 }
 
 // QwenAgent qwen model agent
 type QwenAgent struct {
+	Memory memory.Store   // conversation memory, nil disables multi-turn context
+	Prompt PromptFunc     // system prompt, nil to use qwen.systemDesc
+	Tools  *tool.Registry // tools the model may call, nil or empty disables tool calling
 }
 
 // Chat qwen model agent chat
-func (a *QwenAgent) Chat(ctx context.Context, clientID, message string) (<-chan string, <-chan *metering.Usage, error) {
-	return qwen.QwenChat(ctx, clientID, message)
-}
-
-// LocalAgent local model agent
-type LocalAgent struct {
-}
-
-// Chat local model agent chat
-func (a *LocalAgent) Chat(ctx context.Context, clientID, message string) (<-chan string, <-chan *metering.Usage, error) {
-	return nil, nil, nil
+// the device system prompt and history are sent before the message and the completed exchange is appended to the history,
+// the tools called by the model are run and their results fed back for the final reply
+func (a *QwenAgent) Chat(ctx context.Context, clientID, message string) (<-chan Event, error) {
+	var system string
+	if a.Prompt != nil {
+		system = a.Prompt(ctx, clientID)
+	}
+	history := loadHistory(ctx, a.Memory, clientID)
+	return streamChat(ctx, clientID, message, a.Memory, a.Tools, constant.ModelQwenLLM,
+		func(ctx context.Context, turns []tool.Message, tools []tool.Definition, reply chan<- string) (*metering.Usage, []tool.Call, string, error) {
+			return qwen.Stream(ctx, system, history, message, turns, tools, reply)
+		})
 }
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"context"
+
+	metering "yunyez/internal/pkg/agent/metering"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// EventType the kind of an agent event
+type EventType string
+
+const (
+	EventText     EventType = "text"      // a fragment of the reply
+	EventToolCall EventType = "tool_call" // a tool called by the model and its result
+	EventUsage    EventType = "usage"     // the usage of the turn, before the finish or error event
+	EventFinish   EventType = "finish"    // the turn is completed, the last event of a successful turn
+	EventError    EventType = "error"     // the turn failed, the last event of a failed turn
+)
+
+// the finish reasons of the model, other values reported by the backends are passed through
+const (
+	FinishStop   = "stop"   // the reply is complete
+	FinishLength = "length" // the reply is truncated by the token limit
+)
+
+// Event one event of the agent stream
+// a turn ends with exactly one finish or error event and then the stream is closed,
+// a stream closed without either was interrupted by the cancelled context
+type Event struct {
+	Type   EventType
+	Text   string          // EventText: the reply fragment
+	Tool   *tool.Result    // EventToolCall: the tool call and its result
+	Usage  *metering.Usage // EventUsage: the usage of all the requests of the turn
+	Reason string          // EventFinish: why the model stopped replying
+	Err    error           // EventError: why the turn failed
+}
+
+// Truncated whether the finish event reports a reply cut off by the token limit
+func (e Event) Truncated() bool {
+	return e.Type == EventFinish && e.Reason == FinishLength
+}
+
+// send send the event unless the context is done
+func send(ctx context.Context, out chan<- Event, e Event) bool {
+	select {
+	case out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// textSink forward the text fragments written by a backend to the event stream as text events
+// Returns:
+//   - chan<- string: the channel the backend writes the fragments to
+//   - func(): close the channel and wait until every fragment is forwarded
+func textSink(ctx context.Context, out chan<- Event) (chan<- string, func()) {
+	text := make(chan string, replySize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		forward := true
+		for s := range text {
+			if forward {
+				forward = send(ctx, out, Event{Type: EventText, Text: s})
+			}
+		}
+	}()
+	return text, func() {
+		close(text)
+		<-done
+	}
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	resilience "yunyez/internal/pkg/agent/resilience"
+)
+
+// errIncomplete the agent stream was closed without a finish or error event
+var errIncomplete = errors.New("agent stream ended before the turn finished")
+
+// Failover agent falling back along the chain, e.g. qwen then the local model
+// an agent that fails before its first event is skipped for the next one;
+// once an agent replies the turn is handed over to it, later failures reach the caller as the error event.
+// The breaker of each agent is driven by the outcome of the turn and the time to the first event,
+// the deadline of the agent applies to the whole turn
+type Failover struct {
+	Chain *resilience.Chain[Agent]
+}
+
+// Chat chat with the first available agent of the chain
+func (f *Failover) Chat(ctx context.Context, clientID, message string) (<-chan Event, error) {
+	var errs []error
+	for _, p := range f.Chain.Providers() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := p.Acquire(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+
+		callCtx, cancel := p.WithTimeout(ctx)
+		start := time.Now()
+		events, err := p.Client.Chat(callCtx, clientID, message)
+		if err == nil {
+			first, ok := <-events
+			switch {
+			case !ok:
+				err = cause(callCtx, errIncomplete)
+			case first.Type == EventError:
+				err = first.Err
+				for range events {
+				}
+			default:
+				return f.forward(ctx, callCtx, cancel, p, start, first, events), nil
+			}
+		}
+		cancel()
+		p.Done(ctx, err, time.Since(start))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+	return nil, f.Chain.Unavailable(errs...)
+}
+
+// forward forward the events of the agent that replied and record the outcome of the turn
+func (f *Failover) forward(ctx, callCtx context.Context, cancel context.CancelFunc, p *resilience.Provider[Agent], start time.Time, first Event, events <-chan Event) <-chan Event {
+	latency := time.Since(start)
+	out := make(chan Event, cap(events))
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		var err error
+		terminal := false
+		forward := true
+		handle := func(e Event) {
+			switch e.Type {
+			case EventFinish:
+				terminal = true
+			case EventError:
+				terminal = true
+				err = e.Err
+			}
+			if forward {
+				forward = send(ctx, out, e) // keep draining so the agent can finish
+			}
+		}
+		handle(first)
+		for e := range events {
+			handle(e)
+		}
+		// the deadline of the agent cuts the stream without the error event
+		if !terminal {
+			err = cause(callCtx, errIncomplete)
+			if ctx.Err() == nil {
+				send(ctx, out, Event{Type: EventError, Err: err})
+			}
+		}
+		p.Done(ctx, err, latency)
+	}()
+	return out
+}
+
+// cause the reason the context is done, or err if it's not
+func cause(ctx context.Context, err error) error {
+	if c := context.Cause(ctx); c != nil {
+		return c
+	}
+	return err
+}
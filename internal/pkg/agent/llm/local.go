@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	constant "yunyez/internal/common/constant"
+	ollama "yunyez/internal/pkg/agent/llm/ollama"
+	memory "yunyez/internal/pkg/agent/memory"
+	metering "yunyez/internal/pkg/agent/metering"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// ErrLocalNotConfigured the local model server is not configured
+var ErrLocalNotConfigured = errors.New("local model server is not configured")
+
+// LocalAgent local model agent, served by Ollama /api/chat
+// for the offline and on-prem deployments without DashScope
+type LocalAgent struct {
+	Client *ollama.Client // the local model server, nil if not configured
+	Memory memory.Store   // conversation memory, nil disables multi-turn context
+	Prompt PromptFunc     // system prompt, nil or empty to use the configured default
+	Tools  *tool.Registry // tools the model may call, nil or empty disables tool calling
+}
+
+// Chat local model agent chat
+// the reply is streamed as the model generates it, the usage is taken from the eval counts of the last chunk,
+// the request is aborted when ctx is cancelled or the local timeouts expire
+func (a *LocalAgent) Chat(ctx context.Context, clientID, message string) (<-chan Event, error) {
+	if a.Client == nil {
+		return nil, ErrLocalNotConfigured
+	}
+	system := a.Client.System()
+	if a.Prompt != nil {
+		if s := a.Prompt(ctx, clientID); s != "" {
+			system = s
+		}
+	}
+	messages := ollama.Messages(system, loadHistory(ctx, a.Memory, clientID), message)
+	model := UsageModel(constant.ModelLocalLLM, a.Client.Model())
+
+	return streamChat(ctx, clientID, message, a.Memory, a.Tools, constant.ModelLocalLLM,
+		func(ctx context.Context, turns []tool.Message, tools []tool.Definition, reply chan<- string) (*metering.Usage, []tool.Call, string, error) {
+			start := time.Now()
+			u, calls, reason, err := a.Client.Stream(ctx, append(messages[:len(messages):len(messages)], ollama.ToolMessages(turns)...), tools, reply)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			return &metering.Usage{
+				Model:            model,
+				PromptTokens:     u.PromptTokens,
+				CompletionTokens: u.CompletionTokens,
+				TotalTokens:      u.PromptTokens + u.CompletionTokens,
+				StartTime:        start,
+				EndTime:          time.Now(),
+			}, calls, reason, nil
+		})
+}
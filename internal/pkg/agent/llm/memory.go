@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	memory "yunyez/internal/pkg/agent/memory"
+	metering "yunyez/internal/pkg/agent/metering"
+	logger "yunyez/internal/pkg/logger"
+)
+
+// loadHistory read the device history, a failed read only loses the context
+func loadHistory(ctx context.Context, store memory.Store, clientID string) []memory.Message {
+	if store == nil {
+		return nil
+	}
+	history, err := store.History(ctx, clientID)
+	if err != nil {
+		logger.Warn(ctx, "load conversation history failed", map[string]any{
+			"clientID": clientID,
+			"error":    err.Error(),
+		})
+		return nil
+	}
+	return history
+}
+
+// remember forward the events of the agent and append the completed exchange to the memory
+// an exchange is completed when the reply is not empty, the turn finishes and the context is not cancelled,
+// so interrupted or failed replies are not remembered
+// Parameters:
+//   - ctx: the context of the turn
+//   - store: the conversation memory, nil to forward only
+//   - clientID: the device sequence number
+//   - message: the user text
+//   - events: the events of the agent
+//
+// Returns:
+//   - <-chan Event: the forwarded events
+//   - error: always nil
+func remember(ctx context.Context, store memory.Store, clientID, message string, events <-chan Event) (<-chan Event, error) {
+	if store == nil {
+		return events, nil
+	}
+
+	out := make(chan Event, cap(events))
+	go func() {
+		var full strings.Builder
+		finished := false
+		forward := true
+		for e := range events {
+			switch e.Type {
+			case EventText:
+				full.WriteString(e.Text)
+			case EventFinish:
+				finished = true
+			}
+			if forward {
+				forward = send(ctx, out, e) // keep draining so the agent can finish
+			}
+		}
+		// decided before closing, the consumer may cancel ctx once the stream is closed
+		completed := finished && ctx.Err() == nil && full.Len() > 0
+		close(out)
+
+		if !completed {
+			return
+		}
+		if err := store.Append(context.WithoutCancel(ctx), clientID, message, full.String()); err != nil {
+			logger.Warn(ctx, "append conversation history failed", map[string]any{
+				"clientID": clientID,
+				"error":    err.Error(),
+			})
+		}
+	}()
+	return out, nil
+}
+
+// summaryPrompt the instruction to merge the previous summary and the older turns into a new summary
+const summaryPrompt = `请将下面的对话压缩为一段简洁的中文摘要，保留用户的身份、偏好、提到的事实和尚未完成的请求，省略寒暄。只输出摘要本身。
+
+已有摘要：
+%s
+
+新的对话：
+%s`
+
+// Summarize merge the previous summary and the older turns into a new summary through the agent
+// the agent should not carry memory, otherwise the summary request itself is remembered
+// Parameters:
+//   - ctx: the context of the request
+//   - agent: the agent to summarize with
+//   - clientID: the device sequence number
+//   - previous: the previous summary, may be empty
+//   - turns: the older turns to compress
+//
+// Returns:
+//   - string: the new summary
+//   - *metering.Usage: the usage of the summary request, to be metered like a normal turn
+//   - error: the error object if the agent failed
+func Summarize(ctx context.Context, agent Agent, clientID, previous string, turns []memory.Message) (string, *metering.Usage, error) {
+	if previous == "" {
+		previous = "无"
+	}
+	return collect(ctx, agent, clientID, fmt.Sprintf(summaryPrompt, previous, memory.Transcript(turns)))
+}
+
+// collect send one message to the agent and wait for the whole reply
+// Parameters:
+//   - ctx: the context of the request
+//   - agent: the agent to ask
+//   - clientID: the device sequence number
+//   - message: the message to send
+//
+// Returns:
+//   - string: the whole reply
+//   - *metering.Usage: the usage of the request
+//   - error: the error object if the agent failed or the context is done
+func collect(ctx context.Context, agent Agent, clientID, message string) (string, *metering.Usage, error) {
+	events, err := agent.Chat(ctx, clientID, message)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		full     strings.Builder
+		usage    *metering.Usage
+		finished bool
+	)
+	for e := range events {
+		switch e.Type {
+		case EventText:
+			full.WriteString(e.Text)
+		case EventUsage:
+			usage = e.Usage
+		case EventFinish:
+			finished = true
+		case EventError:
+			err = e.Err
+		}
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", usage, ctxErr
+	}
+	if err != nil {
+		return "", usage, fmt.Errorf("agent reply to %s failed: %w", clientID, err)
+	}
+	if !finished {
+		return "", usage, fmt.Errorf("agent reply to %s is incomplete", clientID)
+	}
+	return full.String(), usage, nil
+}
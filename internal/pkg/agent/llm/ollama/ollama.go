@@ -0,0 +1,300 @@
+// Package ollama 本地模型服务客户端
+// 对接 Ollama 的 /api/chat 接口，流式响应为 NDJSON（每行一个 JSON 片段），
+// 最后一个片段 done=true 并携带 prompt_eval_count / eval_count 用量，不依赖全局配置
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	memory "yunyez/internal/pkg/agent/memory"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// 默认超时
+const (
+	DefaultTimeout      = 120 * time.Second // 整个请求的超时，本地模型首次加载较慢
+	DefaultFirstTimeout = 30 * time.Second  // 等待第一个片段的超时
+)
+
+// chatPath 对话接口路径
+const chatPath = "/api/chat"
+
+var (
+	ErrInvalidConfig = errors.New("invalid ollama config")
+	ErrStatus        = errors.New("ollama returned non-200 status")
+	ErrIncomplete    = errors.New("ollama stream ended before done")
+	ErrTimeout       = errors.New("ollama request timed out")
+)
+
+// Config 本地模型服务配置
+type Config struct {
+	Endpoint     string         // 服务地址，如 http://127.0.0.1:11434
+	Model        string         // 模型名，如 qwen2.5:7b
+	System       string         // 默认系统提示词，设备没有提示词时使用，可为空
+	Timeout      time.Duration  // 整个请求的超时，<= 0 时使用 DefaultTimeout
+	FirstTimeout time.Duration  // 等待第一个片段的超时，<= 0 时使用 DefaultFirstTimeout
+	KeepAlive    string         // 模型在内存中保留的时间，如 5m，为空时使用服务端默认值
+	Options      map[string]any // 模型参数，如 temperature、num_ctx
+}
+
+// Message 对话消息
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"` // 工具执行结果对应的工具名
+}
+
+// ToolCall 消息中的工具调用，参数为 JSON 对象
+type ToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// Usage 一次请求的用量
+type Usage struct {
+	PromptTokens     int           // prompt_eval_count
+	CompletionTokens int           // eval_count
+	TotalDuration    time.Duration // total_duration
+	LoadDuration     time.Duration // load_duration，模型加载耗时
+}
+
+// Client 本地模型服务客户端
+type Client struct {
+	cfg  Config
+	url  string
+	http *http.Client
+}
+
+// New 创建客户端
+// 参数：
+//   - cfg: 本地模型服务配置
+//
+// 返回值:
+//   - *Client: 客户端
+//   - error: 地址或模型为空时返回错误
+func New(cfg Config) (*Client, error) {
+	if cfg.Endpoint == "" || cfg.Model == "" {
+		return nil, fmt.Errorf("%w: endpoint and model are required", ErrInvalidConfig)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.FirstTimeout <= 0 {
+		cfg.FirstTimeout = DefaultFirstTimeout
+	}
+	return &Client{
+		cfg:  cfg,
+		url:  strings.TrimSuffix(cfg.Endpoint, "/") + chatPath,
+		http: &http.Client{},
+	}, nil
+}
+
+// Model 模型名
+func (c *Client) Model() string {
+	return c.cfg.Model
+}
+
+// System 默认系统提示词
+func (c *Client) System() string {
+	return c.cfg.System
+}
+
+// Messages 组装请求消息：系统提示词、对话历史与当前消息
+// 历史开头的 system 消息（对话摘要）并入系统提示词，系统提示词为空时不发送
+func Messages(system string, history []memory.Message, message string) []Message {
+	system, history = memory.MergeSystem(system, history)
+	messages := make([]Message, 0, len(history)+2)
+	if system != "" {
+		messages = append(messages, Message{Role: memory.RoleSystem, Content: system})
+	}
+	for _, m := range history {
+		messages = append(messages, Message{Role: m.Role, Content: m.Content})
+	}
+	return append(messages, Message{Role: memory.RoleUser, Content: message})
+}
+
+// ToolMessages 将工具调用过程转换为请求消息
+func ToolMessages(turns []tool.Message) []Message {
+	names := make(map[string]string)
+	messages := make([]Message, 0, len(turns))
+	for _, t := range turns {
+		m := Message{Role: t.Role, Content: t.Content}
+		for _, c := range t.Calls {
+			names[c.ID] = c.Name
+			var tc ToolCall
+			tc.Function.Name = c.Name
+			tc.Function.Arguments = json.RawMessage(c.Arguments)
+			if c.Arguments == "" {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			m.ToolCalls = append(m.ToolCalls, tc)
+		}
+		if t.CallID != "" {
+			m.ToolName = names[t.CallID]
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// request 请求参数
+type request struct {
+	Model     string         `json:"model"`
+	Messages  []Message      `json:"messages"`
+	Tools     []toolDecl     `json:"tools,omitempty"`
+	Stream    bool           `json:"stream"`
+	KeepAlive string         `json:"keep_alive,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
+}
+
+// toolDecl 工具声明
+type toolDecl struct {
+	Type     string          `json:"type"`
+	Function tool.Definition `json:"function"`
+}
+
+// chunk 流式响应片段
+type chunk struct {
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	Error           string  `json:"error"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	TotalDuration   int64   `json:"total_duration"` // 纳秒
+	LoadDuration    int64   `json:"load_duration"`  // 纳秒
+}
+
+// Stream 以流式请求模型
+// 文本片段按到达顺序发送到 reply；超过 FirstTimeout 没有收到第一个片段、
+// 超过 Timeout 未结束或 ctx 取消时中止请求
+// 参数：
+//   - ctx: 上下文，取消时中止请求
+//   - messages: 请求消息
+//   - tools: 声明的工具，为空时不声明
+//   - reply: 回复片段通道，由调用方关闭
+//
+// 返回值:
+//   - *Usage: 用量
+//   - []tool.Call: 模型发起的工具调用
+//   - string: 结束原因（done_reason），如 stop、length
+//   - error: 请求失败、超时、响应非 200、服务端报错或流未正常结束时返回错误
+func (c *Client) Stream(ctx context.Context, messages []Message, tools []tool.Definition, reply chan<- string) (*Usage, []tool.Call, string, error) {
+	req := request{
+		Model:     c.cfg.Model,
+		Messages:  messages,
+		Stream:    true,
+		KeepAlive: c.cfg.KeepAlive,
+		Options:   c.cfg.Options,
+	}
+	for _, d := range tools {
+		req.Tools = append(req.Tools, toolDecl{Type: "function", Function: d})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, c.cfg.Timeout,
+		fmt.Errorf("%w: not finished in %s", ErrTimeout, c.cfg.Timeout))
+	defer cancel()
+	// 第一个片段到达前由 first 计时，模型加载或排队过久时提前放弃
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	first := time.AfterFunc(c.cfg.FirstTimeout, func() {
+		abort(fmt.Errorf("%w: no reply in %s", ErrTimeout, c.cfg.FirstTimeout))
+	})
+	defer first.Stop()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, nil, "", cause(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, nil, "", fmt.Errorf("%w: %d %s", ErrStatus, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	usage, calls, reason, err := readStream(ctx, resp.Body, reply, first)
+	if err != nil {
+		return nil, nil, "", cause(ctx, err)
+	}
+	return usage, calls, reason, nil
+}
+
+// cause 请求因超时或调用方取消中止时返回中止的原因（ErrTimeout 或 context.Canceled），否则包装原错误
+func cause(ctx context.Context, err error) error {
+	if c := context.Cause(ctx); c != nil {
+		return c
+	}
+	return fmt.Errorf("call ollama: %w", err)
+}
+
+// readStream 读取 NDJSON 流式响应
+func readStream(ctx context.Context, body io.Reader, reply chan<- string, first *time.Timer) (*Usage, []tool.Call, string, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var calls []tool.Call
+	for scanner.Scan() {
+		first.Stop()
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var c chunk
+		if err := json.Unmarshal(line, &c); err != nil {
+			return nil, nil, "", fmt.Errorf("unmarshal chunk: %w", err)
+		}
+		if c.Error != "" {
+			return nil, nil, "", fmt.Errorf("ollama: %s", c.Error)
+		}
+		for _, tc := range c.Message.ToolCalls {
+			calls = append(calls, tool.Call{
+				ID:        fmt.Sprintf("call_%d", len(calls)),
+				Name:      tc.Function.Name,
+				Arguments: string(tc.Function.Arguments),
+			})
+		}
+		if c.Message.Content != "" {
+			select {
+			case reply <- c.Message.Content:
+			case <-ctx.Done():
+				return nil, nil, "", ctx.Err()
+			}
+		}
+		if c.Done {
+			reason := c.DoneReason
+			if reason == "" {
+				reason = "stop"
+			}
+			return &Usage{
+				PromptTokens:     c.PromptEvalCount,
+				CompletionTokens: c.EvalCount,
+				TotalDuration:    time.Duration(c.TotalDuration),
+				LoadDuration:     time.Duration(c.LoadDuration),
+			}, calls, reason, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, "", err
+	}
+	return nil, nil, "", ErrIncomplete
+}
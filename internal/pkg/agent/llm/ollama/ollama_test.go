@@ -0,0 +1,215 @@
+// 测试本地模型服务的请求组装、NDJSON 流式响应解析与超时
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memory "yunyez/internal/pkg/agent/memory"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// ndjsonServer 返回固定 NDJSON 片段的服务，记录收到的请求
+func ndjsonServer(t *testing.T, lines []string, got *request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, chatPath, r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, l := range lines {
+			fmt.Fprintf(w, "%s\n", l)
+		}
+	}))
+}
+
+func collect(ctx context.Context, c *Client, messages []Message, tools []tool.Definition) (string, *Usage, []tool.Call, string, error) {
+	reply := make(chan string, 100)
+	usage, calls, reason, err := c.Stream(ctx, messages, tools, reply)
+	close(reply)
+	var b strings.Builder
+	for s := range reply {
+		b.WriteString(s)
+	}
+	return b.String(), usage, calls, reason, err
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{Endpoint: "http://x"})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	c, err := New(Config{Endpoint: "http://x/", Model: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://x/api/chat", c.url)
+	assert.Equal(t, DefaultTimeout, c.cfg.Timeout)
+	assert.Equal(t, DefaultFirstTimeout, c.cfg.FirstTimeout)
+}
+
+func TestStreamText(t *testing.T) {
+	var got request
+	srv := ndjsonServer(t, []string{
+		`{"model":"m","message":{"role":"assistant","content":"你好"},"done":false}`,
+		``,
+		`{"model":"m","message":{"role":"assistant","content":"，世界"},"done":false}`,
+		`{"model":"m","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop",` +
+			`"prompt_eval_count":12,"eval_count":4,"total_duration":2000000000,"load_duration":500000000}`,
+	}, &got)
+	defer srv.Close()
+
+	c, err := New(Config{Endpoint: srv.URL, Model: "qwen2.5:7b", KeepAlive: "30m", Options: map[string]any{"num_ctx": 4096}})
+	require.NoError(t, err)
+	text, usage, calls, reason, err := collect(context.Background(), c, Messages("sys", nil, "hi"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "你好，世界", text)
+	assert.Equal(t, "stop", reason)
+	assert.Empty(t, calls)
+	assert.Equal(t, &Usage{PromptTokens: 12, CompletionTokens: 4, TotalDuration: 2 * time.Second, LoadDuration: 500 * time.Millisecond}, usage)
+
+	assert.Equal(t, "qwen2.5:7b", got.Model)
+	assert.True(t, got.Stream)
+	assert.Equal(t, "30m", got.KeepAlive)
+	assert.EqualValues(t, 4096, got.Options["num_ctx"])
+	assert.Empty(t, got.Tools)
+	require.Len(t, got.Messages, 2)
+	assert.Equal(t, Message{Role: memory.RoleSystem, Content: "sys"}, got.Messages[0])
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	var got request
+	srv := ndjsonServer(t, []string{
+		`{"message":{"role":"assistant","content":"","tool_calls":[` +
+			`{"function":{"name":"set_temperature","arguments":{"temperature":26}}},` +
+			`{"function":{"name":"get_device_status","arguments":{}}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":30,"eval_count":8}`,
+	}, &got)
+	defer srv.Close()
+
+	c, err := New(Config{Endpoint: srv.URL, Model: "m"})
+	require.NoError(t, err)
+	defs := []tool.Definition{{Name: "set_temperature", Description: "d"}}
+	_, usage, calls, reason, err := collect(context.Background(), c, Messages("", nil, "调到26度"), defs)
+	require.NoError(t, err)
+	assert.Equal(t, 30, usage.PromptTokens)
+	assert.Equal(t, "stop", reason, "done_reason missing")
+	assert.Equal(t, []tool.Call{
+		{ID: "call_0", Name: "set_temperature", Arguments: `{"temperature":26}`},
+		{ID: "call_1", Name: "get_device_status", Arguments: `{}`},
+	}, calls)
+	require.Len(t, got.Tools, 1)
+	assert.Equal(t, "function", got.Tools[0].Type)
+	assert.Equal(t, "set_temperature", got.Tools[0].Function.Name)
+}
+
+func TestStreamErrors(t *testing.T) {
+	t.Run("server error", func(t *testing.T) {
+		var got request
+		srv := ndjsonServer(t, []string{`{"error":"model 'm' not found"}`}, &got)
+		defer srv.Close()
+		c, _ := New(Config{Endpoint: srv.URL, Model: "m"})
+		_, _, _, _, err := collect(context.Background(), c, Messages("", nil, "hi"), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+
+	t.Run("incomplete", func(t *testing.T) {
+		var got request
+		srv := ndjsonServer(t, []string{`{"message":{"role":"assistant","content":"你"},"done":false}`}, &got)
+		defer srv.Close()
+		c, _ := New(Config{Endpoint: srv.URL, Model: "m"})
+		_, _, _, _, err := collect(context.Background(), c, Messages("", nil, "hi"), nil)
+		assert.ErrorIs(t, err, ErrIncomplete)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+		c, _ := New(Config{Endpoint: srv.URL, Model: "m"})
+		_, _, _, _, err := collect(context.Background(), c, Messages("", nil, "hi"), nil)
+		assert.ErrorIs(t, err, ErrStatus)
+		assert.Contains(t, err.Error(), "503")
+	})
+}
+
+// stallServer 发送 first 个片段后挂起，直到请求被中止
+func stallServer(first []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, l := range first {
+			fmt.Fprintf(w, "%s\n", l)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+}
+
+func TestStreamTimeout(t *testing.T) {
+	t.Run("first chunk", func(t *testing.T) {
+		srv := stallServer(nil)
+		defer srv.Close()
+		c, _ := New(Config{Endpoint: srv.URL, Model: "m", FirstTimeout: 50 * time.Millisecond})
+		_, _, _, _, err := collect(context.Background(), c, Messages("", nil, "hi"), nil)
+		assert.ErrorIs(t, err, ErrTimeout)
+	})
+
+	t.Run("whole request", func(t *testing.T) {
+		srv := stallServer([]string{`{"message":{"role":"assistant","content":"你"},"done":false}`})
+		defer srv.Close()
+		c, _ := New(Config{Endpoint: srv.URL, Model: "m", Timeout: 100 * time.Millisecond, FirstTimeout: 50 * time.Millisecond})
+		text, _, _, _, err := collect(context.Background(), c, Messages("", nil, "hi"), nil)
+		assert.ErrorIs(t, err, ErrTimeout)
+		assert.Equal(t, "你", text)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		srv := stallServer([]string{`{"message":{"role":"assistant","content":"你"},"done":false}`})
+		defer srv.Close()
+		c, _ := New(Config{Endpoint: srv.URL, Model: "m"})
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		_, _, _, _, err := collect(ctx, c, Messages("", nil, "hi"), nil)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestToolMessages(t *testing.T) {
+	turns := []tool.Message{
+		{Role: tool.RoleAssistant, Calls: []tool.Call{
+			{ID: "call_0", Name: "set_temperature", Arguments: `{"temperature":26}`},
+			{ID: "call_1", Name: "get_device_status"},
+		}},
+		{Role: tool.RoleTool, CallID: "call_0", Content: "好的"},
+		{Role: tool.RoleTool, CallID: "call_1", Content: "{}"},
+	}
+	got := ToolMessages(turns)
+	require.Len(t, got, 3)
+	require.Len(t, got[0].ToolCalls, 2)
+	assert.JSONEq(t, `{"temperature":26}`, string(got[0].ToolCalls[0].Function.Arguments))
+	assert.JSONEq(t, `{}`, string(got[0].ToolCalls[1].Function.Arguments))
+	assert.Equal(t, "set_temperature", got[1].ToolName)
+	assert.Equal(t, "get_device_status", got[2].ToolName)
+
+	data, err := json.Marshal(got[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"arguments":{"temperature":26}`)
+}
+
+func TestMessagesSummary(t *testing.T) {
+	history := []memory.Message{
+		{Role: memory.RoleSystem, Content: "摘要"},
+		{Role: memory.RoleUser, Content: "u"},
+		{Role: memory.RoleAssistant, Content: "a"},
+	}
+	got := Messages("sys", history, "hi")
+	require.Len(t, got, 4)
+	assert.Equal(t, "sys\n\n摘要", got[0].Content)
+	assert.Equal(t, Message{Role: memory.RoleUser, Content: "hi"}, got[3])
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	openai "yunyez/internal/pkg/agent/llm/openai"
+	memory "yunyez/internal/pkg/agent/memory"
+	metering "yunyez/internal/pkg/agent/metering"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// OpenAIAgent agent of an OpenAI-compatible backend (DeepSeek, Moonshot, vLLM, Ollama...)
+type OpenAIAgent struct {
+	Client *openai.Client // the named backend
+	Memory memory.Store   // conversation memory, nil disables multi-turn context
+	Prompt PromptFunc     // system prompt, nil or empty to use the backend default
+	Tools  *tool.Registry // tools the model may call, nil or empty disables tool calling
+}
+
+// UsageModel the model name of the backend in the usage and the pricing rules,
+// qualified by the backend name so that the same model served by different backends is priced separately
+func UsageModel(backend, model string) string {
+	return backend + "/" + model
+}
+
+// Chat OpenAI-compatible agent chat
+// the device system prompt and history are sent before the message and the completed exchange is appended to the history,
+// the tools called by the model are run and their results fed back for the final reply
+func (a *OpenAIAgent) Chat(ctx context.Context, clientID, message string) (<-chan Event, error) {
+	system := a.Client.System()
+	if a.Prompt != nil {
+		if s := a.Prompt(ctx, clientID); s != "" {
+			system = s
+		}
+	}
+	messages := openai.Messages(system, loadHistory(ctx, a.Memory, clientID), message)
+	model := UsageModel(a.Client.Name(), a.Client.Model())
+
+	return streamChat(ctx, clientID, message, a.Memory, a.Tools, a.Client.Name(),
+		func(ctx context.Context, turns []tool.Message, tools []tool.Definition, reply chan<- string) (*metering.Usage, []tool.Call, string, error) {
+			start := time.Now()
+			u, calls, reason, err := a.Client.Stream(ctx, append(messages[:len(messages):len(messages)], openai.ToolMessages(turns)...), tools, reply)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			return &metering.Usage{
+				Model:            model,
+				PromptTokens:     u.PromptTokens,
+				CompletionTokens: u.CompletionTokens,
+				TotalTokens:      u.TotalTokens,
+				StartTime:        start,
+				EndTime:          time.Now(),
+			}, calls, reason, nil
+		})
+}
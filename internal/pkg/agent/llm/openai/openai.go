@@ -0,0 +1,312 @@
+// Package openai OpenAI 兼容的对话模型客户端
+// 适用于任意实现 /chat/completions 流式接口的服务（DeepSeek、Moonshot、vLLM、Ollama 的 OpenAI 模式等），
+// 每个命名后端一个客户端，不依赖全局配置
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	memory "yunyez/internal/pkg/agent/memory"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// DefaultTimeout 默认请求超时，包括读取整个流式响应的时间
+const DefaultTimeout = 60 * time.Second
+
+var (
+	ErrInvalidConfig = errors.New("invalid openai backend config")
+	ErrStatus        = errors.New("openai backend returned non-200 status")
+	ErrIncomplete    = errors.New("openai stream ended before [DONE] or finish_reason")
+)
+
+// Config 后端配置
+type Config struct {
+	Name     string        // 后端名称，Strategy.SetAgent 按名称选择
+	Endpoint string        // /chat/completions 完整地址
+	APIKey   string        // 为空时不发送 Authorization 头（如本地 vLLM、Ollama）
+	Model    string        // 模型名
+	System   string        // 默认系统提示词，设备没有提示词时使用，可为空
+	Timeout  time.Duration // 请求超时，<= 0 时使用 DefaultTimeout
+}
+
+// Message 对话消息
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall 消息中的工具调用
+type ToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// Usage 一次请求的用量
+type Usage struct {
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	TotalTokens      int  `json:"total_tokens"`
+	Estimated        bool `json:"-"` // 后端未返回用量，按文本估算
+}
+
+// Client OpenAI 兼容的对话模型客户端
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// New 创建客户端
+// 参数：
+//   - cfg: 后端配置
+//
+// 返回值:
+//   - *Client: 客户端
+//   - error: 名称、地址或模型为空时返回错误
+func New(cfg Config) (*Client, error) {
+	if cfg.Name == "" || cfg.Endpoint == "" || cfg.Model == "" {
+		return nil, fmt.Errorf("%w: name, endpoint and model are required: %q", ErrInvalidConfig, cfg.Name)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Client{cfg: cfg, http: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Name 后端名称
+func (c *Client) Name() string {
+	return c.cfg.Name
+}
+
+// Model 模型名
+func (c *Client) Model() string {
+	return c.cfg.Model
+}
+
+// System 默认系统提示词
+func (c *Client) System() string {
+	return c.cfg.System
+}
+
+// Messages 组装请求消息：系统提示词、对话历史与当前消息
+// 历史开头的 system 消息（对话摘要）并入系统提示词，系统提示词为空时不发送
+// 参数：
+//   - system: 系统提示词
+//   - history: 按时间顺序的对话历史
+//   - message: 当前消息
+//
+// 返回值:
+//   - []Message: 请求消息
+func Messages(system string, history []memory.Message, message string) []Message {
+	system, history = memory.MergeSystem(system, history)
+	messages := make([]Message, 0, len(history)+2)
+	if system != "" {
+		messages = append(messages, Message{Role: memory.RoleSystem, Content: system})
+	}
+	for _, m := range history {
+		messages = append(messages, Message{Role: m.Role, Content: m.Content})
+	}
+	return append(messages, Message{Role: memory.RoleUser, Content: message})
+}
+
+// ToolMessages 将工具调用过程转换为请求消息
+func ToolMessages(turns []tool.Message) []Message {
+	messages := make([]Message, 0, len(turns))
+	for _, t := range turns {
+		m := Message{Role: t.Role, Content: t.Content, ToolCallID: t.CallID}
+		for _, c := range t.Calls {
+			tc := ToolCall{ID: c.ID, Type: "function"}
+			tc.Function.Name = c.Name
+			tc.Function.Arguments = c.Arguments
+			m.ToolCalls = append(m.ToolCalls, tc)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// request 请求参数
+type request struct {
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	Tools         []toolDecl     `json:"tools,omitempty"`
+	Stream        bool           `json:"stream"`
+	StreamOptions map[string]any `json:"stream_options,omitempty"`
+}
+
+// toolDecl 工具声明
+type toolDecl struct {
+	Type     string          `json:"type"`
+	Function tool.Definition `json:"function"`
+}
+
+// chunk 流式响应片段
+type chunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Stream 以流式请求模型
+// 文本片段按到达顺序发送到 reply，tool_calls 片段拼装为完整的工具调用；
+// 后端未返回用量时按请求与回复文本估算，未返回结束原因时视为 stop
+// 参数：
+//   - ctx: 上下文，取消时中止请求
+//   - messages: 请求消息
+//   - tools: 声明的工具，为空时不声明
+//   - reply: 回复片段通道，由调用方关闭
+//
+// 返回值:
+//   - *Usage: 用量
+//   - []tool.Call: 模型发起的工具调用
+//   - string: 结束原因，如 stop、length、tool_calls
+//   - error: 请求失败、响应非 200 或解析失败时返回错误
+func (c *Client) Stream(ctx context.Context, messages []Message, tools []tool.Definition, reply chan<- string) (*Usage, []tool.Call, string, error) {
+	req := request{
+		Model:         c.cfg.Model,
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: map[string]any{"include_usage": true},
+	}
+	for _, d := range tools {
+		req.Tools = append(req.Tools, toolDecl{Type: "function", Function: d})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if c.cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("call %s: %w", c.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, nil, "", fmt.Errorf("%w: %s %d %s", ErrStatus, c.cfg.Name, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	usage, calls, text, reason, err := readStream(ctx, resp.Body, reply)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("read %s stream: %w", c.cfg.Name, err)
+	}
+	if usage == nil {
+		usage = estimate(messages, text)
+	}
+	if reason == "" {
+		reason = "stop"
+	}
+	return usage, calls, reason, nil
+}
+
+// readStream 读取 SSE 流式响应
+// 连接在 [DONE] 与 finish_reason 之前断开时回复不完整，返回 ErrIncomplete
+func readStream(ctx context.Context, body io.Reader, reply chan<- string) (*Usage, []tool.Call, string, string, error) {
+	reader := bufio.NewReader(body)
+	var (
+		usage  *Usage
+		calls  tool.Accumulator
+		text   strings.Builder
+		reason string
+		done   bool
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, "", "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "data: [DONE]" {
+			done = true
+			break
+		}
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			var c chunk
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &c); err != nil {
+				return nil, nil, "", "", fmt.Errorf("unmarshal chunk: %w", err)
+			}
+			if c.Usage != nil {
+				usage = c.Usage // 只保留最后一个
+			}
+			for _, choice := range c.Choices {
+				if choice.FinishReason != nil && *choice.FinishReason != "" {
+					reason = *choice.FinishReason
+				}
+				for _, tc := range choice.Delta.ToolCalls {
+					calls.Add(tool.Delta{
+						Index:     tc.Index,
+						ID:        tc.ID,
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					})
+				}
+				if choice.Delta.Content == "" {
+					continue
+				}
+				text.WriteString(choice.Delta.Content)
+				select {
+				case reply <- choice.Delta.Content:
+				case <-ctx.Done():
+					return nil, nil, "", "", ctx.Err()
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if !done && reason == "" {
+		return nil, nil, "", "", ErrIncomplete
+	}
+	return usage, calls.Calls(), text.String(), reason, nil
+}
+
+// estimate 后端未返回用量时按文本估算
+func estimate(messages []Message, reply string) *Usage {
+	var prompt int
+	for _, m := range messages {
+		prompt += memory.EstimateTokens(m.Content)
+	}
+	completion := memory.EstimateTokens(reply)
+	return &Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+		Estimated:        true,
+	}
+}
@@ -0,0 +1,169 @@
+// 测试 OpenAI 兼容后端的请求组装与流式响应解析
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memory "yunyez/internal/pkg/agent/memory"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// sseServer 返回固定 SSE 片段的后端，记录收到的请求
+func sseServer(t *testing.T, lines []string, got *request, auth *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		*auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, l := range lines {
+			fmt.Fprintf(w, "%s\n\n", l)
+		}
+	}))
+}
+
+func collect(t *testing.T, c *Client, messages []Message, tools []tool.Definition) (string, *Usage, []tool.Call, string, error) {
+	reply := make(chan string, 100)
+	usage, calls, reason, err := c.Stream(context.Background(), messages, tools, reply)
+	close(reply)
+	var b strings.Builder
+	for s := range reply {
+		b.WriteString(s)
+	}
+	return b.String(), usage, calls, reason, err
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{Name: "x", Endpoint: "http://x"})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	c, err := New(Config{Name: "x", Endpoint: "http://x", Model: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTimeout, c.http.Timeout)
+}
+
+func TestStreamText(t *testing.T) {
+	var got request
+	var auth string
+	srv := sseServer(t, []string{
+		`: keep-alive`,
+		`data: {"choices":[{"delta":{"role":"assistant","content":"你好"}}]}`,
+		`data: {"choices":[{"delta":{"content":"，世界"},"finish_reason":"stop"}]}`,
+		`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":4,"total_tokens":16}}`,
+		`data: [DONE]`,
+	}, &got, &auth)
+	defer srv.Close()
+
+	c, err := New(Config{Name: "deepseek", Endpoint: srv.URL, APIKey: "sk-1", Model: "deepseek-chat"})
+	require.NoError(t, err)
+	text, usage, calls, reason, err := collect(t, c, Messages("sys", nil, "hi"), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "你好，世界", text)
+	assert.Equal(t, "stop", reason)
+	assert.Equal(t, &Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}, usage)
+	assert.Empty(t, calls)
+	assert.Equal(t, "Bearer sk-1", auth)
+	assert.Equal(t, "deepseek-chat", got.Model)
+	assert.True(t, got.Stream)
+	assert.Empty(t, got.Tools)
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	var got request
+	var auth string
+	srv := sseServer(t, []string{
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"set_temperature","arguments":""}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"temperature\":"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"26}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}, &got, &auth)
+	defer srv.Close()
+
+	c, err := New(Config{Name: "ollama", Endpoint: srv.URL, Model: "qwen2.5:7b"})
+	require.NoError(t, err)
+	defs := []tool.Definition{{Name: "set_temperature", Parameters: map[string]any{"type": "object"}}}
+	turns := ToolMessages([]tool.Message{
+		{Role: tool.RoleAssistant, Calls: []tool.Call{{ID: "call_0", Name: "get_device_status", Arguments: "{}"}}},
+		{Role: tool.RoleTool, Content: `{"status":"online"}`, CallID: "call_0"},
+	})
+	text, usage, calls, reason, err := collect(t, c, append(Messages("", nil, "调到26度"), turns...), defs)
+	require.NoError(t, err)
+
+	assert.Empty(t, text)
+	assert.Equal(t, "tool_calls", reason)
+	assert.Equal(t, []tool.Call{{ID: "call_1", Name: "set_temperature", Arguments: `{"temperature":26}`}}, calls)
+	assert.Empty(t, auth, "no api key, no authorization header")
+	assert.True(t, usage.Estimated, "usage estimated when the backend reports none")
+	assert.Positive(t, usage.PromptTokens)
+
+	require.Len(t, got.Tools, 1)
+	assert.Equal(t, "function", got.Tools[0].Type)
+	assert.Equal(t, "set_temperature", got.Tools[0].Function.Name)
+	require.Len(t, got.Messages, 3)
+	assert.Equal(t, "get_device_status", got.Messages[1].ToolCalls[0].Function.Name)
+	assert.Equal(t, "call_0", got.Messages[2].ToolCallID)
+}
+
+func TestStreamStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{Name: "moonshot", Endpoint: srv.URL, Model: "moonshot-v1-8k"})
+	require.NoError(t, err)
+	_, _, _, _, err = collect(t, c, Messages("", nil, "hi"), nil)
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.Contains(t, err.Error(), "invalid api key")
+}
+
+func TestStreamIncomplete(t *testing.T) {
+	var got request
+	var auth string
+	srv := sseServer(t, []string{
+		`data: {"choices":[{"delta":{"role":"assistant","content":"今天"}}]}`,
+	}, &got, &auth)
+	defer srv.Close()
+
+	c, err := New(Config{Name: "deepseek", Endpoint: srv.URL, Model: "deepseek-chat"})
+	require.NoError(t, err)
+	text, _, _, _, err := collect(t, c, Messages("", nil, "hi"), nil)
+	assert.ErrorIs(t, err, ErrIncomplete)
+	assert.Equal(t, "今天", text, "the partial reply is streamed before the error")
+
+	// 没有 [DONE] 但有 finish_reason 的流视为完整
+	srv2 := sseServer(t, []string{
+		`data: {"choices":[{"delta":{"content":"今天晴天"},"finish_reason":"stop"}]}`,
+	}, &got, &auth)
+	defer srv2.Close()
+	c, err = New(Config{Name: "deepseek", Endpoint: srv2.URL, Model: "deepseek-chat"})
+	require.NoError(t, err)
+	_, _, _, reason, err := collect(t, c, Messages("", nil, "hi"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "stop", reason)
+}
+
+func TestMessages(t *testing.T) {
+	history := []memory.Message{
+		memory.SummaryMessage("用户叫小明"),
+		{Role: memory.RoleUser, Content: "你好"},
+		{Role: memory.RoleAssistant, Content: "你好小明"},
+	}
+	got := Messages("你是助手", history, "今天几号")
+	require.Len(t, got, 4)
+	assert.Equal(t, memory.RoleSystem, got[0].Role)
+	assert.True(t, strings.HasPrefix(got[0].Content, "你是助手\n\n"))
+	assert.Contains(t, got[0].Content, "用户叫小明")
+	assert.Equal(t, Message{Role: memory.RoleUser, Content: "今天几号"}, got[3])
+
+	got = Messages("", nil, "hi")
+	assert.Equal(t, []Message{{Role: memory.RoleUser, Content: "hi"}}, got)
+}
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"context"
+
+	metering "yunyez/internal/pkg/agent/metering"
+	prompt "yunyez/internal/pkg/agent/prompt"
+)
+
+// ExtractFacts ask the agent for the facts about the user worth remembering in the user text
+// the agent should not carry memory or a device prompt, the request is not part of the conversation
+// Parameters:
+//   - ctx: the context of the request
+//   - agent: the agent to extract with
+//   - clientID: the device sequence number
+//   - text: the user text
+//   - known: the facts already remembered, so the agent updates them instead of repeating
+//
+// Returns:
+//   - []prompt.Fact: the facts to remember, empty if nothing is worth remembering
+//   - *metering.Usage: the usage of the extraction request, to be metered like a normal turn
+//   - error: the error object if the agent failed or the reply can't be parsed
+func ExtractFacts(ctx context.Context, agent Agent, clientID, text string, known []prompt.Fact) ([]prompt.Fact, *metering.Usage, error) {
+	reply, usage, err := collect(ctx, agent, clientID, prompt.ExtractPrompt(text, known))
+	if err != nil {
+		return nil, usage, err
+	}
+	facts, err := prompt.ParseFacts(reply)
+	if err != nil {
+		return nil, usage, err
+	}
+	return facts, usage, nil
+}
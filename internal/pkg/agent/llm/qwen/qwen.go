@@ -12,7 +12,9 @@ import (
 	"strings"
 	"time"
 	"yunyez/internal/common/config"
+	"yunyez/internal/pkg/agent/memory"
 	"yunyez/internal/pkg/agent/metering"
+	"yunyez/internal/pkg/agent/tool"
 	"yunyez/internal/pkg/logger"
 )
 
@@ -29,64 +31,46 @@ var (
 	stream     = config.GetBool("qwen.params.stream")
 
 	timeout = 10 * time.Second
-	size    = 10 // 响应通道缓冲区大小
 )
 
 const (
 	DoneChunk = "data: [DONE]" // 流式返回结束chunk e.g. data: [DONE]
 )
 
-// QwenChat 调用 Qwen 模型并返回响应通道（支持流式/非流式）
+// Stream 请求一次 Qwen 模型，文本片段发送到回复通道
+// 工具调用需要流式返回，非流式配置下不声明工具；调用方关闭回复通道，失败时返回错误而不是只记录日志
 // 参数：
-// - ctx context.Context: 上下文
-// - clientID string: 客户端ID
+// - ctx context.Context: 上下文，取消时中止请求
+// - system string: 系统提示词，为空时使用配置的 qwen.systemDesc
+// - history []memory.Message: 按时间顺序的对话历史
 // - message string: 对话内容
+// - turns []tool.Message: 本轮已发生的工具调用与执行结果
+// - tools []tool.Definition: 声明的工具，为空时不声明
+// - reply chan<- string: 回复通道-只写（每个元素为一个片段）
 // 返回值：
-// - <-chan string: 流式响应通道-只读（每个元素为一个片段）
-// - <-chan *metering.Usage: 流式调用成本通道-只读（每个元素为一个调用成本, 每次只发送一个）
+// - *metering.Usage: 模型使用统计
+// - []tool.Call: 模型发起的工具调用
+// - string: 结束原因，如 stop、length、tool_calls
 // - error: 错误信息
-func QwenChat(ctx context.Context, clientID, message string) (<-chan string, <-chan *metering.Usage, error) {
-	var err error
-	params, err := BuildQwenChatParams(ctx, message)
+func Stream(ctx context.Context, system string, history []memory.Message, message string, turns []tool.Message, tools []tool.Definition, reply chan<- string) (*metering.Usage, []tool.Call, string, error) {
+	if !stream {
+		tools = nil
+	}
+	params, err := BuildQwenToolParams(ctx, system, history, message, turns, tools)
 	if err != nil {
-		logger.Error(ctx, "qwen.BuildQwenChatParams failed", map[string]any{
-			"message": message,
-			"error":   err.Error(),
-		})
-		return nil, nil, err
+		return nil, nil, "", err
 	}
 	resp, err := QwenChatHTTPRequest(ctx, params)
 	if err != nil {
-		logger.Error(ctx, "qwen.QwenChatHTTPRequest failed", map[string]any{
-			"message": message,
-			"error":   err.Error(),
-		})
-		return nil, nil, err
+		return nil, nil, "", err
 	}
+	defer resp.Body.Close()
 
-	out := make(chan string, size)
-	usageChan := make(chan *metering.Usage, 1) // 用于接收模型返回的 usage 信息
-	go func() {
-		defer close(out)        // 确保关闭通道
-		defer close(usageChan)  // 确保关闭通道
-		defer resp.Body.Close() // 确保在函数退出时关闭响应体
-
-		// 调用成本计算
-		var usage *metering.Usage
-
-		usage, err = handleQwenChatResponse(ctx, resp, out)
-		if err != nil {
-			logger.Error(ctx, "qwen.handleQwenChatResponse failed", map[string]any{
-				"message": message,
-				"error":   err.Error(),
-			})
-			// 注意：不能往 out 发 error，只能 log
-			// 调用方通过 context 或日志感知异常
-		}
-		// 发送 usage 到通道
-		usageChan <- usage
-	}()
-	return out, usageChan, nil
+	if !stream {
+		usage, reason, err := handleQwenChatResponse(ctx, resp, reply)
+		return usage, nil, reason, err
+	}
+	return handleQwenChatStreamResponse(ctx, resp, reply)
 }
 
 // QwenChatHTTPRequest 调用 qwen 对话模型的 HTTP 请求
@@ -97,7 +81,8 @@ func QwenChat(ctx context.Context, clientID, message string) (<-chan string, <-c
 // - *http.Response: HTTP 响应
 // - error: 错误信息
 func QwenChatHTTPRequest(ctx context.Context, param []byte) (*http.Response, error) {
-	httpReq, err := http.NewRequest("POST", BaseURL, bytes.NewBuffer(param))
+	// 请求随 ctx 取消（如用户打断），流式读取随之中止
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", BaseURL, bytes.NewBuffer(param))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -126,23 +111,88 @@ func QwenChatHTTPRequest(ctx context.Context, param []byte) (*http.Response, err
 // link：https://bailian.console.aliyun.com/?tab=api#/api/?type=model&url=2712576
 // 参数：
 // - ctx: 上下文
+// - system string: 系统提示词，为空时使用配置的 qwen.systemDesc
+// - history []memory.Message: 对话历史
 // - message string: 输入的对话消息
-// - stream bool: 是否开启流式返回
 // 返回值：
 // - []byte: 构建后的参数
 // - error: 错误信息
-func BuildQwenChatParams(ctx context.Context, message string) ([]byte, error) {
+func BuildQwenChatParams(ctx context.Context, system string, history []memory.Message, message string) ([]byte, error) {
+	return BuildQwenToolParams(ctx, system, history, message, nil, nil)
+}
+
+// BuildQwenToolParams 构建携带工具的 qwen 对话模型参数
+// link：https://help.aliyun.com/zh/model-studio/qwen-function-calling
+// 参数：
+// - ctx: 上下文
+// - system string: 系统提示词，为空时使用配置的 qwen.systemDesc
+// - history []memory.Message: 对话历史
+// - message string: 输入的对话消息
+// - turns []tool.Message: 本轮已发生的工具调用与执行结果，位于当前消息之后
+// - tools []tool.Definition: 声明的工具，为空时不声明
+// 返回值：
+// - []byte: 构建后的参数
+// - error: 错误信息
+func BuildQwenToolParams(ctx context.Context, system string, history []memory.Message, message string, turns []tool.Message, tools []tool.Definition) ([]byte, error) {
 	param := make(map[string]interface{})
 	param["model"] = ChatModel
-	param["messages"] = []map[string]string{
-		{
-			"role":    "system",
-			"content": systemDesc,
-		},
-		{
-			"role":    role,
-			"content": message,
-		},
+	if system == "" {
+		system = systemDesc
+	}
+	// 历史开头的 system 消息（对话摘要）并入系统提示词
+	for len(history) > 0 && history[0].Role == memory.RoleSystem {
+		system += "\n\n" + history[0].Content
+		history = history[1:]
+	}
+	messages := make([]map[string]interface{}, 0, len(history)+len(turns)+2)
+	messages = append(messages, map[string]interface{}{
+		"role":    "system",
+		"content": system,
+	})
+	for _, m := range history {
+		messages = append(messages, map[string]interface{}{
+			"role":    m.Role,
+			"content": m.Content,
+		})
+	}
+	messages = append(messages, map[string]interface{}{
+		"role":    role,
+		"content": message,
+	})
+	for _, t := range turns {
+		m := map[string]interface{}{
+			"role":    t.Role,
+			"content": t.Content,
+		}
+		if len(t.Calls) > 0 {
+			calls := make([]map[string]interface{}, 0, len(t.Calls))
+			for _, c := range t.Calls {
+				calls = append(calls, map[string]interface{}{
+					"id":   c.ID,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      c.Name,
+						"arguments": c.Arguments,
+					},
+				})
+			}
+			m["tool_calls"] = calls
+		}
+		if t.CallID != "" {
+			m["tool_call_id"] = t.CallID
+		}
+		messages = append(messages, m)
+	}
+	param["messages"] = messages
+	if len(tools) > 0 {
+		defs := make([]map[string]interface{}, 0, len(tools))
+		for _, d := range tools {
+			defs = append(defs, map[string]interface{}{
+				"type":     "function",
+				"function": d,
+			})
+		}
+		param["tools"] = defs
 	}
 	param["stream"] = stream // 是否开启流式返回
 	if stream {
@@ -165,6 +215,7 @@ type QwenChatResponse struct {
 			Message struct {
 				Content string `json:"content"` // 对话输出内容
 			} `json:"message"`
+			FinishReason string `json:"finish_reason"` // 结束原因
 		} `json:"choices"`
 	} `json:"output"`
 	Usage struct { // 模型使用统计
@@ -181,27 +232,32 @@ type QwenChatResponse struct {
 // - rely chan string: 回复通道-只写（每个元素为一个片段）
 // 返回值：
 // - *metering.Usage: 模型使用统计
+// - string: 结束原因
 // - error: 错误信息
-func handleQwenChatResponse(ctx context.Context, resp *http.Response, rely chan<- string) (*metering.Usage, error) {
+func handleQwenChatResponse(ctx context.Context, resp *http.Response, rely chan<- string) (*metering.Usage, string, error) {
 
 	if !stream { // 非流式返回
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return nil, fmt.Errorf("read response body: %w", err)
+			return nil, "", fmt.Errorf("read response body: %w", err)
 		}
 
 		var respBody QwenChatResponse
 		err = json.Unmarshal(body, &respBody)
 		if err != nil {
-			return nil, fmt.Errorf("unmarshal response body: %w", err)
+			return nil, "", fmt.Errorf("unmarshal response body: %w", err)
 		}
 		if len(respBody.Output.Choices) <= 0 {
 			logger.Error(ctx, "empty choices", map[string]any{
 				"response": string(body),
 			})
-			return nil, fmt.Errorf("empty choices")
+			return nil, "", fmt.Errorf("empty choices")
+		}
+		select {
+		case rely <- respBody.Output.Choices[0].Message.Content:
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
 		}
-		rely <- respBody.Output.Choices[0].Message.Content
 
 		usage := &metering.Usage{
 			Model:            ChatModel,
@@ -209,31 +265,37 @@ func handleQwenChatResponse(ctx context.Context, resp *http.Response, rely chan<
 			CompletionTokens: respBody.Usage.OutputTokens,
 			TotalTokens:      respBody.Usage.TotalTokens,
 		}
-		return usage, nil
+		return usage, respBody.Output.Choices[0].FinishReason, nil
 	}
 
 	fmt.Printf("-------- handleQwenChatStreamResponse --------\n")
 
-	usage, err := handleQwenChatStreamResponse(ctx, resp, rely)
+	usage, _, reason, err := handleQwenChatStreamResponse(ctx, resp, rely)
 	if err != nil {
 		logger.Error(ctx, "handleQwenChatStreamResponse failed", map[string]any{
 			"error": err.Error(),
 		})
-		return nil, fmt.Errorf("handleQwenChatStreamResponse: %w", err)
+		return nil, "", fmt.Errorf("handleQwenChatStreamResponse: %w", err)
 	}
 
-	return usage, nil
+	return usage, reason, nil
 }
 
 // handleQwenChatStreamResponse 处理 qwen 对话模型的 HTTP 流式响应
+// 文本片段发送到回复通道，tool_calls 片段拼装为完整的工具调用
 // 参数：
 // - ctx context.Context: 上下文
 // - resp *http.Response: HTTP 响应
 // - reply chan string: 回复通道-只写（每个元素为一个片段）
 // 返回值：
+// - *metering.Usage: 模型使用统计
+// - []tool.Call: 模型发起的工具调用
+// - string: 结束原因
 // - error: 错误信息
-func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, reply chan<- string) (*metering.Usage, error) {
+func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, reply chan<- string) (*metering.Usage, []tool.Call, string, error) {
 	reader := bufio.NewReader(resp.Body)
+	var calls tool.Accumulator
+	var reason string
 	var finalUsage *struct {
 		InputTokens  int `json:"prompt_tokens"`
 		OutputTokens int `json:"completion_tokens"`
@@ -248,7 +310,7 @@ func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, repl
 			if err == io.EOF {
 				break
 			}
-			return nil, fmt.Errorf("read response body: %w", err)
+			return nil, nil, "", fmt.Errorf("read response body: %w", err)
 		}
 		line = strings.TrimSpace(line)
 		if line == "" || line == ": ping" {
@@ -265,7 +327,15 @@ func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, repl
 		var chunk struct {
 			Choices []struct {
 				Delta struct {
-					Content string `json:"content"`
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
 				} `json:"delta"`
 				FinishReason *string `json:"finish_reason"`
 			} `json:"choices"`
@@ -277,7 +347,7 @@ func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, repl
 		}
 		err = json.Unmarshal([]byte(jsonString), &chunk)
 		if err != nil {
-			return nil, fmt.Errorf("unmarshal response body: %w", err)
+			return nil, nil, "", fmt.Errorf("unmarshal response body: %w", err)
 		}
 		if chunk.Usage != nil {
 			finalUsage = chunk.Usage // 覆盖之前的，最终保留最后一个
@@ -285,12 +355,23 @@ func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, repl
 		if len(chunk.Choices) == 0 {
 			continue
 		}
+		if fr := chunk.Choices[0].FinishReason; fr != nil && *fr != "" {
+			reason = *fr
+		}
+		for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+			calls.Add(tool.Delta{
+				Index:     tc.Index,
+				ID:        tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			})
+		}
 		content := chunk.Choices[0].Delta.Content
 		if content != "" {
 			select {
 			case reply <- content: // 仅发送文本内容到通道
 			case <-ctx.Done():
-				return nil, ctx.Err()
+				return nil, nil, "", ctx.Err()
 			}
 		}
 		// end
@@ -301,7 +382,7 @@ func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, repl
 
 	// 成本计算
 	if finalUsage == nil {
-		return nil, fmt.Errorf("empty usage")
+		return nil, nil, "", fmt.Errorf("empty usage")
 	}
 	usage := &metering.Usage{
 		Model:            ChatModel,
@@ -312,5 +393,5 @@ func handleQwenChatStreamResponse(ctx context.Context, resp *http.Response, repl
 		EndTime:          time.Now(),
 	}
 
-	return usage, nil
+	return usage, calls.Calls(), reason, nil
 }
@@ -15,38 +15,22 @@ func TestQwenChatSingle(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	stream, usage, err := QwenChat(ctx,"", "你是谁")
-	if err != nil {
-		t.Fatalf("QwenChat failed: %v", err)
-	}
-
-	for {
-		select {
-		case <-ctx.Done():
-			t.Logf("context done: %v", ctx.Err())
-			return
-		case reply, ok := <-stream:
-			if !ok {
-				t.Log("stream closed")
-				return
-			}
-			if reply == "" {
-				t.Log("empty reply")
-			} else {
-				t.Logf("Reply: %.50s...", reply)
-			}
-		case u, ok := <-usage:
-			if !ok {
-				t.Log("usage closed")
-				return
-			}
-			if u == nil {
-				t.Log("empty usage")
-			} else {
-				t.Logf("Usage: %v", u)
-			}
+	reply := make(chan string, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for r := range reply {
+			t.Logf("Reply: %.50s...", r)
 		}
+	}()
+
+	usage, _, reason, err := Stream(ctx, "", nil, "你是谁", nil, nil, reply)
+	close(reply)
+	<-done
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
 	}
+	t.Logf("Usage: %v, finish reason: %s", usage, reason)
 }
 
 var questions = []string{
@@ -121,17 +105,22 @@ func BenchmarkQwenChatConcurrent(b *testing.B) {
             // 这里不能用 id，但可以用原子计数 or 取 pb 的隐式序号（不暴露）
             // 我们用一个简单 trick：取当前时间纳秒模
             question := questions[(time.Now().UnixNano() % int64(len(questions)))]
-			reply, usage, err := QwenChat(ctx,"", question)
-			if err != nil {
-				b.Fatalf("QwenChat failed: %v", err)
-			}
+			reply := make(chan string, 10)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for r := range reply {
+					b.Logf("Reply: %.50s...", r)
+				}
+			}()
 
-			for r := range reply {
-				b.Logf("Reply: %.50s...", r)
-			}
-			for u := range usage {
-				b.Logf("Usage: %v", u)
+			usage, _, _, err := Stream(ctx, "", nil, question, nil, nil, reply)
+			close(reply)
+			<-done
+			if err != nil {
+				b.Fatalf("Stream failed: %v", err)
 			}
+			b.Logf("Usage: %v", usage)
 
         }
     })
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+
+	memory "yunyez/internal/pkg/agent/memory"
+	metering "yunyez/internal/pkg/agent/metering"
+	tool "yunyez/internal/pkg/agent/tool"
+	logger "yunyez/internal/pkg/logger"
+)
+
+// replySize the buffer size of the reply channel
+const replySize = 10
+
+// streamFunc request the model once with the tool calls of the turn so far,
+// forward the reply fragments and return the usage, the tool calls and the finish reason of the model
+type streamFunc func(ctx context.Context, turns []tool.Message, tools []tool.Definition, reply chan<- string) (*metering.Usage, []tool.Call, string, error)
+
+// streamChat run one turn of a streaming agent
+// the tools called by the model are run and their results fed back until the model replies,
+// the usage of all the requests of the turn is merged and the completed exchange is remembered
+// Parameters:
+//   - ctx: the context of the turn
+//   - clientID: the device sequence number
+//   - message: the user text
+//   - store: the conversation memory, nil to not remember
+//   - tools: the tools the model may call, nil or empty disables tool calling
+//   - backend: the backend name for the logs
+//   - stream: request the model once
+//
+// Returns:
+//   - <-chan Event: the events of the turn
+//   - error: always nil, the failures are reported by the error event
+func streamChat(ctx context.Context, clientID, message string, store memory.Store, tools *tool.Registry, backend string, stream streamFunc) (<-chan Event, error) {
+	out := make(chan Event, replySize)
+	go func() {
+		defer close(out)
+
+		var (
+			total  *metering.Usage
+			reason string
+		)
+		round := func(ctx context.Context, turns []tool.Message, withTools bool) ([]tool.Call, error) {
+			var defs []tool.Definition
+			if withTools {
+				defs = tools.Definitions()
+			}
+			reply, flush := textSink(ctx, out)
+			u, calls, r, err := stream(ctx, turns, defs, reply)
+			flush()
+			if err != nil {
+				return nil, err
+			}
+			total = mergeUsage(total, u)
+			reason = r
+			return calls, nil
+		}
+		observe := func(r tool.Result) {
+			logToolCall(ctx, clientID, r)
+			send(ctx, out, Event{Type: EventToolCall, Tool: &r})
+		}
+
+		var err error
+		if tools.Len() > 0 {
+			err = tool.Run(ctx, tools, clientID, tool.DefaultMaxRounds, round, observe)
+		} else {
+			_, err = round(ctx, nil, false)
+		}
+		// the requests that completed are billed even if a later one failed
+		if total != nil && !send(ctx, out, Event{Type: EventUsage, Usage: total}) {
+			return
+		}
+		if err != nil {
+			logger.Error(ctx, "llm backend chat failed", map[string]any{
+				"clientID": clientID,
+				"backend":  backend,
+				"message":  message,
+				"error":    err.Error(),
+			})
+			send(ctx, out, Event{Type: EventError, Err: err})
+			return
+		}
+		if reason == "" {
+			reason = FinishStop
+		}
+		send(ctx, out, Event{Type: EventFinish, Reason: reason})
+	}()
+	return remember(ctx, store, clientID, message, out)
+}
+
+// mergeUsage merge the usage of the requests in one turn
+func mergeUsage(total, u *metering.Usage) *metering.Usage {
+	if total == nil {
+		return u
+	}
+	total.PromptTokens += u.PromptTokens
+	total.CompletionTokens += u.CompletionTokens
+	total.TotalTokens += u.TotalTokens
+	total.EndTime = u.EndTime
+	return total
+}
+
+// logToolCall log a tool call of the turn
+func logToolCall(ctx context.Context, clientID string, r tool.Result) {
+	fields := map[string]any{
+		"clientID":  clientID,
+		"tool":      r.Call.Name,
+		"arguments": r.Call.Arguments,
+		"result":    r.Content,
+	}
+	if r.Err != nil {
+		fields["error"] = r.Err.Error()
+		logger.Warn(ctx, "tool call failed", fields)
+		return
+	}
+	logger.Info(ctx, "tool called", fields)
+}
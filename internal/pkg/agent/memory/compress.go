@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 默认压缩配置
+const (
+	DefaultCompressThreshold = 1500 // 默认触发压缩的 Token 数
+	DefaultKeepTurns         = 2    // 默认压缩后保留原文的最近轮次
+)
+
+var (
+	// ErrCompress 对话已追加但压缩失败
+	ErrCompress = errors.New("compress conversation memory failed")
+	// ErrSessionChanged 摘要期间待删除的消息已被清空或删除，摘要未保存
+	ErrSessionChanged = errors.New("conversation memory changed during compaction")
+)
+
+// Compactable 支持摘要压缩的对话记忆存储
+type Compactable interface {
+	Store
+
+	// Load 读取设备未裁剪的对话摘要与全部消息
+	Load(ctx context.Context, sn string) (*Session, error)
+
+	// AppendUntrimmed 追加一轮对话，不按保留轮次丢弃较早的轮次
+	AppendUntrimmed(ctx context.Context, sn, user, assistant string) error
+
+	// Compact 保存新的对话摘要并删除已摘要的最早消息 dropped
+	// 列表开头已不是 dropped 时返回 ErrSessionChanged 且不写入
+	Compact(ctx context.Context, sn string, dropped []Message, summary string) error
+}
+
+// SummarizeFunc 将旧的对话摘要与较早的对话轮次合并为新的摘要
+// 参数：
+//   - ctx: 上下文
+//   - sn: 设备序列号，用于计费
+//   - previous: 旧的对话摘要，可能为空
+//   - turns: 待压缩的对话消息
+//
+// 返回值:
+//   - string: 新的对话摘要
+//   - error: 摘要失败时返回错误，对话历史保持不变
+type SummarizeFunc func(ctx context.Context, sn, previous string, turns []Message) (string, error)
+
+// Compressor 对话记忆压缩
+// 作为 Store 使用：追加对话后，若设备记忆的 Token 数超过阈值，
+// 将较早的轮次经 LLM 合并进滚动摘要并从历史中删除，最近的 KeepTurns 轮保留原文
+type Compressor struct {
+	Compactable
+
+	Summarize SummarizeFunc // 摘要函数
+	Threshold int           // 触发压缩的 Token 数
+	KeepTurns int           // 保留原文的最近轮次
+
+	inflight sync.Map // 正在压缩的设备，同一设备同时只压缩一次
+}
+
+// NewCompressor 创建对话记忆压缩
+// 参数：
+//   - store: 支持摘要压缩的对话记忆存储
+//   - summarize: 摘要函数
+//   - threshold: 触发压缩的 Token 数，<= 0 时使用 DefaultCompressThreshold
+//   - keepTurns: 保留原文的最近轮次，< 0 时使用 DefaultKeepTurns
+//
+// 返回值:
+//   - *Compressor: 对话记忆压缩
+func NewCompressor(store Compactable, summarize SummarizeFunc, threshold, keepTurns int) *Compressor {
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	if keepTurns < 0 {
+		keepTurns = DefaultKeepTurns
+	}
+	return &Compressor{
+		Compactable: store,
+		Summarize:   summarize,
+		Threshold:   threshold,
+		KeepTurns:   keepTurns,
+	}
+}
+
+// Append 追加一轮对话，超过阈值时压缩
+// 较早的轮次先经摘要再删除，不按存储的保留轮次直接丢弃；
+// 压缩失败时对话已追加，返回 ErrCompress，下一轮追加时重试压缩
+func (c *Compressor) Append(ctx context.Context, sn, user, assistant string) error {
+	if err := c.Compactable.AppendUntrimmed(ctx, sn, user, assistant); err != nil {
+		return err
+	}
+	if _, err := c.Compress(ctx, sn); err != nil {
+		return fmt.Errorf("%w: %v", ErrCompress, err)
+	}
+	return nil
+}
+
+// Compress 设备记忆超过阈值时压缩较早的轮次
+// 参数：
+//   - ctx: 上下文
+//   - sn: 设备序列号
+//
+// 返回值:
+//   - bool: 是否进行了压缩
+//   - error: 读取、摘要或写入失败时返回错误
+func (c *Compressor) Compress(ctx context.Context, sn string) (bool, error) {
+	if _, busy := c.inflight.LoadOrStore(sn, struct{}{}); busy {
+		return false, nil
+	}
+	defer c.inflight.Delete(sn)
+
+	session, err := c.Load(ctx, sn)
+	if err != nil {
+		return false, err
+	}
+	if Tokens(session) <= c.Threshold {
+		return false, nil
+	}
+
+	dropped := compressible(session.Messages, c.KeepTurns)
+	if dropped == 0 {
+		return false, nil
+	}
+	summary, err := c.Summarize(ctx, sn, session.Summary, session.Messages[:dropped])
+	if err != nil {
+		return false, fmt.Errorf("summarize session %s: %w", sn, err)
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return false, fmt.Errorf("summarize session %s: empty summary", sn)
+	}
+	if err := c.Compact(ctx, sn, session.Messages[:dropped], summary); err != nil {
+		if errors.Is(err, ErrSessionChanged) { // 摘要期间被清空等，下一轮追加时重新判断
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Tokens 估算会话记忆的 Token 数
+func Tokens(session *Session) int {
+	n := EstimateTokens(session.Summary)
+	for _, m := range session.Messages {
+		n += EstimateTokens(m.Content)
+	}
+	return n
+}
+
+// compressible 可压缩的最早消息数，保留最近 keepTurns 轮，且不拆开一问一答
+func compressible(messages []Message, keepTurns int) int {
+	n := len(messages) - 2*keepTurns
+	for n > 0 && n < len(messages) && messages[n].Role != RoleUser {
+		n--
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Transcript 将对话消息整理为摘要提示使用的文本
+func Transcript(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case RoleUser:
+			b.WriteString("用户：")
+		case RoleAssistant:
+			b.WriteString("助手：")
+		default:
+			continue
+		}
+		b.WriteString(m.Content)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+// Package memory 对话短期记忆
+// 按设备序列号隔离保存最近 N 轮对话（用户文本 + 完整的助手回复），
+// 供 LLM 构建多轮上下文；超过 Token 预算时从最早的轮次开始裁剪
+package memory
+
+import (
+	"context"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 消息角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// 默认配置
+const (
+	DefaultMaxTurns  = 10               // 默认保留的对话轮次
+	DefaultTTL       = 30 * time.Minute // 默认无活动过期时间
+	DefaultMaxTokens = 2000             // 默认历史上下文 Token 预算
+)
+
+// Message 对话消息
+type Message struct {
+	Role      string    `json:"role"`      // 角色：system / user / assistant
+	Content   string    `json:"content"`   // 消息内容
+	Timestamp time.Time `json:"timestamp"` // 时间戳
+}
+
+// Session 设备未裁剪的会话记忆
+type Session struct {
+	Summary  string    // 已压缩轮次的对话摘要
+	Messages []Message // 未压缩的对话消息
+}
+
+// summaryPrefix 对话摘要作为 system 消息时的前缀
+const summaryPrefix = "以下是与用户之前对话的摘要：\n"
+
+// SummaryMessage 对话摘要的 system 消息
+func SummaryMessage(summary string) Message {
+	return Message{Role: RoleSystem, Content: summaryPrefix + summary}
+}
+
+// MergeSystem 将对话历史开头的 system 消息（对话摘要）并入系统提示词
+// 参数：
+//   - system: 系统提示词，可为空
+//   - history: 对话历史
+//
+// 返回值:
+//   - string: 合并后的系统提示词
+//   - []Message: 去掉开头 system 消息的对话历史
+func MergeSystem(system string, history []Message) (string, []Message) {
+	for len(history) > 0 && history[0].Role == RoleSystem {
+		if system != "" {
+			system += "\n\n"
+		}
+		system += history[0].Content
+		history = history[1:]
+	}
+	return system, history
+}
+
+// Store 对话记忆存储
+type Store interface {
+	// History 读取设备的对话历史（按时间顺序，已按 Token 预算裁剪）
+	// 参数：
+	//   - ctx: 上下文
+	//   - sn: 设备序列号
+	//
+	// 返回值:
+	//   - []Message: 对话历史，不存在时为空
+	//   - error: 读取失败时返回错误
+	History(ctx context.Context, sn string) ([]Message, error)
+
+	// Append 追加一轮完整的对话并续期
+	// 参数：
+	//   - ctx: 上下文
+	//   - sn: 设备序列号
+	//   - user: 用户文本
+	//   - assistant: 助手的完整回复
+	//
+	// 返回值:
+	//   - error: 写入失败时返回错误
+	Append(ctx context.Context, sn, user, assistant string) error
+
+	// Clear 清空设备的对话历史
+	Clear(ctx context.Context, sn string) error
+}
+
+// Options 对话记忆配置
+type Options struct {
+	MaxTurns  int           // 保留的对话轮次（一问一答为一轮），<= 0 时使用 DefaultMaxTurns
+	TTL       time.Duration // 无活动过期时间，<= 0 时使用 DefaultTTL
+	MaxTokens int           // 历史上下文 Token 预算，<= 0 时使用 DefaultMaxTokens
+}
+
+// withDefaults 填充默认配置
+func (o Options) withDefaults() Options {
+	if o.MaxTurns <= 0 {
+		o.MaxTurns = DefaultMaxTurns
+	}
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.MaxTokens <= 0 {
+		o.MaxTokens = DefaultMaxTokens
+	}
+	return o
+}
+
+// EstimateTokens 估算文本的 Token 数
+// 中日韩字符按每字 1 个 Token，其余字符按每 4 个 1 个 Token 估算，
+// 仅用于预算裁剪，不参与计费
+func EstimateTokens(text string) int {
+	tokens, others := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			tokens++
+		} else {
+			others++
+		}
+	}
+	return tokens + (others+3)/4
+}
+
+// isCJK 是否为中日韩字符（含全角标点）
+func isCJK(r rune) bool {
+	return r >= utf8.RuneSelf && (unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF))
+}
+
+// Trim 按 Token 预算裁剪对话历史
+// 从最早的消息开始丢弃，裁剪后历史以用户消息开头，保证一问一答不被拆开
+// 参数：
+//   - messages: 按时间顺序的对话历史
+//   - maxTokens: Token 预算
+//
+// 返回值:
+//   - []Message: 裁剪后的对话历史
+func Trim(messages []Message, maxTokens int) []Message {
+	// 从最新的消息往前累计
+	start, budget := len(messages), maxTokens
+	for i := len(messages) - 1; i >= 0; i-- {
+		budget -= EstimateTokens(messages[i].Content)
+		if budget < 0 {
+			break
+		}
+		start = i
+	}
+	for start < len(messages) && messages[start].Role != RoleUser {
+		start++
+	}
+	return messages[start:]
+}
@@ -0,0 +1,255 @@
+// 测试对话记忆的窗口、过期与 Token 裁剪
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStore(t *testing.T, opts Options) (*RedisStore, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewRedisStore(rdb, opts), s
+}
+
+func TestRedisStoreWindow(t *testing.T) {
+	store, _ := setupStore(t, Options{MaxTurns: 2, MaxTokens: 1000})
+	ctx := context.Background()
+
+	history, err := store.History(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	require.NoError(t, store.Append(ctx, "A0001", "q1", "a1"))
+	require.NoError(t, store.Append(ctx, "A0001", "q2", "a2"))
+	require.NoError(t, store.Append(ctx, "A0001", "q3", "a3"))
+	require.NoError(t, store.Append(ctx, "A0002", "other", "device"))
+
+	history, err = store.History(ctx, "A0001")
+	require.NoError(t, err)
+	var contents []string
+	for _, m := range history {
+		contents = append(contents, m.Role+":"+m.Content)
+	}
+	assert.Equal(t, []string{"user:q2", "assistant:a2", "user:q3", "assistant:a3"}, contents)
+
+	require.NoError(t, store.Clear(ctx, "A0001"))
+	history, err = store.History(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	history, err = store.History(ctx, "A0002")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	store, s := setupStore(t, Options{TTL: time.Minute})
+	ctx := context.Background()
+
+	require.NoError(t, store.Append(ctx, "A0001", "q1", "a1"))
+	s.FastForward(50 * time.Second)
+	// 读取续期
+	_, err := store.History(ctx, "A0001")
+	require.NoError(t, err)
+	s.FastForward(50 * time.Second)
+	history, err := store.History(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	s.FastForward(2 * time.Minute)
+	history, err = store.History(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestTrim(t *testing.T) {
+	messages := []Message{
+		{Role: RoleUser, Content: "你好"},                         // 2
+		{Role: RoleAssistant, Content: "你好，有什么可以帮你"},            // 10
+		{Role: RoleUser, Content: "今天天气怎么样"},                    // 7
+		{Role: RoleAssistant, Content: strings.Repeat("a", 20)}, // 5
+	}
+	assert.Len(t, Trim(messages, 100), 4)
+	// 预算只够最近一轮
+	assert.Equal(t, messages[2:], Trim(messages, 15))
+	// 不够一轮时不保留半轮
+	assert.Empty(t, Trim(messages, 5))
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 4, EstimateTokens("你好世界"))
+	assert.Equal(t, 3, EstimateTokens("hello world"))
+	assert.Equal(t, 4, EstimateTokens("播放abcd。"))
+}
+
+func TestMergeSystem(t *testing.T) {
+	history := []Message{SummaryMessage("摘要"), {Role: RoleUser, Content: "u"}}
+	system, rest := MergeSystem("sys", history)
+	assert.Equal(t, "sys\n\n"+SummaryMessage("摘要").Content, system)
+	assert.Equal(t, history[1:], rest)
+
+	system, rest = MergeSystem("", history)
+	assert.Equal(t, SummaryMessage("摘要").Content, system)
+	assert.Len(t, rest, 1)
+}
+
+func TestCompressor(t *testing.T) {
+	store, _ := setupStore(t, Options{MaxTurns: 10, MaxTokens: 1000})
+	ctx := context.Background()
+
+	var calls int
+	var gotPrevious string
+	var gotTurns []Message
+	c := NewCompressor(store, func(ctx context.Context, sn, previous string, turns []Message) (string, error) {
+		calls++
+		gotPrevious, gotTurns = previous, turns
+		return "摘要" + strings.Repeat("x", calls), nil
+	}, 20, 1)
+
+	// 未超过阈值不压缩
+	require.NoError(t, c.Append(ctx, "A0001", "你好", "你好呀"))
+	assert.Equal(t, 0, calls)
+
+	require.NoError(t, c.Append(ctx, "A0001", "今天星期几", "今天星期五"))
+	require.NoError(t, c.Append(ctx, "A0001", "明天呢", "明天星期六"))
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, gotPrevious)
+	assert.Equal(t, "用户：你好\n助手：你好呀\n用户：今天星期几\n助手：今天星期五\n", Transcript(gotTurns))
+
+	session, err := store.Load(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Equal(t, "摘要x", session.Summary)
+	require.Len(t, session.Messages, 2)
+	assert.Equal(t, "明天呢", session.Messages[0].Content)
+
+	history, err := c.History(ctx, "A0001")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, SummaryMessage("摘要x"), history[0])
+
+	// 滚动摘要带上旧摘要
+	require.NoError(t, c.Append(ctx, "A0001", "后天呢", "后天星期日，是周末"))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "摘要x", gotPrevious)
+
+	// 摘要失败时历史保持不变
+	failing := NewCompressor(store, func(ctx context.Context, sn, previous string, turns []Message) (string, error) {
+		return "", assert.AnError
+	}, 1, 0)
+	err = failing.Append(ctx, "A0001", "再见", "再见")
+	assert.ErrorIs(t, err, ErrCompress)
+	session, err = store.Load(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Equal(t, "摘要xx", session.Summary)
+	assert.Len(t, session.Messages, 4)
+
+	require.NoError(t, store.Clear(ctx, "A0001"))
+	session, err = store.Load(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Empty(t, session.Summary)
+	assert.Empty(t, session.Messages)
+}
+
+func TestCompressorKeepsTurnsBeyondMaxTurns(t *testing.T) {
+	// 保留轮次小于压缩前积累的轮次，较早的轮次须先进入摘要而不是被直接丢弃
+	store, _ := setupStore(t, Options{MaxTurns: 1, MaxTokens: 1000})
+	ctx := context.Background()
+
+	var gotTurns []Message
+	c := NewCompressor(store, func(ctx context.Context, sn, previous string, turns []Message) (string, error) {
+		gotTurns = turns
+		return "摘要", nil
+	}, 20, 1)
+
+	require.NoError(t, c.Append(ctx, "A0001", "你好", "你好呀"))
+	require.NoError(t, c.Append(ctx, "A0001", "今天星期几", "今天星期五"))
+	require.NoError(t, c.Append(ctx, "A0001", "明天呢", "明天星期六"))
+	assert.Equal(t, "用户：你好\n助手：你好呀\n用户：今天星期几\n助手：今天星期五\n", Transcript(gotTurns))
+
+	session, err := store.Load(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Equal(t, "摘要", session.Summary)
+	require.Len(t, session.Messages, 2)
+	assert.Equal(t, "明天呢", session.Messages[0].Content)
+}
+
+func TestCompactConcurrentAppend(t *testing.T) {
+	store, _ := setupStore(t, Options{MaxTurns: 10, MaxTokens: 1000})
+	ctx := context.Background()
+
+	// 摘要期间（LLM 调用中）追加的轮次在压缩后保留
+	c := NewCompressor(store, func(ctx context.Context, sn, previous string, turns []Message) (string, error) {
+		require.NoError(t, store.Append(ctx, sn, "插话", "好的"))
+		return "摘要", nil
+	}, 1, 0)
+	require.NoError(t, store.Append(ctx, "A0001", "今天星期几", "今天星期五"))
+	require.NoError(t, c.Append(ctx, "A0001", "明天呢", "明天星期六"))
+
+	session, err := store.Load(ctx, "A0001")
+	require.NoError(t, err)
+	assert.Equal(t, "摘要", session.Summary)
+	require.Len(t, session.Messages, 2)
+	assert.Equal(t, "插话", session.Messages[0].Content)
+}
+
+func TestCompactSessionChanged(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		modify func(store *RedisStore, sn string)
+		want   []string
+	}{
+		{
+			name: "cleared",
+			modify: func(store *RedisStore, sn string) {
+				require.NoError(t, store.Clear(ctx, sn))
+				require.NoError(t, store.Append(ctx, sn, "新的问题", "新的回答"))
+			},
+			want: []string{"新的问题", "新的回答"},
+		},
+		{
+			name: "trimmed",
+			modify: func(store *RedisStore, sn string) {
+				// 按保留轮次裁剪的追加删除了列表开头
+				require.NoError(t, store.Append(ctx, sn, "q3", "a3"))
+				require.NoError(t, store.Append(ctx, sn, "q4", "a4"))
+			},
+			want: []string{"q2", "a2", "q3", "a3", "q4", "a4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := setupStore(t, Options{MaxTurns: 3, MaxTokens: 1000})
+			c := NewCompressor(store, func(ctx context.Context, sn, previous string, turns []Message) (string, error) {
+				tt.modify(store, sn)
+				return "摘要", nil
+			}, 1, 0)
+			require.NoError(t, store.Append(ctx, "A0001", "q1", "a1"))
+			require.NoError(t, store.Append(ctx, "A0001", "q2", "a2"))
+
+			compressed, err := c.Compress(ctx, "A0001")
+			require.NoError(t, err)
+			assert.False(t, compressed)
+
+			// 摘要不写入，摘要期间的消息不被删除
+			session, err := store.Load(ctx, "A0001")
+			require.NoError(t, err)
+			assert.Empty(t, session.Summary)
+			var contents []string
+			for _, m := range session.Messages {
+				contents = append(contents, m.Content)
+			}
+			assert.Equal(t, tt.want, contents)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis 键前缀
+const (
+	keyPrefix        = "yunyez:session:" // 会话记忆，完整键为 yunyez:session:{sn}
+	summaryKeyPrefix = "yunyez:summary:" // 对话摘要，完整键为 yunyez:summary:{sn}
+)
+
+// RedisStore 基于 Redis List 的对话记忆，每个元素为一条 JSON 消息
+type RedisStore struct {
+	client redis.UniversalClient
+	opts   Options
+}
+
+// NewRedisStore 创建 Redis 对话记忆
+// 参数：
+//   - client: Redis 客户端
+//   - opts: 对话记忆配置
+//
+// 返回值:
+//   - *RedisStore: Redis 对话记忆
+func NewRedisStore(client redis.UniversalClient, opts Options) *RedisStore {
+	return &RedisStore{client: client, opts: opts.withDefaults()}
+}
+
+// key 设备的会话记忆键
+func key(sn string) string {
+	return keyPrefix + sn
+}
+
+// summaryKey 设备的对话摘要键
+func summaryKey(sn string) string {
+	return summaryKeyPrefix + sn
+}
+
+// History 读取设备的对话历史，读取即续期
+// 有对话摘要时以 system 消息放在最前，其余消息按扣除摘要后的预算裁剪
+func (s *RedisStore) History(ctx context.Context, sn string) ([]Message, error) {
+	session, err := s.Load(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	if session.Summary == "" {
+		return Trim(session.Messages, s.opts.MaxTokens), nil
+	}
+	summary := SummaryMessage(session.Summary)
+	messages := Trim(session.Messages, s.opts.MaxTokens-EstimateTokens(summary.Content))
+	return append([]Message{summary}, messages...), nil
+}
+
+// Load 读取设备未裁剪的对话摘要与全部消息，读取即续期
+func (s *RedisStore) Load(ctx context.Context, sn string) (*Session, error) {
+	k, sk := key(sn), summaryKey(sn)
+	var values *redis.StringSliceCmd
+	var summary *redis.StringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.LRange(ctx, k, 0, -1)
+		summary = pipe.Get(ctx, sk)
+		pipe.Expire(ctx, k, s.opts.TTL)
+		pipe.Expire(ctx, sk, s.opts.TTL)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("read session %s: %w", sn, err)
+	}
+
+	raw := values.Val()
+	session := &Session{
+		Summary:  summary.Val(),
+		Messages: make([]Message, 0, len(raw)),
+	}
+	for _, v := range raw {
+		var m Message
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			return nil, fmt.Errorf("unmarshal session %s message: %w", sn, err)
+		}
+		session.Messages = append(session.Messages, m)
+	}
+	return session, nil
+}
+
+// compactRetries 压缩写入与并发追加冲突时的重试次数
+const compactRetries = 3
+
+// Compact 保存新的对话摘要并删除已摘要的消息
+// 摘要期间会话可能被并发修改：追加只写在末尾，不影响删除；
+// 若列表开头已不是 dropped（被清空、被裁剪或已被其他压缩删除），返回 ErrSessionChanged 且不写入。
+// 通过 WATCH 保证检查与删除之间没有其他写入，冲突时重试
+func (s *RedisStore) Compact(ctx context.Context, sn string, dropped []Message, summary string) error {
+	k, sk := key(sn), summaryKey(sn)
+	compact := func(tx *redis.Tx) error {
+		if len(dropped) > 0 {
+			raw, err := tx.LRange(ctx, k, 0, int64(len(dropped))-1).Result()
+			if err != nil {
+				return err
+			}
+			if !sameMessages(raw, dropped) {
+				return ErrSessionChanged
+			}
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, sk, summary, s.opts.TTL)
+			if len(dropped) > 0 {
+				pipe.LTrim(ctx, k, int64(len(dropped)), -1)
+			}
+			pipe.Expire(ctx, k, s.opts.TTL)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < compactRetries; i++ {
+		if err = s.client.Watch(ctx, compact, k, sk); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("compact session %s: %w", sn, err)
+	}
+	return nil
+}
+
+// sameMessages 列表开头的原始消息是否与读取时一致
+func sameMessages(raw []string, messages []Message) bool {
+	if len(raw) != len(messages) {
+		return false
+	}
+	for i, v := range raw {
+		var m Message
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			return false
+		}
+		if m.Role != messages[i].Role || m.Content != messages[i].Content || !m.Timestamp.Equal(messages[i].Timestamp) {
+			return false
+		}
+	}
+	return true
+}
+
+// Append 追加一轮对话，只保留最近 MaxTurns 轮，同时续期对话摘要
+func (s *RedisStore) Append(ctx context.Context, sn, user, assistant string) error {
+	return s.appendTurn(ctx, sn, user, assistant, s.opts.MaxTurns)
+}
+
+// AppendUntrimmed 追加一轮对话，不丢弃较早的轮次，同时续期对话摘要
+// 供 Compressor 使用：较早的轮次经摘要后由 Compact 删除，长度由压缩阈值控制
+func (s *RedisStore) AppendUntrimmed(ctx context.Context, sn, user, assistant string) error {
+	return s.appendTurn(ctx, sn, user, assistant, 0)
+}
+
+// appendTurn 追加一轮对话，maxTurns > 0 时只保留最近 maxTurns 轮
+func (s *RedisStore) appendTurn(ctx context.Context, sn, user, assistant string, maxTurns int) error {
+	now := time.Now()
+	values := make([]any, 0, 2)
+	for _, m := range []Message{
+		{Role: RoleUser, Content: user, Timestamp: now},
+		{Role: RoleAssistant, Content: assistant, Timestamp: now},
+	} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("marshal session %s message: %w", sn, err)
+		}
+		values = append(values, data)
+	}
+
+	k := key(sn)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, k, values...)
+		if maxTurns > 0 {
+			pipe.LTrim(ctx, k, int64(-2*maxTurns), -1)
+		}
+		pipe.Expire(ctx, k, s.opts.TTL)
+		pipe.Expire(ctx, summaryKey(sn), s.opts.TTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("append session %s: %w", sn, err)
+	}
+	return nil
+}
+
+// Clear 清空设备的对话历史
+func (s *RedisStore) Clear(ctx context.Context, sn string) error {
+	if err := s.client.Del(ctx, key(sn), summaryKey(sn)).Err(); err != nil {
+		return fmt.Errorf("clear session %s: %w", sn, err)
+	}
+	return nil
+}
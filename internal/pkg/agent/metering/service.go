@@ -9,9 +9,7 @@ import (
 )
 
 var (
-	once          sync.Once
-
-	dbClient = postgre.GetClient()
+	once sync.Once
 )
 
 // MeteringService 成本计算服务
@@ -32,7 +30,7 @@ func Initialize(rules map[string]PricingRule) *MeteringService {
 	var ms *MeteringService
 	once.Do(func() {
 		calculator := NewStandardCostCalculator(rules)
-		repo := NewPostgreCostRepository(dbClient)
+		repo := NewPostgreCostRepository(postgre.GetClient())
 		ms = &MeteringService{
 			calculator: calculator,
 			repo:       repo,
@@ -40,6 +40,8 @@ type Intent struct {
 	Intent     string  `json:"intent"`     // 意图
 	Confidence float32 `json:"confidence"` // 置信度
 	IsCommand  bool    `json:"is_command"` // 是否为命令意图
+	// Entities 实体（如 song、temperature），目前仅 HTTP 服务返回
+	Entities map[string]string `json:"entities,omitempty"`
 }
 
 // Emotion 情感识别结果
@@ -73,24 +75,31 @@ type GRPCClient struct {
 // NewClient 创建 NLU 客户端
 func NewClient(cfg Config) Client {
 	once.Do(func() {
-		client := Client{
-			Protocol:     cfg.Protocol,
-			httpEndpoint: cfg.HTTPEndpoint,
+		client, err := New(cfg)
+		if err != nil {
+			panic(fmt.Sprintf("create gRPC client failed: %v", err))
 		}
-		
-		if cfg.Protocol == ProtocolGRPC {
-			grpcClient, err := newGRPCClient(cfg.GRPCEndpoint)
-			if err != nil {
-				panic(fmt.Sprintf("create gRPC client failed: %v", err))
-			}
-			client.grpcClient = grpcClient
-		}
-		
-		NLUClient = client
+		NLUClient = *client
 	})
 	return NLUClient
 }
 
+// New 创建独立的 NLU 客户端，不共享全局客户端，用于同时连接多个 NLU 服务（如 gRPC 与 HTTP 互为备份）
+func New(cfg Config) (*Client, error) {
+	client := &Client{
+		Protocol:     cfg.Protocol,
+		httpEndpoint: cfg.HTTPEndpoint,
+	}
+	if cfg.Protocol == ProtocolGRPC {
+		grpcClient, err := newGRPCClient(cfg.GRPCEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		client.grpcClient = grpcClient
+	}
+	return client, nil
+}
+
 // newGRPCClient 创建 gRPC 客户端
 func newGRPCClient(endpoint string) (*GRPCClient, error) {
 	conn, err := grpc.NewClient(endpoint,
@@ -116,15 +125,20 @@ func (c *Client) Close() error {
 
 // Health 检查 NLU 服务健康状态
 func (c *Client) Health() error {
+	return c.HealthContext(context.Background())
+}
+
+// HealthContext 检查 NLU 服务健康状态，ctx 取消时中止
+func (c *Client) HealthContext(ctx context.Context) error {
 	if c.Protocol == ProtocolGRPC {
-		return c.healthGRPC()
+		return c.healthGRPC(ctx)
 	}
-	return c.healthHTTP()
+	return c.healthHTTP(ctx)
 }
 
 // healthHTTP HTTP 方式健康检查
-func (c *Client) healthHTTP() error {
-	httpReq, err := http.NewRequest("GET", c.httpEndpoint+"/health", nil)
+func (c *Client) healthHTTP(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.httpEndpoint+"/health", nil)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
@@ -144,8 +158,8 @@ func (c *Client) healthHTTP() error {
 }
 
 // healthGRPC gRPC 方式健康检查
-func (c *Client) healthGRPC() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (c *Client) healthGRPC(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	resp, err := c.grpcClient.client.Health(ctx, &pbCommon.HealthRequest{})
@@ -162,21 +176,26 @@ func (c *Client) healthGRPC() error {
 
 // Predict 意图识别
 func (c *Client) Predict(input *Input) (*Intent, error) {
+	return c.PredictContext(context.Background(), input)
+}
+
+// PredictContext 意图识别，ctx 取消或超时时中止
+func (c *Client) PredictContext(ctx context.Context, input *Input) (*Intent, error) {
 	if c.Protocol == ProtocolGRPC {
-		return c.predictGRPC(input)
+		return c.predictGRPC(ctx, input)
 	}
-	return c.predictHTTP(input)
+	return c.predictHTTP(ctx, input)
 }
 
 // predictHTTP HTTP 方式意图识别
-func (c *Client) predictHTTP(input *Input) (*Intent, error) {
+func (c *Client) predictHTTP(ctx context.Context, input *Input) (*Intent, error) {
 	reqBody := Input{Text: input.Text}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.httpEndpoint, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.httpEndpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -202,8 +221,8 @@ func (c *Client) predictHTTP(input *Input) (*Intent, error) {
 }
 
 // predictGRPC gRPC 方式意图识别
-func (c *Client) predictGRPC(input *Input) (*Intent, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (c *Client) predictGRPC(ctx context.Context, input *Input) (*Intent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	resp, err := c.grpcClient.client.Predict(ctx, &pb.PredictRequest{
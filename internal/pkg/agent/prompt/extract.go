@@ -0,0 +1,120 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"yunyez/internal/pkg/agent/memory"
+)
+
+// 事实提取限制
+const (
+	MaxFactsPerTurn = 5   // 单轮最多记住的事实数
+	MaxFactValueLen = 100 // 事实内容最大字符数
+	MaxFacts        = 50  // 每台设备最多记住的事实数，超出时淘汰最早的 LLM 提取的事实
+	MaxFactTokens   = 300 // 系统提示词中事实的 Token 预算
+)
+
+var ErrInvalidFacts = errors.New("invalid extracted facts")
+
+// regFactKey 事实键：小写字母开头，小写字母、数字与下划线，最长 32 个字符
+var regFactKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// factCues 可能包含需要记住的信息的表达，命中时才调用 LLM 提取，避免每轮都产生额外成本
+var factCues = []string{
+	"我叫", "我的名字", "叫我", "我是", "我姓",
+	"我喜欢", "我不喜欢", "我爱", "我讨厌", "我习惯", "我一般", "我通常", "我每天",
+	"我更喜欢", "我偏好", "我住在", "我家",
+	"记住", "别忘了", "以后",
+	"my name", "call me", "i prefer", "i like", "remember",
+}
+
+// extractTemplate 事实提取提示词
+const extractTemplate = `从用户的话中提取值得长期记住的关于用户本人的事实（如姓名、称呼、偏好、习惯、家庭成员、住址城市），忽略一次性的请求和闲聊。
+已知事实：
+%s
+用户说：%s
+
+只输出 JSON 数组，元素格式为 {"key": "英文小写下划线键名", "value": "简短的中文内容"}，与已知事实相同的键表示更新。没有需要记住的事实时输出 []。`
+
+// MayContainFacts 用户文本是否可能包含需要记住的事实
+func MayContainFacts(text string) bool {
+	text = strings.ToLower(text)
+	for _, cue := range factCues {
+		if strings.Contains(text, cue) {
+			return true
+		}
+	}
+	return false
+}
+
+// FactTokens 事实在系统提示词中占用的 Token 数估算
+func FactTokens(f Fact) int {
+	return memory.EstimateTokens("- " + f.Key + "：" + f.Value + "\n")
+}
+
+// ExtractPrompt 构建事实提取提示词
+// 参数：
+//   - text: 用户文本
+//   - known: 已知事实，便于 LLM 更新而不是重复
+//
+// 返回值:
+//   - string: 提取提示词
+func ExtractPrompt(text string, known []Fact) string {
+	var b strings.Builder
+	if len(known) == 0 {
+		b.WriteString("无")
+	}
+	for i, f := range known {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "- %s：%s", f.Key, f.Value)
+	}
+	return fmt.Sprintf(extractTemplate, b.String(), text)
+}
+
+// ParseFacts 解析 LLM 返回的事实
+// 容忍 JSON 前后的说明文字与代码块标记；键不合法、内容为空或过长的事实被丢弃，
+// 最多返回 MaxFactsPerTurn 条
+// 参数：
+//   - reply: LLM 回复
+//
+// 返回值:
+//   - []Fact: 事实
+//   - error: 回复中没有合法的 JSON 数组时返回 ErrInvalidFacts
+func ParseFacts(reply string) ([]Fact, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("%w: no json array in %q", ErrInvalidFacts, reply)
+	}
+	var raw []Fact
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFacts, err)
+	}
+
+	facts := make([]Fact, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for _, f := range raw {
+		f.Key = strings.ToLower(strings.TrimSpace(f.Key))
+		f.Value = strings.TrimSpace(f.Value)
+		if !ValidFact(f) || seen[f.Key] {
+			continue
+		}
+		seen[f.Key] = true
+		facts = append(facts, f)
+		if len(facts) == MaxFactsPerTurn {
+			break
+		}
+	}
+	return facts, nil
+}
+
+// ValidFact 事实的键与内容是否合法
+func ValidFact(f Fact) bool {
+	return regFactKey.MatchString(f.Key) && f.Value != "" && utf8.RuneCountInString(f.Value) <= MaxFactValueLen
+}
@@ -0,0 +1,142 @@
+// Package prompt 系统提示词模板
+// 系统提示词由模板渲染，注入设备上下文、用户画像与需要长期记住的事实，
+// 模板语法为 text/template，可按厂商、设备类型、设备逐级覆盖
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultLanguage 默认语言
+const DefaultLanguage = "zh-CN"
+
+// DefaultSystemTemplate 默认系统提示词模板
+const DefaultSystemTemplate = `你是一个智能语音助手，请用简洁的纯中文回答问题。不要使用任何 Markdown 格式（如 **加粗**、### 标题、代码块等），不要包含特殊符号，只输出自然语言文本。
+{{- if .DeviceName}}
+你的名字是{{.DeviceName}}。
+{{- end}}
+当前时间：{{.Now.Format "2006年1月2日 15:04"}}，{{weekday .Now}}。
+{{- if .Weather}}
+当前天气：{{.Weather}}。
+{{- end}}
+{{- if .UserName}}
+用户的称呼是{{.UserName}}。
+{{- end}}
+{{- if .Location}}
+设备位于{{.Location}}。
+{{- end}}
+{{- if and .Language (ne .Language "zh-CN")}}
+请使用用户的语言（{{.Language}}）回答。
+{{- end}}
+{{- if .Facts}}
+关于用户，你已经知道：
+{{- range .Facts}}
+- {{.Key}}：{{.Value}}
+{{- end}}
+{{- end}}`
+
+// Fact 需要长期记住的事实
+type Fact struct {
+	Key   string `json:"key"`   // 事实键，如 name、temperature_unit
+	Value string `json:"value"` // 事实内容
+}
+
+// Data 模板数据
+type Data struct {
+	SN           string    // 设备序列号
+	Vendor       string    // 厂商名称
+	DeviceType   string    // 设备类型
+	ProductModel string    // 产品型号
+	DeviceName   string    // 设备名称，即助手的名字
+	UserName     string    // 用户称呼
+	Location     string    // 设备位置
+	Timezone     string    // 时区（IANA 名称），为空或无法识别时使用服务器时区
+	Language     string    // 语言
+	Weather      string    // 当前天气，暂无天气数据源，为空时模板不展示
+	Facts        []Fact    // 需要长期记住的事实
+	Now          time.Time // 当前时间，为空时取渲染时间，按 Timezone 转换
+}
+
+// weekdays 星期的中文名称
+var weekdays = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// funcs 模板函数
+var funcs = template.FuncMap{
+	"weekday": func(t time.Time) string { return weekdays[t.Weekday()] },
+	"join":    strings.Join,
+}
+
+// Template 系统提示词模板
+type Template struct {
+	tmpl *template.Template
+	text string
+}
+
+// Parse 解析系统提示词模板
+// 参数：
+//   - name: 模板名称，用于错误信息
+//   - text: 模板内容
+//
+// 返回值:
+//   - *Template: 系统提示词模板
+//   - error: 模板语法错误时返回错误
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt template %s: %w", name, err)
+	}
+	return &Template{tmpl: tmpl, text: text}, nil
+}
+
+// MustParse 解析系统提示词模板，语法错误时 panic，用于内置模板
+func MustParse(name, text string) *Template {
+	t, err := Parse(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Default 默认系统提示词模板
+var Default = MustParse("default", DefaultSystemTemplate)
+
+// Name 模板名称
+func (t *Template) Name() string {
+	return t.tmpl.Name()
+}
+
+// Text 模板内容
+func (t *Template) Text() string {
+	return t.text
+}
+
+// Render 渲染系统提示词
+// 参数：
+//   - data: 模板数据
+//
+// 返回值:
+//   - string: 系统提示词
+//   - error: 渲染失败时返回错误
+func (t *Template) Render(data Data) (string, error) {
+	if data.Now.IsZero() {
+		data.Now = time.Now()
+	}
+	if data.Timezone != "" {
+		if loc, err := time.LoadLocation(data.Timezone); err == nil {
+			data.Now = data.Now.In(loc)
+		}
+	}
+	if data.Language == "" {
+		data.Language = DefaultLanguage
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render prompt template %s: %w", t.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
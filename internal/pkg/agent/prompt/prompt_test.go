@@ -0,0 +1,129 @@
+// 测试系统提示词渲染、覆盖模板查找与事实提取结果解析
+package prompt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderDefault(t *testing.T) {
+	now := time.Date(2026, 10, 16, 1, 30, 0, 0, time.UTC)
+	got, err := Default.Render(Data{
+		UserName: "小明",
+		Location: "客厅",
+		Timezone: "Asia/Shanghai",
+		Facts:    []Fact{{Key: "temperature_unit", Value: "摄氏度"}},
+		Now:      now,
+	})
+	require.NoError(t, err)
+	assert.Contains(t, got, "2026年10月16日 09:30，星期五")
+	assert.Contains(t, got, "用户的称呼是小明")
+	assert.Contains(t, got, "设备位于客厅")
+	assert.Contains(t, got, "- temperature_unit：摄氏度")
+	assert.NotContains(t, got, "请使用用户的语言")
+
+	// 没有画像时只有基础提示与时间
+	got, err = Default.Render(Data{Now: now, Language: "en-US"})
+	require.NoError(t, err)
+	assert.NotContains(t, got, "用户的称呼")
+	assert.NotContains(t, got, "你已经知道")
+	assert.Contains(t, got, "请使用用户的语言（en-US）回答")
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse("bad", "{{.UserName")
+	assert.Error(t, err)
+
+	tmpl, err := Parse("custom", "{{.Vendor}}/{{.DeviceType}}/{{.SN}} {{.Unknown}}")
+	require.NoError(t, err)
+	_, err = tmpl.Render(Data{Vendor: "v", DeviceType: "t", SN: "s"})
+	assert.Error(t, err, "unknown fields are template errors")
+}
+
+func TestParseFacts(t *testing.T) {
+	facts, err := ParseFacts("好的：\n```json\n[{\"key\":\"Name\",\"value\":\" 小明 \"},{\"key\":\"bad key\",\"value\":\"x\"},{\"key\":\"name\",\"value\":\"重复\"},{\"key\":\"hobby\",\"value\":\"\"}]\n```")
+	require.NoError(t, err)
+	assert.Equal(t, []Fact{{Key: "name", Value: "小明"}}, facts)
+
+	facts, err = ParseFacts("[]")
+	require.NoError(t, err)
+	assert.Empty(t, facts)
+
+	_, err = ParseFacts("没有需要记住的")
+	assert.ErrorIs(t, err, ErrInvalidFacts)
+
+	long := `[{"key":"note","value":"` + strings.Repeat("长", MaxFactValueLen+1) + `"}]`
+	facts, err = ParseFacts(long)
+	require.NoError(t, err)
+	assert.Empty(t, facts)
+}
+
+func TestMayContainFacts(t *testing.T) {
+	assert.True(t, MayContainFacts("我叫小明"))
+	assert.True(t, MayContainFacts("Call me Bob"))
+	assert.False(t, MayContainFacts("今天天气怎么样"))
+}
+
+func TestExtractPrompt(t *testing.T) {
+	p := ExtractPrompt("我喜欢听周杰伦", []Fact{{Key: "name", Value: "小明"}})
+	assert.Contains(t, p, "- name：小明")
+	assert.Contains(t, p, "用户说：我喜欢听周杰伦")
+}
+
+func TestRenderDeviceNameWeather(t *testing.T) {
+	got, err := Default.Render(Data{DeviceName: "小云", Weather: "晴，22℃"})
+	require.NoError(t, err)
+	assert.Contains(t, got, "你的名字是小云。\n当前时间：")
+	assert.Contains(t, got, "当前天气：晴，22℃。")
+
+	got, err = Default.Render(Data{})
+	require.NoError(t, err)
+	assert.NotContains(t, got, "你的名字")
+	assert.NotContains(t, got, "当前天气")
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+	_, ok := r.Resolve(Data{SN: "sn1", Vendor: "yunyez"})
+	assert.False(t, ok, "empty registry has no overrides")
+
+	n, err := r.Replace([]Entry{
+		{Scope: ScopeVendor, Target: "yunyez", Text: "vendor"},
+		{Scope: ScopeDeviceType, Target: "kids", Text: "kids"},
+		{Scope: ScopeDevice, Target: "sn1", Text: "device"},
+		{Scope: ScopeDevice, Target: "sn2", Text: "{{.UserName"},
+		{Scope: "user", Target: "u1", Text: "unknown scope"},
+	})
+	assert.Equal(t, 3, n)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	assert.Equal(t, 3, r.Len())
+
+	for _, tc := range []struct {
+		data Data
+		want string
+	}{
+		{Data{SN: "sn1", DeviceType: "kids", Vendor: "yunyez"}, "device"},
+		{Data{SN: "sn3", DeviceType: "kids", Vendor: "yunyez"}, "kids"},
+		{Data{SN: "sn3", DeviceType: "speaker", Vendor: "yunyez"}, "vendor"},
+		{Data{SN: "sn2", Vendor: "yunyez"}, "vendor"}, // 非法的设备模板被跳过
+	} {
+		tmpl, ok := r.Resolve(tc.data)
+		require.True(t, ok)
+		assert.Equal(t, tc.want, tmpl.Text())
+	}
+	_, ok = r.Resolve(Data{SN: "sn3", Vendor: "public"})
+	assert.False(t, ok)
+
+	// 整体替换，删除的模板不再生效
+	_, err = r.Replace([]Entry{{Scope: ScopeDeviceType, Target: "kids", Text: "kids v2"}})
+	require.NoError(t, err)
+	tmpl, ok := r.Resolve(Data{SN: "sn1", DeviceType: "kids", Vendor: "yunyez"})
+	require.True(t, ok)
+	assert.Equal(t, "kids v2", tmpl.Text())
+	_, ok = r.Resolve(Data{Vendor: "yunyez"})
+	assert.False(t, ok)
+}
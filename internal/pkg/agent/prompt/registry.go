@@ -0,0 +1,114 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Scope 模板覆盖范围，按 厂商 → 设备类型 → 设备 逐级覆盖
+type Scope string
+
+const (
+	ScopeVendor     Scope = "vendor"      // 厂商，目标为厂商名称
+	ScopeDeviceType Scope = "device_type" // 设备类型，目标为设备类型
+	ScopeDevice     Scope = "device"      // 单台设备，目标为设备序列号
+)
+
+var ErrInvalidScope = errors.New("invalid prompt template scope")
+
+// ValidScope 覆盖范围是否合法
+func ValidScope(s Scope) bool {
+	switch s {
+	case ScopeVendor, ScopeDeviceType, ScopeDevice:
+		return true
+	}
+	return false
+}
+
+// Entry 覆盖模板
+type Entry struct {
+	Scope  Scope  // 覆盖范围
+	Target string // 覆盖目标：厂商名称、设备类型或设备序列号
+	Text   string // 模板内容
+}
+
+// key 覆盖模板的索引键
+type key struct {
+	scope  Scope
+	target string
+}
+
+// Registry 覆盖模板注册表
+// 按设备、设备类型、厂商的顺序查找最具体的模板，整体替换以支持热更新，并发安全
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[key]*Template
+}
+
+// NewRegistry 创建空的覆盖模板注册表
+func NewRegistry() *Registry {
+	return &Registry{templates: make(map[key]*Template)}
+}
+
+// Replace 解析并整体替换覆盖模板
+// 解析失败的模板被跳过，其余模板照常生效
+// 参数：
+//   - entries: 覆盖模板
+//
+// 返回值:
+//   - int: 生效的模板数
+//   - error: 存在非法模板时返回所有解析错误
+func (r *Registry) Replace(entries []Entry) (int, error) {
+	templates := make(map[key]*Template, len(entries))
+	var errs []error
+	for _, e := range entries {
+		if !ValidScope(e.Scope) || e.Target == "" {
+			errs = append(errs, fmt.Errorf("%w: %q/%q", ErrInvalidScope, e.Scope, e.Target))
+			continue
+		}
+		t, err := Parse(fmt.Sprintf("%s:%s", e.Scope, e.Target), e.Text)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		templates[key{e.Scope, e.Target}] = t
+	}
+
+	r.mu.Lock()
+	r.templates = templates
+	r.mu.Unlock()
+	return len(templates), errors.Join(errs...)
+}
+
+// Resolve 查找设备适用的覆盖模板
+// 参数：
+//   - data: 模板数据，使用其中的设备序列号、设备类型与厂商
+//
+// 返回值:
+//   - *Template: 最具体的覆盖模板
+//   - bool: 没有覆盖模板时返回 false，由调用方使用默认模板
+func (r *Registry) Resolve(data Data) (*Template, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range []key{
+		{ScopeDevice, data.SN},
+		{ScopeDeviceType, data.DeviceType},
+		{ScopeVendor, data.Vendor},
+	} {
+		if k.target == "" {
+			continue
+		}
+		if t, ok := r.templates[k]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Len 生效的覆盖模板数
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.templates)
+}
@@ -0,0 +1,178 @@
+// Package resilience AI 依赖的容错：按顺序降级的提供方链、熔断器、健康检查与单次调用超时
+// 不依赖全局配置，由语音处理流程按配置组装
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// 熔断器默认参数
+const (
+	DefaultWindow      = 20               // 统计最近的调用次数
+	DefaultMinRequests = 5                // 窗口内至少多少次调用才判断失败率
+	DefaultFailureRate = 0.5              // 失败率阈值
+	DefaultOpenTimeout = 30 * time.Second // 熔断持续时间
+)
+
+// State 熔断器状态
+type State string
+
+const (
+	StateClosed   State = "closed"    // 正常放行
+	StateOpen     State = "open"      // 熔断，拒绝调用
+	StateHalfOpen State = "half_open" // 熔断到期，放行一次试探调用
+)
+
+// ErrOpen 熔断器处于熔断状态
+var ErrOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	Window      int           // 统计最近多少次调用，<= 0 时使用 DefaultWindow
+	MinRequests int           // 窗口内至少多少次调用才判断失败率，<= 0 时使用 DefaultMinRequests
+	FailureRate float64       // 失败率阈值 (0, 1]，慢调用计为失败，<= 0 时使用 DefaultFailureRate
+	SlowCall    time.Duration // 超过该耗时的调用计为失败，<= 0 时不判断耗时
+	OpenTimeout time.Duration // 熔断后多久放行试探调用，<= 0 时使用 DefaultOpenTimeout
+}
+
+// Breaker 按错误率与耗时熔断的熔断器
+// 窗口内失败（含慢调用）比例达到阈值时熔断，熔断到期后放行一次试探调用，
+// 试探成功恢复放行，失败继续熔断
+type Breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	outcomes []bool // 环形窗口，true 为失败
+	next     int
+	count    int
+	failures int
+	openedAt time.Time
+	probing  bool // 半开状态下试探调用进行中
+}
+
+// NewBreaker 创建熔断器
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultMinRequests
+	}
+	if cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = cfg.Window
+	}
+	if cfg.FailureRate <= 0 || cfg.FailureRate > 1 {
+		cfg.FailureRate = DefaultFailureRate
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultOpenTimeout
+	}
+	return &Breaker{
+		cfg:      cfg,
+		now:      time.Now,
+		state:    StateClosed,
+		outcomes: make([]bool, cfg.Window),
+	}
+}
+
+// Allow 判断能否调用，放行后须以 Record 或 Release 结束
+// 返回值:
+//   - error: 熔断中或试探调用进行中时返回 ErrOpen
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record 记录一次调用的结果
+// 参数：
+//   - err: 调用的错误，nil 为成功
+//   - latency: 调用耗时
+func (b *Breaker) Record(err error, latency time.Duration) {
+	failed := err != nil || (b.cfg.SlowCall > 0 && latency > b.cfg.SlowCall)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.state = StateClosed
+		b.reset()
+	case StateClosed:
+		if b.count == len(b.outcomes) && b.outcomes[b.next] {
+			b.failures--
+		}
+		b.outcomes[b.next] = failed
+		b.next = (b.next + 1) % len(b.outcomes)
+		if b.count < len(b.outcomes) {
+			b.count++
+		}
+		if failed {
+			b.failures++
+		}
+		if b.count >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.FailureRate*float64(b.count) {
+			b.open()
+		}
+	}
+	// 熔断中返回的调用结果不影响状态
+}
+
+// Release 结束一次不计入统计的调用，如调用方主动取消
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+// State 当前状态，熔断到期但尚未试探时仍为 StateOpen
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Counts 窗口内的调用次数与失败次数
+func (b *Breaker) Counts() (requests, failures int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count, b.failures
+}
+
+// open 进入熔断状态，调用方持有锁
+func (b *Breaker) open() {
+	b.state = StateOpen
+	b.openedAt = b.now()
+	b.reset()
+}
+
+// reset 清空统计窗口，调用方持有锁
+func (b *Breaker) reset() {
+	clear(b.outcomes)
+	b.next, b.count, b.failures = 0, 0, 0
+}
@@ -0,0 +1,271 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultProbeTimeout 单次健康检查的超时
+const DefaultProbeTimeout = 3 * time.Second
+
+var (
+	ErrUnhealthy   = errors.New("provider is unhealthy")
+	ErrUnavailable = errors.New("no provider available")
+)
+
+// ProbeFunc 健康检查，返回 nil 为健康
+type ProbeFunc func(ctx context.Context) error
+
+// Provider 一个能力的提供方，如 gRPC ASR、HTTP ASR
+type Provider[T any] struct {
+	Name    string        // 提供方名称，用于日志与状态
+	Client  T             // 客户端
+	Timeout time.Duration // 单次调用的超时，<= 0 时不限制
+	Probe   ProbeFunc     // 健康检查，nil 时视为一直健康
+
+	breaker *Breaker
+
+	mu        sync.Mutex
+	healthy   bool
+	lastCheck time.Time
+	lastError string // 最近一次调用或健康检查的错误
+}
+
+// NewProvider 创建提供方
+// 参数：
+//   - name: 提供方名称
+//   - client: 客户端
+//   - timeout: 单次调用的超时，<= 0 时不限制
+//   - probe: 健康检查，nil 时视为一直健康
+//
+// 返回值:
+//   - *Provider[T]: 提供方，加入链时创建熔断器
+func NewProvider[T any](name string, client T, timeout time.Duration, probe ProbeFunc) *Provider[T] {
+	return &Provider[T]{Name: name, Client: client, Timeout: timeout, Probe: probe, healthy: true}
+}
+
+// Acquire 判断当前能否调用：健康检查通过且熔断器放行
+// 放行后须以 Done 结束
+// 返回值:
+//   - error: 不健康时返回 ErrUnhealthy，熔断时返回 ErrOpen
+func (p *Provider[T]) Acquire() error {
+	p.mu.Lock()
+	healthy := p.healthy
+	p.mu.Unlock()
+	if !healthy {
+		return ErrUnhealthy
+	}
+	return p.breaker.Allow()
+}
+
+// Done 记录一次调用的结果
+// 调用方（ctx）已取消时不计入熔断统计，单次调用超时计为失败
+// 参数：
+//   - ctx: 调用方的上下文，不是单次调用的超时上下文
+//   - err: 调用的错误，nil 为成功
+//   - latency: 调用耗时
+func (p *Provider[T]) Done(ctx context.Context, err error, latency time.Duration) {
+	if ctx.Err() != nil {
+		p.breaker.Release()
+		return
+	}
+	p.breaker.Record(err, latency)
+	if err != nil {
+		p.mu.Lock()
+		p.lastError = err.Error()
+		p.mu.Unlock()
+	}
+}
+
+// WithTimeout 单次调用的超时上下文
+func (p *Provider[T]) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, p.Timeout, fmt.Errorf("%s: call not finished in %s", p.Name, p.Timeout))
+}
+
+// check 执行一次健康检查
+func (p *Provider[T]) check(ctx context.Context) {
+	if p.Probe == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultProbeTimeout)
+	defer cancel()
+	err := p.Probe(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.healthy = err == nil
+	p.lastCheck = time.Now()
+	if err != nil {
+		p.lastError = err.Error()
+	}
+}
+
+// Status 提供方状态
+type Status struct {
+	Name      string    `json:"name"`                // 提供方名称
+	Healthy   bool      `json:"healthy"`             // 最近一次健康检查是否通过
+	State     State     `json:"state"`               // 熔断器状态
+	Requests  int       `json:"requests"`            // 统计窗口内的调用次数
+	Failures  int       `json:"failures"`            // 统计窗口内的失败次数（含慢调用）
+	LastError string    `json:"lastError,omitempty"` // 最近一次错误
+	LastCheck time.Time `json:"lastCheck,omitzero"`  // 最近一次健康检查时间，没有健康检查时为空
+}
+
+// Status 当前状态
+func (p *Provider[T]) Status() Status {
+	requests, failures := p.breaker.Counts()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Status{
+		Name:      p.Name,
+		Healthy:   p.healthy,
+		State:     p.breaker.State(),
+		Requests:  requests,
+		Failures:  failures,
+		LastError: p.lastError,
+		LastCheck: p.lastCheck,
+	}
+}
+
+// ChainStatus 能力的提供方链状态
+type ChainStatus struct {
+	Capability string   `json:"capability"` // 能力名称，如 asr、tts
+	Providers  []Status `json:"providers"`  // 按降级顺序的提供方状态
+}
+
+// Monitor 可查询状态与执行健康检查的提供方链，与客户端类型无关
+type Monitor interface {
+	// Status 提供方链状态
+	Status() ChainStatus
+	// Check 对所有提供方执行一次健康检查
+	Check(ctx context.Context)
+}
+
+// Chain 按顺序降级的提供方链
+// 依次调用健康且未熔断的提供方，直到一个成功
+type Chain[T any] struct {
+	capability string
+	providers  []*Provider[T]
+}
+
+// NewChain 创建提供方链，每个提供方使用独立的熔断器
+// 参数：
+//   - capability: 能力名称，如 asr、tts
+//   - cfg: 熔断器配置
+//   - providers: 按降级顺序的提供方
+//
+// 返回值:
+//   - *Chain[T]: 提供方链
+func NewChain[T any](capability string, cfg BreakerConfig, providers ...*Provider[T]) *Chain[T] {
+	for _, p := range providers {
+		p.breaker = NewBreaker(cfg)
+	}
+	return &Chain[T]{capability: capability, providers: providers}
+}
+
+// Len 提供方数量，nil 时为 0
+func (c *Chain[T]) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.providers)
+}
+
+// Providers 按降级顺序的提供方，用于需要自行判断结果的调用（如流式会话）
+func (c *Chain[T]) Providers() []*Provider[T] {
+	return c.providers
+}
+
+// Do 按顺序调用提供方直到一个成功
+// 每次调用使用提供方的超时；调用方取消时不再降级
+// 参数：
+//   - ctx: 调用方的上下文
+//   - fn: 使用客户端的调用
+//
+// 返回值:
+//   - error: 所有提供方都失败或不可用时返回包装 ErrUnavailable 的错误，调用方取消时返回 ctx 的错误
+func (c *Chain[T]) Do(ctx context.Context, fn func(ctx context.Context, client T) error) error {
+	var errs []error
+	for _, p := range c.providers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.Acquire(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		callCtx, cancel := p.WithTimeout(ctx)
+		start := time.Now()
+		err := fn(callCtx, p.Client)
+		if err != nil && callCtx.Err() != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%w: %w", err, context.Cause(callCtx))
+		}
+		cancel()
+		p.Done(ctx, err, time.Since(start))
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+	return c.Unavailable(errs...)
+}
+
+// Unavailable 所有提供方都失败或不可用的错误
+func (c *Chain[T]) Unavailable(errs ...error) error {
+	return fmt.Errorf("%w: %s: %w", ErrUnavailable, c.capability, errors.Join(errs...))
+}
+
+// Check 对所有提供方执行一次健康检查
+func (c *Chain[T]) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range c.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.check(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Status 提供方链状态
+func (c *Chain[T]) Status() ChainStatus {
+	s := ChainStatus{Capability: c.capability, Providers: make([]Status, 0, len(c.providers))}
+	for _, p := range c.providers {
+		s.Providers = append(s.Providers, p.Status())
+	}
+	return s
+}
+
+// Watch 定时对提供方链执行健康检查，直到 ctx 取消
+// 参数：
+//   - ctx: 上下文，取消时停止
+//   - interval: 检查间隔
+//   - monitors: 提供方链
+func Watch(ctx context.Context, interval time.Duration, monitors ...Monitor) {
+	check := func() {
+		for _, m := range monitors {
+			m.Check(ctx)
+		}
+	}
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
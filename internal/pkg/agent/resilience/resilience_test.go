@@ -0,0 +1,206 @@
+// 测试熔断器状态转换与提供方链的降级、超时和健康检查
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errCall = errors.New("call failed")
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestBreaker(cfg BreakerConfig) (*Breaker, *fakeClock) {
+	b := NewBreaker(cfg)
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b.now = clock.now
+	return b, clock
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	b, clock := newTestBreaker(BreakerConfig{Window: 4, MinRequests: 4, FailureRate: 0.5, OpenTimeout: time.Second})
+
+	for _, err := range []error{nil, errCall, nil} {
+		require.NoError(t, b.Allow())
+		b.Record(err, 0)
+	}
+	assert.Equal(t, StateClosed, b.State(), "below min requests")
+
+	require.NoError(t, b.Allow())
+	b.Record(errCall, 0)
+	assert.Equal(t, StateOpen, b.State(), "2 of 4 failed")
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+
+	// 熔断到期，只放行一次试探调用
+	clock.t = clock.t.Add(time.Second)
+	require.NoError(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+
+	b.Record(errCall, 0)
+	assert.Equal(t, StateOpen, b.State(), "trial failed")
+
+	clock.t = clock.t.Add(time.Second)
+	require.NoError(t, b.Allow())
+	b.Record(nil, 0)
+	assert.Equal(t, StateClosed, b.State(), "trial succeeded")
+	requests, failures := b.Counts()
+	assert.Zero(t, requests)
+	assert.Zero(t, failures)
+}
+
+func TestBreakerWindow(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{Window: 4, MinRequests: 2, FailureRate: 0.75})
+	for _, err := range []error{nil, errCall, nil, nil, nil, nil} {
+		b.Record(err, 0)
+	}
+	requests, failures := b.Counts()
+	assert.Equal(t, 4, requests)
+	assert.Zero(t, failures, "old failures slide out of the window")
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerSlowCall(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{Window: 2, MinRequests: 2, FailureRate: 1, SlowCall: 100 * time.Millisecond})
+	b.Record(nil, 200*time.Millisecond)
+	b.Record(nil, 50*time.Millisecond)
+	assert.Equal(t, StateClosed, b.State())
+	b.Record(nil, 200*time.Millisecond)
+	assert.Equal(t, StateClosed, b.State())
+	b.Record(nil, 300*time.Millisecond)
+	assert.Equal(t, StateOpen, b.State(), "every call in the window is slow")
+}
+
+func TestBreakerRelease(t *testing.T) {
+	b, clock := newTestBreaker(BreakerConfig{Window: 1, MinRequests: 1, OpenTimeout: time.Second})
+	b.Record(errCall, 0)
+	clock.t = clock.t.Add(time.Second)
+	require.NoError(t, b.Allow())
+	b.Release()
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.NoError(t, b.Allow(), "the released trial lets the next call through")
+}
+
+func TestChainFallback(t *testing.T) {
+	cfg := BreakerConfig{Window: 2, MinRequests: 2, FailureRate: 1}
+	grpc := NewProvider("grpc", "grpc", 0, nil)
+	http := NewProvider("http", "http", 0, nil)
+	chain := NewChain("asr", cfg, grpc, http)
+
+	var called []string
+	call := func(ctx context.Context, client string) error {
+		called = append(called, client)
+		if client == "grpc" {
+			return errCall
+		}
+		return nil
+	}
+	require.NoError(t, chain.Do(context.Background(), call))
+	require.NoError(t, chain.Do(context.Background(), call))
+	assert.Equal(t, []string{"grpc", "http", "grpc", "http"}, called)
+
+	// grpc 熔断后直接使用 http
+	called = nil
+	require.NoError(t, chain.Do(context.Background(), call))
+	assert.Equal(t, []string{"http"}, called)
+
+	status := chain.Status()
+	assert.Equal(t, "asr", status.Capability)
+	require.Len(t, status.Providers, 2)
+	assert.Equal(t, StateOpen, status.Providers[0].State)
+	assert.Equal(t, errCall.Error(), status.Providers[0].LastError)
+	assert.Equal(t, StateClosed, status.Providers[1].State)
+	assert.Equal(t, 2, status.Providers[1].Requests)
+}
+
+func TestChainUnavailable(t *testing.T) {
+	chain := NewChain("tts", BreakerConfig{}, NewProvider("edge", 1, 0, nil), NewProvider("chat", 2, 0, nil))
+	err := chain.Do(context.Background(), func(ctx context.Context, client int) error {
+		return errCall
+	})
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, errCall)
+	assert.Contains(t, err.Error(), "edge")
+	assert.Contains(t, err.Error(), "chat")
+
+	assert.ErrorIs(t, NewChain[int]("tts", BreakerConfig{}).Do(context.Background(), nil), ErrUnavailable)
+}
+
+func TestChainTimeout(t *testing.T) {
+	slow := NewProvider("slow", "slow", 20*time.Millisecond, nil)
+	fast := NewProvider("fast", "fast", 0, nil)
+	chain := NewChain("llm", BreakerConfig{}, slow, fast)
+
+	var got string
+	err := chain.Do(context.Background(), func(ctx context.Context, client string) error {
+		if client == "slow" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		got = client
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "fast", got)
+	assert.Contains(t, slow.Status().LastError, "not finished in 20ms")
+	requests, failures := slow.breaker.Counts()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 1, failures)
+}
+
+func TestChainCancelled(t *testing.T) {
+	p := NewProvider("grpc", "grpc", 0, nil)
+	next := NewProvider("http", "http", 0, nil)
+	chain := NewChain("asr", BreakerConfig{}, p, next)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var called []string
+	err := chain.Do(ctx, func(ctx context.Context, client string) error {
+		called = append(called, client)
+		cancel()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"grpc"}, called, "no fallback once the caller gave up")
+	requests, _ := p.breaker.Counts()
+	assert.Zero(t, requests, "cancelled calls are not counted")
+}
+
+func TestChainHealth(t *testing.T) {
+	healthy := false
+	probe := func(ctx context.Context) error {
+		if !healthy {
+			return errors.New("unhealthy status: loading")
+		}
+		return nil
+	}
+	grpc := NewProvider("grpc", "grpc", 0, probe)
+	http := NewProvider("http", "http", 0, nil)
+	chain := NewChain("nlu", BreakerConfig{}, grpc, http)
+
+	chain.Check(context.Background())
+	status := chain.Status()
+	assert.False(t, status.Providers[0].Healthy)
+	assert.False(t, status.Providers[0].LastCheck.IsZero())
+	assert.True(t, status.Providers[1].Healthy, "no probe, always healthy")
+	assert.ErrorIs(t, grpc.Acquire(), ErrUnhealthy)
+
+	var got string
+	require.NoError(t, chain.Do(context.Background(), func(ctx context.Context, client string) error {
+		got = client
+		return nil
+	}))
+	assert.Equal(t, "http", got)
+
+	healthy = true
+	chain.Check(context.Background())
+	assert.NoError(t, grpc.Acquire())
+}
@@ -0,0 +1,76 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+)
+
+// RoundFunc 请求一次模型
+// 模型的文本回复由实现直接转发给调用方，工具调用通过返回值交回
+// 参数：
+//   - ctx: 上下文
+//   - messages: 本轮对话中已发生的工具调用与执行结果，按顺序追加在用户消息之后
+//   - tools: 是否向模型声明工具，最后一次请求不声明，模型只能直接回答
+//
+// 返回值:
+//   - []Call: 模型发起的工具调用，为空表示模型已给出最终回复
+//   - error: 请求失败时返回错误
+type RoundFunc func(ctx context.Context, messages []Message, tools bool) ([]Call, error)
+
+// Result 一次工具调用的执行结果
+type Result struct {
+	Call    Call
+	Content string
+	Err     error
+}
+
+// Run 执行工具调用循环
+// 模型发起工具调用时执行工具，把调用与结果追加到对话后再次请求模型，
+// 直到模型直接回答或达到 maxRounds；工具执行失败时把错误交给模型，由模型向用户说明
+// 参数：
+//   - ctx: 上下文
+//   - r: 工具注册表
+//   - clientID: 客户端ID(设备序列号)
+//   - maxRounds: 最多执行工具的次数，<= 0 时使用 DefaultMaxRounds
+//   - round: 请求一次模型
+//   - observe: 每次工具执行后回调，用于记录日志，可为空
+//
+// 返回值:
+//   - error: 请求模型失败或 ctx 取消时返回错误
+func Run(ctx context.Context, r *Registry, clientID string, maxRounds int, round RoundFunc, observe func(Result)) error {
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxRounds
+	}
+
+	var messages []Message
+	for i := 0; ; i++ {
+		calls, err := round(ctx, messages, i < maxRounds)
+		if err != nil {
+			return err
+		}
+		if len(calls) == 0 {
+			return nil
+		}
+		if i == maxRounds { // 未声明工具仍返回调用，不再执行
+			return fmt.Errorf("tool calls exceed %d rounds", maxRounds)
+		}
+
+		messages = append(messages, Message{Role: RoleAssistant, Calls: calls})
+		for _, call := range calls {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			content, err := r.Execute(ctx, clientID, call)
+			if observe != nil {
+				observe(Result{Call: call, Content: content, Err: err})
+			}
+			switch {
+			case err != nil:
+				content = "执行失败：" + err.Error()
+			case content == "":
+				content = "执行成功"
+			}
+			messages = append(messages, Message{Role: RoleTool, Content: content, CallID: call.ID})
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package tool LLM 工具调用
+// 声明可供模型调用的工具（设置温度、播放音乐、设置定时器、查询设备状态等），
+// 拼装流式返回的 tool_calls 片段，执行工具并把结果交回模型生成最终回复
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 消息角色
+const (
+	RoleAssistant = "assistant" // 模型发起工具调用
+	RoleTool      = "tool"      // 工具执行结果
+)
+
+// DefaultMaxRounds 单轮对话中最多执行工具的次数，超过后模型必须直接回答
+const DefaultMaxRounds = 3
+
+var (
+	ErrUnknownTool  = errors.New("unknown tool")
+	ErrInvalidTool  = errors.New("invalid tool")
+	ErrDuplicate    = errors.New("tool already registered")
+	ErrInvalidInput = errors.New("invalid tool arguments")
+)
+
+// Definition 工具声明，按 OpenAI 兼容的 function 格式发送给模型
+type Definition struct {
+	Name        string         `json:"name"`        // 工具名，小写字母与下划线
+	Description string         `json:"description"` // 工具用途，模型据此决定是否调用
+	Parameters  map[string]any `json:"parameters"`  // 参数的 JSON Schema
+}
+
+// Call 模型发起的一次工具调用
+type Call struct {
+	ID        string `json:"id"`        // 调用ID，结果消息通过它对应到调用
+	Name      string `json:"name"`      // 工具名
+	Arguments string `json:"arguments"` // JSON 格式的参数
+}
+
+// Message 工具调用过程中追加到对话里的消息
+// 模型发起调用时为 assistant 消息（Calls 非空），执行结果为 tool 消息（CallID 非空）
+type Message struct {
+	Role    string
+	Content string
+	Calls   []Call
+	CallID  string
+}
+
+// Func 工具执行函数
+// 参数：
+//   - ctx: 上下文，随本轮对话取消
+//   - clientID: 客户端ID(设备序列号)
+//   - args: 解析后的参数
+//
+// 返回值:
+//   - string: 执行结果，交给模型生成回复
+//   - error: 执行失败时返回错误，错误信息同样交给模型，由模型向用户说明
+type Func func(ctx context.Context, clientID string, args map[string]any) (string, error)
+
+// Tool 工具
+type Tool struct {
+	Definition
+	Run Func
+}
+
+// Registry 工具注册表
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]*Tool
+}
+
+// NewRegistry 创建工具注册表
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]*Tool)}
+}
+
+// Register 注册工具
+// 参数：
+//   - t: 工具
+//
+// 返回值:
+//   - error: 工具名或执行函数为空、工具已注册时返回错误
+func (r *Registry) Register(t Tool) error {
+	if t.Name == "" || t.Run == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidTool, t.Name)
+	}
+	if t.Parameters == nil {
+		t.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[t.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, t.Name)
+	}
+	r.tools[t.Name] = &t
+	return nil
+}
+
+// Len 已注册的工具数
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tools)
+}
+
+// Definitions 已注册工具的声明，按工具名排序
+func (r *Registry) Definitions() []Definition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	defs := make([]Definition, 0, len(r.tools))
+	for _, t := range r.tools {
+		defs = append(defs, t.Definition)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Execute 执行一次工具调用
+// 参数：
+//   - ctx: 上下文
+//   - clientID: 客户端ID(设备序列号)
+//   - call: 工具调用
+//
+// 返回值:
+//   - string: 执行结果
+//   - error: 工具未注册、参数不是 JSON 对象或执行失败时返回错误
+func (r *Registry) Execute(ctx context.Context, clientID string, call Call) (string, error) {
+	r.mu.RLock()
+	t, ok := r.tools[call.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTool, call.Name)
+	}
+
+	args := map[string]any{}
+	if call.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			return "", fmt.Errorf("%w: %s %v", ErrInvalidInput, call.Name, err)
+		}
+	}
+	return t.Run(ctx, clientID, args)
+}
+
+// Delta 流式返回的工具调用片段
+// 同一调用的片段 Index 相同，ID 与 Name 只在首个片段出现，Arguments 需要按顺序拼接
+type Delta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Accumulator 拼装流式返回的工具调用片段
+type Accumulator struct {
+	calls map[int]*Call
+}
+
+// Add 追加一个片段
+func (a *Accumulator) Add(d Delta) {
+	if a.calls == nil {
+		a.calls = make(map[int]*Call)
+	}
+	c, ok := a.calls[d.Index]
+	if !ok {
+		c = &Call{}
+		a.calls[d.Index] = c
+	}
+	if d.ID != "" {
+		c.ID = d.ID
+	}
+	if d.Name != "" {
+		c.Name = d.Name
+	}
+	c.Arguments += d.Arguments
+}
+
+// Calls 拼装完成的工具调用，按 Index 排序，跳过没有工具名的调用
+func (a *Accumulator) Calls() []Call {
+	indexes := make([]int, 0, len(a.calls))
+	for i := range a.calls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	calls := make([]Call, 0, len(indexes))
+	for _, i := range indexes {
+		c := *a.calls[i]
+		if c.Name == "" {
+			continue
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("call_%d", i)
+		}
+		calls = append(calls, c)
+	}
+	return calls
+}
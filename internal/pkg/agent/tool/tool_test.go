@@ -0,0 +1,124 @@
+// 测试工具调用片段拼装、工具注册执行与工具调用循环
+package tool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoTool(name string) Tool {
+	return Tool{
+		Definition: Definition{Name: name},
+		Run: func(ctx context.Context, clientID string, args map[string]any) (string, error) {
+			if v, ok := args["fail"].(bool); ok && v {
+				return "", errors.New("device offline")
+			}
+			return clientID + ":" + name, nil
+		},
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	var a Accumulator
+	a.Add(Delta{Index: 1, ID: "call_b", Name: "play_music", Arguments: `{"song":`})
+	a.Add(Delta{Index: 0, ID: "call_a", Name: "set_temperature"})
+	a.Add(Delta{Index: 0, Arguments: `{"temperature":`})
+	a.Add(Delta{Index: 1, Arguments: `"晴天"}`})
+	a.Add(Delta{Index: 0, Arguments: `26}`})
+	a.Add(Delta{Index: 2, Arguments: `{}`}) // 没有工具名的片段被丢弃
+
+	assert.Equal(t, []Call{
+		{ID: "call_a", Name: "set_temperature", Arguments: `{"temperature":26}`},
+		{ID: "call_b", Name: "play_music", Arguments: `{"song":"晴天"}`},
+	}, a.Calls())
+
+	var empty Accumulator
+	assert.Empty(t, empty.Calls())
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(echoTool("b")))
+	require.NoError(t, r.Register(echoTool("a")))
+	assert.ErrorIs(t, r.Register(echoTool("a")), ErrDuplicate)
+	assert.ErrorIs(t, r.Register(Tool{Definition: Definition{Name: "c"}}), ErrInvalidTool)
+
+	defs := r.Definitions()
+	require.Len(t, defs, 2)
+	assert.Equal(t, "a", defs[0].Name)
+	assert.Equal(t, "object", defs[0].Parameters["type"], "missing parameters default to an empty object")
+
+	got, err := r.Execute(context.Background(), "sn1", Call{Name: "a", Arguments: `{}`})
+	require.NoError(t, err)
+	assert.Equal(t, "sn1:a", got)
+	_, err = r.Execute(context.Background(), "sn1", Call{Name: "x"})
+	assert.ErrorIs(t, err, ErrUnknownTool)
+	_, err = r.Execute(context.Background(), "sn1", Call{Name: "a", Arguments: `{"temperature":`})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	var nilRegistry *Registry
+	assert.Equal(t, 0, nilRegistry.Len())
+}
+
+func TestRun(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(echoTool("a")))
+
+	var rounds [][]Message
+	var declared []bool
+	round := func(ctx context.Context, messages []Message, tools bool) ([]Call, error) {
+		rounds = append(rounds, messages)
+		declared = append(declared, tools)
+		if len(rounds) == 1 {
+			return []Call{
+				{ID: "1", Name: "a"},
+				{ID: "2", Name: "a", Arguments: `{"fail":true}`},
+			}, nil
+		}
+		return nil, nil
+	}
+	var results []Result
+	err := Run(context.Background(), r, "sn1", 0, round, func(res Result) { results = append(results, res) })
+	require.NoError(t, err)
+
+	require.Len(t, rounds, 2)
+	assert.Equal(t, []bool{true, true}, declared)
+	assert.Equal(t, []Message{
+		{Role: RoleAssistant, Calls: []Call{{ID: "1", Name: "a"}, {ID: "2", Name: "a", Arguments: `{"fail":true}`}}},
+		{Role: RoleTool, Content: "sn1:a", CallID: "1"},
+		{Role: RoleTool, Content: "执行失败：device offline", CallID: "2"},
+	}, rounds[1])
+	require.Len(t, results, 2)
+	assert.EqualError(t, results[1].Err, "device offline")
+}
+
+func TestRunMaxRounds(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(echoTool("a")))
+
+	var declared []bool
+	loop := func(ctx context.Context, messages []Message, tools bool) ([]Call, error) {
+		declared = append(declared, tools)
+		if !tools {
+			return nil, nil // 不再声明工具时模型直接回答
+		}
+		return []Call{{ID: "1", Name: "a"}}, nil
+	}
+	require.NoError(t, Run(context.Background(), r, "sn1", 2, loop, nil))
+	assert.Equal(t, []bool{true, true, false}, declared)
+
+	stubborn := func(ctx context.Context, messages []Message, tools bool) ([]Call, error) {
+		return []Call{{ID: "1", Name: "a"}}, nil
+	}
+	assert.Error(t, Run(context.Background(), r, "sn1", 1, stubborn, nil))
+
+	failed := errors.New("http 500")
+	broken := func(ctx context.Context, messages []Message, tools bool) ([]Call, error) {
+		return nil, failed
+	}
+	assert.ErrorIs(t, Run(context.Background(), r, "sn1", 1, broken, nil), failed)
+}
@@ -85,6 +85,11 @@ func (e *EdgeTTS) Synthesize(ctx context.Context, text string) ([]byte, error) {
 	return body, nil
 }
 
+// Format Edge TTS 服务返回 WAV
+func (e *EdgeTTS) Format() Format {
+	return FormatWAV
+}
+
 // Close 关闭 HTTP 客户端（无操作）
 func (e *EdgeTTS) Close() error {
 	return nil
@@ -118,6 +123,11 @@ func (c *ChatTTS) Synthesize(ctx context.Context, text string) ([]byte, error) {
 	return nil, nil
 }
 
+// Format ChatTTS 服务返回 WAV
+func (c *ChatTTS) Format() Format {
+	return FormatWAV
+}
+
 // Close 关闭 HTTP 客户端（无操作）
 func (c *ChatTTS) Close() error {
 	return nil
@@ -0,0 +1,107 @@
+package tts
+
+import "context"
+
+// segmentBuffer 单句合成结果的缓冲分块数，超出后合成方等待输出方读取
+const segmentBuffer = 16
+
+// Segment 按序输出的合成结果
+// 一句文本对应若干音频分块，最后以 Last 为 true 的结果结束（此时 Audio 为空，Err 为该句的合成错误）
+type Segment struct {
+	Index  int    // 句子序号，从 0 开始
+	Text   string // 句子文本
+	Audio  []byte // 音频分块
+	Format Format // 音频分块的格式
+	Last   bool   // 该句结束
+	Err    error  // 该句合成失败的错误，仅 Last 时有效
+}
+
+// segmentJob 单句合成任务
+type segmentJob struct {
+	index  int
+	text   string
+	chunks chan Segment // 音频分块与其格式
+	err    error        // chunks 关闭后可读
+}
+
+// SynthesizeOrdered 逐句合成并按句子顺序输出音频
+// 前一句播放（emit 阻塞）期间，后续句子最多 concurrency 句同时合成，
+// 输出顺序始终与输入顺序一致；单句合成失败不影响后续句子
+// 参数：
+//   - ctx: 上下文，取消时终止所有合成
+//   - svc: 语音合成服务
+//   - sentences: 待合成的句子，关闭表示结束
+//   - concurrency: 同时合成的最大句数，<= 0 时为 1
+//   - emit: 按序输出回调，返回错误时终止合成
+//
+// 返回值:
+//   - error: emit 返回的错误或上下文错误
+func SynthesizeOrdered(ctx context.Context, svc Service, sentences <-chan string, concurrency int, emit func(Segment) error) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 信号量限制同时合成的句数，jobs 保持输入顺序
+	sem := make(chan struct{}, concurrency)
+	jobs := make(chan *segmentJob, concurrency)
+	go func() {
+		defer close(jobs)
+		for index := 0; ; index++ {
+			var text string
+			var ok bool
+			select {
+			case text, ok = <-sentences:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			job := &segmentJob{index: index, text: text, chunks: make(chan Segment, segmentBuffer)}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				<-sem
+				return
+			}
+			go job.run(ctx, svc, sem)
+		}
+	}()
+
+	for job := range jobs {
+		for chunk := range job.chunks {
+			chunk.Index, chunk.Text = job.index, job.text
+			if err := emit(chunk); err != nil {
+				return err
+			}
+		}
+		if err := emit(Segment{Index: job.index, Text: job.text, Last: true, Err: job.err}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// run 合成单句，完成后释放信号量
+// 最早未输出的句子总是持有信号量且被输出方读取，因此缓冲写满时不会死锁
+func (j *segmentJob) run(ctx context.Context, svc Service, sem chan struct{}) {
+	defer func() { <-sem }()
+	defer close(j.chunks)
+
+	j.err = Stream(ctx, svc, j.text, func(chunk []byte, format Format) error {
+		select {
+		case j.chunks <- Segment{Audio: chunk, Format: format}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
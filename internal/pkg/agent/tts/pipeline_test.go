@@ -0,0 +1,127 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeStreamingTTS 按句子长度倒序耗时的流式合成服务：越靠前的句子合成越慢
+type fakeStreamingTTS struct {
+	active  atomic.Int32
+	maxSeen atomic.Int32
+}
+
+func (f *fakeStreamingTTS) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	return nil, errors.New("unary not expected")
+}
+
+func (f *fakeStreamingTTS) Close() error { return nil }
+
+func (f *fakeStreamingTTS) SynthesizeStream(ctx context.Context, text string, onChunk func([]byte, Format) error) error {
+	n := f.active.Add(1)
+	defer f.active.Add(-1)
+	for {
+		m := f.maxSeen.Load()
+		if n <= m || f.maxSeen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	if strings.HasPrefix(text, "fail") {
+		return errors.New("synthesize failed")
+	}
+	time.Sleep(time.Duration(10-len(text)) * 3 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := onChunk([]byte(fmt.Sprintf("%s#%d", text, i)), FormatPCM); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func feed(texts ...string) <-chan string {
+	ch := make(chan string, len(texts))
+	for _, t := range texts {
+		ch <- t
+	}
+	close(ch)
+	return ch
+}
+
+func TestSynthesizeOrdered(t *testing.T) {
+	svc := &fakeStreamingTTS{}
+	var got []string
+	var failed []int
+	err := SynthesizeOrdered(context.Background(), svc, feed("a", "bb", "fail", "ccc", "dddd"), 2, func(s Segment) error {
+		if s.Last {
+			if s.Err != nil {
+				failed = append(failed, s.Index)
+			}
+			return nil
+		}
+		if s.Format != FormatPCM {
+			t.Errorf("segment %d format %q, want %q", s.Index, s.Format, FormatPCM)
+		}
+		got = append(got, string(s.Audio))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for _, text := range []string{"a", "bb", "ccc", "dddd"} {
+		for i := 0; i < 3; i++ {
+			want = append(want, fmt.Sprintf("%s#%d", text, i))
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("chunks out of order:\n got  %v\n want %v", got, want)
+	}
+	if len(failed) != 1 || failed[0] != 2 {
+		t.Errorf("failed segments = %v, want [2]", failed)
+	}
+	if m := svc.maxSeen.Load(); m > 2 {
+		t.Errorf("concurrency %d exceeds limit 2", m)
+	}
+}
+
+func TestSynthesizeOrderedAbort(t *testing.T) {
+	stop := errors.New("stop")
+	sentences := make(chan string) // 永不关闭，终止后不应阻塞
+	go func() { sentences <- "a"; sentences <- "b" }()
+
+	err := SynthesizeOrdered(context.Background(), &fakeStreamingTTS{}, sentences, 2, func(s Segment) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+}
+
+func TestStreamUnaryFallback(t *testing.T) {
+	svc := &unaryTTS{audio: []byte("wav")}
+	var chunks [][]byte
+	var formats []Format
+	err := Stream(context.Background(), svc, "hi", func(c []byte, f Format) error {
+		chunks = append(chunks, c)
+		formats = append(formats, f)
+		return nil
+	})
+	if err != nil || len(chunks) != 1 || string(chunks[0]) != "wav" {
+		t.Errorf("got %q, %v", chunks, err)
+	}
+	// 未声明格式的服务按 WAV 处理
+	if len(formats) != 1 || formats[0] != FormatWAV {
+		t.Errorf("format %v, want %v", formats, FormatWAV)
+	}
+}
+
+type unaryTTS struct{ audio []byte }
+
+func (u *unaryTTS) Synthesize(ctx context.Context, text string) ([]byte, error) { return u.audio, nil }
+func (u *unaryTTS) Close() error                                                { return nil }
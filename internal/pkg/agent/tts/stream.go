@@ -0,0 +1,99 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "yunyez/internal/pkg/types/pb/ai"
+)
+
+// StreamingService 支持流式合成的语音合成服务
+type StreamingService interface {
+	Service
+	// SynthesizeStream 流式合成，音频分块到达时按序回调 onChunk，format 为分块的音频格式
+	// onChunk 返回错误时终止合成并返回该错误
+	SynthesizeStream(ctx context.Context, text string, onChunk func(chunk []byte, format Format) error) error
+}
+
+// SynthesizeStream 流式语音合成 - gRPC 方式
+// 每句文本开启一个 StreamingSynthesize 会话：首包发送合成配置，随后发送文本并关闭发送端，
+// 服务端返回的音频分块到达即回调
+func (c *GRPCTTSClient) SynthesizeStream(ctx context.Context, text string, onChunk func(chunk []byte, format Format) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.StreamingSynthesize(ctx)
+	if err != nil {
+		return fmt.Errorf("open TTS stream: %w", err)
+	}
+	err = stream.Send(&pb.StreamingSynthesizeRequest{
+		Request: &pb.StreamingSynthesizeRequest_Config{
+			Config: &pb.StreamingSynthesizeConfig{
+				Voice:        c.voice,
+				Rate:         1.0,
+				Pitch:        1.0,
+				Volume:       1.0,
+				OutputFormat: "AUDIO_16KHZ_16BIT_RAW_PCM",
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("send TTS stream config: %w", err)
+	}
+	err = stream.Send(&pb.StreamingSynthesizeRequest{
+		Request: &pb.StreamingSynthesizeRequest_Text{Text: text},
+	})
+	if err != nil {
+		return fmt.Errorf("send TTS stream text: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("close TTS stream: %w", err)
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("receive TTS audio: %w", err)
+		}
+		switch r := resp.Result.(type) {
+		case *pb.StreamingSynthesizeResponse_AudioContent:
+			if len(r.AudioContent) == 0 {
+				continue
+			}
+			if err := onChunk(r.AudioContent, FormatPCM); err != nil {
+				return err
+			}
+		case *pb.StreamingSynthesizeResponse_Error:
+			return fmt.Errorf("TTS error: %s", r.Error.GetMessage())
+		}
+	}
+}
+
+// Stream 合成一句文本并按分块回调
+// 服务支持流式合成时边合成边回调，否则整句合成后按服务的输出格式一次回调
+// 参数：
+//   - ctx: 上下文
+//   - svc: 语音合成服务
+//   - text: 待合成文本
+//   - onChunk: 音频分块与其格式的回调
+//
+// 返回值:
+//   - error: 合成失败或回调返回的错误
+func Stream(ctx context.Context, svc Service, text string, onChunk func(chunk []byte, format Format) error) error {
+	if s, ok := svc.(StreamingService); ok {
+		return s.SynthesizeStream(ctx, text, onChunk)
+	}
+	audio, err := svc.Synthesize(ctx, text)
+	if err != nil {
+		return err
+	}
+	if len(audio) == 0 {
+		return nil
+	}
+	return onChunk(audio, FormatOf(svc))
+}
@@ -9,6 +9,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	pb "yunyez/internal/pkg/types/pb/ai"
+	pbCommon "yunyez/internal/pkg/types/pb/common"
 )
 
 // Protocol 协议类型
@@ -19,6 +20,28 @@ const (
 	ProtocolGRPC  Protocol = "grpc"
 )
 
+// Format 合成音频的格式，与实际提供合成的服务一致，下行转码据此解码
+type Format string
+
+const (
+	FormatPCM Format = "pcm" // 16kHz 16bit 单声道裸 PCM
+	FormatWAV Format = "wav" // WAV 容器
+)
+
+// Formatter 声明输出音频格式的语音合成服务
+type Formatter interface {
+	// Format 合成音频的格式
+	Format() Format
+}
+
+// FormatOf 语音合成服务输出的音频格式，未声明时为 WAV（HTTP 服务返回 WAV）
+func FormatOf(svc Service) Format {
+	if f, ok := svc.(Formatter); ok {
+		return f.Format()
+	}
+	return FormatWAV
+}
+
 // Service convert text to speech realtime interface
 type Service interface {
 	// Synthesize convert text to speech realtime
@@ -73,6 +96,23 @@ func (c *GRPCTTSClient) Close() error {
 	return nil
 }
 
+// Format 请求的输出格式为 AUDIO_16KHZ_16BIT_RAW_PCM
+func (c *GRPCTTSClient) Format() Format {
+	return FormatPCM
+}
+
+// Health 检查 TTS 服务健康状态 - gRPC 方式
+func (c *GRPCTTSClient) Health(ctx context.Context) error {
+	resp, err := c.client.Health(ctx, &pbCommon.HealthRequest{})
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	if resp.Status != "ok" {
+		return fmt.Errorf("unhealthy status: %s", resp.Status)
+	}
+	return nil
+}
+
 // Synthesize 语音合成 - gRPC 方式
 func (c *GRPCTTSClient) Synthesize(ctx context.Context, text string) ([]byte, error) {
 	resp, err := c.client.Synthesize(ctx, &pb.SynthesizeRequest{
@@ -0,0 +1,179 @@
+// Package audio implements audio sample conversion
+// It encodes and decodes ITU-T G.711 (A-law / µ-law) to and from 16-bit linear PCM
+package audio
+
+// A-law / µ-law 段终点，用于查找压扩段号
+var (
+	aLawSegEnd = [8]int32{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+	uLawSegEnd = [8]int32{0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF}
+)
+
+const (
+	uLawBias = 0x84 // µ-law 偏置
+	uLawClip = 8159 // µ-law 14 位幅度上限
+)
+
+// 解码查找表，init 时生成
+var (
+	aLawTable [256]int16
+	uLawTable [256]int16
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		aLawTable[i] = aLawDecode(byte(i))
+		uLawTable[i] = uLawDecode(byte(i))
+	}
+}
+
+// segment 查找采样值所在的压扩段
+func segment(val int32, table *[8]int32) int32 {
+	for i, end := range table {
+		if val <= end {
+			return int32(i)
+		}
+	}
+	return 8
+}
+
+// ALawEncodeSample 将一个 16 位线性 PCM 采样编码为 A-law
+func ALawEncodeSample(sample int16) byte {
+	val := int32(sample) >> 3
+	var mask int32
+	if val >= 0 {
+		mask = 0xD5 // 符号位 1，偶数位取反
+	} else {
+		mask = 0x55
+		val = -val - 1
+	}
+
+	seg := segment(val, &aLawSegEnd)
+	if seg >= 8 { // 超出范围，取最大值
+		return byte(0x7F ^ mask)
+	}
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (val >> 1) & 0x0F
+	} else {
+		aval |= (val >> seg) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
+
+// ALawDecodeSample 将一个 A-law 采样解码为 16 位线性 PCM
+func ALawDecodeSample(b byte) int16 {
+	return aLawTable[b]
+}
+
+func aLawDecode(b byte) int16 {
+	val := int32(b ^ 0x55)
+	t := (val & 0x0F) << 4
+	seg := (val & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if val&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// ULawEncodeSample 将一个 16 位线性 PCM 采样编码为 µ-law
+func ULawEncodeSample(sample int16) byte {
+	val := int32(sample) >> 2
+	var mask int32
+	if val < 0 {
+		val = -val
+		mask = 0x7F
+	} else {
+		mask = 0xFF
+	}
+	if val > uLawClip {
+		val = uLawClip
+	}
+	val += uLawBias >> 2
+
+	seg := segment(val, &uLawSegEnd)
+	if seg >= 8 { // 超出范围，取最大值
+		return byte(0x7F ^ mask)
+	}
+	uval := (seg << 4) | ((val >> (seg + 1)) & 0x0F)
+	return byte(uval ^ mask)
+}
+
+// ULawDecodeSample 将一个 µ-law 采样解码为 16 位线性 PCM
+func ULawDecodeSample(b byte) int16 {
+	return uLawTable[b]
+}
+
+func uLawDecode(b byte) int16 {
+	val := int32(^b)
+	t := ((val & 0x0F) << 3) + uLawBias
+	t <<= (val & 0x70) >> 4
+	if val&0x80 != 0 {
+		return int16(uLawBias - t)
+	}
+	return int16(t - uLawBias)
+}
+
+// EncodeALaw 将 16 位小端线性 PCM 编码为 A-law
+// 参数：
+//   - pcm: 16 位小端 PCM 数据，长度为奇数时忽略最后一个字节
+//
+// 返回值:
+//   - []byte: A-law 数据，长度为采样数
+func EncodeALaw(pcm []byte) []byte {
+	out := make([]byte, len(pcm)/2)
+	for i := range out {
+		out[i] = ALawEncodeSample(sampleAt(pcm, i))
+	}
+	return out
+}
+
+// DecodeALaw 将 A-law 解码为 16 位小端线性 PCM
+// 参数：
+//   - data: A-law 数据
+//
+// 返回值:
+//   - []byte: 16 位小端 PCM 数据，长度为采样数的 2 倍
+func DecodeALaw(data []byte) []byte {
+	out := make([]byte, len(data)*2)
+	for i, b := range data {
+		putSample(out, i, aLawTable[b])
+	}
+	return out
+}
+
+// EncodeULaw 将 16 位小端线性 PCM 编码为 µ-law
+// 参数：
+//   - pcm: 16 位小端 PCM 数据，长度为奇数时忽略最后一个字节
+//
+// 返回值:
+//   - []byte: µ-law 数据，长度为采样数
+func EncodeULaw(pcm []byte) []byte {
+	out := make([]byte, len(pcm)/2)
+	for i := range out {
+		out[i] = ULawEncodeSample(sampleAt(pcm, i))
+	}
+	return out
+}
+
+// DecodeULaw 将 µ-law 解码为 16 位小端线性 PCM
+// 参数：
+//   - data: µ-law 数据
+//
+// 返回值:
+//   - []byte: 16 位小端 PCM 数据，长度为采样数的 2 倍
+func DecodeULaw(data []byte) []byte {
+	out := make([]byte, len(data)*2)
+	for i, b := range data {
+		putSample(out, i, uLawTable[b])
+	}
+	return out
+}
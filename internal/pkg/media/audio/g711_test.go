@@ -0,0 +1,103 @@
+// 测试 G.711 编解码
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestG711KnownValues(t *testing.T) {
+	tests := []struct {
+		sample int16
+		alaw   byte
+		ulaw   byte
+	}{
+		{0, 0xD5, 0xFF},
+		{-1, 0x55, 0x7E},
+		{32767, 0xAA, 0x80},
+		{-32768, 0x2A, 0x00},
+		{1000, 0xFA, 0xCE},
+	}
+	for _, tt := range tests {
+		if got := ALawEncodeSample(tt.sample); got != tt.alaw {
+			t.Errorf("ALawEncodeSample(%d) = %#02x, want %#02x", tt.sample, got, tt.alaw)
+		}
+		if got := ULawEncodeSample(tt.sample); got != tt.ulaw {
+			t.Errorf("ULawEncodeSample(%d) = %#02x, want %#02x", tt.sample, got, tt.ulaw)
+		}
+	}
+}
+
+func TestG711CodeRoundTrip(t *testing.T) {
+	// 每个码字解码后再编码应得到自身（µ-law 的 0x7F 与 0xFF 均表示 0）
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		if got := ALawEncodeSample(ALawDecodeSample(b)); got != b {
+			t.Errorf("a-law %#02x -> %d -> %#02x", b, ALawDecodeSample(b), got)
+		}
+		if b == 0x7F {
+			continue
+		}
+		if got := ULawEncodeSample(ULawDecodeSample(b)); got != b {
+			t.Errorf("µ-law %#02x -> %d -> %#02x", b, ULawDecodeSample(b), got)
+		}
+	}
+}
+
+func TestG711QuantizationError(t *testing.T) {
+	// 压扩误差随幅度增大，不超过所在段步长的一半
+	for s := -32768; s <= 32767; s += 7 {
+		sample := int16(s)
+		limit := int(abs(s))/16 + 16
+		if d := abs(int(ALawDecodeSample(ALawEncodeSample(sample))) - s); d > limit {
+			t.Fatalf("a-law error %d for %d exceeds %d", d, s, limit)
+		}
+		if d := abs(int(ULawDecodeSample(ULawEncodeSample(sample))) - s); d > limit {
+			t.Fatalf("µ-law error %d for %d exceeds %d", d, s, limit)
+		}
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	pcm := Bytes([]int16{0, 100, -100, 1000, -1000, 30000, -30000})
+
+	alaw, err := Transcode(pcm, EncodingPCM16, EncodingALaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alaw) != len(pcm)/2 {
+		t.Fatalf("a-law length = %d, want %d", len(alaw), len(pcm)/2)
+	}
+	ulaw, err := Transcode(alaw, EncodingALaw, EncodingULaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Transcode(ulaw, EncodingULaw, EncodingPCM16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range Samples(back) {
+		want := Samples(pcm)[i]
+		if d := abs(int(s) - int(want)); d > int(abs(int(want)))/8+16 {
+			t.Errorf("sample %d: got %d, want ~%d", i, s, want)
+		}
+	}
+
+	if same, _ := Transcode(pcm, EncodingPCM16, EncodingPCM16); !bytes.Equal(same, pcm) {
+		t.Error("identity transcode changed data")
+	}
+	if _, err := Transcode([]byte{1, 2, 3}, EncodingPCM16, EncodingALaw); !errors.Is(err, ErrOddLength) {
+		t.Errorf("got error %v, want %v", err, ErrOddLength)
+	}
+	if _, err := Transcode(pcm, Encoding(0), EncodingALaw); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedEncoding)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
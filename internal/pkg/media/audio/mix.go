@@ -0,0 +1,59 @@
+package audio
+
+// Downmix 将交织存储的多声道采样混合为单声道（各声道取平均）
+// 参数：
+//   - samples: 交织存储的 16 位采样
+//   - channels: 声道数
+//
+// 返回值:
+//   - []int16: 单声道采样
+func Downmix(samples []int16, channels int) []int16 {
+	if channels <= 1 {
+		return samples
+	}
+	out := make([]int16, len(samples)/channels)
+	for i := range out {
+		var sum int
+		for ch := 0; ch < channels; ch++ {
+			sum += int(samples[i*channels+ch])
+		}
+		out[i] = int16(sum / channels)
+	}
+	return out
+}
+
+// Upmix 将单声道采样复制到多个声道（交织存储）
+// 参数：
+//   - mono: 单声道采样
+//   - channels: 目标声道数
+//
+// 返回值:
+//   - []int16: 交织存储的多声道采样
+func Upmix(mono []int16, channels int) []int16 {
+	if channels <= 1 {
+		return mono
+	}
+	out := make([]int16, len(mono)*channels)
+	for i, s := range mono {
+		for ch := 0; ch < channels; ch++ {
+			out[i*channels+ch] = s
+		}
+	}
+	return out
+}
+
+// Remix 转换声道数
+// 多声道之间的转换先混合为单声道再复制
+// 参数：
+//   - samples: 交织存储的 16 位采样
+//   - from: 源声道数
+//   - to: 目标声道数
+//
+// 返回值:
+//   - []int16: 目标声道数的交织采样
+func Remix(samples []int16, from, to int) []int16 {
+	if from == to {
+		return samples
+	}
+	return Upmix(Downmix(samples, from), to)
+}
@@ -0,0 +1,106 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Encoding 音频采样编码
+type Encoding uint8
+
+const (
+	EncodingPCM16 Encoding = iota + 1 // 16 位小端线性 PCM
+	EncodingALaw                      // G.711 A-law
+	EncodingULaw                      // G.711 µ-law
+)
+
+// String 编码名称
+func (e Encoding) String() string {
+	switch e {
+	case EncodingPCM16:
+		return "pcm16"
+	case EncodingALaw:
+		return "g711a"
+	case EncodingULaw:
+		return "g711u"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(e))
+	}
+}
+
+var (
+	ErrUnsupportedEncoding = errors.New("audio: unsupported encoding")
+	ErrOddLength           = errors.New("audio: 16-bit pcm has odd length")
+)
+
+// Transcode 在 PCM 与 G.711 之间转换
+// 参数：
+//   - data: 源音频数据
+//   - from: 源编码
+//   - to: 目标编码
+//
+// 返回值:
+//   - []byte: 目标编码的音频数据，源与目标相同时原样返回
+//   - error: 不支持的编码或 PCM 长度非法时返回错误
+func Transcode(data []byte, from, to Encoding) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+
+	// 先解码为 PCM
+	var pcm []byte
+	switch from {
+	case EncodingPCM16:
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("%w: %d bytes", ErrOddLength, len(data))
+		}
+		pcm = data
+	case EncodingALaw:
+		pcm = DecodeALaw(data)
+	case EncodingULaw:
+		pcm = DecodeULaw(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, from)
+	}
+
+	// 再编码为目标格式
+	switch to {
+	case EncodingPCM16:
+		return pcm, nil
+	case EncodingALaw:
+		return EncodeALaw(pcm), nil
+	case EncodingULaw:
+		return EncodeULaw(pcm), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, to)
+	}
+}
+
+// Samples 将 16 位小端 PCM 字节转换为采样
+func Samples(pcm []byte) []int16 {
+	out := make([]int16, len(pcm)/2)
+	for i := range out {
+		out[i] = sampleAt(pcm, i)
+	}
+	return out
+}
+
+// Bytes 将采样转换为 16 位小端 PCM 字节
+func Bytes(samples []int16) []byte {
+	out := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		putSample(out, i, s)
+	}
+	return out
+}
+
+// sampleAt 读取第 i 个 16 位小端采样
+func sampleAt(pcm []byte, i int) int16 {
+	return int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+}
+
+// putSample 写入第 i 个 16 位小端采样
+func putSample(pcm []byte, i int, s int16) {
+	binary.LittleEndian.PutUint16(pcm[2*i:], uint16(s))
+}
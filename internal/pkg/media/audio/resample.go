@@ -0,0 +1,256 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	resampleZeroCrossings = 16   // 每侧 sinc 过零点个数，决定滤波器长度与过渡带宽度
+	maxResamplePhases     = 4096 // 多相滤波器最大相位数
+)
+
+// Resampler 多相（polyphase）加窗 sinc 重采样器
+// 将采样率从 from 转换到 to：先按 L/M 化简比例，为 L 个相位预计算低通滤波器系数，
+// 每个输出采样只对所需的输入采样做一次卷积
+type Resampler struct {
+	from, to int
+	l, m     int         // 上采样/下采样因子 to/from = l/m
+	half     int         // 每侧滤波器抽头数
+	coeffs   [][]float64 // [相位][抽头]
+}
+
+// NewResampler 创建重采样器
+// 参数：
+//   - from: 源采样率
+//   - to: 目标采样率
+//
+// 返回值:
+//   - *Resampler: 重采样器，可并发复用
+//   - error: 采样率非法或比例过于复杂时返回错误
+func NewResampler(from, to int) (*Resampler, error) {
+	if from <= 0 || to <= 0 {
+		return nil, fmt.Errorf("audio: invalid sample rate %d -> %d", from, to)
+	}
+	g := gcd(from, to)
+	r := &Resampler{from: from, to: to, l: to / g, m: from / g}
+	if r.l > maxResamplePhases {
+		return nil, fmt.Errorf("audio: resample ratio %d/%d too complex", r.l, r.m)
+	}
+	if from == to {
+		return r, nil
+	}
+
+	// 截止频率（相对源采样率奈奎斯特频率），下采样时降低截止频率以抗混叠
+	cutoff := 1.0
+	if to < from {
+		cutoff = float64(to) / float64(from)
+	}
+	r.half = int(math.Ceil(resampleZeroCrossings / cutoff))
+
+	r.coeffs = make([][]float64, r.l)
+	for p := 0; p < r.l; p++ {
+		frac := float64(p) / float64(r.l)
+		taps := make([]float64, 2*r.half)
+		var sum float64
+		for j := range taps {
+			x := float64(j-r.half+1) - frac // 抽头与输出位置的距离（源采样）
+			taps[j] = cutoff * sinc(cutoff*x) * blackman(x, float64(r.half))
+			sum += taps[j]
+		}
+		// 归一化，保证直流增益为 1
+		for j := range taps {
+			taps[j] /= sum
+		}
+		r.coeffs[p] = taps
+	}
+	return r, nil
+}
+
+// Process 重采样交织存储的多声道采样
+// 参数：
+//   - samples: 交织存储的 16 位采样
+//   - channels: 声道数
+//
+// 返回值:
+//   - []int16: 重采样后的交织采样
+func (r *Resampler) Process(samples []int16, channels int) []int16 {
+	if channels <= 0 {
+		channels = 1
+	}
+	if r.from == r.to {
+		return append([]int16(nil), samples...)
+	}
+
+	frames := len(samples) / channels
+	outFrames := (frames*r.l + r.m - 1) / r.m
+	out := make([]int16, outFrames*channels)
+	for n := 0; n < outFrames; n++ {
+		r.convolve(out[n*channels:(n+1)*channels], n, samples, 0, frames, channels)
+	}
+	return out
+}
+
+// convolve 计算第 n 个输出帧
+// samples 为从第 base 帧开始的交织输入，frames 为输入总帧数，超出 [0, frames) 的输入按 0 计
+func (r *Resampler) convolve(out []int16, n int, samples []int16, base, frames, channels int) {
+	pos := n * r.m
+	i := pos / r.l // 对应的源采样位置
+	taps := r.coeffs[pos%r.l]
+	start := i - r.half + 1
+	for ch := 0; ch < channels; ch++ {
+		var acc float64
+		for j, c := range taps {
+			k := start + j
+			if k < 0 || k >= frames {
+				continue
+			}
+			acc += c * float64(samples[(k-base)*channels+ch])
+		}
+		out[ch] = clip16(acc)
+	}
+}
+
+// StreamResampler 流式重采样器
+// 保留滤波器所需的历史采样与输出相位，分块输入的输出与整段输入的输出完全一致：
+// 每个输出采样等到右侧抽头所需的输入到达后才计算，Flush 时剩余输入按 0 补齐
+type StreamResampler struct {
+	r        *Resampler
+	channels int
+	buf      []int16 // 尚需参与卷积的交织输入，buf[0] 为第 base 帧
+	base     int     // buf 首帧的序号
+	frames   int     // 已输入的总帧数
+	next     int     // 下一个输出帧的序号
+}
+
+// NewStreamResampler 创建流式重采样器
+// 参数：
+//   - from: 源采样率
+//   - to: 目标采样率
+//   - channels: 声道数
+//
+// 返回值:
+//   - *StreamResampler: 流式重采样器，不可并发使用
+//   - error: 采样率非法或比例过于复杂时返回错误
+func NewStreamResampler(from, to, channels int) (*StreamResampler, error) {
+	r, err := NewResampler(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if channels <= 0 {
+		channels = 1
+	}
+	return &StreamResampler{r: r, channels: channels}, nil
+}
+
+// Process 输入一段交织采样，返回已可计算的输出
+// 参数：
+//   - samples: 交织存储的 16 位采样，不足一帧的尾部被丢弃
+//
+// 返回值:
+//   - []int16: 重采样后的交织采样，比输入延迟约滤波器半长
+func (s *StreamResampler) Process(samples []int16) []int16 {
+	samples = samples[:len(samples)-len(samples)%s.channels]
+	if s.r.from == s.r.to {
+		return append([]int16(nil), samples...)
+	}
+	s.buf = append(s.buf, samples...)
+	s.frames += len(samples) / s.channels
+
+	// 右侧抽头已到达的输出帧: n*m/l + half < frames
+	ready := 0
+	if avail := s.frames - s.r.half; avail > 0 {
+		ready = (avail*s.r.l + s.r.m - 1) / s.r.m
+	}
+	return s.emit(ready)
+}
+
+// Flush 剩余输入按 0 补齐，输出全部剩余采样并重置状态，之后可开始新的音频流
+// 返回值:
+//   - []int16: 剩余的交织采样
+func (s *StreamResampler) Flush() []int16 {
+	if s.r.from == s.r.to {
+		return nil
+	}
+	out := s.emit((s.frames*s.r.l + s.r.m - 1) / s.r.m)
+	s.buf, s.base, s.frames, s.next = nil, 0, 0, 0
+	return out
+}
+
+// emit 计算序号小于 end 的输出帧，丢弃之后不再需要的输入
+func (s *StreamResampler) emit(end int) []int16 {
+	if end <= s.next {
+		return nil
+	}
+	out := make([]int16, (end-s.next)*s.channels)
+	for n := s.next; n < end; n++ {
+		k := n - s.next
+		s.r.convolve(out[k*s.channels:(k+1)*s.channels], n, s.buf, s.base, s.frames, s.channels)
+	}
+	s.next = end
+
+	// 下一个输出帧的最左抽头之前的输入不再需要
+	if keep := (s.next*s.r.m)/s.r.l - s.r.half + 1; keep > s.base {
+		drop := min(keep, s.frames) - s.base
+		s.buf = append(s.buf[:0], s.buf[drop*s.channels:]...)
+		s.base += drop
+	}
+	return out
+}
+
+// Resample 重采样交织存储的 16 位采样
+// 参数：
+//   - samples: 交织存储的 16 位采样
+//   - channels: 声道数
+//   - from: 源采样率
+//   - to: 目标采样率
+//
+// 返回值:
+//   - []int16: 重采样后的交织采样
+//   - error: 采样率非法时返回错误
+func Resample(samples []int16, channels, from, to int) ([]int16, error) {
+	if from == to {
+		return samples, nil
+	}
+	r, err := NewResampler(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return r.Process(samples, channels), nil
+}
+
+// sinc 归一化 sinc 函数 sin(πx)/(πx)
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman Blackman 窗，x ∈ (-half, half)
+func blackman(x, half float64) float64 {
+	if math.Abs(x) >= half {
+		return 0
+	}
+	t := math.Pi * x / half
+	return 0.42 + 0.5*math.Cos(t) + 0.08*math.Cos(2*t)
+}
+
+// clip16 四舍五入并限幅到 int16
+func clip16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,156 @@
+// 测试重采样与声道混合
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// sine 生成单声道正弦波
+func sine(freq, rate, n int, amp float64) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(amp * math.Sin(2*math.Pi*float64(freq)*float64(i)/float64(rate)))
+	}
+	return out
+}
+
+// rms 计算均方根（跳过首尾边缘）
+func rms(samples []int16, edge int) float64 {
+	var sum float64
+	n := 0
+	for _, s := range samples[edge : len(samples)-edge] {
+		sum += float64(s) * float64(s)
+		n++
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+func TestResamplePreservesTone(t *testing.T) {
+	tests := []struct{ from, to int }{
+		{8000, 16000},
+		{48000, 16000},
+		{16000, 8000},
+		{44100, 16000},
+		{16000, 48000},
+	}
+	for _, tt := range tests {
+		in := sine(1000, tt.from, tt.from/2, 10000) // 0.5 秒 1kHz
+		out, err := Resample(in, 1, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("%d->%d: %v", tt.from, tt.to, err)
+		}
+		if want := tt.to / 2; len(out) < want-1 || len(out) > want+1 {
+			t.Errorf("%d->%d: length %d, want ~%d", tt.from, tt.to, len(out), want)
+		}
+		// 通带内幅度保持不变
+		want := sine(1000, tt.to, len(out), 10000)
+		if got, exp := rms(out, 100), rms(want, 100); math.Abs(got-exp)/exp > 0.02 {
+			t.Errorf("%d->%d: rms %.0f, want %.0f", tt.from, tt.to, got, exp)
+		}
+	}
+}
+
+func TestResampleAntiAliasing(t *testing.T) {
+	// 48kHz 下的 12kHz 高于 16kHz 的奈奎斯特频率，应被滤除
+	in := sine(12000, 48000, 24000, 10000)
+	out, err := Resample(in, 1, 48000, 16000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rms(out, 100); got > 100 {
+		t.Errorf("aliased tone rms %.0f, want < 100", got)
+	}
+}
+
+func TestResampleStereo(t *testing.T) {
+	left := sine(500, 8000, 800, 8000)
+	stereo := make([]int16, 0, 2*len(left))
+	for _, s := range left {
+		stereo = append(stereo, s, -s)
+	}
+	out, err := Resample(stereo, 2, 8000, 16000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(out); i += 2 {
+		if d := int(out[i]) + int(out[i+1]); d > 1 || d < -1 {
+			t.Fatalf("channels mixed at frame %d: %d, %d", i/2, out[i], out[i+1])
+		}
+	}
+
+	if _, err := NewResampler(0, 16000); err == nil {
+		t.Error("expected error for invalid rate")
+	}
+}
+
+func TestRemix(t *testing.T) {
+	stereo := []int16{100, 300, -100, -300, 32767, 32767}
+	mono := Remix(stereo, 2, 1)
+	if len(mono) != 3 || mono[0] != 200 || mono[1] != -200 || mono[2] != 32767 {
+		t.Errorf("downmix = %v", mono)
+	}
+	up := Remix(mono, 1, 2)
+	if len(up) != 6 || up[0] != 200 || up[1] != 200 {
+		t.Errorf("upmix = %v", up)
+	}
+	if same := Remix(stereo, 2, 2); &same[0] != &stereo[0] {
+		t.Error("same channel count should not copy")
+	}
+}
+
+func TestStreamResamplerMatchesWhole(t *testing.T) {
+	tests := []struct{ from, to, channels int }{
+		{16000, 8000, 1},
+		{16000, 48000, 1},
+		{44100, 16000, 1},
+		{8000, 16000, 2},
+		{16000, 16000, 1},
+	}
+	for _, tt := range tests {
+		mono := sine(1000, tt.from, tt.from/2, 10000)
+		in := Upmix(mono, tt.channels)
+		whole, err := Resample(in, tt.channels, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := NewStreamResampler(tt.from, tt.to, tt.channels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var chunked []int16
+		for off, size := 0, 1; off < len(mono); off, size = off+size, size%317+7 {
+			end := min(off+size, len(mono))
+			chunked = append(chunked, s.Process(in[off*tt.channels:end*tt.channels])...)
+		}
+		chunked = append(chunked, s.Flush()...)
+
+		if len(chunked) != len(whole) {
+			t.Fatalf("%d->%d: chunked length %d, whole %d", tt.from, tt.to, len(chunked), len(whole))
+		}
+		for i := range whole {
+			if chunked[i] != whole[i] {
+				t.Fatalf("%d->%d: sample %d = %d, want %d", tt.from, tt.to, i, chunked[i], whole[i])
+			}
+		}
+	}
+}
+
+func TestStreamResamplerFlushResets(t *testing.T) {
+	s, err := NewStreamResampler(16000, 8000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := sine(1000, 16000, 1600, 10000)
+	first := append(s.Process(in), s.Flush()...)
+	second := append(s.Process(in), s.Flush()...)
+	if len(first) != 800 || len(second) != 800 {
+		t.Fatalf("lengths %d, %d, want 800", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("sample %d differs after flush: %d, %d", i, first[i], second[i])
+		}
+	}
+}
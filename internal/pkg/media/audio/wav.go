@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// WAV fmt 块中的编码标识
+const (
+	WAVFormatPCM        uint16 = 0x0001
+	WAVFormatALaw       uint16 = 0x0006
+	WAVFormatULaw       uint16 = 0x0007
+	WAVFormatExtensible uint16 = 0xFFFE
+)
+
+const wavHeaderSize = 44 // RIFF + fmt(16) + data 块头
+
+var (
+	ErrNotWAV         = errors.New("audio: not a riff/wave container")
+	ErrInvalidWAV     = errors.New("audio: malformed wav")
+	ErrUnsupportedWAV = errors.New("audio: unsupported wav encoding")
+)
+
+// WAVFormat WAV fmt 块
+type WAVFormat struct {
+	AudioFormat   uint16 // 编码标识，Extensible 时为子格式的编码标识
+	Channels      uint16 // 声道数
+	SampleRate    uint32 // 采样率
+	ByteRate      uint32 // 每秒字节数
+	BlockAlign    uint16 // 每个采样点（所有声道）的字节数
+	BitsPerSample uint16 // 采样位数
+}
+
+// NewWAVFormat 根据编码、采样率与声道数创建 fmt
+func NewWAVFormat(encoding Encoding, sampleRate, channels int) WAVFormat {
+	format := WAVFormat{
+		AudioFormat:   WAVFormatPCM,
+		Channels:      uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		BitsPerSample: 16,
+	}
+	switch encoding {
+	case EncodingALaw:
+		format.AudioFormat, format.BitsPerSample = WAVFormatALaw, 8
+	case EncodingULaw:
+		format.AudioFormat, format.BitsPerSample = WAVFormatULaw, 8
+	}
+	format.BlockAlign = format.Channels * format.BitsPerSample / 8
+	format.ByteRate = format.SampleRate * uint32(format.BlockAlign)
+	return format
+}
+
+// Encoding 获取 fmt 对应的采样编码
+// 仅支持 16 位 PCM 与 8 位 G.711
+func (f WAVFormat) Encoding() (Encoding, error) {
+	switch {
+	case f.AudioFormat == WAVFormatPCM && f.BitsPerSample == 16:
+		return EncodingPCM16, nil
+	case f.AudioFormat == WAVFormatALaw && f.BitsPerSample == 8:
+		return EncodingALaw, nil
+	case f.AudioFormat == WAVFormatULaw && f.BitsPerSample == 8:
+		return EncodingULaw, nil
+	default:
+		return 0, fmt.Errorf("%w: format %#04x, %d bits", ErrUnsupportedWAV, f.AudioFormat, f.BitsPerSample)
+	}
+}
+
+// validate 校验 fmt 字段的一致性
+func (f WAVFormat) validate() error {
+	if f.Channels == 0 || f.SampleRate == 0 || f.BitsPerSample == 0 {
+		return fmt.Errorf("%w: zero channels, sample rate or bits", ErrInvalidWAV)
+	}
+	if want := f.Channels * ((f.BitsPerSample + 7) / 8); f.BlockAlign != want {
+		return fmt.Errorf("%w: block align %d, want %d", ErrInvalidWAV, f.BlockAlign, want)
+	}
+	if want := f.SampleRate * uint32(f.BlockAlign); f.ByteRate != want {
+		return fmt.Errorf("%w: byte rate %d, want %d", ErrInvalidWAV, f.ByteRate, want)
+	}
+	return nil
+}
+
+// IsWAV 判断数据是否为 RIFF/WAVE 容器
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+}
+
+// ParseWAV 解析 WAV 容器
+// 遍历 RIFF 子块，读取并校验 fmt 块，返回 data 块的音频数据；其他块（LIST、fact 等）被忽略
+// 流式生成的 WAV 常把 data 长度写为 0 或 0xFFFFFFFF，此时取到数据末尾
+// 参数：
+//   - data: 完整的 WAV 文件数据
+//
+// 返回值:
+//   - *WAVFormat: fmt 块
+//   - []byte: 音频数据（与入参共享底层数组）
+//   - error: 非 WAV 容器或结构非法时返回 ErrNotWAV / ErrInvalidWAV
+func ParseWAV(data []byte) (*WAVFormat, []byte, error) {
+	if !IsWAV(data) {
+		return nil, nil, ErrNotWAV
+	}
+
+	var format *WAVFormat
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > len(body) {
+				return nil, nil, fmt.Errorf("%w: fmt chunk size %d", ErrInvalidWAV, size)
+			}
+			format = parseFmt(body[:size])
+			if err := format.validate(); err != nil {
+				return nil, nil, err
+			}
+		case "data":
+			if format == nil {
+				return nil, nil, fmt.Errorf("%w: data chunk before fmt", ErrInvalidWAV)
+			}
+			if size == 0 || size > len(body) {
+				size = len(body)
+			}
+			return format, body[:size], nil
+		}
+
+		if size > len(body) {
+			break
+		}
+		pos += 8 + size + size%2 // 子块按偶数字节对齐
+	}
+
+	if format == nil {
+		return nil, nil, fmt.Errorf("%w: missing fmt chunk", ErrInvalidWAV)
+	}
+	return nil, nil, fmt.Errorf("%w: missing data chunk", ErrInvalidWAV)
+}
+
+// parseFmt 解析 fmt 块，Extensible 格式取子格式 GUID 的前 2 字节作为编码标识
+func parseFmt(chunk []byte) *WAVFormat {
+	format := &WAVFormat{
+		AudioFormat:   binary.LittleEndian.Uint16(chunk[0:2]),
+		Channels:      binary.LittleEndian.Uint16(chunk[2:4]),
+		SampleRate:    binary.LittleEndian.Uint32(chunk[4:8]),
+		ByteRate:      binary.LittleEndian.Uint32(chunk[8:12]),
+		BlockAlign:    binary.LittleEndian.Uint16(chunk[12:14]),
+		BitsPerSample: binary.LittleEndian.Uint16(chunk[14:16]),
+	}
+	// cbSize(2) + validBits(2) + channelMask(4) + subFormat(16)
+	if format.AudioFormat == WAVFormatExtensible && len(chunk) >= 40 {
+		format.AudioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+	}
+	return format
+}
+
+// EncodeWAV 为音频数据添加 WAV 头
+// 参数：
+//   - format: fmt 块
+//   - data: 音频数据
+//
+// 返回值:
+//   - []byte: 完整的 WAV 文件数据
+func EncodeWAV(format WAVFormat, data []byte) []byte {
+	out := make([]byte, wavHeaderSize+len(data)+len(data)%2)
+	copy(out[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	copy(out[8:12], "WAVE")
+
+	copy(out[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(out[16:20], 16)
+	binary.LittleEndian.PutUint16(out[20:22], format.AudioFormat)
+	binary.LittleEndian.PutUint16(out[22:24], format.Channels)
+	binary.LittleEndian.PutUint32(out[24:28], format.SampleRate)
+	binary.LittleEndian.PutUint32(out[28:32], format.ByteRate)
+	binary.LittleEndian.PutUint16(out[32:34], format.BlockAlign)
+	binary.LittleEndian.PutUint16(out[34:36], format.BitsPerSample)
+
+	copy(out[36:40], "data")
+	binary.LittleEndian.PutUint32(out[40:44], uint32(len(data)))
+	copy(out[wavHeaderSize:], data)
+	return out
+}
+
+// WrapPCM 为 16 位 PCM 添加 WAV 头
+func WrapPCM(pcm []byte, sampleRate, channels int) []byte {
+	return EncodeWAV(NewWAVFormat(EncodingPCM16, sampleRate, channels), pcm)
+}
+
+// StripWAV 去除 WAV 头，非 WAV 数据原样返回
+// 参数：
+//   - data: 音频数据
+//
+// 返回值:
+//   - []byte: 去除 WAV 头后的音频数据
+//   - *WAVFormat: fmt 块，非 WAV 数据时为 nil
+//   - error: WAV 结构非法时返回错误
+func StripWAV(data []byte) ([]byte, *WAVFormat, error) {
+	if !IsWAV(data) {
+		return data, nil, nil
+	}
+	format, body, err := ParseWAV(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, format, nil
+}
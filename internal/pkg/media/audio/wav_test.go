@@ -0,0 +1,101 @@
+// 测试 WAV 容器解析与生成
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestWAVRoundTrip(t *testing.T) {
+	pcm := Bytes([]int16{1, -1, 1000, -1000})
+	wav := WrapPCM(pcm, 16000, 1)
+	if len(wav) != 44+len(pcm) || !IsWAV(wav) {
+		t.Fatalf("unexpected wav: %d bytes", len(wav))
+	}
+
+	format, body, err := ParseWAV(wav)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != 16000 || format.Channels != 1 || format.ByteRate != 32000 {
+		t.Errorf("unexpected format: %+v", format)
+	}
+	if enc, err := format.Encoding(); err != nil || enc != EncodingPCM16 {
+		t.Errorf("encoding = %v, %v", enc, err)
+	}
+	if !bytes.Equal(body, pcm) {
+		t.Error("data chunk mismatch")
+	}
+
+	// 非 WAV 数据原样返回
+	raw, f, err := StripWAV(pcm)
+	if err != nil || f != nil || !bytes.Equal(raw, pcm) {
+		t.Errorf("StripWAV(raw) = %v, %v, %v", raw, f, err)
+	}
+}
+
+func TestParseWAVChunks(t *testing.T) {
+	alaw := []byte{0xD5, 0x55, 0xD5}
+	wav := EncodeWAV(NewWAVFormat(EncodingALaw, 8000, 1), alaw)
+
+	// 在 fmt 与 data 之间插入奇数长度的 LIST 块
+	list := []byte("LIST\x03\x00\x00\x00abc\x00")
+	withList := append(append(append([]byte{}, wav[:36]...), list...), wav[36:]...)
+	binary.LittleEndian.PutUint32(withList[4:8], uint32(len(withList)-8))
+
+	format, body, err := ParseWAV(withList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc, _ := format.Encoding(); enc != EncodingALaw || !bytes.Equal(body, alaw) {
+		t.Errorf("unexpected result: %+v, %v", format, body)
+	}
+
+	// 流式 WAV：data 长度未知
+	streaming := append([]byte{}, wav...)
+	binary.LittleEndian.PutUint32(streaming[40:44], 0xFFFFFFFF)
+	if _, body, err := ParseWAV(streaming); err != nil || len(body) != len(alaw)+1 {
+		t.Errorf("streaming wav: %d bytes, %v", len(body), err)
+	}
+}
+
+func TestParseWAVRejects(t *testing.T) {
+	valid := WrapPCM(make([]byte, 8), 16000, 2)
+	corrupt := func(off int, v uint16) []byte {
+		p := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint16(p[off:], v)
+		return p
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"raw pcm", make([]byte, 64), ErrNotWAV},
+		{"truncated", valid[:30], ErrInvalidWAV},
+		{"no data chunk", valid[:36], ErrInvalidWAV},
+		{"bad block align", corrupt(32, 2), ErrInvalidWAV},
+		{"zero channels", corrupt(22, 0), ErrInvalidWAV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseWAV(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 8 位 PCM 结构合法但不支持转换
+	format := NewWAVFormat(EncodingPCM16, 8000, 1)
+	format.BitsPerSample, format.BlockAlign, format.ByteRate = 8, 1, 8000
+	parsed, _, err := ParseWAV(EncodeWAV(format, []byte{1, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsed.Encoding(); !errors.Is(err, ErrUnsupportedWAV) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedWAV)
+	}
+}
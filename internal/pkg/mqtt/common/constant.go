@@ -2,7 +2,9 @@
 package common
 
 const (
-	VoiceVersion = 0x01 // 版本号 1.0
+	VoiceVersionV1 = 0x01           // 版本号 1.0 12字节协议头
+	VoiceVersionV2 = 0x02           // 版本号 2.0 20字节协议头（会话ID、32位序号与时间戳）
+	VoiceVersion   = VoiceVersionV1 // 默认版本号
 
 	// 音频帧类型
 	VoiceFrameFull     = 0x01 // 完整帧
@@ -19,6 +21,12 @@ const (
 	VoiceAudioFormatWav   = 0x07 // wav
 )
 
+// 命令类型（topic 第四级）
+const (
+	CommandVoice   = "voice" // 语音
+	CommandControl = "cmd"   // 控制指令（JSON）
+)
+
 // AudioFormatString 获取音频格式
 func AudioFormatString(format uint8) string {
 	switch format {
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"time"
 	logger "yunyez/internal/pkg/logger"
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	"yunyez/internal/pkg/mqtt/protocol/control"
 	"yunyez/internal/pkg/mqtt/protocol/voice"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
@@ -14,6 +16,7 @@ import (
 
 var (
 	ErrMQTTClientNotInit = errors.New("mqtt.client not init")
+	ErrPayloadTooLarge   = errors.New("mqtt.payload exceeds max payload length")
 )
 
 // Client 封装的一个自定义的 MQTT 客户端
@@ -26,6 +29,7 @@ type Client struct {
 	RequestID string             // 请求ID
 	ReplayID  string             // 回复ID 防止对话回答错位
 	Data      []byte             // 消息数据
+	Session   *voice.Session     // 语音会话 决定下行协议版本与会话ID，为空时使用 v1
 }
 
 // Init 初始化 MQTT 客户端
@@ -57,6 +61,8 @@ func GetMQTTClient(ctx context.Context, topic Topic) (Client, error) {
 }
 
 // Publish 发送消息到指定topic
+// 整段数据作为一个完整帧发送，超过 voice.MaxPayloadLen 时返回 ErrPayloadTooLarge，
+// 较长的音频请使用 AudioPublisher 分片发送
 // 参数:
 //   - ctx: 上下文
 //   - data: 消息数据 字节切片
@@ -72,7 +78,15 @@ func (c *Client) Publish(ctx context.Context, data []byte, audioConfig voice.Aud
 		})
 		return ErrMQTTClientNotInit
 	}
-	payload := voice.BuildFullPayload(0, data, audioConfig)
+	if len(data) > voice.MaxPayloadLen {
+		logger.Error(ctx, "mqtt.publish payload too large", map[string]interface{}{
+			"topic":    c.Topic.String(),
+			"data_len": len(data),
+			"error":    ErrPayloadTooLarge,
+		})
+		return ErrPayloadTooLarge
+	}
+	payload := c.buildPayload(0, data, mqttCommon.VoiceFrameFull, audioConfig)
 	err := send(ctx, c.Client, c.Topic, c.Qos, payload)
 	if err != nil {
 		logger.Error(ctx, "mqtt.publishStream error", map[string]interface{}{
@@ -96,14 +110,14 @@ func (c *Client) Publish(ctx context.Context, data []byte, audioConfig voice.Aud
 // PublishStream 发送流式消息到指定topic
 // 参数:
 //   - ctx: 上下文
-//   - seq: 消息序号 从0开始递增
+//   - seq: 消息序号 从0开始递增（v1 协议仅保留低 16 位）
 //   - data: 消息数据 字节切片
 //   - audioConfig: 语音配置[采样率、格式、声道数]
 //   - isLast: 是否为最后一帧
 //
 // 返回值:
 //   - error: 错误信息
-func (c Client) PublishStream(ctx context.Context, seq uint16, data []byte, audioConfig voice.AudioConfig, isLast bool) error {
+func (c Client) PublishStream(ctx context.Context, seq uint32, data []byte, audioConfig voice.AudioConfig, isLast bool) error {
 	if c.Client == nil {
 		logger.Error(ctx, "mqtt.client not init", map[string]interface{}{
 			"topic": c.Topic.String(),
@@ -111,7 +125,16 @@ func (c Client) PublishStream(ctx context.Context, seq uint16, data []byte, audi
 		})
 		return ErrMQTTClientNotInit
 	}
-	payload := voice.BuildStreamPayload(seq, data, audioConfig, isLast)
+	if len(data) > voice.MaxPayloadLen {
+		logger.Error(ctx, "mqtt.publishStream payload too large", map[string]interface{}{
+			"topic":    c.Topic.String(),
+			"seq":      seq,
+			"data_len": len(data),
+			"error":    ErrPayloadTooLarge,
+		})
+		return ErrPayloadTooLarge
+	}
+	payload := c.buildPayload(seq, data, voice.StreamFrameType(isLast), audioConfig)
 	err := send(ctx, c.Client, c.Topic, c.Qos, payload)
 	if err != nil {
 		logger.Error(ctx, "mqtt.send error", map[string]interface{}{
@@ -134,6 +157,65 @@ func (c Client) PublishStream(ctx context.Context, seq uint16, data []byte, audi
 	return nil
 }
 
+// PublishCommand 发送控制消息到指定topic
+// 控制消息为 JSON 文本，不带语音协议头
+// 参数:
+//   - ctx: 上下文
+//   - data: 消息数据 字节切片
+//
+// 返回值:
+//   - error: 错误信息
+func (c *Client) PublishCommand(ctx context.Context, data []byte) error {
+	if c.Client == nil {
+		logger.Error(ctx, "mqtt.client not init", map[string]interface{}{
+			"topic": c.Topic.String(),
+			"error": ErrMQTTClientNotInit,
+		})
+		return ErrMQTTClientNotInit
+	}
+	err := send(ctx, c.Client, c.Topic, c.Qos, data)
+	if err != nil {
+		logger.Error(ctx, "mqtt.publishCommand error", map[string]interface{}{
+			"topic": c.Topic.String(),
+			"error": err,
+		})
+		return err
+	}
+
+	logger.Info(ctx, "mqtt.publishCommand success", map[string]interface{}{
+		"topic":       c.Topic.String(),
+		"payload_len": len(data),
+	})
+	return nil
+}
+
+// PublishControl 发送控制协议消息到指定topic
+// 请求ID与回复ID取自控制消息，便于按ID关联指令与应答
+// 参数:
+//   - ctx: 上下文
+//   - msg: 控制消息
+//
+// 返回值:
+//   - error: 错误信息
+func (c *Client) PublishControl(ctx context.Context, msg *control.Message) error {
+	data, err := control.Encode(msg)
+	if err != nil {
+		return err
+	}
+	c.RequestID = msg.ID
+	c.ReplayID = msg.ReplyID
+	return c.PublishCommand(ctx, data)
+}
+
+// buildPayload 构建下行音频消息
+// 设置了语音会话时按会话协商的版本构建，否则使用 v1 协议头
+func (c *Client) buildPayload(seq uint32, data []byte, frameType uint8, audioConfig voice.AudioConfig) []byte {
+	if c.Session != nil {
+		return c.Session.Build(seq, data, frameType, audioConfig)
+	}
+	return voice.BuildPayload(uint16(seq), data, frameType, audioConfig)
+}
+
 // send 实际发送函数
 // 内部调用mqtt客户端的Publish方法
 func send(ctx context.Context, client paho.Client, topic Topic, qos byte, data []byte) error {
@@ -6,7 +6,9 @@ import (
 
 	config "yunyez/internal/common/config"
 	logger "yunyez/internal/pkg/logger"
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
 	"yunyez/internal/pkg/mqtt/handler"
+	"yunyez/internal/pkg/mqtt/protocol/voice"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
@@ -69,6 +71,20 @@ var (
 				return
 			}
 
+			// 语音帧入站校验，损坏的帧不再转发
+			if topicObj.CommandType == mqttCommon.CommandVoice {
+				if _, _, err := voice.Decode(msg.Payload()); err != nil {
+					reason := voice.Rejects.Record(topicObj.DeviceSN, err)
+					logger.Warn(ctx, "mqtt.core.voice frame rejected", map[string]interface{}{
+						"topic":    topic,
+						"reason":   reason,
+						"rejected": voice.Rejects.Total(topicObj.DeviceSN),
+						"error":    err,
+					})
+					return
+				}
+			}
+
 			message := &handler.Message{
 				Topic:       topic,
 				CommandType: topicObj.CommandType,
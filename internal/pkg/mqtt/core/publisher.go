@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	"yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+var (
+	ErrPublisherClosed = errors.New("mqtt.audio publisher closed")
+)
+
+// DefaultPublishLead 默认允许领先实时播放的时长
+const DefaultPublishLead = 300 * time.Millisecond
+
+// PublishConfig 下行音频分片发布参数
+type PublishConfig struct {
+	MTU    int           // 设备单帧最大字节数（含协议头），<= 0 时使用 voice.DefaultMTU
+	Pacing bool          // 是否按实时速率发送
+	Lead   time.Duration // 允许领先实时播放的时长（设备预缓冲）
+}
+
+// AudioPublisher 下行音频分片发布器
+// 将任意长度的音频按设备 MTU 切分为分片帧，通过 PublishStream 依次发送，
+// 序号递增，关闭时发送最后一帧（VoiceFrameLast）
+// 开启节流后按音频时长控制发送速率，避免设备缓冲区溢出
+type AudioPublisher struct {
+	MTU    int           // 单帧最大字节数（含协议头）
+	Pacing bool          // 是否按实时速率发送
+	Lead   time.Duration // 允许领先实时播放的时长（设备预缓冲）
+
+	client  *Client
+	config  voice.AudioConfig
+	seq     uint32
+	pending []byte        // 未满一帧的尾部数据，留待下次写入或关闭时发送
+	sent    time.Duration // 已发送音频时长
+	start   time.Time     // 首帧发送时间
+	closed  bool
+}
+
+// NewAudioPublisher 创建下行音频分片发布器
+// 参数:
+//   - client: MQTT 客户端，其 Session 决定协议版本与会话ID
+//   - audioConfig: 语音配置[采样率、格式、声道数]
+//   - publishConfig: 分帧与节流参数
+//
+// 返回值:
+//   - *AudioPublisher: 音频分片发布器
+func NewAudioPublisher(client *Client, audioConfig voice.AudioConfig, publishConfig PublishConfig) *AudioPublisher {
+	return &AudioPublisher{
+		MTU:    publishConfig.MTU,
+		Pacing: publishConfig.Pacing,
+		Lead:   publishConfig.Lead,
+		client: client,
+		config: audioConfig,
+	}
+}
+
+// Write 追加音频数据，满一帧即发送
+// 参数:
+//   - ctx: 上下文
+//   - data: 音频数据
+//
+// 返回值:
+//   - error: 错误信息
+func (p *AudioPublisher) Write(ctx context.Context, data []byte) error {
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	p.pending = append(p.pending, data...)
+
+	size := p.frameSize()
+	offset := 0
+	// 严格大于：保留最后一块，保证 Close 时最后一帧携带数据
+	for len(p.pending)-offset > size {
+		if err := p.send(ctx, p.pending[offset:offset+size], false); err != nil {
+			return err
+		}
+		offset += size
+	}
+	p.pending = append(p.pending[:0], p.pending[offset:]...)
+	return nil
+}
+
+// Close 发送剩余数据作为最后一帧
+// 参数:
+//   - ctx: 上下文
+//
+// 返回值:
+//   - error: 错误信息
+func (p *AudioPublisher) Close(ctx context.Context) error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	err := p.send(ctx, p.pending, true)
+	p.pending = nil
+	return err
+}
+
+// Publish 发送一段完整音频：分片发送并以最后一帧结束
+// 参数:
+//   - ctx: 上下文
+//   - data: 音频数据
+//
+// 返回值:
+//   - error: 错误信息
+func (p *AudioPublisher) Publish(ctx context.Context, data []byte) error {
+	if err := p.Write(ctx, data); err != nil {
+		return err
+	}
+	return p.Close(ctx)
+}
+
+// Frames 获取已发送的帧数
+func (p *AudioPublisher) Frames() uint32 {
+	return p.seq
+}
+
+// frameSize 单帧载荷字节数
+func (p *AudioPublisher) frameSize() int {
+	version := uint8(mqttCommon.VoiceVersion)
+	if p.client.Session != nil {
+		version = p.client.Session.Version
+	}
+	return voice.FramePayloadSize(p.MTU, version, p.config)
+}
+
+// send 发送一帧并推进序号
+func (p *AudioPublisher) send(ctx context.Context, chunk []byte, isLast bool) error {
+	if err := p.pace(ctx); err != nil {
+		return err
+	}
+	if err := p.client.PublishStream(ctx, p.seq, chunk, p.config, isLast); err != nil {
+		return err
+	}
+	p.seq++
+	p.sent += voice.AudioDuration(p.config, len(chunk))
+	return nil
+}
+
+// pace 节流：已发送音频超出实时播放进度 Lead 以上时等待
+func (p *AudioPublisher) pace(ctx context.Context) error {
+	if !p.Pacing {
+		return nil
+	}
+	if p.start.IsZero() {
+		p.start = time.Now()
+		return nil
+	}
+	wait := p.sent - time.Since(p.start) - p.Lead
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,166 @@
+// 测试下行音频分片发布：按帧大小切分、序号递增、关闭时发送最后一帧、按实时速率节流
+package core
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	"yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+// doneToken 立即完成的发布结果
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+func (doneToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// fakeClient 记录发布的消息，未实现的方法调用时 panic
+type fakeClient struct {
+	paho.Client
+	mu       sync.Mutex
+	payloads [][]byte
+}
+
+func (f *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.payloads = append(f.payloads, append([]byte(nil), payload.([]byte)...))
+	return doneToken{}
+}
+
+// frames 解码已发布的帧
+func (f *fakeClient) frames(t *testing.T) ([]*voice.Header, [][]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var headers []*voice.Header
+	var chunks [][]byte
+	for _, p := range f.payloads {
+		h, data, err := voice.Decode(p)
+		require.NoError(t, err)
+		headers = append(headers, h)
+		chunks = append(chunks, data)
+	}
+	return headers, chunks
+}
+
+// pcmConfig 16kHz 单声道 PCM，每 320 字节 10ms
+var pcmConfig = voice.AudioConfig{
+	AudioSampleRate: 16000,
+	AudioChannel:    1,
+	AudioFormat:     mqttCommon.VoiceAudioFormatPcm,
+}
+
+// newTestPublisher 单帧载荷 320 字节、不节流的发布器
+func newTestPublisher() (*AudioPublisher, *fakeClient) {
+	fake := &fakeClient{}
+	return NewAudioPublisher(&Client{Client: fake}, pcmConfig, PublishConfig{MTU: voice.HeaderSize + 320}), fake
+}
+
+func TestAudioPublisherSplitsFrames(t *testing.T) {
+	p, fake := newTestPublisher()
+	ctx := context.Background()
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// 未超过一帧时暂存
+	require.NoError(t, p.Write(ctx, data[:300]))
+	assert.Empty(t, fake.payloads)
+
+	require.NoError(t, p.Write(ctx, data[300:]))
+	assert.Equal(t, uint32(3), p.Frames())
+
+	require.NoError(t, p.Close(ctx))
+	headers, chunks := fake.frames(t)
+	require.Len(t, headers, 4)
+	for i, h := range headers {
+		assert.Equal(t, uint16(i), uint16(h.FrameSeq))
+		want := uint8(mqttCommon.VoiceFrameFragment)
+		if i == len(headers)-1 {
+			want = mqttCommon.VoiceFrameLast
+		}
+		assert.Equal(t, want, h.F, "frame %d", i)
+	}
+	assert.Equal(t, []int{320, 320, 320, 40}, []int{len(chunks[0]), len(chunks[1]), len(chunks[2]), len(chunks[3])})
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	assert.Equal(t, uint32(4), p.Frames())
+}
+
+func TestAudioPublisherLastFrameCarriesData(t *testing.T) {
+	p, fake := newTestPublisher()
+	ctx := context.Background()
+
+	// 恰好两帧：最后一块留到关闭时作为最后一帧发送
+	require.NoError(t, p.Write(ctx, make([]byte, 640)))
+	assert.Equal(t, uint32(1), p.Frames())
+	require.NoError(t, p.Close(ctx))
+
+	headers, chunks := fake.frames(t)
+	require.Len(t, headers, 2)
+	assert.Equal(t, uint8(mqttCommon.VoiceFrameLast), headers[1].F)
+	assert.Len(t, chunks[1], 320)
+}
+
+func TestAudioPublisherEmptyLastFrame(t *testing.T) {
+	p, fake := newTestPublisher()
+	ctx := context.Background()
+
+	// 没有数据时关闭仍发送最后一帧，设备据此结束播放
+	require.NoError(t, p.Close(ctx))
+	headers, chunks := fake.frames(t)
+	require.Len(t, headers, 1)
+	assert.Equal(t, uint32(0), headers[0].FrameSeq)
+	assert.Equal(t, uint8(mqttCommon.VoiceFrameLast), headers[0].F)
+	assert.Empty(t, chunks[0])
+
+	// 重复关闭不再发送，关闭后不能写入
+	require.NoError(t, p.Close(ctx))
+	assert.ErrorIs(t, p.Write(ctx, make([]byte, 10)), ErrPublisherClosed)
+	assert.Len(t, fake.payloads, 1)
+}
+
+func TestAudioPublisherPacing(t *testing.T) {
+	p, _ := newTestPublisher()
+	p.Pacing, p.Lead = true, 0
+	ctx := context.Background()
+
+	// 10 帧共 100ms，最后一帧发送前已发送 90ms 的音频
+	start := time.Now()
+	require.NoError(t, p.Publish(ctx, make([]byte, 3200)))
+	assert.GreaterOrEqual(t, time.Since(start), voice.AudioDuration(pcmConfig, 2880)-5*time.Millisecond)
+	assert.Equal(t, uint32(10), p.Frames())
+
+	// 领先量足够时不等待
+	p, _ = newTestPublisher()
+	p.Pacing, p.Lead = true, time.Second
+	start = time.Now()
+	require.NoError(t, p.Publish(ctx, make([]byte, 3200)))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestAudioPublisherPacingCanceled(t *testing.T) {
+	p, fake := newTestPublisher()
+	p.Pacing, p.Lead = true, 0
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// 1 秒的音频在取消前无法发完
+	err := p.Write(ctx, make([]byte, 32000))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, len(fake.payloads), 10)
+}
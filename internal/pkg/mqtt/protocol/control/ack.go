@@ -0,0 +1,140 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAckTimeout = errors.New("control command ack timeout")
+	ErrRejected   = errors.New("control command rejected by device")
+	ErrPending    = errors.New("control command already pending")
+)
+
+// 应答等待默认值
+const (
+	DefaultAckTimeout = 3 * time.Second
+	DefaultRetries    = 2
+)
+
+// PublishFunc 发送序列化后的控制消息
+type PublishFunc func(ctx context.Context, data []byte) error
+
+// AckManager 跟踪已下发指令的应答，超时未应答时以相同请求ID重发
+type AckManager struct {
+	Timeout time.Duration // 单次等待应答的超时时间
+	Retries int           // 超时后的重发次数
+
+	mu      sync.Mutex
+	pending map[string]chan *Message
+}
+
+// NewAckManager 创建应答管理器
+// 参数：
+//   - timeout: 单次等待应答的超时时间，<= 0 时使用 DefaultAckTimeout
+//   - retries: 超时后的重发次数，< 0 时不重发
+//
+// 返回值:
+//   - *AckManager: 应答管理器
+func NewAckManager(timeout time.Duration, retries int) *AckManager {
+	if timeout <= 0 {
+		timeout = DefaultAckTimeout
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	return &AckManager{
+		Timeout: timeout,
+		Retries: retries,
+		pending: make(map[string]chan *Message),
+	}
+}
+
+// Send 发送指令并等待设备应答
+// 参数：
+//   - ctx: 上下文，取消时停止等待
+//   - msg: 指令
+//   - publish: 发送函数，每次（重）发都会调用
+//
+// 返回值:
+//   - *Message: 设备应答
+//   - error: 发送失败、ErrAckTimeout（重发后仍未应答）、ErrRejected（应答结果码非 0）
+func (m *AckManager) Send(ctx context.Context, msg *Message, publish PublishFunc) (*Message, error) {
+	data, err := Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	if msg.IsAck() {
+		return nil, fmt.Errorf("%w: ack does not wait for ack", ErrInvalidMessage)
+	}
+
+	ch := make(chan *Message, 1)
+	m.mu.Lock()
+	if _, ok := m.pending[msg.ID]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrPending, msg.ID)
+	}
+	m.pending[msg.ID] = ch
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, msg.ID)
+		m.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(m.Timeout)
+	defer timer.Stop()
+	for attempt := 0; ; attempt++ {
+		if err := publish(ctx, data); err != nil {
+			return nil, err
+		}
+		timer.Reset(m.Timeout)
+		select {
+		case ack := <-ch:
+			if !ack.OK() {
+				return ack, fmt.Errorf("%w: %s code=%d %s", ErrRejected, msg.Type, ack.Code, ack.Message)
+			}
+			return ack, nil
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-timer.C:
+			if attempt >= m.Retries {
+				return nil, fmt.Errorf("%w: %s id=%s after %d attempts", ErrAckTimeout, msg.Type, msg.ID, attempt+1)
+			}
+		}
+	}
+}
+
+// Resolve 将设备应答交给等待中的 Send
+// 参数：
+//   - ack: 设备应答
+//
+// 返回值:
+//   - bool: 是否有对应的待应答指令，重复应答或已超时的应答返回 false
+func (m *AckManager) Resolve(ack *Message) bool {
+	if ack == nil || !ack.IsAck() {
+		return false
+	}
+	m.mu.Lock()
+	ch, ok := m.pending[ack.ReplyID]
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- ack:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pending 待应答的指令数
+func (m *AckManager) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pending)
+}
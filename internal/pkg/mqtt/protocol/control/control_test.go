@@ -0,0 +1,152 @@
+// 测试控制消息的构建、校验与应答等待
+package control
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuildAndDecode(t *testing.T) {
+	msg, err := NewCommand(TypeSetTemperature).Param("temperature", 26).Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if msg.ID == "" || msg.Timestamp == 0 || msg.Version != Version {
+		t.Fatalf("envelope not filled: %+v", msg)
+	}
+
+	data, err := Encode(msg)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	got, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.ID != msg.ID || got.Type != TypeSetTemperature || got.Params["temperature"] != float64(26) {
+		t.Errorf("round trip = %+v", got)
+	}
+
+	ack := NewAck(got, CodeOK, "")
+	data, err = Encode(ack)
+	if err != nil {
+		t.Fatalf("Encode ack: %v", err)
+	}
+	got, err = Decode(data)
+	if err != nil {
+		t.Fatalf("Decode ack: %v", err)
+	}
+	if !got.IsAck() || !got.OK() || got.ReplyID != msg.ID {
+		t.Errorf("ack = %+v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"not json", `{`, ErrInvalidMessage},
+		{"version", `{"version":2,"kind":"command","id":"1","type":"cancel"}`, ErrUnsupportedVersion},
+		{"empty id", `{"version":1,"kind":"command","type":"cancel"}`, ErrInvalidMessage},
+		{"unknown kind", `{"version":1,"kind":"event","id":"1","type":"cancel"}`, ErrInvalidMessage},
+		{"unknown type", `{"version":1,"kind":"command","id":"1","type":"reboot"}`, ErrUnknownType},
+		{"missing param", `{"version":1,"kind":"command","id":"1","type":"set_light"}`, ErrInvalidMessage},
+		{"param kind", `{"version":1,"kind":"command","id":"1","type":"set_light","params":{"on":"yes"}}`, ErrInvalidMessage},
+		{"param range", `{"version":1,"kind":"command","id":"1","type":"set_volume","params":{"volume":120}}`, ErrInvalidMessage},
+		{"unknown param", `{"version":1,"kind":"command","id":"1","type":"cancel","params":{"x":1}}`, ErrInvalidMessage},
+		{"ack without reply", `{"version":1,"kind":"ack","id":"2","type":"cancel"}`, ErrInvalidMessage},
+		{"command", `{"version":1,"kind":"command","id":"1","type":"play_music"}`, nil},
+		{"ack of unknown type", `{"version":1,"kind":"ack","id":"2","reply_id":"1","type":"reboot","code":2}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.data))
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Decode = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAckManagerResolve(t *testing.T) {
+	m := NewAckManager(time.Second, 0)
+	msg, _ := NewCommand(TypeStopPlayback).Build()
+
+	ack, err := m.Send(context.Background(), msg, func(ctx context.Context, data []byte) error {
+		cmd, err := Decode(data)
+		if err != nil {
+			return err
+		}
+		go m.Resolve(NewAck(cmd, CodeOK, ""))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if ack.ReplyID != msg.ID {
+		t.Errorf("ack reply_id = %s, want %s", ack.ReplyID, msg.ID)
+	}
+	if m.Pending() != 0 {
+		t.Error("pending command not removed")
+	}
+	// 迟到的重复应答被丢弃
+	if m.Resolve(NewAck(msg, CodeOK, "")) {
+		t.Error("resolved an ack with no pending command")
+	}
+}
+
+func TestAckManagerRetry(t *testing.T) {
+	m := NewAckManager(10*time.Millisecond, 2)
+	msg, _ := NewCommand(TypeStopPlayback).Build()
+
+	var sent atomic.Int32
+	_, err := m.Send(context.Background(), msg, func(ctx context.Context, data []byte) error {
+		cmd, _ := Decode(data)
+		if cmd.ID != msg.ID {
+			t.Errorf("retry id = %s, want %s", cmd.ID, msg.ID)
+		}
+		sent.Add(1)
+		return nil
+	})
+	if !errors.Is(err, ErrAckTimeout) {
+		t.Fatalf("Send = %v, want %v", err, ErrAckTimeout)
+	}
+	if n := sent.Load(); n != 3 {
+		t.Errorf("sent %d times, want 3", n)
+	}
+}
+
+func TestAckManagerRejected(t *testing.T) {
+	m := NewAckManager(time.Second, 0)
+	msg, _ := NewCommand(TypeSetLight).Param("on", true).Build()
+
+	ack, err := m.Send(context.Background(), msg, func(ctx context.Context, data []byte) error {
+		go m.Resolve(NewAck(msg, CodeUnsupported, "no light"))
+		return nil
+	})
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("Send = %v, want %v", err, ErrRejected)
+	}
+	if ack == nil || ack.Code != CodeUnsupported {
+		t.Errorf("ack = %+v", ack)
+	}
+}
+
+func TestAckManagerCancel(t *testing.T) {
+	m := NewAckManager(time.Second, 0)
+	msg, _ := NewCommand(TypeStopPlayback).Build()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, err := m.Send(ctx, msg, func(ctx context.Context, data []byte) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send = %v, want %v", err, context.Canceled)
+	}
+}
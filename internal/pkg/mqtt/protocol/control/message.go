@@ -0,0 +1,191 @@
+// Package control 设备控制消息协议
+// 控制消息为 JSON 文本，与二进制语音协议分开，使用 cmd 命令类型的主题：
+//   - 服务端 -> 设备：<厂商名称>/<设备类型>/<设备序列号>/cmd/client
+//   - 设备 -> 服务端：<厂商名称>/<设备类型>/<设备序列号>/cmd/server
+//
+// 消息分为指令（command）与应答（ack）两类。每条指令带唯一的请求ID，
+// 接收方以 reply_id 指向该ID回复应答；发送方未按时收到应答时以相同ID重发，接收方应按ID去重
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Version 当前协议版本
+const Version = 1
+
+// 消息类别
+const (
+	KindCommand = "command" // 指令
+	KindAck     = "ack"     // 应答
+)
+
+// 应答结果码
+const (
+	CodeOK          = 0 // 执行成功
+	CodeBadRequest  = 1 // 指令非法
+	CodeUnsupported = 2 // 不支持的指令
+	CodeFailed      = 3 // 执行失败
+)
+
+var (
+	ErrInvalidMessage     = errors.New("invalid control message")
+	ErrUnsupportedVersion = errors.New("unsupported control message version")
+	ErrUnknownType        = errors.New("unknown control command type")
+)
+
+// Message 控制消息
+type Message struct {
+	Version   int            `json:"version"`            // 协议版本
+	Kind      string         `json:"kind"`               // 消息类别：command / ack
+	ID        string         `json:"id"`                 // 消息ID（请求ID）
+	ReplyID   string         `json:"reply_id,omitempty"` // 应答对应的指令ID
+	Type      string         `json:"type"`               // 指令类型，应答沿用指令的类型
+	Timestamp int64          `json:"timestamp"`          // 发送时间（毫秒时间戳）
+	Params    map[string]any `json:"params,omitempty"`   // 指令参数
+	Code      int            `json:"code,omitempty"`     // 应答结果码
+	Message   string         `json:"message,omitempty"`  // 应答说明
+}
+
+// IsAck 是否为应答
+func (m *Message) IsAck() bool {
+	return m.Kind == KindAck
+}
+
+// OK 应答是否表示执行成功
+func (m *Message) OK() bool {
+	return m.Code == CodeOK
+}
+
+// Builder 指令构建器
+type Builder struct {
+	msg Message
+}
+
+// NewCommand 创建指令构建器，自动生成请求ID
+// 参数：
+//   - typ: 指令类型
+//
+// 返回值:
+//   - *Builder: 指令构建器
+func NewCommand(typ string) *Builder {
+	return &Builder{msg: Message{
+		Version: Version,
+		Kind:    KindCommand,
+		ID:      uuid.NewString(),
+		Type:    typ,
+	}}
+}
+
+// ID 指定请求ID
+func (b *Builder) ID(id string) *Builder {
+	b.msg.ID = id
+	return b
+}
+
+// Param 设置指令参数
+func (b *Builder) Param(key string, value any) *Builder {
+	if b.msg.Params == nil {
+		b.msg.Params = make(map[string]any)
+	}
+	b.msg.Params[key] = value
+	return b
+}
+
+// Params 批量设置指令参数
+func (b *Builder) Params(params map[string]any) *Builder {
+	for k, v := range params {
+		b.Param(k, v)
+	}
+	return b
+}
+
+// Build 填充时间戳并校验指令
+// 返回值:
+//   - *Message: 指令
+//   - error: 校验失败时返回错误
+func (b *Builder) Build() (*Message, error) {
+	msg := b.msg
+	msg.Timestamp = time.Now().UnixMilli()
+	if err := Validate(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// NewAck 创建指令的应答
+// 参数：
+//   - cmd: 被应答的指令
+//   - code: 结果码
+//   - message: 结果说明
+//
+// 返回值:
+//   - *Message: 应答
+func NewAck(cmd *Message, code int, message string) *Message {
+	return &Message{
+		Version:   Version,
+		Kind:      KindAck,
+		ID:        uuid.NewString(),
+		ReplyID:   cmd.ID,
+		Type:      cmd.Type,
+		Timestamp: time.Now().UnixMilli(),
+		Code:      code,
+		Message:   message,
+	}
+}
+
+// Encode 校验并序列化控制消息
+func Encode(msg *Message) ([]byte, error) {
+	if err := Validate(msg); err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
+
+// Decode 解析并校验控制消息
+// 参数：
+//   - data: JSON 控制消息
+//
+// 返回值:
+//   - *Message: 控制消息
+//   - error: 解析或校验失败时返回错误，可用 errors.Is 判断 ErrInvalidMessage 等
+func Decode(data []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if err := Validate(&msg); err != nil {
+		return &msg, err
+	}
+	return &msg, nil
+}
+
+// Validate 校验控制消息
+// 指令按类型校验参数，应答只校验信封字段
+func Validate(msg *Message) error {
+	if msg.Version != Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, msg.Version)
+	}
+	if msg.ID == "" {
+		return fmt.Errorf("%w: empty id", ErrInvalidMessage)
+	}
+	if msg.Type == "" {
+		return fmt.Errorf("%w: empty type", ErrInvalidMessage)
+	}
+	switch msg.Kind {
+	case KindAck:
+		if msg.ReplyID == "" {
+			return fmt.Errorf("%w: ack without reply_id", ErrInvalidMessage)
+		}
+		return nil
+	case KindCommand:
+		return validateParams(msg.Type, msg.Params)
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidMessage, msg.Kind)
+	}
+}
@@ -0,0 +1,142 @@
+package control
+
+import (
+	"fmt"
+	"math"
+)
+
+// 指令类型
+const (
+	TypeCancel         = "cancel"          // 设备 -> 服务端：取消当前回复
+	TypeStopPlayback   = "stop_playback"   // 服务端 -> 设备：停止播放已下发的音频
+	TypePlayMusic      = "play_music"      // 服务端 -> 设备：播放音乐
+	TypeSetTemperature = "set_temperature" // 服务端 -> 设备：设置温度
+	TypeSetVolume      = "set_volume"      // 服务端 -> 设备：调节音量
+	TypeSetLight       = "set_light"       // 服务端 -> 设备：开关灯
+	TypeSetTimer       = "set_timer"       // 服务端 -> 设备：设置定时提醒
+)
+
+// paramKind 参数类型
+type paramKind int
+
+const (
+	kindString paramKind = iota
+	kindNumber
+	kindBool
+)
+
+// String 参数类型名称
+func (k paramKind) String() string {
+	switch k {
+	case kindString:
+		return "string"
+	case kindNumber:
+		return "number"
+	default:
+		return "bool"
+	}
+}
+
+// paramSpec 参数约束
+type paramSpec struct {
+	kind     paramKind
+	required bool
+	min, max float64 // 数值范围，仅 kindNumber 且 min < max 时校验
+}
+
+// schemas 各指令类型的参数约束，未声明的参数视为非法
+var schemas = map[string]map[string]paramSpec{
+	TypeCancel:       {},
+	TypeStopPlayback: {},
+	TypePlayMusic: {
+		"song": {kind: kindString},
+	},
+	TypeSetTemperature: {
+		"temperature": {kind: kindNumber, required: true, min: 16, max: 30},
+	},
+	TypeSetVolume: {
+		"volume": {kind: kindNumber, required: true, min: 0, max: 100},
+	},
+	TypeSetLight: {
+		"on": {kind: kindBool, required: true},
+	},
+	TypeSetTimer: {
+		"seconds": {kind: kindNumber, required: true, min: 1, max: 86400},
+		"label":   {kind: kindString},
+	},
+}
+
+// Types 已定义的指令类型
+func Types() []string {
+	types := make([]string, 0, len(schemas))
+	for typ := range schemas {
+		types = append(types, typ)
+	}
+	return types
+}
+
+// validateParams 按指令类型校验参数
+func validateParams(typ string, params map[string]any) error {
+	schema, ok := schemas[typ]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownType, typ)
+	}
+	for name, spec := range schema {
+		if _, ok := params[name]; !ok && spec.required {
+			return fmt.Errorf("%w: %s missing param %s", ErrInvalidMessage, typ, name)
+		}
+	}
+	for name, value := range params {
+		spec, ok := schema[name]
+		if !ok {
+			return fmt.Errorf("%w: %s unknown param %s", ErrInvalidMessage, typ, name)
+		}
+		if err := spec.check(value); err != nil {
+			return fmt.Errorf("%w: %s param %s %v", ErrInvalidMessage, typ, name, err)
+		}
+	}
+	return nil
+}
+
+// check 校验参数值
+func (s paramSpec) check(value any) error {
+	switch s.kind {
+	case kindString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("must be a %s", s.kind)
+		}
+	case kindBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be a %s", s.kind)
+		}
+	case kindNumber:
+		n, ok := number(value)
+		if !ok || math.IsNaN(n) {
+			return fmt.Errorf("must be a %s", s.kind)
+		}
+		if s.min < s.max && (n < s.min || n > s.max) {
+			return fmt.Errorf("%v out of range [%v, %v]", n, s.min, s.max)
+		}
+	}
+	return nil
+}
+
+// number 数值参数转换为 float64，JSON 解码后的数值为 float64
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
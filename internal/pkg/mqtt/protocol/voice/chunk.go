@@ -0,0 +1,70 @@
+package voice
+
+import (
+	"math"
+	"time"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
+)
+
+const (
+	MaxPayloadLen = math.MaxUint16 // PayloadLen 为 16 位，单帧载荷上限
+	DefaultMTU    = 4096           // 默认单帧最大字节数（含协议头）
+)
+
+// SampleBlockSize 获取一个采样点（所有声道）的字节数
+// 分片边界按该值对齐，避免把一个采样拆到两帧；压缩格式无法对齐，返回 1
+func SampleBlockSize(config AudioConfig) int {
+	channels := int(config.AudioChannel)
+	if channels <= 0 {
+		channels = 1
+	}
+	switch config.AudioFormat {
+	case mqtt_common.VoiceAudioFormatPcm, mqtt_common.VoiceAudioFormatWav:
+		return 2 * channels // 16bit
+	case mqtt_common.VoiceAudioFormatG711A, mqtt_common.VoiceAudioFormatG711U:
+		return channels // 8bit
+	default:
+		return 1
+	}
+}
+
+// FramePayloadSize 计算单帧可承载的音频字节数
+// 参数：
+//   - mtu: 单帧最大字节数（含协议头），<= 0 时使用 DefaultMTU
+//   - version: 下行协议版本，决定协议头长度
+//   - config: 语音配置[采样率、格式、声道数]
+//
+// 返回值:
+//   - int: 单帧载荷字节数，不超过 MaxPayloadLen 且按采样点对齐
+func FramePayloadSize(mtu int, version uint8, config AudioConfig) int {
+	if mtu <= 0 {
+		mtu = DefaultMTU
+	}
+	size := mtu - HeaderSizeOf(version)
+	if size > MaxPayloadLen {
+		size = MaxPayloadLen
+	}
+	block := SampleBlockSize(config)
+	size -= size % block
+	if size < block {
+		size = block
+	}
+	return size
+}
+
+// AudioDuration 计算音频数据的播放时长
+// 仅支持未压缩格式（PCM/WAV/G.711），其他格式返回 0
+func AudioDuration(config AudioConfig, n int) time.Duration {
+	switch config.AudioFormat {
+	case mqtt_common.VoiceAudioFormatPcm, mqtt_common.VoiceAudioFormatWav,
+		mqtt_common.VoiceAudioFormatG711A, mqtt_common.VoiceAudioFormatG711U:
+	default:
+		return 0
+	}
+	bytesPerSecond := int64(config.AudioSampleRate) * int64(SampleBlockSize(config))
+	if bytesPerSecond == 0 {
+		return 0
+	}
+	return time.Duration(int64(n) * int64(time.Second) / bytesPerSecond)
+}
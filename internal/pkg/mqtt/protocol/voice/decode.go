@@ -0,0 +1,95 @@
+package voice
+
+import (
+	"errors"
+	"fmt"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
+
+	"github.com/sigurn/crc16"
+)
+
+// 入站音频帧校验错误
+// 调用方通过 errors.Is 判断具体的拒绝原因
+var (
+	ErrShortBuffer        = errors.New("voice: buffer shorter than header")
+	ErrPayloadLenMismatch = errors.New("voice: payload length mismatch")
+	ErrUnsupportedVersion = errors.New("voice: unsupported protocol version")
+	ErrChecksumMismatch   = errors.New("voice: crc16 checksum mismatch")
+)
+
+// Checksum 计算音频帧 CRC16 校验值
+// 校验范围：头部（Ver~PayloadLen，不含 CRC 字段）+ 音频载荷数据
+// 参数：
+//   - header: 序列化后的完整头部数据（末尾 2 字节为 CRC 字段，不参与计算）
+//   - payload: 音频载荷数据
+//
+// 返回值:
+//   - uint16: CRC16_MAXIM 校验值
+func Checksum(header []byte, payload []byte) uint16 {
+	crc := crc16.Init(crc16Table)
+	crc = crc16.Update(crc, header[:len(header)-2], crc16Table)
+	crc = crc16.Update(crc, payload, crc16Table)
+	return crc16.Complete(crc, crc16Table)
+}
+
+// Decode 解析并校验入站音频帧
+// 依次校验：长度 -> 版本号 -> 载荷长度 -> CRC16
+// 支持 v1（12字节头）与 v2（20字节头），版本由首字节高 4 位决定
+// 参数：
+//   - payload: 包含协议头的完整音频消息
+//
+// 返回值:
+//   - *Header: 音频协议头
+//   - []byte: 音频载荷数据（与入参共享底层数组）
+//   - error: 校验失败时返回 ErrShortBuffer / ErrUnsupportedVersion / ErrPayloadLenMismatch / ErrChecksumMismatch
+func Decode(payload []byte) (*Header, []byte, error) {
+	if len(payload) < HeaderSize {
+		return nil, nil, fmt.Errorf("%w: got %d bytes, need %d", ErrShortBuffer, len(payload), HeaderSize)
+	}
+
+	version := (payload[0] >> 4) & 0x0F
+	if !SupportedVersion(version) {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	size := HeaderSizeOf(version)
+	if len(payload) < size {
+		return nil, nil, fmt.Errorf("%w: got %d bytes, need %d", ErrShortBuffer, len(payload), size)
+	}
+
+	header := &Header{}
+	if err := header.UnmarshalHeader(payload[:size]); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrShortBuffer, err)
+	}
+
+	body := payload[size:]
+	if int(header.PayloadLen) != len(body) {
+		return header, nil, fmt.Errorf("%w: header declares %d bytes, got %d", ErrPayloadLenMismatch, header.PayloadLen, len(body))
+	}
+
+	if crc := Checksum(payload[:size], body); crc != header.CRC16 {
+		return header, nil, fmt.Errorf("%w: header %04x, computed %04x", ErrChecksumMismatch, header.CRC16, crc)
+	}
+
+	return header, body, nil
+}
+
+// SupportedVersion 判断协议版本是否受支持
+func SupportedVersion(version uint8) bool {
+	switch version {
+	case mqtt_common.VoiceVersionV1, mqtt_common.VoiceVersionV2:
+		return true
+	default:
+		return false
+	}
+}
+
+// NegotiateVersion 协商下行协议版本
+// 服务端使用与设备上行相同的版本回复，未知版本回退到默认版本
+func NegotiateVersion(deviceVersion uint8) uint8 {
+	if SupportedVersion(deviceVersion) {
+		return deviceVersion
+	}
+	return mqtt_common.VoiceVersion
+}
@@ -0,0 +1,195 @@
+// 测试入站音频帧的解析与校验
+package voice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
+)
+
+var testAudioConfig = AudioConfig{
+	AudioSampleRate: 16000,
+	AudioChannel:    1,
+	AudioFormat:     mqtt_common.VoiceAudioFormatPcm,
+}
+
+// crc16Maxim 设备端（C 实现）的 CRC16_MAXIM，用于交叉校验
+func crc16Maxim(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc ^ 0xFFFF
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	data := []byte("PCM_FRAME_0123456789")
+	packet := BuildStreamPayload(7, data, testAudioConfig, true)
+
+	header, payload, err := Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(payload, data) {
+		t.Errorf("payload mismatch: got %q, want %q", payload, data)
+	}
+	if header.FrameSeq != 7 || header.F != mqtt_common.VoiceFrameLast || header.SampleRate != 16000 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	// 设备端算法应得到相同的校验值
+	checksumData := append(append([]byte{}, packet[:HeaderSize-2]...), data...)
+	if crc := crc16Maxim(checksumData); crc != header.CRC16 {
+		t.Errorf("device crc %04x != header crc %04x", crc, header.CRC16)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	valid := BuildFullPayload(1, []byte("hello-voice"), testAudioConfig)
+
+	corrupt := func(mutate func(p []byte) []byte) []byte {
+		p := append([]byte{}, valid...)
+		return mutate(p)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"empty", nil, ErrShortBuffer},
+		{"short header", valid[:HeaderSize-1], ErrShortBuffer},
+		{"truncated payload", valid[:len(valid)-1], ErrPayloadLenMismatch},
+		{"trailing bytes", append(append([]byte{}, valid...), 0x00), ErrPayloadLenMismatch},
+		{"bad version", corrupt(func(p []byte) []byte {
+			p[0] = (0x0F << 4) | (p[0] & 0x0F)
+			return p
+		}), ErrUnsupportedVersion},
+		{"flipped payload bit", corrupt(func(p []byte) []byte {
+			p[HeaderSize] ^= 0x01
+			return p
+		}), ErrChecksumMismatch},
+		{"flipped header bit", corrupt(func(p []byte) []byte {
+			p[5] ^= 0x80 // FrameSeq
+			return p
+		}), ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Decode(tt.packet)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectCounter(t *testing.T) {
+	counter := NewRejectCounter()
+
+	_, _, err := Decode([]byte{0x10})
+	if reason := counter.Record("A0001", err); reason != RejectReasonShortBuffer {
+		t.Errorf("unexpected reason: %s", reason)
+	}
+	counter.Record("A0001", ErrChecksumMismatch)
+	counter.Record("A0002", errors.New("other"))
+
+	if got := counter.Total("A0001"); got != 2 {
+		t.Errorf("A0001 total = %d, want 2", got)
+	}
+	snapshot := counter.Snapshot()
+	if snapshot["A0002"][RejectReasonUnknown] != 1 {
+		t.Errorf("unexpected snapshot: %v", snapshot)
+	}
+}
+
+func TestDecodeV2(t *testing.T) {
+	data := []byte("PCM_FRAME_V2")
+	packet := BuildPayloadV2(0x01020304, 65536+5, 1500, data, mqtt_common.VoiceFrameFragment, testAudioConfig)
+	if len(packet) != HeaderSizeV2+len(data) {
+		t.Fatalf("unexpected packet length %d", len(packet))
+	}
+
+	header, payload, err := Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if header.Version != mqtt_common.VoiceVersionV2 || header.SessionID != 0x01020304 ||
+		header.FrameSeq != 65536+5 || header.Timestamp != 1500 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	if !bytes.Equal(payload, data) {
+		t.Errorf("payload mismatch: got %q, want %q", payload, data)
+	}
+
+	// v2 帧不足 20 字节
+	if _, _, err := Decode(packet[:HeaderSize]); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("got error %v, want %v", err, ErrShortBuffer)
+	}
+	// 会话ID被篡改
+	packet[4] ^= 0xFF
+	if _, _, err := Decode(packet); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestSessionNegotiation(t *testing.T) {
+	uplink := &Header{Version: mqtt_common.VoiceVersionV2, SessionID: 42}
+	session := SessionFromContext(WithHeader(context.Background(), uplink))
+	if session.Version != mqtt_common.VoiceVersionV2 || session.ID != 42 {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+
+	first, _, err := Decode(session.Build(0, []byte("a"), mqtt_common.VoiceFrameFragment, testAudioConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	second, _, err := Decode(session.Build(1, []byte("b"), mqtt_common.VoiceFrameLast, testAudioConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Timestamp != 0 || second.Timestamp < 20 {
+		t.Errorf("timestamps not relative to first frame: %d, %d", first.Timestamp, second.Timestamp)
+	}
+	if second.SessionID != 42 {
+		t.Errorf("session id not echoed: %d", second.SessionID)
+	}
+
+	// 无上行头或未知版本时回退到 v1
+	legacy := SessionFromContext(context.Background())
+	if legacy.Version != mqtt_common.VoiceVersionV1 {
+		t.Errorf("expected v1 fallback, got %d", legacy.Version)
+	}
+	if len(legacy.Build(0, nil, mqtt_common.VoiceFrameFull, testAudioConfig)) != HeaderSize {
+		t.Error("expected v1 header size")
+	}
+}
+
+func TestFramePayloadSize(t *testing.T) {
+	stereo := AudioConfig{AudioSampleRate: 16000, AudioChannel: 2, AudioFormat: mqtt_common.VoiceAudioFormatPcm}
+	if got := FramePayloadSize(1031, mqtt_common.VoiceVersionV1, stereo); got != 1016 {
+		t.Errorf("v1 stereo frame size = %d, want 1016", got)
+	}
+	if got := FramePayloadSize(1024, mqtt_common.VoiceVersionV2, testAudioConfig); got != 1004 {
+		t.Errorf("v2 frame size = %d, want 1004", got)
+	}
+	if got := FramePayloadSize(1<<20, mqtt_common.VoiceVersionV1, testAudioConfig); got > MaxPayloadLen {
+		t.Errorf("frame size %d exceeds PayloadLen", got)
+	}
+	if got := AudioDuration(testAudioConfig, 32000); got != time.Second {
+		t.Errorf("duration = %v, want 1s", got)
+	}
+}
@@ -20,7 +20,34 @@ type AudioConfig struct {
 	AudioFormat     uint8  // 音频格式
 }
 
+// Encode 根据协议头构建音频消息 payload
+// 自动填充 PayloadLen 与 CRC16，序列化布局由 header.Version 决定
+// 参数：
+//   - header: 音频协议头
+//   - data: 消息数据 字节切片
+//
+// 返回值:
+//   - []byte: 包含协议头的音频消息 payload
+func Encode(header *Header, data []byte) []byte {
+	header.PayloadLen = uint16(len(data))
+	header.CRC16 = 0
+
+	headerBytes := header.Marshal()
+	payload := make([]byte, len(headerBytes)+len(data))
+	copy(payload, headerBytes)
+	copy(payload[len(headerBytes):], data)
+
+	// 计算CRC16校验值（头部 + 载荷）
+	header.CRC16 = Checksum(headerBytes, data)
+	// 重新序列化头信息
+	headerBytes = header.Marshal()
+	copy(payload, headerBytes)
+
+	return payload
+}
+
 // BuildPayload 构建音频消息 payload（包含协议头）
+// 使用 v1 协议头
 // 参数：
 //   - seq: 消息序号 从0开始递增
 //   - data: 消息数据 字节切片
@@ -36,24 +63,35 @@ func BuildPayload(seq uint16, data []byte, frameType uint8, config AudioConfig)
 		SampleRate:  config.AudioSampleRate,
 		Ch:          config.AudioChannel,
 		F:           frameType,
-		FrameSeq:    seq,
-		Timestamp:   uint16(time.Now().Unix() & 0xFFFF),
-		PayloadLen:  uint16(len(data)),
-		CRC16:       0,
+		FrameSeq:    uint32(seq),
+		Timestamp:   uint32(time.Now().Unix() & 0xFFFF),
 	}
+	return Encode(header, data)
+}
 
-	headerBytes := header.Marshal()
-	payload := make([]byte, len(headerBytes)+len(data))
-	copy(payload, headerBytes)
-	copy(payload[len(headerBytes):], data)
-
-	// 计算CRC16校验值
-	header.CRC16 = crc16.Checksum(payload[:len(headerBytes)-2], crc16Table)
-	// 重新序列化头信息
-	headerBytes = header.Marshal()
-	copy(payload, headerBytes)
-
-	return payload
+// BuildPayloadV2 构建 v2 音频消息 payload（包含协议头）
+// 参数：
+//   - sessionID: 会话/语句ID
+//   - seq: 消息序号 从0开始递增
+//   - timestamp: 相对首帧的毫秒偏移
+//   - data: 消息数据 字节切片
+//   - frameType: 音频帧类型
+//   - config: 语音配置[采样率、格式、声道数]
+//
+// 返回值:
+//   - []byte: 包含协议头的音频消息 payload
+func BuildPayloadV2(sessionID, seq, timestamp uint32, data []byte, frameType uint8, config AudioConfig) []byte {
+	header := &Header{
+		Version:     mqtt_common.VoiceVersionV2,
+		AudioFormat: config.AudioFormat,
+		SampleRate:  config.AudioSampleRate,
+		Ch:          config.AudioChannel,
+		F:           frameType,
+		SessionID:   sessionID,
+		FrameSeq:    seq,
+		Timestamp:   timestamp,
+	}
+	return Encode(header, data)
 }
 
 // BuildFullPayload 构建完整音频消息 payload（包含协议头）
@@ -78,9 +116,13 @@ func BuildFullPayload(seq uint16, data []byte, config AudioConfig) []byte {
 // 返回值:
 //   - []byte: 包含协议头的流式音频消息 payload
 func BuildStreamPayload(seq uint16, data []byte, config AudioConfig, isLast bool) []byte {
-	frameType := mqtt_common.VoiceFrameFragment
+	return BuildPayload(seq, data, StreamFrameType(isLast), config)
+}
+
+// StreamFrameType 获取流式音频帧类型
+func StreamFrameType(isLast bool) uint8 {
 	if isLast {
-		frameType = mqtt_common.VoiceFrameLast
+		return mqtt_common.VoiceFrameLast
 	}
-	return BuildPayload(seq, data, uint8(frameType), config)
+	return mqtt_common.VoiceFrameFragment
 }
@@ -0,0 +1,100 @@
+package voice
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
+)
+
+// Session 一次语音会话（一句话）的帧构建器
+// v2 协议下携带会话ID，时间戳为相对首帧的毫秒偏移；v1 协议下退化为 BuildPayload
+type Session struct {
+	Version uint8  // 协议版本
+	ID      uint32 // 会话/语句ID，仅 v2 有效
+
+	mu    sync.Mutex
+	start time.Time // 首帧发送时间
+}
+
+// NewSession 创建语音会话
+// 参数：
+//   - version: 协议版本，通常为设备上行帧的版本（见 NegotiateVersion）
+//   - id: 会话ID，为 0 时随机生成
+//
+// 返回值:
+//   - *Session: 语音会话
+func NewSession(version uint8, id uint32) *Session {
+	if id == 0 {
+		id = NewSessionID()
+	}
+	return &Session{
+		Version: NegotiateVersion(version),
+		ID:      id,
+	}
+}
+
+// NewSessionID 生成非 0 的随机会话ID
+func NewSessionID() uint32 {
+	for {
+		if id := rand.Uint32(); id != 0 {
+			return id
+		}
+	}
+}
+
+// Build 构建会话内的一帧音频消息
+// 参数：
+//   - seq: 消息序号 从0开始递增
+//   - data: 消息数据 字节切片
+//   - frameType: 音频帧类型
+//   - config: 语音配置[采样率、格式、声道数]
+//
+// 返回值:
+//   - []byte: 包含协议头的音频消息 payload
+func (s *Session) Build(seq uint32, data []byte, frameType uint8, config AudioConfig) []byte {
+	if s.Version != mqtt_common.VoiceVersionV2 {
+		return BuildPayload(uint16(seq), data, frameType, config)
+	}
+	return BuildPayloadV2(s.ID, seq, s.elapsed(), data, frameType, config)
+}
+
+// elapsed 获取相对首帧的毫秒偏移，首次调用时记录首帧时间
+func (s *Session) elapsed() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.start.IsZero() {
+		s.start = now
+	}
+	return uint32(now.Sub(s.start).Milliseconds())
+}
+
+type headerContextKey struct{}
+
+// WithHeader 将设备上行帧的协议头保存到上下文
+// 下行回复据此协商协议版本与会话ID
+func WithHeader(ctx context.Context, header *Header) context.Context {
+	return context.WithValue(ctx, headerContextKey{}, header)
+}
+
+// HeaderFromContext 从上下文获取设备上行帧的协议头
+func HeaderFromContext(ctx context.Context) (*Header, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	header, ok := ctx.Value(headerContextKey{}).(*Header)
+	return header, ok && header != nil
+}
+
+// SessionFromContext 根据上下文中的上行协议头创建下行会话
+// 上行为 v2 时复用其会话ID，以便设备把回复与提问对应起来
+func SessionFromContext(ctx context.Context) *Session {
+	header, ok := HeaderFromContext(ctx)
+	if !ok {
+		return NewSession(mqtt_common.VoiceVersion, 0)
+	}
+	return NewSession(header.Version, header.SessionID)
+}
@@ -0,0 +1,94 @@
+package voice
+
+import (
+	"errors"
+	"sync"
+)
+
+// 被拒绝音频帧的原因标签
+const (
+	RejectReasonShortBuffer = "short_buffer"
+	RejectReasonPayloadLen  = "payload_len"
+	RejectReasonVersion     = "version"
+	RejectReasonChecksum    = "crc16"
+	RejectReasonUnknown     = "unknown"
+)
+
+// RejectCounter 按设备统计被拒绝的音频帧
+type RejectCounter struct {
+	mu     sync.RWMutex
+	counts map[string]map[string]uint64 // deviceSN -> reason -> count
+}
+
+// Rejects 全局入站音频帧拒绝计数器
+var Rejects = NewRejectCounter()
+
+// NewRejectCounter 创建拒绝计数器
+func NewRejectCounter() *RejectCounter {
+	return &RejectCounter{
+		counts: make(map[string]map[string]uint64),
+	}
+}
+
+// Record 记录一次拒绝
+// 参数：
+//   - deviceSN: 设备序列号
+//   - err: Decode 返回的错误
+//
+// 返回值:
+//   - string: 拒绝原因标签
+func (r *RejectCounter) Record(deviceSN string, err error) string {
+	reason := RejectReason(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byReason, ok := r.counts[deviceSN]
+	if !ok {
+		byReason = make(map[string]uint64)
+		r.counts[deviceSN] = byReason
+	}
+	byReason[reason]++
+	return reason
+}
+
+// Total 获取设备被拒绝的音频帧总数
+func (r *RejectCounter) Total(deviceSN string) uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var total uint64
+	for _, n := range r.counts[deviceSN] {
+		total += n
+	}
+	return total
+}
+
+// Snapshot 获取所有设备的拒绝计数副本
+func (r *RejectCounter) Snapshot() map[string]map[string]uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]map[string]uint64, len(r.counts))
+	for sn, byReason := range r.counts {
+		cp := make(map[string]uint64, len(byReason))
+		for reason, n := range byReason {
+			cp[reason] = n
+		}
+		out[sn] = cp
+	}
+	return out
+}
+
+// RejectReason 将 Decode 错误映射为原因标签
+func RejectReason(err error) string {
+	switch {
+	case errors.Is(err, ErrShortBuffer):
+		return RejectReasonShortBuffer
+	case errors.Is(err, ErrPayloadLenMismatch):
+		return RejectReasonPayloadLen
+	case errors.Is(err, ErrUnsupportedVersion):
+		return RejectReasonVersion
+	case errors.Is(err, ErrChecksumMismatch):
+		return RejectReasonChecksum
+	default:
+		return RejectReasonUnknown
+	}
+}
@@ -9,29 +9,49 @@ package voice
 import (
 	"encoding/binary"
 	"errors"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
 )
 
 const (
-	HeaderSize = 12 // 96 bits = 12 bytes
+	HeaderSize   = 12 // v1: 96 bits = 12 bytes
+	HeaderSizeV2 = 20 // v2: 160 bits = 20 bytes
 )
 
 // Header 音频协议头
+// v1 与 v2 共用前 4 字节（Ver/AudioFormat/SampleRate/Ch/F），
+// 通过 Version 决定后续字段的位宽
 type Header struct {
 	Version     uint8  // 4 bits (0-15)
 	AudioFormat uint8  // 8 bits
 	SampleRate  uint16 // 16 bits
 	Ch          uint8  // 2 bits (1=mono, 2=stereo, 3=multi)
 	F           uint8  // 2 bits (1=full, 2=fragment, 3=last)
-	FrameSeq    uint16 // 16 bits
-	Timestamp   uint16 // 16 bits
+	SessionID   uint32 // v2: 32 bits 会话/语句ID；v1 无此字段
+	FrameSeq    uint32 // v1: 16 bits / v2: 32 bits
+	Timestamp   uint32 // v1: 16 bits / v2: 32 bits 相对首帧的毫秒偏移
 	PayloadLen  uint16 // 16 bits
 	CRC16       uint16 // 16 bits, computed over header (without CRC) + payload
 }
 
+// HeaderSizeOf 获取指定版本的协议头长度
+// 未知版本按 v1 处理
+func HeaderSizeOf(version uint8) int {
+	if version == mqtt_common.VoiceVersionV2 {
+		return HeaderSizeV2
+	}
+	return HeaderSize
+}
+
+// Size 获取协议头序列化后的长度
+func (h *Header) Size() int {
+	return HeaderSizeOf(h.Version)
+}
+
 // Marshal 序列化音频协议头
 // @return []byte 序列化后的音频协议头数据
 func (h *Header) Marshal() []byte {
-	buf := make([]byte, HeaderSize)
+	buf := make([]byte, h.Size())
 
 	// Byte 0: [Ver:4][AUdioFormat high 4]
 	buf[0] = ((h.Version & 0x0F) << 4) | ((h.AudioFormat >> 4) & 0x0F)
@@ -45,11 +65,30 @@ func (h *Header) Marshal() []byte {
 	// Byte 3: [SampleRate low 4][Ch:2][F:2]
 	buf[3] = byte((h.SampleRate&0x0F)<<4) | byte((h.Ch&0x03)<<2) | byte(h.F&0x03)
 
+	if h.Version == mqtt_common.VoiceVersionV2 {
+		// Bytes 4-7: SessionID
+		binary.BigEndian.PutUint32(buf[4:8], h.SessionID)
+
+		// Bytes 8-11: FrameSeq
+		binary.BigEndian.PutUint32(buf[8:12], h.FrameSeq)
+
+		// Bytes 12-15: Timestamp
+		binary.BigEndian.PutUint32(buf[12:16], h.Timestamp)
+
+		// Bytes 16-17: PayloadLen
+		binary.BigEndian.PutUint16(buf[16:18], h.PayloadLen)
+
+		// Bytes 18-19: CRC16
+		binary.BigEndian.PutUint16(buf[18:20], h.CRC16)
+
+		return buf
+	}
+
 	// Bytes 4-5: FrameSeq
-	binary.BigEndian.PutUint16(buf[4:6], h.FrameSeq)
+	binary.BigEndian.PutUint16(buf[4:6], uint16(h.FrameSeq))
 
 	// Bytes 6-7: Timestamp
-	binary.BigEndian.PutUint16(buf[6:8], h.Timestamp)
+	binary.BigEndian.PutUint16(buf[6:8], uint16(h.Timestamp))
 
 	// Bytes 8-9: PayloadLen
 	binary.BigEndian.PutUint16(buf[8:10], h.PayloadLen)
@@ -61,6 +100,7 @@ func (h *Header) Marshal() []byte {
 }
 
 // UnmarshalHeader 反序列化音频协议头
+// 根据首字节的版本号选择 v1 / v2 布局，未知版本按 v1 布局解析
 // @param data 音频协议头数据
 // @return error 反序列化错误
 func (h *Header) UnmarshalHeader(data []byte) error {
@@ -69,6 +109,10 @@ func (h *Header) UnmarshalHeader(data []byte) error {
 	}
 
 	h.Version = (data[0] >> 4) & 0x0F
+	if h.Version == mqtt_common.VoiceVersionV2 && len(data) < HeaderSizeV2 {
+		return errors.New("insufficient data for v2 header (need 20 bytes)")
+	}
+
 	h.AudioFormat = ((data[0] & 0x0F) << 4) | (data[1] >> 4)
 
 	// Build SampleRate from 3 parts
@@ -78,8 +122,19 @@ func (h *Header) UnmarshalHeader(data []byte) error {
 
 	h.Ch = (data[3] >> 2) & 0x03
 	h.F = data[3] & 0x03
-	h.FrameSeq = binary.BigEndian.Uint16(data[4:6])
-	h.Timestamp = binary.BigEndian.Uint16(data[6:8])
+
+	if h.Version == mqtt_common.VoiceVersionV2 {
+		h.SessionID = binary.BigEndian.Uint32(data[4:8])
+		h.FrameSeq = binary.BigEndian.Uint32(data[8:12])
+		h.Timestamp = binary.BigEndian.Uint32(data[12:16])
+		h.PayloadLen = binary.BigEndian.Uint16(data[16:18])
+		h.CRC16 = binary.BigEndian.Uint16(data[18:20])
+		return nil
+	}
+
+	h.SessionID = 0
+	h.FrameSeq = uint32(binary.BigEndian.Uint16(data[4:6]))
+	h.Timestamp = uint32(binary.BigEndian.Uint16(data[6:8]))
 	h.PayloadLen = binary.BigEndian.Uint16(data[8:10])
 	h.CRC16 = binary.BigEndian.Uint16(data[10:12])
 
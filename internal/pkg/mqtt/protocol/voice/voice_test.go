@@ -8,10 +8,10 @@ import (
 func TestHeaderRoundTrip(t *testing.T) {
 	original := &Header{
 		Version:     1,
-		AudioFormat: 3,        // OPUS
+		AudioFormat: 3, // OPUS
 		SampleRate:  16000,
-		Ch:          1,        // mono
-		F:           1,        // full frame
+		Ch:          1, // mono
+		F:           1, // full frame
 		FrameSeq:    42,
 		Timestamp:   1000,
 		PayloadLen:  28,
@@ -103,13 +103,46 @@ func TestFullPacketWithCRC(t *testing.T) {
 	// Reconstruct the data that was used to compute CRC:
 	// i.e., original header with CRC=0 + payload
 	dataForCRC := make([]byte, len(packet))
-	copy(dataForCRC, packet)           // copy full packet
-	dataForCRC[10] = 0                 // zero out CRC high byte
-	dataForCRC[11] = 0                 // zero out CRC low byte
+	copy(dataForCRC, packet) // copy full packet
+	dataForCRC[10] = 0       // zero out CRC high byte
+	dataForCRC[11] = 0       // zero out CRC low byte
 
 	computedCRC := crc16A(dataForCRC)
 
 	if receivedHeader.CRC16 != computedCRC {
 		t.Errorf("CRC mismatch: got %04x, expected %04x", receivedHeader.CRC16, computedCRC)
 	}
-}
\ No newline at end of file
+}
+
+func TestHeaderV2RoundTrip(t *testing.T) {
+	original := &Header{
+		Version:     2,
+		AudioFormat: 1, // PCM
+		SampleRate:  48000,
+		Ch:          2, // stereo
+		F:           2, // fragment
+		SessionID:   0xDEADBEEF,
+		FrameSeq:    70000, // 超过 16 位
+		Timestamp:   123456,
+		PayloadLen:  960,
+		CRC16:       0xABCD,
+	}
+
+	data := original.Marshal()
+	if len(data) != HeaderSizeV2 {
+		t.Fatalf("Expected header size %d, got %d", HeaderSizeV2, len(data))
+	}
+
+	var recovered Header
+	if err := recovered.UnmarshalHeader(data); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if *original != recovered {
+		t.Errorf("Round-trip mismatch!\nOriginal: %+v\nRecovered: %+v", original, &recovered)
+	}
+
+	// v2 头部被截断时应报错
+	if err := recovered.UnmarshalHeader(data[:HeaderSize]); err == nil {
+		t.Error("expected error for truncated v2 header")
+	}
+}
@@ -129,6 +129,7 @@ func GetClient() *Client {
 				logger.Error(ctx, "Failed to initialize PostgreSQL client: %v", map[string]any{
 					"Error": err,
 				})
+				mutex.Unlock()
 				return nil
 			}
 		}
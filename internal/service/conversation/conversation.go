@@ -0,0 +1,321 @@
+// Package conversation device conversation history service
+// 设备听到的内容与回复，按会话保存，支持全文检索
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"yunyez/internal/model/conversation"
+	"yunyez/internal/pkg/postgre"
+)
+
+var (
+	ServiceInstance *service
+)
+
+func init() {
+	// Initialize the service instance with a default DBProvider.
+	// The database is connected on first use, so importing the package does not need PostgreSQL.
+	ServiceInstance = &service{
+		provider: &PostgreClient{},
+	}
+}
+
+const (
+	// searchConfig 全文检索的文本搜索配置，与 search_vector 列的生成表达式一致
+	// 安装了 zhparser 或 pg_jieba 时使用中文分词，否则为 simple 的副本
+	searchConfig = "voice_search"
+	// searchText 子串匹配的文本表达式，与 pg_trgm 索引的表达式一致
+	searchText = "(transcript || ' ' || reply)"
+)
+
+// TurnFilter 对话查询条件，零值不过滤
+type TurnFilter struct {
+	ConversationID int64  // 会话ID
+	Query          string // 全文检索关键词，空格分隔的关键词同时出现，支持引号与 - 排除
+}
+
+// Service defines the conversation history business logic interface.
+type Service interface {
+	// 追加一轮对话，续接设备在 idle 内有过对话的会话，否则新建会话
+	AppendTurn(ctx context.Context, turn *conversation.Turn, idle time.Duration) error
+	// 分页查询设备的会话，按最近对话时间倒序
+	ListConversations(ctx context.Context, sn string, page, pageSize int) ([]*conversation.Conversation, int64, error)
+	// 分页查询设备的对话，按对话时间倒序
+	ListTurns(ctx context.Context, sn string, filter TurnFilter, page, pageSize int) ([]*conversation.Turn, int64, error)
+	// 删除设备的全部会话与对话，返回删除的对话轮数
+	ClearHistory(ctx context.Context, sn string) (int64, error)
+}
+
+// DBProvider abstracts database access.
+type DBProvider interface {
+	DB() *gorm.DB
+}
+
+// PostgreClient implements DBProvider using PostgreSQL.
+// A nil Client is resolved to the global client on first use.
+type PostgreClient struct {
+	Client *postgre.Client
+	once   sync.Once
+}
+
+func (p *PostgreClient) DB() *gorm.DB {
+	p.once.Do(func() {
+		if p.Client == nil {
+			p.Client = postgre.GetClient()
+		}
+	})
+	return p.Client.DB
+}
+
+// NewService returns a conversation history service backed by the DBProvider.
+func NewService(dbProvider DBProvider) Service {
+	return &service{provider: dbProvider}
+}
+
+// service implements the Service interface.
+type service struct {
+	provider DBProvider
+
+	searchMu  sync.Mutex
+	searchSet bool // 已查询文本搜索配置的分词器
+	segmented bool // 文本搜索配置使用中文分词
+}
+
+// AppendTurn 追加一轮对话
+// 参数：
+//   - ctx context.Context 上下文
+//   - turn *conversation.Turn 对话，CreateTime 为空时使用当前时间
+//   - idle time.Duration 会话无对话的最长时间，超过后新建会话
+//
+// 返回：
+//   - error 保存失败时返回错误
+func (s *service) AppendTurn(ctx context.Context, turn *conversation.Turn, idle time.Duration) error {
+	if turn == nil || turn.SN == "" {
+		return errors.New("empty conversation turn")
+	}
+	if turn.CreateTime.IsZero() {
+		turn.CreateTime = time.Now()
+	}
+
+	return s.provider.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var c conversation.Conversation
+		err := tx.Where("device_sn = ? AND last_time >= ?", turn.SN, turn.CreateTime.Add(-idle)).
+			Order("last_time DESC").First(&c).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c = conversation.Conversation{SN: turn.SN, StartTime: turn.CreateTime, LastTime: turn.CreateTime}
+			if err := tx.Create(&c).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		turn.ConversationID = c.ID
+		if err := tx.Create(turn).Error; err != nil {
+			return err
+		}
+		return tx.Model(&conversation.Conversation{}).Where("id = ?", c.ID).Updates(map[string]interface{}{
+			"last_time":  gorm.Expr("GREATEST(last_time, ?)", turn.CreateTime),
+			"turn_count": gorm.Expr("turn_count + 1"),
+		}).Error
+	})
+}
+
+// ListConversations 分页查询设备的会话，按最近对话时间倒序
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//   - page int 页码，从 1 开始
+//   - pageSize int 每页条数
+//
+// 返回：
+//   - []*conversation.Conversation 会话
+//   - int64 总条数
+//   - error 查询失败时返回错误
+func (s *service) ListConversations(ctx context.Context, sn string, page, pageSize int) ([]*conversation.Conversation, int64, error) {
+	if sn == "" {
+		return nil, 0, errors.New("empty serial number")
+	}
+	page, pageSize = normalizePage(page, pageSize)
+
+	db := s.provider.DB().WithContext(ctx).Model(&conversation.Conversation{}).Where("device_sn = ?", sn)
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var conversations []*conversation.Conversation
+	offset := (page - 1) * pageSize
+	if err := db.Order("last_time DESC").Offset(offset).Limit(pageSize).Find(&conversations).Error; err != nil {
+		return nil, 0, err
+	}
+	return conversations, total, nil
+}
+
+// ListTurns 分页查询设备的对话，按对话时间倒序
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//   - filter TurnFilter 查询条件
+//   - page int 页码，从 1 开始
+//   - pageSize int 每页条数
+//
+// 返回：
+//   - []*conversation.Turn 对话
+//   - int64 总条数
+//   - error 查询失败时返回错误
+func (s *service) ListTurns(ctx context.Context, sn string, filter TurnFilter, page, pageSize int) ([]*conversation.Turn, int64, error) {
+	if sn == "" {
+		return nil, 0, errors.New("empty serial number")
+	}
+	page, pageSize = normalizePage(page, pageSize)
+
+	db := s.provider.DB().WithContext(ctx).Model(&conversation.Turn{}).Where("device_sn = ?", sn)
+	if filter.ConversationID > 0 {
+		db = db.Where("conversation_id = ?", filter.ConversationID)
+	}
+	if filter.Query != "" {
+		segmented, err := s.searchSegmented(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		if cond, args := searchCondition(segmented, filter.Query); cond != "" {
+			db = db.Where(cond, args...)
+		}
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var turns []*conversation.Turn
+	offset := (page - 1) * pageSize
+	if err := db.Order("create_time DESC").Offset(offset).Limit(pageSize).Find(&turns).Error; err != nil {
+		return nil, 0, err
+	}
+	return turns, total, nil
+}
+
+// ClearHistory 删除设备的全部会话与对话
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//
+// 返回：
+//   - int64 删除的对话轮数
+//   - error 删除失败时返回错误
+func (s *service) ClearHistory(ctx context.Context, sn string) (int64, error) {
+	if sn == "" {
+		return 0, errors.New("empty serial number")
+	}
+	var deleted int64
+	err := s.provider.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("device_sn = ?", sn).Delete(&conversation.Turn{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Where("device_sn = ?", sn).Delete(&conversation.Conversation{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// searchSegmented 文本搜索配置是否使用中文分词，首次检索时查询并缓存
+func (s *service) searchSegmented(ctx context.Context) (bool, error) {
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+	if s.searchSet {
+		return s.segmented, nil
+	}
+
+	var parsers []string
+	err := s.provider.DB().WithContext(ctx).Table("pg_ts_config AS c").
+		Joins("JOIN pg_ts_parser AS p ON p.oid = c.cfgparser").
+		Where("c.cfgname = ?", searchConfig).Pluck("p.prsname", &parsers).Error
+	if err != nil {
+		return false, err
+	}
+	s.segmented = len(parsers) > 0 && parsers[0] != "default"
+	s.searchSet = true
+	return s.segmented, nil
+}
+
+// searchCondition 对话检索条件
+// 使用中文分词时按 search_vector 全文检索（websearch 语法）；
+// 否则 simple 分词无法切分中文，按关键词对识别文本与回复做子串匹配
+// 参数：
+//   - segmented bool 文本搜索配置是否使用中文分词
+//   - query string 检索关键词
+//
+// 返回：
+//   - string 查询条件，没有关键词时为空
+//   - []interface{} 查询参数
+func searchCondition(segmented bool, query string) (string, []interface{}) {
+	if segmented {
+		return "search_vector @@ websearch_to_tsquery(?, ?)", []interface{}{searchConfig, query}
+	}
+
+	var conds []string
+	var args []interface{}
+	for _, term := range searchTerms(query) {
+		op := "ILIKE"
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			op, term = "NOT ILIKE", term[1:]
+		}
+		conds = append(conds, searchText+" "+op+" ?")
+		args = append(args, "%"+escapeLike(term)+"%")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// searchTerms 按空格切分关键词，引号内的短语作为一个关键词
+func searchTerms(query string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '　'):
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// normalizePage 分页参数的默认值
+func normalizePage(page, pageSize int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
@@ -0,0 +1,73 @@
+// 测试对话检索条件：中文关键词在没有中文分词时按子串匹配
+package conversation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB 不连接数据库，记录生成的 SQL
+type dryRunDB struct {
+	db   *gorm.DB
+	sqls []string
+}
+
+func (d *dryRunDB) DB() *gorm.DB { return d.db }
+
+func newDryRunDB(t *testing.T) *dryRunDB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	d := &dryRunDB{db: db}
+	capture := func(tx *gorm.DB) {
+		d.sqls = append(d.sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:capture", capture))
+	return d
+}
+
+func TestSearchConditionChinese(t *testing.T) {
+	cond, args := searchCondition(false, `天气 "明天 下雨" -北京`)
+	assert.Equal(t, "(transcript || ' ' || reply) ILIKE ? AND (transcript || ' ' || reply) ILIKE ? AND (transcript || ' ' || reply) NOT ILIKE ?", cond)
+	assert.Equal(t, []interface{}{"%天气%", "%明天 下雨%", "%北京%"}, args)
+
+	// 使用中文分词时交给 websearch_to_tsquery
+	cond, args = searchCondition(true, "今天天气")
+	assert.Equal(t, "search_vector @@ websearch_to_tsquery(?, ?)", cond)
+	assert.Equal(t, []interface{}{searchConfig, "今天天气"}, args)
+
+	// 通配符按字面匹配
+	_, args = searchCondition(false, "100%_好")
+	assert.Equal(t, []interface{}{`%100\%\_好%`}, args)
+
+	cond, _ = searchCondition(false, ` "" `)
+	assert.Empty(t, cond)
+}
+
+func TestListTurnsChineseQuery(t *testing.T) {
+	d := newDryRunDB(t)
+	s := NewService(d)
+
+	_, _, err := s.ListTurns(context.Background(), "A0001", TurnFilter{Query: "天气"}, 1, 10)
+	require.NoError(t, err)
+
+	// 首次检索查询分词器，之后使用缓存
+	require.NotEmpty(t, d.sqls)
+	assert.Contains(t, d.sqls[0], "pg_ts_parser")
+	found := false
+	for _, sql := range d.sqls[1:] {
+		assert.NotContains(t, sql, "pg_ts_parser")
+		if assert.Contains(t, sql, "device_sn = 'A0001'") && assert.Contains(t, sql, "ILIKE '%天气%'") {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
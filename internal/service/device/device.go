@@ -23,10 +23,9 @@ var (
 
 func init() {
 	// Initialize the service instance with a default DBProvider.
+	// The database is connected on first use, so importing the package does not need PostgreSQL.
 	ServiceInstance = &service{
-		provider: &PostgreClient{
-			Client: postgre.GetClient(),
-		},
+		provider: &PostgreClient{},
 	}
 }
 
@@ -53,11 +52,18 @@ type DBProvider interface {
 }
 
 // PostgreClient implements DBProvider using PostgreSQL.
+// A nil Client is resolved to the global client on first use.
 type PostgreClient struct {
 	Client *postgre.Client
+	once   sync.Once
 }
 
 func (p *PostgreClient) DB() *gorm.DB {
+	p.once.Do(func() {
+		if p.Client == nil {
+			p.Client = postgre.GetClient()
+		}
+	})
 	return p.Client.DB
 }
 
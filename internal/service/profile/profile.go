@@ -0,0 +1,293 @@
+// Package profile device and user profile service
+// 设备与绑定用户的长期画像（称呼、位置、时区、语言）及需要长期记住的事实
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"yunyez/internal/common/constant"
+	"yunyez/internal/model/profile"
+	prompt "yunyez/internal/pkg/agent/prompt"
+	"yunyez/internal/pkg/postgre"
+)
+
+var (
+	ServiceInstance *service
+)
+
+func init() {
+	// Initialize the service instance with a default DBProvider.
+	// The database is connected on first use, so importing the package does not need PostgreSQL.
+	ServiceInstance = &service{
+		provider: &PostgreClient{},
+	}
+}
+
+// Service defines the profile business logic interface.
+type Service interface {
+	// 根据序列号查询设备画像，不存在时返回 gorm.ErrRecordNotFound
+	GetProfile(ctx context.Context, sn string) (*profile.DeviceProfile, error)
+	// 创建或更新设备画像
+	SaveProfile(ctx context.Context, sn string, updates map[string]interface{}) error
+	// 查询设备需要长期记住的事实
+	ListFacts(ctx context.Context, sn string) ([]*profile.ProfileFact, error)
+	// 保存事实，同一键覆盖旧值，LLM 提取的事实不覆盖管理员录入的事实
+	SaveFacts(ctx context.Context, sn string, facts []prompt.Fact, source string) error
+	// 删除事实
+	DeleteFact(ctx context.Context, sn, key string) error
+}
+
+// DBProvider abstracts database access.
+type DBProvider interface {
+	DB() *gorm.DB
+}
+
+// PostgreClient implements DBProvider using PostgreSQL.
+// A nil Client is resolved to the global client on first use.
+type PostgreClient struct {
+	Client *postgre.Client
+	once   sync.Once
+}
+
+func (p *PostgreClient) DB() *gorm.DB {
+	p.once.Do(func() {
+		if p.Client == nil {
+			p.Client = postgre.GetClient()
+		}
+	})
+	return p.Client.DB
+}
+
+// NewService returns a profile service backed by the DBProvider.
+func NewService(dbProvider DBProvider) Service {
+	return &service{provider: dbProvider}
+}
+
+// service implements the Service interface.
+type service struct {
+	provider DBProvider
+}
+
+// GetProfile 根据序列号查询设备画像
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//
+// 返回：
+//   - *profile.DeviceProfile 设备画像
+//   - error 不存在时返回 gorm.ErrRecordNotFound
+func (s *service) GetProfile(ctx context.Context, sn string) (*profile.DeviceProfile, error) {
+	if sn == "" {
+		return nil, errors.New("empty serial number")
+	}
+	var p profile.DeviceProfile
+	err := s.provider.DB().WithContext(ctx).Where(&profile.DeviceProfile{SN: sn}).First(&p).Error
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveProfile 创建或更新设备画像
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//   - updates map[string]interface{} 更新字段（列名）
+//
+// 返回：
+//   - error 保存失败时返回错误
+func (s *service) SaveProfile(ctx context.Context, sn string, updates map[string]interface{}) error {
+	if sn == "" {
+		return fmt.Errorf("[%d]empty serial number", constant.ErrInvalidParam)
+	}
+	if len(updates) == 0 {
+		return fmt.Errorf("[%d]no fields to update", constant.ErrInvalidParam)
+	}
+	updates["update_time"] = time.Now()
+
+	return s.provider.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&profile.DeviceProfile{}).Where(&profile.DeviceProfile{SN: sn}).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		// 首次编辑时创建
+		values := map[string]interface{}{"device_sn": sn}
+		for k, v := range updates {
+			values[k] = v
+		}
+		return tx.Model(&profile.DeviceProfile{}).Create(values).Error
+	})
+}
+
+// ListFacts 查询设备需要长期记住的事实，按更新时间排序
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//
+// 返回：
+//   - []*profile.ProfileFact 事实
+//   - error 查询失败时返回错误
+func (s *service) ListFacts(ctx context.Context, sn string) ([]*profile.ProfileFact, error) {
+	if sn == "" {
+		return nil, errors.New("empty serial number")
+	}
+	var facts []*profile.ProfileFact
+	err := s.provider.DB().WithContext(ctx).Where(&profile.ProfileFact{SN: sn}).Order("update_time").Find(&facts).Error
+	if err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+// SaveFacts 保存事实，同一设备同一键覆盖旧值
+// LLM 提取的事实不覆盖管理员录入的同一键；保存后事实数超过 prompt.MaxFacts 时
+// 淘汰最早更新的 LLM 提取的事实，管理员录入的事实不淘汰
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//   - facts []prompt.Fact 事实
+//   - source string 来源：profile.SourceAdmin / profile.SourceLLM
+//
+// 返回：
+//   - error 事实不合法或保存失败时返回错误
+func (s *service) SaveFacts(ctx context.Context, sn string, facts []prompt.Fact, source string) error {
+	if sn == "" {
+		return fmt.Errorf("[%d]empty serial number", constant.ErrInvalidParam)
+	}
+	if len(facts) == 0 {
+		return nil
+	}
+	now := time.Now()
+	records := make([]*profile.ProfileFact, 0, len(facts))
+	for _, f := range facts {
+		if !prompt.ValidFact(f) {
+			return fmt.Errorf("[%d]invalid fact %q", constant.ErrInvalidParam, f.Key)
+		}
+		records = append(records, &profile.ProfileFact{
+			SN:         sn,
+			Key:        f.Key,
+			Value:      f.Value,
+			Source:     source,
+			CreateTime: now,
+			UpdateTime: now,
+		})
+	}
+	return s.provider.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(factUpsert(source)).Create(&records).Error; err != nil {
+			return err
+		}
+		return evictFacts(tx, sn, prompt.MaxFacts)
+	})
+}
+
+// factUpsert 同一键覆盖旧值，非管理员来源不覆盖管理员录入的事实
+func factUpsert(source string) clause.OnConflict {
+	upsert := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_sn"}, {Name: "fact_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"fact_value", "source", "update_time"}),
+	}
+	if source != profile.SourceAdmin {
+		upsert.Where = clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "device_profile_fact.source <> ?", Vars: []interface{}{profile.SourceAdmin}},
+		}}
+	}
+	return upsert
+}
+
+// evictFacts 事实数超过 max 时淘汰最早更新的 LLM 提取的事实
+func evictFacts(tx *gorm.DB, sn string, max int) error {
+	var total int64
+	if err := tx.Model(&profile.ProfileFact{}).Where(&profile.ProfileFact{SN: sn}).Count(&total).Error; err != nil {
+		return err
+	}
+	over := int(total) - max
+	if over <= 0 {
+		return nil
+	}
+	oldest := tx.Model(&profile.ProfileFact{}).Select("id").
+		Where(&profile.ProfileFact{SN: sn, Source: profile.SourceLLM}).
+		Order("update_time, id").Limit(over)
+	return tx.Where("id IN (?)", oldest).Delete(&profile.ProfileFact{}).Error
+}
+
+// DeleteFact 删除事实
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//   - key string 事实键
+//
+// 返回：
+//   - error 不存在时返回 gorm.ErrRecordNotFound
+func (s *service) DeleteFact(ctx context.Context, sn, key string) error {
+	if sn == "" || key == "" {
+		return fmt.Errorf("[%d]empty serial number or key", constant.ErrInvalidParam)
+	}
+	result := s.provider.DB().WithContext(ctx).Where(&profile.ProfileFact{SN: sn, Key: key}).Delete(&profile.ProfileFact{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Facts 将事实记录转换为模板使用的事实
+func Facts(records []*profile.ProfileFact) []prompt.Fact {
+	facts := make([]prompt.Fact, 0, len(records))
+	for _, r := range records {
+		facts = append(facts, prompt.Fact{Key: r.Key, Value: r.Value})
+	}
+	return facts
+}
+
+// PromptFacts 系统提示词使用的事实，估算的 Token 数不超过 maxTokens
+// 管理员录入的事实优先，其次是最近更新的 LLM 提取的事实；保留的事实仍按更新时间排序
+// 参数：
+//   - records []*profile.ProfileFact 事实记录，按更新时间排序
+//   - maxTokens int Token 预算
+//
+// 返回：
+//   - []prompt.Fact 预算内的事实
+func PromptFacts(records []*profile.ProfileFact, maxTokens int) []prompt.Fact {
+	order := make([]int, 0, len(records))
+	for i, r := range records {
+		if r.Source == profile.SourceAdmin {
+			order = append(order, i)
+		}
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Source != profile.SourceAdmin {
+			order = append(order, i)
+		}
+	}
+
+	keep := make([]bool, len(records))
+	used := 0
+	for _, i := range order {
+		n := prompt.FactTokens(prompt.Fact{Key: records[i].Key, Value: records[i].Value})
+		if used+n > maxTokens {
+			continue
+		}
+		keep[i] = true
+		used += n
+	}
+
+	var kept []*profile.ProfileFact
+	for i, r := range records {
+		if keep[i] {
+			kept = append(kept, r)
+		}
+	}
+	return Facts(kept)
+}
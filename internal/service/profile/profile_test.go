@@ -0,0 +1,100 @@
+// 测试事实的保存与提示词预算：LLM 不覆盖管理员录入的事实，超出上限淘汰最早的 LLM 事实
+package profile
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"yunyez/internal/model/profile"
+	prompt "yunyez/internal/pkg/agent/prompt"
+)
+
+// dryRunDB 不连接数据库，记录生成的 SQL
+type dryRunDB struct {
+	db   *gorm.DB
+	sqls []string
+}
+
+func (d *dryRunDB) DB() *gorm.DB { return d.db }
+
+func newDryRunDB(t *testing.T) *dryRunDB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	d := &dryRunDB{db: db}
+	capture := func(tx *gorm.DB) {
+		d.sqls = append(d.sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	require.NoError(t, db.Callback().Create().After("gorm:create").Register("test:capture", capture))
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:capture", capture))
+	require.NoError(t, db.Callback().Delete().After("gorm:delete").Register("test:capture", capture))
+	return d
+}
+
+func TestFactUpsertKeepsAdmin(t *testing.T) {
+	d := newDryRunDB(t)
+	fact := &profile.ProfileFact{SN: "A0001", Key: "name", Value: "小明"}
+
+	require.NoError(t, d.db.Clauses(factUpsert(profile.SourceLLM)).Create(fact).Error)
+	require.Len(t, d.sqls, 1)
+	assert.Contains(t, d.sqls[0], `ON CONFLICT ("device_sn","fact_key") DO UPDATE`)
+	assert.Contains(t, d.sqls[0], "WHERE device_profile_fact.source <> 'admin'")
+
+	// 管理员录入的事实覆盖任何来源
+	d.sqls = nil
+	require.NoError(t, d.db.Clauses(factUpsert(profile.SourceAdmin)).Create(fact).Error)
+	require.Len(t, d.sqls, 1)
+	assert.NotContains(t, d.sqls[0], "device_profile_fact.source <>")
+}
+
+func TestEvictFactsOnlyLLM(t *testing.T) {
+	d := newDryRunDB(t)
+
+	require.NoError(t, evictFacts(d.db, "A0001", prompt.MaxFacts))
+	// DryRun 下计数为 0，未超出上限时不删除
+	require.Len(t, d.sqls, 1)
+	assert.Contains(t, d.sqls[0], "count(*)")
+
+	d.sqls = nil
+	require.NoError(t, evictFacts(d.db, "A0001", -2))
+	require.NotEmpty(t, d.sqls)
+	last := d.sqls[len(d.sqls)-1]
+	assert.Contains(t, last, `DELETE FROM "device_profile_fact" WHERE id IN (SELECT "id" FROM "device_profile_fact" WHERE`)
+	assert.Contains(t, last, `"device_profile_fact"."source" = 'llm'`)
+	assert.Contains(t, last, "ORDER BY update_time, id LIMIT 2")
+}
+
+func TestPromptFactsBudget(t *testing.T) {
+	now := time.Now()
+	record := func(key, value, source string) *profile.ProfileFact {
+		now = now.Add(time.Second)
+		return &profile.ProfileFact{Key: key, Value: value, Source: source, UpdateTime: now}
+	}
+	long := strings.Repeat("长", 40)
+	records := []*profile.ProfileFact{
+		record("old_hobby", long, profile.SourceLLM),
+		record("name", "小明", profile.SourceAdmin),
+		record("pet", long, profile.SourceLLM),
+		record("city", "上海", profile.SourceLLM),
+	}
+
+	// 预算不足时先保留管理员录入的事实，再保留最近的 LLM 事实，顺序不变
+	facts := PromptFacts(records, 60)
+	assert.Equal(t, []prompt.Fact{
+		{Key: "name", Value: "小明"},
+		{Key: "pet", Value: long},
+		{Key: "city", Value: "上海"},
+	}, facts)
+
+	assert.Len(t, PromptFacts(records, 1000), 4)
+	assert.Empty(t, PromptFacts(records, 0))
+}
@@ -0,0 +1,248 @@
+// Package prompt system prompt template service
+// 系统提示词覆盖模板的存储与热更新，模板按 厂商 → 设备类型 → 设备 逐级覆盖
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"yunyez/internal/common/constant"
+	promptModel "yunyez/internal/model/prompt"
+	prompt "yunyez/internal/pkg/agent/prompt"
+	logger "yunyez/internal/pkg/logger"
+	"yunyez/internal/pkg/postgre"
+)
+
+var (
+	ServiceInstance *service
+)
+
+func init() {
+	// Initialize the service instance with a default DBProvider.
+	// The database is connected on first use, so importing the package does not need PostgreSQL.
+	ServiceInstance = &service{
+		provider: &PostgreClient{},
+		registry: prompt.NewRegistry(),
+	}
+}
+
+// Service defines the prompt template business logic interface.
+type Service interface {
+	// 查询所有覆盖模板
+	ListTemplates(ctx context.Context) ([]*promptModel.PromptTemplate, error)
+	// 创建或更新覆盖模板，同一范围同一目标覆盖旧模板
+	SaveTemplate(ctx context.Context, t *promptModel.PromptTemplate) error
+	// 删除覆盖模板
+	DeleteTemplate(ctx context.Context, id int64) error
+	// 从数据库重新加载启用的覆盖模板
+	Reload(ctx context.Context) error
+	// 查找设备适用的覆盖模板
+	Resolve(data prompt.Data) (*prompt.Template, bool)
+}
+
+// DBProvider abstracts database access.
+type DBProvider interface {
+	DB() *gorm.DB
+}
+
+// PostgreClient implements DBProvider using PostgreSQL.
+// A nil Client is resolved to the global client on first use.
+type PostgreClient struct {
+	Client *postgre.Client
+	once   sync.Once
+}
+
+func (p *PostgreClient) DB() *gorm.DB {
+	p.once.Do(func() {
+		if p.Client == nil {
+			p.Client = postgre.GetClient()
+		}
+	})
+	return p.Client.DB
+}
+
+// NewService returns a prompt template service backed by the DBProvider.
+func NewService(dbProvider DBProvider) Service {
+	return &service{provider: dbProvider, registry: prompt.NewRegistry()}
+}
+
+// version 模板表的版本标识，数量或最后更新时间变化即表示模板有修改
+type version struct {
+	Count      int64
+	UpdateTime *time.Time
+}
+
+// service implements the Service interface.
+type service struct {
+	provider DBProvider
+	registry *prompt.Registry
+
+	mu      sync.Mutex
+	version version // 最近一次加载时的版本
+}
+
+// ListTemplates 查询所有覆盖模板，按范围与目标排序
+// 参数：
+//   - ctx context.Context 上下文
+//
+// 返回：
+//   - []*promptModel.PromptTemplate 覆盖模板
+//   - error 查询失败时返回错误
+func (s *service) ListTemplates(ctx context.Context) ([]*promptModel.PromptTemplate, error) {
+	var templates []*promptModel.PromptTemplate
+	err := s.provider.DB().WithContext(ctx).Order("scope").Order("target").Find(&templates).Error
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// SaveTemplate 创建或更新覆盖模板，保存成功后立即重新加载
+// 参数：
+//   - ctx context.Context 上下文
+//   - t *promptModel.PromptTemplate 覆盖模板
+//
+// 返回：
+//   - error 范围、目标或模板语法不合法，或保存失败时返回错误
+func (s *service) SaveTemplate(ctx context.Context, t *promptModel.PromptTemplate) error {
+	if !prompt.ValidScope(prompt.Scope(t.Scope)) || t.Target == "" {
+		return fmt.Errorf("[%d]%w: %q/%q", constant.ErrInvalidParam, prompt.ErrInvalidScope, t.Scope, t.Target)
+	}
+	if _, err := prompt.Parse(t.Scope+":"+t.Target, t.Content); err != nil {
+		return fmt.Errorf("[%d]%w", constant.ErrInvalidParam, err)
+	}
+	now := time.Now()
+	t.CreateTime, t.UpdateTime = now, now
+
+	err := s.provider.DB().WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content", "enabled", "remark", "update_time"}),
+	}).Create(t).Error
+	if err != nil {
+		return err
+	}
+	return s.Reload(ctx)
+}
+
+// DeleteTemplate 删除覆盖模板，删除成功后立即重新加载
+// 参数：
+//   - ctx context.Context 上下文
+//   - id int64 模板ID
+//
+// 返回：
+//   - error 不存在时返回 gorm.ErrRecordNotFound
+func (s *service) DeleteTemplate(ctx context.Context, id int64) error {
+	result := s.provider.DB().WithContext(ctx).Delete(&promptModel.PromptTemplate{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return s.Reload(ctx)
+}
+
+// Reload 从数据库重新加载启用的覆盖模板
+// 语法错误的模板被跳过并记录日志，不影响其余模板生效
+// 参数：
+//   - ctx context.Context 上下文
+//
+// 返回：
+//   - error 查询失败时返回错误，已加载的模板保持不变
+func (s *service) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.currentVersion(ctx)
+	if err != nil {
+		return err
+	}
+	var records []*promptModel.PromptTemplate
+	err = s.provider.DB().WithContext(ctx).Where("enabled = ?", true).Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	entries := make([]prompt.Entry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, prompt.Entry{
+			Scope:  prompt.Scope(r.Scope),
+			Target: r.Target,
+			Text:   r.Content,
+		})
+	}
+	n, err := s.registry.Replace(entries)
+	if err != nil {
+		logger.Error(ctx, "some prompt templates are invalid", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	s.version = v
+	logger.Info(ctx, "prompt templates reloaded", map[string]any{
+		"templates": n,
+	})
+	return nil
+}
+
+// Watch 定期检查模板是否有修改，有修改时重新加载，ctx 取消时退出
+// 多实例部署时，其他实例通过管理接口修改的模板由此生效
+// 参数：
+//   - ctx context.Context 上下文
+//   - interval time.Duration 检查间隔
+func (s *service) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := s.changed(ctx)
+			if err == nil && changed {
+				err = s.Reload(ctx)
+			}
+			if err != nil {
+				logger.Warn(ctx, "check prompt templates failed", map[string]any{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// Resolve 查找设备适用的覆盖模板，没有覆盖模板时返回 false
+func (s *service) Resolve(data prompt.Data) (*prompt.Template, bool) {
+	return s.registry.Resolve(data)
+}
+
+// changed 模板表自上次加载后是否有修改
+func (s *service) changed(ctx context.Context) (bool, error) {
+	v, err := s.currentVersion(ctx)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !sameVersion(v, s.version), nil
+}
+
+// currentVersion 查询模板表当前的版本
+func (s *service) currentVersion(ctx context.Context) (version, error) {
+	var v version
+	err := s.provider.DB().WithContext(ctx).Model(&promptModel.PromptTemplate{}).
+		Select("COUNT(*) AS count, MAX(update_time) AS update_time").Scan(&v).Error
+	return v, err
+}
+
+// sameVersion 两个版本是否相同
+func sameVersion(a, b version) bool {
+	if a.Count != b.Count || (a.UpdateTime == nil) != (b.UpdateTime == nil) {
+		return false
+	}
+	return a.UpdateTime == nil || a.UpdateTime.Equal(*b.UpdateTime)
+}
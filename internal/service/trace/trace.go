@@ -0,0 +1,180 @@
+// Package trace voice pipeline turn record service
+// 语音处理流程每轮的记录，用于排查各阶段的耗时
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"yunyez/internal/model/trace"
+	"yunyez/internal/pkg/postgre"
+)
+
+var (
+	ServiceInstance *service
+)
+
+func init() {
+	// Initialize the service instance with a default DBProvider.
+	// The database is connected on first use, so importing the package does not need PostgreSQL.
+	ServiceInstance = &service{
+		provider: &PostgreClient{},
+	}
+}
+
+// TurnFilter 轮次记录的查询条件，零值不过滤
+type TurnFilter struct {
+	SN           string    // 设备序列号
+	Start        time.Time // 开始时间不早于
+	End          time.Time // 开始时间早于
+	MinLatencyMS int64     // 首个合成音频的最小毫秒数
+	ErrorOnly    bool      // 只查询出错的轮次
+}
+
+// Service defines the turn record business logic interface.
+type Service interface {
+	// 保存轮次记录
+	SaveTurn(ctx context.Context, record *trace.TurnRecord) error
+	// 按条件分页查询轮次记录，按开始时间倒序
+	ListTurns(ctx context.Context, filter TurnFilter, page, pageSize int) ([]*trace.TurnRecord, int64, error)
+	// 根据链路ID查询轮次记录，不存在时返回 gorm.ErrRecordNotFound
+	GetTurn(ctx context.Context, traceID string) (*trace.TurnRecord, error)
+	// 清除设备轮次记录中的识别文本与回复，返回清除的记录数
+	RedactTurns(ctx context.Context, sn string) (int64, error)
+}
+
+// DBProvider abstracts database access.
+type DBProvider interface {
+	DB() *gorm.DB
+}
+
+// PostgreClient implements DBProvider using PostgreSQL.
+// A nil Client is resolved to the global client on first use.
+type PostgreClient struct {
+	Client *postgre.Client
+	once   sync.Once
+}
+
+func (p *PostgreClient) DB() *gorm.DB {
+	p.once.Do(func() {
+		if p.Client == nil {
+			p.Client = postgre.GetClient()
+		}
+	})
+	return p.Client.DB
+}
+
+// NewService returns a turn record service backed by the DBProvider.
+func NewService(dbProvider DBProvider) Service {
+	return &service{provider: dbProvider}
+}
+
+// service implements the Service interface.
+type service struct {
+	provider DBProvider
+}
+
+// SaveTurn 保存轮次记录
+// 参数：
+//   - ctx context.Context 上下文
+//   - record *trace.TurnRecord 轮次记录
+//
+// 返回：
+//   - error 保存失败时返回错误
+func (s *service) SaveTurn(ctx context.Context, record *trace.TurnRecord) error {
+	if record == nil || record.SN == "" {
+		return errors.New("empty turn record")
+	}
+	return s.provider.DB().WithContext(ctx).Create(record).Error
+}
+
+// ListTurns 按条件分页查询轮次记录，按开始时间倒序
+// 参数：
+//   - ctx context.Context 上下文
+//   - filter TurnFilter 查询条件
+//   - page int 页码，从 1 开始
+//   - pageSize int 每页条数
+//
+// 返回：
+//   - []*trace.TurnRecord 轮次记录
+//   - int64 总条数
+//   - error 查询失败时返回错误
+func (s *service) ListTurns(ctx context.Context, filter TurnFilter, page, pageSize int) ([]*trace.TurnRecord, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	db := s.provider.DB().WithContext(ctx).Model(&trace.TurnRecord{})
+	if filter.SN != "" {
+		db = db.Where("device_sn = ?", filter.SN)
+	}
+	if !filter.Start.IsZero() {
+		db = db.Where("start_time >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		db = db.Where("start_time < ?", filter.End)
+	}
+	if filter.MinLatencyMS > 0 {
+		db = db.Where("first_audio_ms >= ?", filter.MinLatencyMS)
+	}
+	if filter.ErrorOnly {
+		db = db.Where("error_stage <> ''")
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []*trace.TurnRecord
+	offset := (page - 1) * pageSize
+	if err := db.Order("start_time DESC").Offset(offset).Limit(pageSize).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// GetTurn 根据链路ID查询轮次记录
+// 参数：
+//   - ctx context.Context 上下文
+//   - traceID string 链路ID
+//
+// 返回：
+//   - *trace.TurnRecord 轮次记录
+//   - error 不存在时返回 gorm.ErrRecordNotFound
+func (s *service) GetTurn(ctx context.Context, traceID string) (*trace.TurnRecord, error) {
+	if traceID == "" {
+		return nil, errors.New("empty trace id")
+	}
+	var record trace.TurnRecord
+	err := s.provider.DB().WithContext(ctx).Where(&trace.TurnRecord{TraceID: traceID}).Order("start_time DESC").First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// RedactTurns 清除设备轮次记录中的识别文本与回复，保留各阶段耗时用于排查
+// 参数：
+//   - ctx context.Context 上下文
+//   - sn string 设备序列号
+//
+// 返回：
+//   - int64 清除的记录数
+//   - error 更新失败时返回错误
+func (s *service) RedactTurns(ctx context.Context, sn string) (int64, error) {
+	if sn == "" {
+		return 0, errors.New("empty serial number")
+	}
+	result := s.provider.DB().WithContext(ctx).Model(&trace.TurnRecord{}).
+		Where("device_sn = ? AND (transcript <> '' OR reply <> '')", sn).
+		Updates(map[string]interface{}{"transcript": "", "reply": ""})
+	return result.RowsAffected, result.Error
+}
@@ -1,70 +1,424 @@
 // Package fragment  分片管理器
+// 按 设备 + 语句(SessionID) 缓存分片帧，按 FrameSeq 重排，
+// 检测丢帧与重复帧，在收到最后一帧后合并为完整语句
 package fragment
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
 )
 
-type FragmentManager struct {
-	buffers sync.Map // map[string]*fragmentBuffer
+// 分片处理错误
+var (
+	ErrUtteranceTooLarge = errors.New("fragment: utterance exceeds max size")
+	ErrUtteranceTooLong  = errors.New("fragment: utterance exceeds max duration")
+	ErrTooManyUtterances = errors.New("fragment: too many concurrent utterances for device")
+	ErrUtteranceClosed   = errors.New("fragment: utterance already finalized")
+	ErrInvalidFrame      = errors.New("fragment: not a fragment frame")
+)
+
+// Config 分片管理器配置
+type Config struct {
+	MaxUtteranceBytes   int           // 单句最大字节数
+	MaxUtteranceTime    time.Duration // 单句最长持续时间（从首帧到达开始计时）
+	MaxConcurrentPerDev int           // 单设备最大并发语句数
+	GapTimeout          time.Duration // 收到最后一帧后等待缺失帧的时间，超时后带缺口合并
+	IdleTimeout         time.Duration // 未收到最后一帧且空闲超过该时间的语句将被丢弃
+}
+
+// DefaultConfig 默认配置
+// 16kHz 16bit 单声道 60 秒约 1.9MB
+func DefaultConfig() Config {
+	return Config{
+		MaxUtteranceBytes:   2 * 1024 * 1024,
+		MaxUtteranceTime:    60 * time.Second,
+		MaxConcurrentPerDev: 2,
+		GapTimeout:          300 * time.Millisecond,
+		IdleTimeout:         5 * time.Second,
+	}
+}
+
+// Utterance 合并完成的一句语音
+type Utterance struct {
+	ClientID   string             // 设备序列号
+	SessionID  uint32             // 语句ID（v1 协议恒为 0）
+	Header     *mqtt_voice.Header // 首个到达帧的协议头（格式、采样率、声道）
+	Audio      []byte             // 按 FrameSeq 排序合并后的音频数据
+	Frames     int                // 实际合并的帧数
+	Missing    []uint32           // 缺失的帧序号（最多记录 maxReportedMissing 个）
+	MissingNum int                // 缺失的帧总数
+	Duplicates int                // 重复帧数
+	StartedAt  time.Time          // 首帧到达时间
+	FinishedAt time.Time          // 合并完成时间
 }
 
-type fragmentBuffer struct {
-	buf      *bytes.Buffer
-	lastSeen time.Time
+// Complete 是否无缺帧
+func (u *Utterance) Complete() bool {
+	return u.MissingNum == 0
+}
+
+// maxReportedMissing 最多记录的缺失帧序号个数
+const maxReportedMissing = 256
+
+// utteranceBuffer 单句分片缓冲区
+type utteranceBuffer struct {
+	clientID   string
+	sessionID  uint32
+	header     *mqtt_voice.Header
+	frames     map[uint32][]byte
+	size       int
+	duplicates int
+	lastSeq    uint32
+	hasLast    bool
+	maxSeq     uint32 // 已到达的最大帧序号
+	startedAt  time.Time
+	lastSeen   time.Time
+	gapTimer   *time.Timer
 }
 
-func NewFragmentManager() *FragmentManager {
-	mgr := &FragmentManager{}
+// flushedV1 提前结束的 v1 语句
+// v1 协议没有语句ID，不能按键关闭；帧序号回到 0 视为下一句开始，收到最后一帧视为该句结束
+type flushedV1 struct {
+	maxSeq uint32    // 提前结束时已到达的最大帧序号
+	at     time.Time // 提前结束的时间
+}
+
+// FragmentManager 分片管理器
+type FragmentManager struct {
+	cfg Config
+
+	mu      sync.Mutex
+	buffers map[string]*utteranceBuffer // key: clientID/sessionID
+	closed  map[string]time.Time        // 最近完成/丢弃的语句，用于丢弃迟到帧
+	flushed map[string]flushedV1        // 提前结束的 v1 语句，丢弃其后续帧直到下一句开始
+	perDev  map[string]int              // 单设备进行中的语句数
+
+	// OnComplete 缺帧等待超时后带缺口合并的回调
+	// 正常完成的语句由 Add 直接返回，不经过该回调
+	OnComplete func(u *Utterance)
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewFragmentManager 创建分片管理器
+func NewFragmentManager(cfg Config) *FragmentManager {
+	def := DefaultConfig()
+	if cfg.MaxUtteranceBytes <= 0 {
+		cfg.MaxUtteranceBytes = def.MaxUtteranceBytes
+	}
+	if cfg.MaxUtteranceTime <= 0 {
+		cfg.MaxUtteranceTime = def.MaxUtteranceTime
+	}
+	if cfg.MaxConcurrentPerDev <= 0 {
+		cfg.MaxConcurrentPerDev = def.MaxConcurrentPerDev
+	}
+	if cfg.GapTimeout <= 0 {
+		cfg.GapTimeout = def.GapTimeout
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = def.IdleTimeout
+	}
+	mgr := &FragmentManager{
+		cfg:     cfg,
+		buffers: make(map[string]*utteranceBuffer),
+		closed:  make(map[string]time.Time),
+		flushed: make(map[string]flushedV1),
+		perDev:  make(map[string]int),
+		done:    make(chan struct{}),
+	}
 	// 启动清理 goroutine
 	go mgr.cleanupLoop()
 	return mgr
 }
 
-// Append 追加分片数据到缓冲区
+// Close 停止清理 goroutine 并取消所有等待中的定时器
+func (mgr *FragmentManager) Close() {
+	mgr.once.Do(func() {
+		close(mgr.done)
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		for _, ub := range mgr.buffers {
+			if ub.gapTimer != nil {
+				ub.gapTimer.Stop()
+			}
+		}
+	})
+}
+
+// Add 追加分片帧
 // 参数：
-//   - clientID: 客户端唯一标识符，用于区分不同的客户端分片
-//   - data: 包含音频数据的字节切片
+//   - clientID: 设备序列号
+//   - header: 已校验的音频协议头（F 必须为分片帧或最后一帧）
+//   - payload: 音频载荷
+//
 // 返回值：
-//   - *bytes.Buffer: 包含所有已追加数据的缓冲区
-func (mgr *FragmentManager) Append(clientID string, data []byte) *bytes.Buffer {
+//   - *Utterance: 语句已完整（收到最后一帧且无缺帧）时返回合并结果，否则为 nil
+//   - error: 超出限制或帧非法时返回错误，超限的语句会被整体丢弃
+func (mgr *FragmentManager) Add(clientID string, header *mqtt_voice.Header, payload []byte) (*Utterance, error) {
+	if header == nil || (header.F != mqtt_common.VoiceFrameFragment && header.F != mqtt_common.VoiceFrameLast) {
+		return nil, ErrInvalidFrame
+	}
+
+	key := bufferKey(clientID, header.SessionID)
 	now := time.Now()
-	bufAny, _ := mgr.buffers.LoadOrStore(clientID, &fragmentBuffer{
-		buf:      &bytes.Buffer{},
-		lastSeen: now,
-	})
-	fb := bufAny.(*fragmentBuffer)
-	fb.buf.Write(data)
-	fb.lastSeen = now
-	return fb.buf
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if _, ok := mgr.closed[key]; ok {
+		return nil, fmt.Errorf("%w: %s seq %d", ErrUtteranceClosed, key, header.FrameSeq)
+	}
+	if f, ok := mgr.flushed[key]; ok {
+		switch {
+		case header.FrameSeq == 0 && f.maxSeq > 0: // 下一句开始
+			delete(mgr.flushed, key)
+		case header.F == mqtt_common.VoiceFrameLast:
+			delete(mgr.flushed, key)
+			return nil, fmt.Errorf("%w: %s seq %d", ErrUtteranceClosed, key, header.FrameSeq)
+		default:
+			return nil, fmt.Errorf("%w: %s seq %d", ErrUtteranceClosed, key, header.FrameSeq)
+		}
+	}
+
+	ub, ok := mgr.buffers[key]
+	if !ok {
+		if mgr.perDev[clientID] >= mgr.cfg.MaxConcurrentPerDev {
+			return nil, fmt.Errorf("%w: %s has %d", ErrTooManyUtterances, clientID, mgr.perDev[clientID])
+		}
+		ub = &utteranceBuffer{
+			clientID:  clientID,
+			sessionID: header.SessionID,
+			header:    header,
+			frames:    make(map[uint32][]byte),
+			startedAt: now,
+		}
+		mgr.buffers[key] = ub
+		mgr.perDev[clientID]++
+	}
+	ub.lastSeen = now
+	if header.FrameSeq > ub.maxSeq {
+		ub.maxSeq = header.FrameSeq
+	}
+
+	if now.Sub(ub.startedAt) > mgr.cfg.MaxUtteranceTime {
+		mgr.dropLocked(key, now)
+		return nil, fmt.Errorf("%w: %s", ErrUtteranceTooLong, key)
+	}
+
+	if _, dup := ub.frames[header.FrameSeq]; dup {
+		ub.duplicates++
+	} else {
+		if ub.size+len(payload) > mgr.cfg.MaxUtteranceBytes {
+			mgr.dropLocked(key, now)
+			return nil, fmt.Errorf("%w: %s", ErrUtteranceTooLarge, key)
+		}
+		// 复制载荷，避免与调用方共享底层数组
+		ub.frames[header.FrameSeq] = append([]byte(nil), payload...)
+		ub.size += len(payload)
+	}
+
+	if header.F == mqtt_common.VoiceFrameLast {
+		ub.hasLast = true
+		ub.lastSeq = header.FrameSeq
+	}
+	if !ub.hasLast {
+		return nil, nil
+	}
+
+	if ub.missingNum() == 0 {
+		return mgr.finalizeLocked(key, now), nil
+	}
+
+	// 收到最后一帧但存在缺口：等待乱序到达的帧，超时后带缺口合并
+	if ub.gapTimer == nil {
+		ub.gapTimer = time.AfterFunc(mgr.cfg.GapTimeout, func() {
+			mgr.flushGap(key)
+		})
+	}
+	return nil, nil
 }
 
-// GetAndDelete 获取并删除指定客户端的分片缓冲区
+// Flush 立即合并进行中的语句（不等待最后一帧）
+// 用于服务端端点检测（VAD）判定语音结束时提前结束语句，之后到达的该语句帧将被丢弃；
+// v1 语句的后续帧丢弃到帧序号回到 0 或收到最后一帧为止
 // 参数：
-//   - clientID: 客户端唯一标识符，用于区分不同的客户端分片
+//   - clientID: 设备序列号
+//   - sessionID: 语句ID
+//
 // 返回值：
-//   - *bytes.Buffer: 包含所有已追加数据的缓冲区
-func (mgr *FragmentManager) GetAndDelete(clientID string) *bytes.Buffer {
-	if bufAny, ok := mgr.buffers.LoadAndDelete(clientID); ok {
-		return bufAny.(*fragmentBuffer).buf
+//   - *Utterance: 合并结果，语句不存在时为 nil
+func (mgr *FragmentManager) Flush(clientID string, sessionID uint32) *Utterance {
+	key := bufferKey(clientID, sessionID)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	ub, ok := mgr.buffers[key]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if sessionID == 0 && !ub.hasLast {
+		mgr.flushed[key] = flushedV1{maxSeq: ub.maxSeq, at: now}
+	}
+	return mgr.finalizeLocked(key, now)
+}
+
+// Pending 获取设备进行中的语句数
+func (mgr *FragmentManager) Pending(clientID string) int {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	return mgr.perDev[clientID]
+}
+
+// flushGap 缺帧等待超时，带缺口合并并通过 OnComplete 回调交付
+func (mgr *FragmentManager) flushGap(key string) {
+	mgr.mu.Lock()
+	if _, ok := mgr.buffers[key]; !ok {
+		mgr.mu.Unlock()
+		return
+	}
+	u := mgr.finalizeLocked(key, time.Now())
+	onComplete := mgr.OnComplete
+	mgr.mu.Unlock()
+
+	if onComplete != nil {
+		onComplete(u)
+	}
+}
+
+// finalizeLocked 合并语句并移除缓冲区，调用方需持有锁
+func (mgr *FragmentManager) finalizeLocked(key string, now time.Time) *Utterance {
+	ub := mgr.buffers[key]
+	mgr.dropLocked(key, now)
+
+	seqs := ub.sortedSeqs()
+	var audio bytes.Buffer
+	audio.Grow(ub.size)
+	for _, seq := range seqs {
+		audio.Write(ub.frames[seq])
+	}
+
+	return &Utterance{
+		ClientID:   ub.clientID,
+		SessionID:  ub.sessionID,
+		Header:     ub.header,
+		Audio:      audio.Bytes(),
+		Frames:     len(seqs),
+		Missing:    missingSeqs(seqs, maxReportedMissing),
+		MissingNum: ub.missingNum(),
+		Duplicates: ub.duplicates,
+		StartedAt:  ub.startedAt,
+		FinishedAt: now,
 	}
-	return nil
+}
+
+// dropLocked 移除缓冲区并记录为已关闭，调用方需持有锁
+func (mgr *FragmentManager) dropLocked(key string, now time.Time) {
+	ub, ok := mgr.buffers[key]
+	if !ok {
+		return
+	}
+	if ub.gapTimer != nil {
+		ub.gapTimer.Stop()
+	}
+	delete(mgr.buffers, key)
+	// v1 协议没有语句ID，同一设备的下一句复用同一个键，不能记录为已关闭
+	if ub.sessionID != 0 {
+		mgr.closed[key] = now
+	}
+	if mgr.perDev[ub.clientID]--; mgr.perDev[ub.clientID] <= 0 {
+		delete(mgr.perDev, ub.clientID)
+	}
+}
+
+// sortedSeqs 获取按序排列的有效帧序号
+// 收到最后一帧后，序号大于最后一帧的帧视为无效帧
+func (ub *utteranceBuffer) sortedSeqs() []uint32 {
+	seqs := make([]uint32, 0, len(ub.frames))
+	for seq := range ub.frames {
+		if ub.hasLast && seq > ub.lastSeq {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// missingNum 获取 [0, lastSeq] 范围内缺失的帧数
+func (ub *utteranceBuffer) missingNum() int {
+	if !ub.hasLast {
+		return 0
+	}
+	received := 0
+	for seq := range ub.frames {
+		if seq <= ub.lastSeq {
+			received++
+		}
+	}
+	return int(uint64(ub.lastSeq) + 1 - uint64(received))
+}
+
+// missingSeqs 根据已排序的帧序号计算缺失的序号，最多返回 limit 个
+func missingSeqs(seqs []uint32, limit int) []uint32 {
+	var missing []uint32
+	var expected uint32
+	for _, seq := range seqs {
+		for ; expected < seq; expected++ {
+			if len(missing) >= limit {
+				return missing
+			}
+			missing = append(missing, expected)
+		}
+		expected = seq + 1
+	}
+	return missing
 }
 
 // cleanupLoop 清理过期分片缓冲区的 goroutine
-// 该 goroutine 每 60 秒检查一次所有分片缓冲区，删除超过 2 分钟未更新的缓冲区
+// 每秒检查一次：丢弃空闲超时或超过最长持续时间的语句，并清理过期的已关闭记录
 func (mgr *FragmentManager) cleanupLoop() {
-	ticker := time.NewTicker(60 * time.Second)
-	for range ticker.C {
-		now := time.Now()
-		mgr.buffers.Range(func(key, value any) bool {
-			fb := value.(*fragmentBuffer)
-			if now.Sub(fb.lastSeen) > 2*time.Minute { // 超时 2 分钟
-				mgr.buffers.Delete(key)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mgr.done:
+			return
+		case now := <-ticker.C:
+			mgr.mu.Lock()
+			for key, ub := range mgr.buffers {
+				if ub.hasLast {
+					continue // 由缺帧定时器负责
+				}
+				if now.Sub(ub.lastSeen) > mgr.cfg.IdleTimeout || now.Sub(ub.startedAt) > mgr.cfg.MaxUtteranceTime {
+					mgr.dropLocked(key, now)
+				}
 			}
-			return true
-		})
+			for key, at := range mgr.closed {
+				if now.Sub(at) > mgr.cfg.IdleTimeout {
+					delete(mgr.closed, key)
+				}
+			}
+			for key, f := range mgr.flushed {
+				if now.Sub(f.at) > mgr.cfg.IdleTimeout {
+					delete(mgr.flushed, key)
+				}
+			}
+			mgr.mu.Unlock()
+		}
 	}
-}
\ No newline at end of file
+}
+
+// bufferKey 缓冲区键
+func bufferKey(clientID string, sessionID uint32) string {
+	return fmt.Sprintf("%s/%d", clientID, sessionID)
+}
@@ -0,0 +1,210 @@
+// 测试分片帧的重排、去重、缺帧与限流
+package fragment
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	mqtt_common "yunyez/internal/pkg/mqtt/common"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+func frame(sessionID, seq uint32, last bool) *mqtt_voice.Header {
+	return &mqtt_voice.Header{
+		Version:   mqtt_common.VoiceVersionV2,
+		SessionID: sessionID,
+		FrameSeq:  seq,
+		F:         mqtt_voice.StreamFrameType(last),
+	}
+}
+
+func TestAddInOrderAndOutOfOrder(t *testing.T) {
+	mgr := NewFragmentManager(Config{})
+	defer mgr.Close()
+
+	// 乱序到达：最后一帧先到
+	order := []uint32{2, 0, 1}
+	var u *Utterance
+	for i, seq := range order {
+		got, err := mgr.Add("A0001", frame(7, seq, seq == 2), []byte{byte('a' + seq)})
+		if err != nil {
+			t.Fatalf("Add seq %d: %v", seq, err)
+		}
+		if i < len(order)-1 && got != nil {
+			t.Fatalf("utterance finalized early at seq %d", seq)
+		}
+		u = got
+	}
+	if u == nil {
+		t.Fatal("utterance not finalized")
+	}
+	if !bytes.Equal(u.Audio, []byte("abc")) || u.Frames != 3 || !u.Complete() {
+		t.Errorf("unexpected utterance: %+v", u)
+	}
+	if mgr.Pending("A0001") != 0 {
+		t.Errorf("pending = %d, want 0", mgr.Pending("A0001"))
+	}
+
+	// 迟到帧被丢弃
+	if _, err := mgr.Add("A0001", frame(7, 1, false), []byte("x")); !errors.Is(err, ErrUtteranceClosed) {
+		t.Errorf("got error %v, want %v", err, ErrUtteranceClosed)
+	}
+}
+
+func TestAddDuplicates(t *testing.T) {
+	mgr := NewFragmentManager(Config{})
+	defer mgr.Close()
+
+	mgr.Add("A0001", frame(1, 0, false), []byte("a"))
+	mgr.Add("A0001", frame(1, 0, false), []byte("a"))
+	u, err := mgr.Add("A0001", frame(1, 1, true), []byte("b"))
+	if err != nil || u == nil {
+		t.Fatalf("expected utterance, got %v, %v", u, err)
+	}
+	if u.Duplicates != 1 || !bytes.Equal(u.Audio, []byte("ab")) {
+		t.Errorf("unexpected utterance: %+v", u)
+	}
+}
+
+func TestGapTimeout(t *testing.T) {
+	mgr := NewFragmentManager(Config{GapTimeout: 20 * time.Millisecond})
+	defer mgr.Close()
+
+	done := make(chan *Utterance, 1)
+	mgr.OnComplete = func(u *Utterance) { done <- u }
+
+	mgr.Add("A0001", frame(3, 0, false), []byte("a"))
+	if u, _ := mgr.Add("A0001", frame(3, 2, true), []byte("c")); u != nil {
+		t.Fatal("utterance with gap should wait for missing frames")
+	}
+
+	select {
+	case u := <-done:
+		if u.Complete() || u.MissingNum != 1 || len(u.Missing) != 1 || u.Missing[0] != 1 {
+			t.Errorf("unexpected missing frames: %+v", u)
+		}
+		if !bytes.Equal(u.Audio, []byte("ac")) {
+			t.Errorf("audio = %q, want %q", u.Audio, "ac")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("gap timeout not fired")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	mgr := NewFragmentManager(Config{MaxUtteranceBytes: 4, MaxConcurrentPerDev: 1})
+	defer mgr.Close()
+
+	if _, err := mgr.Add("A0001", frame(1, 0, false), []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	// 单设备并发语句超限
+	if _, err := mgr.Add("A0001", frame(2, 0, false), []byte("a")); !errors.Is(err, ErrTooManyUtterances) {
+		t.Errorf("got error %v, want %v", err, ErrTooManyUtterances)
+	}
+	// 其他设备不受影响
+	if _, err := mgr.Add("A0002", frame(2, 0, false), []byte("a")); err != nil {
+		t.Errorf("other device rejected: %v", err)
+	}
+	// 单句字节数超限，整句丢弃
+	if _, err := mgr.Add("A0001", frame(1, 1, false), []byte("de")); !errors.Is(err, ErrUtteranceTooLarge) {
+		t.Errorf("got error %v, want %v", err, ErrUtteranceTooLarge)
+	}
+	if mgr.Pending("A0001") != 0 {
+		t.Errorf("pending = %d, want 0", mgr.Pending("A0001"))
+	}
+
+	if _, err := mgr.Add("A0001", &mqtt_voice.Header{F: mqtt_common.VoiceFrameFull}, nil); !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidFrame)
+	}
+}
+
+func TestV1SessionReuse(t *testing.T) {
+	mgr := NewFragmentManager(Config{})
+	defer mgr.Close()
+
+	// v1 协议语句ID恒为 0，连续两句不能被当作迟到帧丢弃
+	for i := 0; i < 2; i++ {
+		mgr.Add("A0001", frame(0, 0, false), []byte("a"))
+		u, err := mgr.Add("A0001", frame(0, 1, true), []byte("b"))
+		if err != nil || u == nil {
+			t.Fatalf("utterance %d: %v, %v", i, u, err)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	mgr := NewFragmentManager(Config{})
+	defer mgr.Close()
+
+	mgr.Add("A0001", frame(5, 1, false), []byte("b"))
+	mgr.Add("A0001", frame(5, 0, false), []byte("a"))
+	u := mgr.Flush("A0001", 5)
+	if u == nil || !bytes.Equal(u.Audio, []byte("ab")) {
+		t.Fatalf("unexpected utterance: %+v", u)
+	}
+	if mgr.Flush("A0001", 5) != nil {
+		t.Error("flushed utterance returned twice")
+	}
+	// 提前结束后到达的最后一帧被丢弃
+	if _, err := mgr.Add("A0001", frame(5, 2, true), []byte("c")); !errors.Is(err, ErrUtteranceClosed) {
+		t.Errorf("got error %v, want %v", err, ErrUtteranceClosed)
+	}
+}
+
+func TestFlushV1DropsTrailingFrames(t *testing.T) {
+	mgr := NewFragmentManager(Config{GapTimeout: 20 * time.Millisecond})
+	defer mgr.Close()
+
+	flushed := make(chan *Utterance, 1)
+	mgr.OnComplete = func(u *Utterance) { flushed <- u }
+
+	mgr.Add("A0001", frame(0, 0, false), []byte("a"))
+	mgr.Add("A0001", frame(0, 1, false), []byte("b"))
+	if u := mgr.Flush("A0001", 0); u == nil || !bytes.Equal(u.Audio, []byte("ab")) {
+		t.Fatalf("unexpected utterance: %+v", u)
+	}
+
+	// 端点检测提前结束后，设备仍在发送的帧与最后一帧不组成新的语句
+	for _, h := range []*mqtt_voice.Header{frame(0, 2, false), frame(0, 3, false), frame(0, 4, true)} {
+		if _, err := mgr.Add("A0001", h, []byte("x")); !errors.Is(err, ErrUtteranceClosed) {
+			t.Errorf("seq %d: got error %v, want %v", h.FrameSeq, err, ErrUtteranceClosed)
+		}
+	}
+	if mgr.Pending("A0001") != 0 {
+		t.Errorf("pending = %d, want 0", mgr.Pending("A0001"))
+	}
+	select {
+	case u := <-flushed:
+		t.Fatalf("trailing frames built an utterance: %+v", u)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 收到最后一帧后下一句正常处理
+	mgr.Add("A0001", frame(0, 0, false), []byte("c"))
+	u, err := mgr.Add("A0001", frame(0, 1, true), []byte("d"))
+	if err != nil || u == nil || !bytes.Equal(u.Audio, []byte("cd")) {
+		t.Fatalf("next utterance: %+v, %v", u, err)
+	}
+}
+
+func TestFlushV1NextUtteranceWithoutLast(t *testing.T) {
+	mgr := NewFragmentManager(Config{})
+	defer mgr.Close()
+
+	mgr.Add("A0001", frame(0, 0, false), []byte("a"))
+	mgr.Add("A0001", frame(0, 1, false), []byte("b"))
+	mgr.Flush("A0001", 0)
+	if _, err := mgr.Add("A0001", frame(0, 2, false), []byte("x")); !errors.Is(err, ErrUtteranceClosed) {
+		t.Errorf("got error %v, want %v", err, ErrUtteranceClosed)
+	}
+
+	// 最后一帧丢失时，帧序号回到 0 视为下一句开始
+	mgr.Add("A0001", frame(0, 0, false), []byte("c"))
+	u, err := mgr.Add("A0001", frame(0, 1, true), []byte("d"))
+	if err != nil || u == nil || !bytes.Equal(u.Audio, []byte("cd")) {
+		t.Fatalf("next utterance: %+v, %v", u, err)
+	}
+}
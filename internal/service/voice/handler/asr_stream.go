@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tools "yunyez/internal/common/tools"
+	asr "yunyez/internal/pkg/agent/asr"
+	logger "yunyez/internal/pkg/logger"
+)
+
+// asrSessionIdleTimeout 未正常结束的会话空闲超时清理时间，也是结束的会话忽略迟到分片的时间
+const asrSessionIdleTimeout = 10 * time.Second
+
+// asrSessions 按语句（设备 + 语句ID）管理流式识别会话
+type asrSessions struct {
+	client        asr.StreamingService // 流式识别客户端，nil 时不开启会话
+	streamTimeout time.Duration        // 单个流式会话最长时间
+	finishTimeout time.Duration        // 说话结束后等待最终结果的时间
+
+	mu       sync.Mutex
+	sessions map[string]*asrSession
+	finished map[string]time.Time // 已结束的语句，迟到的分片不再开启会话
+}
+
+// newASRSessions 创建流式识别会话管理
+// 参数：
+//   - client: 流式识别客户端，nil 时不边说边识别
+//   - streamTimeout: 单个流式会话最长时间
+//   - finishTimeout: 说话结束后等待最终结果的时间
+func newASRSessions(client asr.StreamingService, streamTimeout, finishTimeout time.Duration) *asrSessions {
+	return &asrSessions{
+		client:        client,
+		streamTimeout: streamTimeout,
+		finishTimeout: finishTimeout,
+		sessions:      make(map[string]*asrSession),
+		finished:      make(map[string]time.Time),
+	}
+}
+
+// enabled 是否边说边识别
+func (m *asrSessions) enabled() bool {
+	return m.client != nil
+}
+
+// asrSession 单句语音的流式识别会话
+// 分片由上行转码按帧序号排序后输入
+type asrSession struct {
+	mu       sync.Mutex
+	stream   asr.Stream
+	cancel   context.CancelFunc
+	failed   bool // 会话已失败，结束时回退到整句识别
+	lastSeen time.Time
+}
+
+// feed 向语句的流式识别会话输入按序的 PCM，首个分片到达时开启会话
+// 语句结束后迟到的分片被忽略，帧序号为 0 的分片视为复用语句键的下一句（v1 协议）
+// 参数：
+//   - ctx: 上下文对象
+//   - key: 语句键
+//   - seq: 分片帧序号
+//   - pcm: 16kHz 单声道 16 位 PCM
+func (m *asrSessions) feed(ctx context.Context, key string, seq uint32, pcm []byte) {
+	if m.client == nil {
+		return
+	}
+	s := m.session(ctx, key, seq)
+	if s == nil || len(pcm) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed {
+		return
+	}
+	if err := s.stream.Send(pcm); err != nil {
+		logger.Warn(ctx, "asr stream send failed", map[string]any{
+			"error": err.Error(),
+			"key":   key,
+		})
+		s.failed = true
+	}
+}
+
+// session 获取或创建语句的流式识别会话，同时清理空闲会话
+// 语句已结束且分片不是下一句的开始时返回 nil
+func (m *asrSessions) session(ctx context.Context, key string, seq uint32) *asrSession {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, s := range m.sessions {
+		if now.Sub(s.lastSeen) > asrSessionIdleTimeout {
+			s.cancel()
+			delete(m.sessions, k)
+		}
+	}
+	for k, at := range m.finished {
+		if now.Sub(at) > asrSessionIdleTimeout {
+			delete(m.finished, k)
+		}
+	}
+
+	s, ok := m.sessions[key]
+	if ok {
+		s.lastSeen = now
+		return s
+	}
+	if _, ok := m.finished[key]; ok {
+		if seq != 0 {
+			return nil
+		}
+		delete(m.finished, key)
+	}
+
+	// 会话生命周期跨越多个分片请求，脱离单个请求的上下文
+	streamCtx, cancel := context.WithTimeout(tools.WithTraceID(context.Background(), tools.GetTraceID(ctx)), m.streamTimeout)
+	s = &asrSession{cancel: cancel, lastSeen: now}
+	stream, err := m.client.StartStream(streamCtx, asr.DefaultStreamConfig())
+	if err != nil {
+		logger.Warn(ctx, "asr stream start failed", map[string]any{
+			"error": err.Error(),
+			"key":   key,
+		})
+		s.failed = true
+	} else {
+		s.stream = stream
+		go logPartials(streamCtx, key, stream)
+	}
+	m.sessions[key] = s
+	return s
+}
+
+// logPartials 记录识别的中间结果
+func logPartials(ctx context.Context, key string, stream asr.Stream) {
+	for r := range stream.Results() {
+		logger.Info(ctx, "asr stream result", map[string]any{
+			"key":        key,
+			"text":       r.Text,
+			"final":      r.IsFinal,
+			"stability":  r.Stability,
+			"confidence": r.Confidence,
+		})
+	}
+}
+
+// finish 语句结束，发送剩余的 PCM 并等待最终识别文本
+// 参数：
+//   - ctx: 上下文对象
+//   - key: 语句键
+//   - tail: 上行转码剩余的 PCM
+//
+// 返回值:
+//   - string: 识别文本
+//   - bool: 是否识别成功，false 时调用方回退到整句识别
+func (m *asrSessions) finish(ctx context.Context, key string, tail []byte) (string, bool) {
+	m.mu.Lock()
+	s, ok := m.sessions[key]
+	m.close(key)
+	m.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	defer s.cancel()
+
+	s.mu.Lock()
+	if !s.failed && len(tail) > 0 {
+		if err := s.stream.Send(tail); err != nil {
+			s.failed = true
+		}
+	}
+	failed := s.failed
+	s.mu.Unlock()
+	if failed {
+		return "", false
+	}
+
+	if err := s.stream.CloseSend(); err != nil {
+		logger.Warn(ctx, "asr stream close failed", map[string]any{
+			"error": err.Error(),
+			"key":   key,
+		})
+		return "", false
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, m.finishTimeout)
+	defer cancel()
+	text, err := s.stream.Transcript(waitCtx)
+	if err != nil {
+		logger.Warn(ctx, "asr stream transcript failed", map[string]any{
+			"error": err.Error(),
+			"key":   key,
+		})
+		return "", false
+	}
+	return text, true
+}
+
+// drop 丢弃语句的流式识别会话
+func (m *asrSessions) drop(key string) {
+	m.mu.Lock()
+	s, ok := m.sessions[key]
+	m.close(key)
+	m.mu.Unlock()
+	if ok {
+		s.cancel()
+	}
+}
+
+// close 移除语句的会话并记录语句已结束，调用方持有锁
+func (m *asrSessions) close(key string) {
+	delete(m.sessions, key)
+	if m.client != nil {
+		m.finished[key] = time.Now()
+	}
+}
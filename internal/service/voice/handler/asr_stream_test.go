@@ -0,0 +1,87 @@
+// 测试流式识别会话：按序输入分片，语句结束后迟到的分片不再开启会话
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	asr "yunyez/internal/pkg/agent/asr"
+)
+
+type fakeASRStream struct {
+	mu      sync.Mutex
+	sent    []byte
+	results chan asr.Result
+}
+
+func (s *fakeASRStream) Send(chunk []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, chunk...)
+	return nil
+}
+
+func (s *fakeASRStream) CloseSend() error {
+	close(s.results)
+	return nil
+}
+
+func (s *fakeASRStream) Results() <-chan asr.Result { return s.results }
+
+func (s *fakeASRStream) Transcript(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.sent), nil
+}
+
+type fakeStreamingASR struct {
+	fakeASR
+	mu      sync.Mutex
+	streams []*fakeASRStream
+}
+
+func (f *fakeStreamingASR) StartStream(ctx context.Context, cfg asr.StreamConfig) (asr.Stream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := &fakeASRStream{results: make(chan asr.Result)}
+	f.streams = append(f.streams, s)
+	return s, nil
+}
+
+func (f *fakeStreamingASR) started() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.streams)
+}
+
+func TestASRSessionsIgnoreLateFrames(t *testing.T) {
+	client := &fakeStreamingASR{}
+	m := newASRSessions(client, time.Minute, time.Second)
+	ctx := context.Background()
+	key := utteranceKey(testClient, 0)
+
+	m.feed(ctx, key, 0, []byte("ab"))
+	m.feed(ctx, key, 1, []byte("cd"))
+	text, ok := m.finish(ctx, key, []byte("ef"))
+	require.True(t, ok)
+	assert.Equal(t, "abcdef", text)
+
+	// 语句结束后迟到的分片不再开启会话
+	m.feed(ctx, key, 2, []byte("gh"))
+	assert.Equal(t, 1, client.started())
+	m.mu.Lock()
+	assert.Empty(t, m.sessions)
+	m.mu.Unlock()
+
+	// 帧序号回到 0 的分片是复用语句键的下一句
+	m.feed(ctx, key, 0, []byte("ij"))
+	text, ok = m.finish(ctx, key, nil)
+	require.True(t, ok)
+	assert.Equal(t, "ij", text)
+	assert.Equal(t, 2, client.started())
+}
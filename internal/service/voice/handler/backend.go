@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	config "yunyez/internal/common/config"
+	constant "yunyez/internal/common/constant"
+	llm "yunyez/internal/pkg/agent/llm"
+	ollama "yunyez/internal/pkg/agent/llm/ollama"
+	openai "yunyez/internal/pkg/agent/llm/openai"
+	metering "yunyez/internal/pkg/agent/metering"
+	logger "yunyez/internal/pkg/logger"
+)
+
+// initBackends 初始化 llm.backends 中按名称配置的 OpenAI 兼容后端及其计费规则
+// agent.model 填写后端名称即可切换模型，配置不完整的后端被跳过
+// 返回值:
+//   - map[string]*openai.Client: 按名称索引的后端
+//   - map[string]metering.PricingRule: 按 llm.UsageModel 索引的计费规则
+func initBackends() (map[string]*openai.Client, map[string]metering.PricingRule) {
+	backends := make(map[string]*openai.Client)
+	pricing := make(map[string]metering.PricingRule)
+	for name := range config.GetStringMap("llm.backends") {
+		prefix := "llm.backends." + name + "."
+		c, err := openai.New(openai.Config{
+			Name:     name,
+			Endpoint: config.GetString(prefix + "endpoint"),
+			APIKey:   config.GetString(prefix + "api_key"),
+			Model:    config.GetString(prefix + "model"),
+			System:   config.GetString(prefix + "system"),
+			Timeout:  time.Duration(config.GetInt(prefix+"timeout_ms")) * time.Millisecond,
+		})
+		if err != nil {
+			logger.Error(context.Background(), "init llm backend failed", map[string]any{
+				"backend": name,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		backends[name] = c
+		pricing[llm.UsageModel(name, c.Model())] = metering.PricingRule{
+			InputPrice:  config.GetFloat64(prefix + "pricing.input_price"),
+			OutputPrice: config.GetFloat64(prefix + "pricing.output_price"),
+			Currency:    config.GetStringWithDefault(prefix+"pricing.currency", "CNY"),
+		}
+	}
+	return backends, pricing
+}
+
+// initLocal 初始化 llm.local 中配置的本地模型服务（Ollama）及其计费规则
+// agent.model 为 local 时使用，未配置时本地模型对话返回错误
+// 返回值:
+//   - *ollama.Client: 本地模型服务，未配置或配置不完整时返回 nil
+//   - map[string]metering.PricingRule: 按 llm.UsageModel 索引的计费规则
+func initLocal() (*ollama.Client, map[string]metering.PricingRule) {
+	pricing := make(map[string]metering.PricingRule)
+	if config.GetString("llm.local.endpoint") == "" {
+		return nil, pricing
+	}
+	c, err := ollama.New(ollama.Config{
+		Endpoint:     config.GetString("llm.local.endpoint"),
+		Model:        config.GetString("llm.local.model"),
+		System:       config.GetString("llm.local.system"),
+		Timeout:      time.Duration(config.GetInt("llm.local.timeout_ms")) * time.Millisecond,
+		FirstTimeout: time.Duration(config.GetInt("llm.local.first_timeout_ms")) * time.Millisecond,
+		KeepAlive:    config.GetString("llm.local.keep_alive"),
+		Options:      config.GetStringMap("llm.local.options"),
+	})
+	if err != nil {
+		logger.Error(context.Background(), "init local llm failed", map[string]any{
+			"error": err.Error(),
+		})
+		return nil, pricing
+	}
+	pricing[llm.UsageModel(constant.ModelLocalLLM, c.Model())] = metering.PricingRule{
+		InputPrice:  config.GetFloat64("llm.local.pricing.input_price"),
+		OutputPrice: config.GetFloat64("llm.local.pricing.output_price"),
+		Currency:    config.GetStringWithDefault("llm.local.pricing.currency", "CNY"),
+	}
+	return c, pricing
+}
+
+// plainAgent 不带记忆、设备提示词与工具的模型，用于摘要、事实提取等不属于对话的请求
+func plainAgent(backends map[string]*openai.Client, local *ollama.Client, model string) llm.Agent {
+	return (&llm.Strategy{Backends: backends, Local: local}).SetAgent(model).Model
+}
+
+// initPricing 合并各模型的计费规则
+// agent.model 为 qwen 等内置模型时按 <agent.model>.model 的模型名计费，默认按 qwen-flash 的价格
+// 参数：
+//   - chatModel: 默认对话模型，即 agent.model
+//   - pricing: 各后端按 llm.UsageModel 索引的计费规则
+//
+// 返回值:
+//   - map[string]metering.PricingRule: 按模型名索引的计费规则
+func initPricing(chatModel string, pricing ...map[string]metering.PricingRule) map[string]metering.PricingRule {
+	rules := map[string]metering.PricingRule{
+		config.GetString(chatModel + ".model"): {
+			InputPrice:  config.GetFloat64WithDefault("pricing.models.qwen-flash.input_price", 0.001),
+			OutputPrice: config.GetFloat64WithDefault("pricing.models.qwen-flash.output_price", 0.002),
+			Currency:    config.GetStringWithDefault("pricing.models.qwen-flash.currency", "CNY"),
+		},
+	}
+	for _, p := range pricing {
+		for model, rule := range p {
+			rules[model] = rule
+		}
+	}
+	return rules
+}
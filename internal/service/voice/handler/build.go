@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	config "yunyez/internal/common/config"
+	llm "yunyez/internal/pkg/agent/llm"
+	memory "yunyez/internal/pkg/agent/memory"
+	metering "yunyez/internal/pkg/agent/metering"
+	resilience "yunyez/internal/pkg/agent/resilience"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+	postgre "yunyez/internal/pkg/postgre"
+	conversationService "yunyez/internal/service/conversation"
+	traceService "yunyez/internal/service/trace"
+	intent "yunyez/internal/service/voice/intent"
+)
+
+// BuildPipeline 按配置创建语音处理流程，须在 config.Init 之后调用
+// ASR、NLU、LLM、TTS 各自按提供方链降级并定时健康检查，
+// 加载提示词模板，按各模型的计费规则计费，按配置保存每轮的阶段耗时记录
+// 返回值:
+//   - *VoicePipeline: 语音处理流程，不再使用时调用 Close
+//   - error: 创建失败时返回错误
+func BuildPipeline() (*VoicePipeline, error) {
+	// 下发控制指令共用的应答跟踪
+	acks := control.NewAckManager(
+		time.Duration(config.GetIntWithDefault("mqtt.control.ack_timeout_ms", int(control.DefaultAckTimeout/time.Millisecond)))*time.Millisecond,
+		config.GetIntWithDefault("mqtt.control.retries", control.DefaultRetries),
+	)
+	commander := mqttCommander{acks: acks}
+
+	// 命令类意图与 LLM 可调用的工具
+	intents := newIntentRegistry(float32(config.GetFloat64WithDefault("nlu.confidence_threshold", intent.DefaultConfidence)))
+	tools := initTools(intents, commander)
+
+	// LLM 后端与计费，摘要、事实提取使用不带记忆的模型
+	chatModel := config.GetString("agent.model")
+	backends, pricing := initBackends()
+	local, localPricing := initLocal()
+	rec := metering.NewMeteringService(
+		metering.NewStandardCostCalculator(initPricing(chatModel, pricing, localPricing)),
+		metering.NewPostgreCostRepository(postgre.GetClient()),
+	)
+	plain := plainAgent(backends, local, chatModel)
+
+	// 后台任务（提示词模板热更新、健康检查）随流程关闭停止
+	ctx, stop := context.WithCancel(context.Background())
+
+	// 加载提示词模板，LLM 提供方共享对话记忆、提示词与工具
+	initPromptTemplates(ctx)
+	mem := initMemory(plain, rec)
+	strategy := &llm.Strategy{
+		Memory:   mem,
+		Prompt:   systemPrompt(initSystemTemplate()),
+		Tools:    tools,
+		Backends: backends,
+		Local:    local,
+	}
+
+	// 每轮处理的阶段耗时记录与对话记录
+	var turns TurnStore
+	if config.GetBool("audio.trace.enabled") {
+		turns = traceService.ServiceInstance
+	}
+	var conversations ConversationStore
+	if config.GetBool("audio.conversation.enabled") {
+		conversations = conversationService.ServiceInstance
+	}
+
+	asrClient := initASRChain()
+	nluClient := initNLUChain()
+	agent := initLLMChain(strategy, chatModel)
+	ttsClient := initTTSChain()
+
+	p, err := NewVoicePipeline(Dependencies{
+		ASR:           asrClient,
+		NLU:           nluClient,
+		Intents:       &deviceIntents{registry: intents, commander: commander},
+		Agent:         agent,
+		TTS:           ttsClient,
+		Publisher:     mqttPublisher{acks: acks, publish: newPublishConfig()},
+		Metering:      rec,
+		Storage:       fileStorage{dir: config.GetString("audio.storage")},
+		Turns:         turns,
+		Conversations: conversations,
+		Memory:        mem,
+		Acks:          acks,
+	}, Options{
+		VAD:              config.GetBool("audio.vad.enabled"),
+		VADConfig:        newVADConfig(),
+		ASRStreaming:     config.GetBool("asr.streaming"),
+		ASRStreamTimeout: time.Duration(config.GetInt("asr.stream_timeout_ms")) * time.Millisecond,
+		ASRFinishTimeout: time.Duration(config.GetInt("asr.finish_timeout_ms")) * time.Millisecond,
+		SkipNLU:          config.GetBool("agent.tools.skip_nlu") && tools.Len() > 0,
+		BargeIn:          config.GetBool("audio.barge_in"),
+		TTSConcurrency:   config.GetInt("tts.concurrency"),
+		Fragment:         newFragmentConfig(),
+		ConversationIdle: time.Duration(config.GetIntWithDefault("memory.ttl_s", int(memory.DefaultTTL/time.Second))) * time.Second,
+	})
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	p.stop = stop
+	p.intents = intents
+	p.tools = tools
+
+	// 从对话中提取需要长期记住的事实
+	if config.GetBool("profile.extract.enabled") {
+		timeout := time.Duration(config.GetIntWithDefault("profile.extract.timeout_ms", 10000)) * time.Millisecond
+		p.OnStage(StageLLM, rememberFacts(plain, rec, timeout))
+	}
+
+	// 定时检查各提供方的健康状态
+	p.monitors = []resilience.Monitor{asrClient.chain, nluClient.chain, agent.Chain, ttsClient.chain}
+	interval := time.Duration(config.GetIntWithDefault("resilience.probe_interval_s", 15)) * time.Second
+	go resilience.Watch(ctx, interval, p.monitors...)
+	return p, nil
+}
@@ -9,129 +9,25 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"sync/atomic"
+	"strings"
 	"time"
 
-	config "yunyez/internal/common/config"
 	constant "yunyez/internal/common/constant"
 	tools "yunyez/internal/common/tools"
-	asr "yunyez/internal/pkg/agent/asr"
 	llm "yunyez/internal/pkg/agent/llm"
 	metering "yunyez/internal/pkg/agent/metering"
 	nlu "yunyez/internal/pkg/agent/nlu"
+	resilience "yunyez/internal/pkg/agent/resilience"
 	tts "yunyez/internal/pkg/agent/tts"
 	logger "yunyez/internal/pkg/logger"
-	mqttCommon "yunyez/internal/pkg/mqtt/common"
 	mqttCore "yunyez/internal/pkg/mqtt/core"
 	voice "yunyez/internal/pkg/mqtt/protocol/voice"
 	buffer "yunyez/internal/service/voice/buffer"
+	vad "yunyez/internal/service/voice/vad"
 )
 
-var (
-	asrModel     = config.GetString("asr.model")      // default asr model
-	asrProtocol  = config.GetString("asr.protocol")   // default asr protocol
-	nluModel     = config.GetString("nlu.model")      // default nlu model
-	nluProtocol  = config.GetString("nlu.protocol")   // default nlu protocol
-	chatModel    = config.GetString("agent.model")    // default chat model：qwen
-	ttsModel     = config.GetString("tts.model")      // default tts model
-	ttsProtocol  = config.GetString("tts.protocol")   // default tts protocol
-
-	asrHTTPEndpoint = config.GetString("asr.http_endpoint") // default asr http endpoint
-	asrGRPCEndpoint = config.GetString("asr.grpc_endpoint") // default asr grpc endpoint
-	nluHTTPEndpoint = config.GetString("nlu.http_endpoint") // default nlu http endpoint
-	nluGRPCEndpoint = config.GetString("nlu.grpc_endpoint") // default nlu grpc endpoint
-	ttsGRPCEndpoint = config.GetString("tts.grpc_endpoint") // default tts grpc endpoint
-
-	agentStrategy *llm.Strategy // llm model strategy
-
-	asrClient asr.Service
-	nluClient nlu.Client
-	ttsClient tts.Service
-
-	publishCounter uint64 // TODO: 测试暂存序列号 记得移除
-)
-
-// 第三方 api 成本计算
-var (
-	model = config.GetString(fmt.Sprintf("%s.model", chatModel)) // qwen-flash
-	rules = map[string]metering.PricingRule{
-		model: {
-			InputPrice:  config.GetFloat64WithDefault("pricing.models.qwen-flash.input_price", 0.001),
-			OutputPrice: config.GetFloat64WithDefault("pricing.models.qwen-flash.output_price", 0.002),
-			Currency:    config.GetStringWithDefault("pricing.models.qwen-flash.currency", "CNY"),
-		},
-	}
-	meteringService *metering.MeteringService // metering service
-)
-
-func init() {
-	// 初始化 ASR 客户端
-	asrClient = initASRClient()
-	// 初始化 NLU 客户端
-	nluClient = initNLUClient()
-	// 初始化 LLM 策略
-	agentStrategy = &llm.Strategy{}
-	agentStrategy.SetAgent(chatModel)
-	// 初始化 TTS 客户端
-	ttsClient = tts.CreateTTSClient()
-	// 初始化计费服务
-	meteringService = metering.Initialize(rules)
-}
-
-// initASRClient 初始化 ASR 客户端
-func initASRClient() asr.Service {
-	cfg := asr.Config{
-		Model:      asrModel,
-		Protocol:   asr.Protocol(asrProtocol),
-		HTTPEndpoint: asrHTTPEndpoint,
-		GRPCEndpoint: asrGRPCEndpoint,
-	}
-	client, err := asr.NewASRClient(cfg)
-	if err != nil {
-		logger.Error(context.Background(), "initASRClient failed", map[string]any{
-			"error": err.Error(),
-		})
-		return nil
-	}
-	return client
-}
-
-// initNLUClient 初始化 NLU 客户端
-func initNLUClient() nlu.Client {
-	cfg := nlu.Config{
-		Model:      nluModel,
-		Protocol:   nlu.Protocol(nluProtocol),
-		HTTPEndpoint: nluHTTPEndpoint,
-		GRPCEndpoint: nluGRPCEndpoint,
-	}
-	return nlu.NewClient(cfg)
-}
-
-// initTTSClient 初始化 TTS 客户端
-func initTTSClient() tts.Service {
-	cfg := tts.Config{
-		Model:      ttsModel,
-		Protocol:   tts.Protocol(ttsProtocol),
-		HTTPEndpoint: config.GetString("tts.edge.endpoint"),
-		GRPCEndpoint: ttsGRPCEndpoint,
-		Voice:      config.GetString("tts.edge.params.voice"),
-		Rate:       config.GetString("tts.edge.params.rate"),
-		Pitch:      config.GetString("tts.edge.params.pitch"),
-		Volume:     config.GetString("tts.edge.params.volume"),
-	}
-	client, err := tts.NewTTSClient(cfg)
-	if err != nil {
-		logger.Error(context.Background(), "initTTSClient failed", map[string]any{
-			"error": err.Error(),
-		})
-		return nil
-	}
-	return client
-}
-
 // ChatPipeline response the natural language conversation response
 // step:
 // 1. asr: recognize the voice message to text
@@ -146,13 +42,39 @@ func initTTSClient() tts.Service {
 //
 // Returns:
 //   - error: the error object if the chat failed
-func ChatPipeline(ctx context.Context, clientID string, message []byte) error {
+func (p *VoicePipeline) ChatPipeline(ctx context.Context, clientID string, message []byte) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
 	}
 
+	// transcode the device upload (g711...) to the pcm expected by asr
+	pcm, isPCM, err := decodeUplink(ctx, message)
+	if err != nil {
+		logger.Error(ctx, "decode uplink audio failed", map[string]any{
+			"error":     err.Error(),
+			"clientID":  clientID,
+			"audio_len": len(message),
+		})
+		return err
+	}
+	// trim the leading and trailing silence to cut the asr cost
+	if isPCM && p.opts.VAD {
+		trimmed := vad.Trim(pcm, p.opts.VADConfig)
+		if trimmed == nil {
+			logger.Info(ctx, "no speech detected, skip asr", map[string]any{
+				"clientID":  clientID,
+				"audio_len": len(pcm),
+			})
+			return nil
+		}
+		pcm = trimmed
+	}
+	message = pcm
+
 	// asr
-	text, err := asrClient.Transfer(ctx, message)
+	start := time.Now()
+	text, err := p.deps.ASR.Transfer(ctx, message)
+	p.stage(ctx, StageResult{Stage: StageASR, ClientID: clientID, Start: start, Text: text, Err: err})
 	if err != nil {
 		logger.Error(ctx, "asr service failed", map[string]any{
 			"error":     err.Error(),
@@ -161,10 +83,39 @@ func ChatPipeline(ctx context.Context, clientID string, message []byte) error {
 		})
 		return err
 	}
+	return p.ChatText(ctx, clientID, text)
+}
+
+// ChatText response the recognized text, the pipeline after asr
+// used by ChatPipeline and the streaming asr which recognizes while the user speaks
+// Parameters:
+//   - ctx: the context.Context object
+//   - clientID: the device sequence number to generate the MQTT topic
+//   - text: the recognized text of the utterance
+//
+// Returns:
+//   - error: the error object if the chat failed
+func (p *VoicePipeline) ChatText(ctx context.Context, clientID string, text string) error {
+	// commands are carried out by the llm through the tools, skip the nlu hop
+	if p.opts.SkipNLU || p.deps.NLU == nil {
+		return p.chat(ctx, clientID, text)
+	}
+
 	// nlu
-	intent, err := nluClient.Predict(&nlu.Input{
+	start := time.Now()
+	intent, err := p.deps.NLU.Predict(ctx, &nlu.Input{
 		Text: text,
 	})
+	p.stage(ctx, StageResult{Stage: StageNLU, ClientID: clientID, Start: start, Text: text, Intent: intent, Err: err})
+	if errors.Is(err, resilience.ErrUnavailable) {
+		// every nlu provider is down, the llm still answers (and calls the tools if enabled)
+		logger.Warn(ctx, "nlu unavailable, fall back to chat", map[string]any{
+			"error":    err.Error(),
+			"clientID": clientID,
+			"text":     text,
+		})
+		return p.chat(ctx, clientID, text)
+	}
 	if err != nil {
 		logger.Error(ctx, "nlu service failed", map[string]any{
 			"error":    err.Error(),
@@ -173,165 +124,289 @@ func ChatPipeline(ctx context.Context, clientID string, message []byte) error {
 		})
 		return err
 	}
+	if p.deps.Intents == nil {
+		return p.chat(ctx, clientID, text)
+	}
 
-	// judge intent from input text
-	if intent.Intent != constant.IntentChitChat {
-		// special intent command
-		err := SpecialAction(ctx, clientID, intent)
-		if err != nil {
-			logger.Error(ctx, "special action failed", map[string]any{
-				"error":             err.Error(),
-				"clientID":          clientID,
-				"text":              text,
-				"intent":            intent.Intent,
-				"intent_confidence": intent.Confidence,
-				"intent_is_command": intent.IsCommand,
-			})
-			return err
-		}
+	if intent.Text == "" {
+		intent.Text = text
+	}
+	// command intents are handled by the intent handler,
+	// unknown or uncertain ones fall back to chit-chat
+	start = time.Now()
+	reply, handled, err := p.deps.Intents.Handle(ctx, clientID, intent)
+	p.stage(ctx, StageResult{Stage: StageIntent, ClientID: clientID, Start: start, Text: text, Intent: intent, Handled: handled, Reply: reply, Err: err})
+	if err != nil {
+		logger.Error(ctx, "handle intent failed", map[string]any{
+			"error":             err.Error(),
+			"clientID":          clientID,
+			"text":              text,
+			"intent":            intent.Intent,
+			"intent_confidence": intent.Confidence,
+			"intent_is_command": intent.IsCommand,
+		})
+		return err
+	}
+	if !handled {
+		return p.chat(ctx, clientID, text)
+	}
+	if reply == "" {
 		return nil
 	}
+	// the spoken confirmation of the command
+	return p.Speak(ctx, clientID, sentence(reply))
+}
+
+// chatApology the reply spoken when the llm fails, so the device is not left in silence
+const chatApology = "抱歉，我刚才走神了，请再说一遍吧"
+
+// errReplyIncomplete the reply stream of the agent closed without a finish or error event
+var errReplyIncomplete = errors.New("llm reply ended without finish")
 
+// chat call the llm model to response in streaming, speak the reply and record the usage
+// Parameters:
+//   - ctx: the context.Context object
+//   - clientID: the device sequence number to generate the MQTT topic
+//   - text: the user text
+//
+// Returns:
+//   - error: the error object if the chat failed
+func (p *VoicePipeline) chat(ctx context.Context, clientID string, text string) error {
 	// chat -- call the llm model to response in streaming
-	replyChan, usageChan, err := agentStrategy.Model.Chat(ctx, clientID, text)
+	start := time.Now()
+	events, err := p.deps.Agent.Chat(ctx, clientID, text)
 	if err != nil {
+		p.stage(ctx, StageResult{Stage: StageLLM, ClientID: clientID, Start: start, Text: text, Err: err})
 		logger.Error(ctx, "llm service failed", map[string]any{
 			"error":    err.Error(),
 			"clientID": clientID,
 			"text":     text,
 		})
-		return err
-	}
-
-	// merge the token text from replyChan to text buffer
-	textBuffer := buffer.NewTextBuffer(replyChan)
-	// generate audio by every sentence
-	for sentence := range textBuffer.Output() {
-		// tts
-		audio, err := ttsClient.Synthesize(ctx, sentence)
-		if err != nil {
-			logger.Error(ctx, "tts service failed", map[string]any{
-				"error":      err.Error(),
-				"clientID":   clientID,
-				"sentence":   sentence,
-				"audio_size": len(audio),
-			})
-			continue
-		}
-		// publish the audio message to the MQTT topic
-		err = Publish(ctx, clientID, audio)
-		if err != nil {
-			logger.Error(ctx, "publish audio failed", map[string]any{
-				"error":    err.Error(),
+		if speakErr := p.Speak(ctx, clientID, sentence(chatApology)); speakErr != nil {
+			logger.Error(ctx, "speak apology failed", map[string]any{
+				"error":    speakErr.Error(),
 				"clientID": clientID,
-				"text":     sentence,
 			})
-			return err
 		}
+		return err
+	}
 
-		fmt.Printf("sentence: %s\n", sentence)
+	// merge the token text of the reply to text buffer
+	textBuffer := buffer.NewTextBuffer(p.replyText(ctx, clientID, text, start, events))
+	// synthesize every sentence and stream the audio to the device as it arrives
+	err = p.Speak(ctx, clientID, textBuffer.Output())
+	if err != nil {
+		logger.Error(ctx, "speak reply failed", map[string]any{
+			"error":    err.Error(),
+			"clientID": clientID,
+			"text":     text,
+		})
+		return err
 	}
+	return nil
+}
 
-	// record usage
+// replyText forward the reply text of the agent events to be spoken and record the usage of the turn
+// a turn that fails, even after part of the reply was spoken, ends with the apology (the error is logged by the agent);
+// a turn interrupted by the cancelled context (barge-in) just stops
+// Parameters:
+//   - ctx: the context.Context object
+//   - clientID: the device sequence number
+//   - text: the user text
+//   - start: when the agent was called
+//   - events: the events of the agent
+//
+// Returns:
+//   - <-chan string: the reply fragments, closed when the turn ends
+func (p *VoicePipeline) replyText(ctx context.Context, clientID, text string, start time.Time, events <-chan llm.Event) <-chan string {
+	out := make(chan string, cap(events))
 	go func() {
-		bgCtx := context.Background()
-		tid := tools.GetTraceID(ctx)
-		if tid != "" {
-			bgCtx = tools.WithTraceID(bgCtx, tid)
+		defer close(out)
+
+		result := StageResult{Stage: StageLLM, ClientID: clientID, Start: start, Text: text}
+		var reply strings.Builder
+		forward := true
+		finished := false
+		for e := range events {
+			switch e.Type {
+			case llm.EventText:
+				if result.FirstToken.IsZero() {
+					result.FirstToken = time.Now()
+				}
+				reply.WriteString(e.Text)
+				if forward {
+					select {
+					case out <- e.Text:
+					case <-ctx.Done():
+						forward = false // keep draining so the agent can finish
+					}
+				}
+			case llm.EventUsage:
+				result.Usage = e.Usage
+				go recordUsage(ctx, p.deps.Metering, clientID, e.Usage)
+			case llm.EventFinish:
+				finished = true
+				if e.Truncated() {
+					logger.Warn(ctx, "llm reply truncated", map[string]any{
+						"clientID": clientID,
+						"text":     text,
+					})
+				}
+			case llm.EventError:
+				result.Err = e.Err
+			}
+		}
+		result.Reply = reply.String()
+		switch {
+		case finished:
+		case result.Err != nil:
+		case ctx.Err() != nil:
+			result.Err = context.Cause(ctx)
+		default:
+			result.Err = errReplyIncomplete
 		}
+		p.stage(ctx, result)
 
+		if finished || ctx.Err() != nil {
+			return
+		}
 		select {
-		case u, ok := <-usageChan:
-			if !ok {
-				logger.Info(bgCtx, "llm usage closed", map[string]any{
-					"clientID": clientID,
-				})
-				return
-			}
-			logger.Info(bgCtx, "llm usage", map[string]any{
-				"clientID": clientID,
-				"usage":    u,
-			})
-
-			// record into metering repository
-			err = meteringService.Record(bgCtx, clientID, *u)
-			if err != nil {
-				logger.Error(bgCtx, "metering record failed", map[string]any{
-					"error":    err.Error(),
-					"clientID": clientID,
-					"usage":    u,
-				})
-			}
-
-		case <-time.After(10 * time.Second): // ⏱️ 超时兜底
-			logger.Warn(bgCtx, "timeout waiting for LLM usage data", map[string]any{
-				"clientID": clientID,
-			})
+		case out <- chatApology:
+		case <-ctx.Done():
 		}
 	}()
-
-	return nil
+	return out
 }
 
-func SpecialAction(ctx context.Context, clientID string, intent *nlu.Intent) error {
-	if intent == nil {
-		return fmt.Errorf("intent is nil")
+// recordUsage record the usage of a model request into the metering repository
+// the record is kept even if the turn is cancelled, with the trace id of the turn
+// Parameters:
+//   - ctx: the context.Context object of the turn
+//   - rec: the metering recorder, nil to only log the usage
+//   - clientID: the device sequence number
+//   - u: the usage of the request
+func recordUsage(ctx context.Context, rec Recorder, clientID string, u *metering.Usage) {
+	bgCtx := context.Background()
+	if tid := tools.GetTraceID(ctx); tid != "" {
+		bgCtx = tools.WithTraceID(bgCtx, tid)
 	}
-
-	switch intent.Text {
-	case constant.IntentDenyAction: // cannel action -- the unique command
-		// TODO publish the cancel message to the MQTT topic
-
-		return nil
-	case constant.IntentPlayMusic: // play music action
-		// TODO publish the play music message to the MQTT topic
-
-		return nil
-	case constant.IntentSetTemperature: // set temperature action
-		// TODO publish the set temperature message to the MQTT topic
-
-		return nil
+	logger.Info(bgCtx, "llm usage", map[string]any{
+		"clientID": clientID,
+		"usage":    u,
+	})
+	if rec == nil {
+		return
 	}
-	return nil
+	if err := rec.Record(bgCtx, clientID, *u); err != nil {
+		logger.Error(bgCtx, "metering record failed", map[string]any{
+			"error":    err.Error(),
+			"clientID": clientID,
+			"usage":    u,
+		})
+	}
+}
+
+// sentence a closed channel of one sentence to speak
+func sentence(text string) <-chan string {
+	sentences := make(chan string, 1)
+	sentences <- text
+	close(sentences)
+	return sentences
 }
 
-// Publish publish the message to the MQTT topic
+// Speak synthesize the sentences and stream the audio to the device as it arrives
+// The following sentences are synthesized while the previous one is being played,
+// at most Options.TTSConcurrency at a time, and the audio keeps the sentence order.
+// All sentences of the reply are sent as one audio stream ended by the last frame
 // Parameters:
-//   - ctx: the context.Context object
+//   - ctx: the context.Context object carrying the device uplink header
 //   - clientID: the device sequence number to generate the MQTT topic
-//   - payload: the message payload to publish
+//   - sentences: the sentences to speak, closed when the reply ends
 //
 // Returns:
-//   - error: the error object if the publish failed
-func Publish(ctx context.Context, clientID string, payload []byte) error {
-	// TODO 移除
-	// @dev 暂存到./storage/tmp/audio/<clientID>/<timestamp>.wav
-	rootDir := tools.GetRootDir()
-	audioDir := filepath.Join(rootDir, "storage", "tmp", "audio", clientID)
-	if err := os.MkdirAll(audioDir, 0755); err != nil {
-		logger.Error(ctx, "failed to create audio dir", map[string]any{
-			"dir":   audioDir,
-			"error": err.Error(),
-		})
+//   - error: the error object if the audio can't be sent
+func (p *VoicePipeline) Speak(ctx context.Context, clientID string, sentences <-chan string) error {
+	start := time.Now()
+	stream, err := p.deps.Publisher.Open(ctx, clientID)
+	if err != nil {
+		p.stage(ctx, StageResult{Stage: StagePublish, ClientID: clientID, Start: start, Err: err})
 		return err
 	}
-	filename := fmt.Sprintf("%d_%04d.wav", time.Now().UnixNano(), atomic.AddUint64(&publishCounter, 1))
-	fullPath := filepath.Join(audioDir, filename)
 
-	if err := os.WriteFile(fullPath, payload, 0644); err != nil {
-		logger.Error(ctx, "failed to save audio file", map[string]any{
-			"path":  fullPath,
-			"error": err.Error(),
-		})
-		return err
-	}
+	// the synthesis stops reading once ctx is cancelled (barge-in),
+	// drain the rest so the llm and the text buffer don't block
+	defer func() {
+		go func() {
+			for range sentences {
+			}
+		}()
+	}()
+
+	written := false
+	firstChunk := make(map[int]time.Time) // when the first audio chunk of each sentence arrived
+	err = tts.SynthesizeOrdered(ctx, p.deps.TTS, sentences, p.opts.TTSConcurrency, func(seg tts.Segment) error {
+		if seg.Last {
+			sentenceStart, ok := firstChunk[seg.Index]
+			if !ok {
+				sentenceStart = time.Now()
+			}
+			delete(firstChunk, seg.Index)
+			p.stage(ctx, StageResult{Stage: StageTTS, ClientID: clientID, Start: sentenceStart, Text: seg.Text, Err: seg.Err})
+			if seg.Err != nil { // skip the sentence, the rest of the reply is still spoken
+				logger.Error(ctx, "tts service failed", map[string]any{
+					"error":    seg.Err.Error(),
+					"clientID": clientID,
+					"sentence": seg.Text,
+				})
+			} else {
+				logger.Info(ctx, "sentence published", map[string]any{
+					"clientID": clientID,
+					"index":    seg.Index,
+					"sentence": seg.Text,
+				})
+			}
+			return nil
+		}
 
-	logger.Info(ctx, "audio saved", map[string]any{
-		"path":       fullPath,
-		"size_bytes": len(payload),
-		"client_id":  clientID,
+		if _, ok := firstChunk[seg.Index]; !ok {
+			firstChunk[seg.Index] = time.Now()
+		}
+		written = true
+		return stream.Write(ctx, seg.Audio, seg.Format)
 	})
+	if !written {
+		p.stage(ctx, StageResult{Stage: StagePublish, ClientID: clientID, Start: start, Err: err})
+		return err
+	}
+	if ctx.Err() != nil { // aborted, the device is told to stop playback instead
+		p.stage(ctx, StageResult{Stage: StagePublish, ClientID: clientID, Start: start, Err: context.Cause(ctx)})
+		return ctx.Err()
+	}
+	// end the stream even if a sentence failed, so the device stops waiting
+	if closeErr := stream.Close(ctx); err == nil {
+		err = closeErr
+	}
+	p.stage(ctx, StageResult{Stage: StagePublish, ClientID: clientID, Start: start, Err: err})
+	if err != nil {
+		logger.Error(ctx, "failed to publish audio stream", map[string]any{
+			"clientID": clientID,
+			"error":    err.Error(),
+		})
+	}
+	return err
+}
 
+// deviceClient get the MQTT client publishing to the device voice topic
+// The protocol version and session ID follow the device's uplink frame in ctx
+// Parameters:
+//   - ctx: the context carrying the device uplink header
+//   - clientID: the device sequence number to generate the MQTT topic
+//
+// Returns:
+//   - mqttCore.Client: the MQTT client
+//   - mqttCore.Topic: the voice topic of the device
+//   - error: the error object if the client is unavailable
+func deviceClient(ctx context.Context, clientID string) (mqttCore.Client, mqttCore.Topic, error) {
 	// TODO 发布 MQTT 消息
 	// TODO 开发测试目前先保留配置参数硬编码，记得移除
 	// test topic：test/T0001/A0001/voice/client
@@ -348,28 +423,9 @@ func Publish(ctx context.Context, clientID string, payload []byte) error {
 			"clientID": clientID,
 			"error":    err.Error(),
 		})
-		return err
-	}
-
-	audioConfig := voice.AudioConfig{
-		AudioFormat:     mqttCommon.VoiceAudioFormatWav,
-		AudioSampleRate: 16000, // TODO: get from constant
-		AudioChannel:    1,
+		return mqtt, topic, err
 	}
-
-	logger.Info(ctx, "publish audio config", map[string]any{
-		"topic":        topic.String(),
-		"audio_config": audioConfig,
-	})
-
-	err = mqtt.Publish(ctx, payload, audioConfig)
-	if err != nil {
-		logger.Error(ctx, "failed to publish audio stream", map[string]any{
-			"clientID": clientID,
-			"error":    err.Error(),
-		})
-		return err
-	}
-
-	return nil
+	// negotiate the protocol version with the device's uplink frame
+	mqtt.Session = voice.SessionFromContext(ctx)
+	return mqtt, topic, nil
 }
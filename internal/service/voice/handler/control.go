@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	constant "yunyez/internal/common/constant"
+	logger "yunyez/internal/pkg/logger"
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	mqttCore "yunyez/internal/pkg/mqtt/core"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+)
+
+// ProcessCommand 处理设备上行的控制消息
+// 应答交给等待中的指令；指令处理后回复应答，非法指令回复错误应答
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - payload: JSON 控制消息
+//
+// 返回值:
+//   - error: 消息非法或处理失败时返回错误
+func (p *VoicePipeline) ProcessCommand(ctx context.Context, clientID string, payload []byte) error {
+	msg, err := control.Decode(payload)
+	if err != nil {
+		// 能识别出请求ID的非法指令回复错误应答，便于设备停止重发
+		if msg != nil && msg.Kind == control.KindCommand && msg.ID != "" && msg.Type != "" {
+			code := control.CodeBadRequest
+			if errors.Is(err, control.ErrUnknownType) {
+				code = control.CodeUnsupported
+			}
+			replyControl(ctx, clientID, msg, code, err.Error())
+		}
+		return err
+	}
+
+	if msg.IsAck() {
+		if !p.deps.Acks.Resolve(msg) {
+			logger.Info(ctx, "control ack without pending command", map[string]any{
+				"clientID": clientID,
+				"replyID":  msg.ReplyID,
+				"type":     msg.Type,
+			})
+		}
+		return nil
+	}
+
+	switch msg.Type {
+	case control.TypeCancel:
+		// 设备重发的取消指令重复执行无副作用
+		if err := p.CancelTurn(ctx, clientID); err != nil {
+			replyControl(ctx, clientID, msg, control.CodeFailed, err.Error())
+			return err
+		}
+		replyControl(ctx, clientID, msg, control.CodeOK, "")
+		return nil
+	default:
+		err := fmt.Errorf("%w: %s is not a device command", control.ErrUnknownType, msg.Type)
+		replyControl(ctx, clientID, msg, control.CodeUnsupported, err.Error())
+		return err
+	}
+}
+
+// sendControl 下发控制指令并等待设备应答，超时未应答时以相同请求ID重发
+// 参数：
+//   - ctx: 上下文对象
+//   - acks: 控制指令应答跟踪，与处理设备上行应答的流程共用
+//   - clientID: 客户端ID(设备序列号)
+//   - msg: 控制指令
+//
+// 返回值:
+//   - *control.Message: 设备应答
+//   - error: 发送失败、应答超时（control.ErrAckTimeout）或设备拒绝（control.ErrRejected）时返回错误
+func sendControl(ctx context.Context, acks *control.AckManager, clientID string, msg *control.Message) (*control.Message, error) {
+	ack, err := acks.Send(ctx, msg, func(ctx context.Context, _ []byte) error {
+		return publishControl(ctx, clientID, msg)
+	})
+	if err != nil {
+		logger.Warn(ctx, "control command not acknowledged", map[string]any{
+			"clientID": clientID,
+			"id":       msg.ID,
+			"type":     msg.Type,
+			"error":    err.Error(),
+		})
+		return ack, err
+	}
+	return ack, nil
+}
+
+// replyControl 回复设备指令的应答，发送失败只记录日志
+func replyControl(ctx context.Context, clientID string, cmd *control.Message, code int, message string) {
+	_ = publishControl(ctx, clientID, control.NewAck(cmd, code, message))
+}
+
+// publishControl 下发控制消息到设备的控制指令主题
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - msg: 控制消息
+//
+// 返回值:
+//   - error: 发送失败时返回错误
+func publishControl(ctx context.Context, clientID string, msg *control.Message) error {
+	topic := mqttCore.Topic{ // TODO: get from device registry
+		Vendor:      constant.VendorTest,
+		DeviceType:  "T0001",
+		DeviceSN:    clientID,
+		CommandType: mqttCommon.CommandControl,
+		Flag:        "client",
+	}
+	mqtt, err := mqttCore.GetMQTTClient(ctx, topic)
+	if err != nil {
+		return err
+	}
+	err = mqtt.PublishControl(ctx, msg)
+	if err != nil {
+		logger.Error(ctx, "publish control message failed", map[string]any{
+			"clientID": clientID,
+			"id":       msg.ID,
+			"kind":     msg.Kind,
+			"type":     msg.Type,
+			"error":    err.Error(),
+		})
+	}
+	return err
+}
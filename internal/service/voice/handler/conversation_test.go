@@ -0,0 +1,121 @@
+// 测试对话记录：每轮识别文本与回复追加到设备的会话，清空时一并清空对话记忆
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conversationModel "yunyez/internal/model/conversation"
+	traceModel "yunyez/internal/model/trace"
+	memory "yunyez/internal/pkg/agent/memory"
+)
+
+type fakeConversations struct {
+	mu       sync.Mutex
+	turns    []*conversationModel.Turn
+	idle     time.Duration
+	clearErr error
+}
+
+func (f *fakeConversations) AppendTurn(ctx context.Context, turn *conversationModel.Turn, idle time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.turns = append(f.turns, turn)
+	f.idle = idle
+	return nil
+}
+
+func (f *fakeConversations) ClearHistory(ctx context.Context, sn string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clearErr != nil {
+		return 0, f.clearErr
+	}
+	n := int64(len(f.turns))
+	f.turns = nil
+	return n, nil
+}
+
+func (f *fakeConversations) saved() []*conversationModel.Turn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.turns
+}
+
+type fakeMemory struct {
+	cleared []string
+}
+
+func (f *fakeMemory) History(ctx context.Context, sn string) ([]memory.Message, error) {
+	return nil, nil
+}
+
+func (f *fakeMemory) Append(ctx context.Context, sn, user, assistant string) error { return nil }
+
+func (f *fakeMemory) Clear(ctx context.Context, sn string) error {
+	f.cleared = append(f.cleared, sn)
+	return nil
+}
+
+func TestProcessFullAppendsConversationTurn(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{ConversationIdle: time.Minute})
+
+	require.NoError(t, p.ProcessFull(context.Background(), testClient, pcmHeader(), make([]byte, 640)))
+
+	require.Eventually(t, func() bool { return len(f.convs.saved()) == 1 }, time.Second, 10*time.Millisecond)
+	turn := f.convs.saved()[0]
+	assert.Equal(t, testClient, turn.SN)
+	assert.Equal(t, "今天天气怎么样", turn.Transcript)
+	assert.Equal(t, "今天晴天。适合出门。", turn.Reply)
+	assert.Equal(t, "chat", turn.Intent)
+	assert.Equal(t, "A0001/7.pcm", turn.AudioRef)
+	assert.Equal(t, savedTurn(t, f).TraceID, turn.TraceID, "the turn links to its latency record")
+	assert.Equal(t, time.Minute, f.convs.idle)
+}
+
+func TestProcessFullSkipsConversationWithoutTranscript(t *testing.T) {
+	f := newFakes()
+	f.asr.text, f.asr.err = "", errors.New("asr timeout")
+	p := f.pipeline(t, Options{})
+
+	assert.Error(t, p.ProcessFull(context.Background(), testClient, pcmHeader(), make([]byte, 640)))
+
+	savedTurn(t, f)
+	assert.Empty(t, f.convs.saved())
+}
+
+func TestClearHistory(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+	f.convs.turns = []*conversationModel.Turn{{SN: testClient}, {SN: testClient}}
+	f.turns.records = []*traceModel.TurnRecord{
+		{SN: testClient, Transcript: "今天天气怎么样", Reply: "今天晴天。", TotalMS: 800},
+		{SN: "B0002", Transcript: "你好", Reply: "你好呀"},
+	}
+
+	deleted, err := p.ClearHistory(context.Background(), testClient)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Empty(t, f.convs.saved())
+	assert.Equal(t, []string{testClient}, f.memory.cleared)
+
+	// 轮次记录保留耗时，清除识别文本与回复；其他设备的记录不受影响
+	records := f.turns.saved()
+	assert.Empty(t, records[0].Transcript)
+	assert.Empty(t, records[0].Reply)
+	assert.Equal(t, int64(800), records[0].TotalMS)
+	assert.Equal(t, "你好", records[1].Transcript)
+
+	// 对话记录删除失败时仍清空对话记忆
+	f.convs.clearErr = errors.New("db down")
+	_, err = p.ClearHistory(context.Background(), testClient)
+	assert.ErrorContains(t, err, "db down")
+	assert.Len(t, f.memory.cleared, 2)
+}
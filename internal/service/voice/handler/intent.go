@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	nlu "yunyez/internal/pkg/agent/nlu"
+	logger "yunyez/internal/pkg/logger"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+	deviceService "yunyez/internal/service/device"
+	intent "yunyez/internal/service/voice/intent"
+)
+
+// newIntentRegistry 创建意图处理器注册表并注册内置处理器
+// 参数：
+//   - confidence: 默认置信度阈值，<= 0 时使用 intent.DefaultConfidence
+func newIntentRegistry(confidence float32) *intent.Registry {
+	r := intent.NewRegistry()
+	if confidence > 0 {
+		r.DefaultConfidence = confidence
+	}
+	if err := intent.RegisterBuiltins(r); err != nil {
+		logger.Error(context.Background(), "register builtin intents failed", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	return r
+}
+
+// mqttCommander 通过 MQTT 控制指令主题向设备下发指令
+type mqttCommander struct {
+	acks *control.AckManager // 控制指令应答跟踪
+}
+
+// Send 下发指令并等待设备应答
+func (c mqttCommander) Send(ctx context.Context, device intent.Device, command string, params map[string]any) error {
+	msg, err := control.NewCommand(command).Params(params).Build()
+	if err != nil {
+		return err
+	}
+	_, err = sendControl(ctx, c.acks, device.SN, msg)
+	return err
+}
+
+// deviceContext 查询设备上下文，查询失败时只带序列号
+func deviceContext(ctx context.Context, clientID string) intent.Device {
+	dev := intent.Device{SN: clientID}
+	info, err := deviceService.ServiceInstance.GetDeviceBySN(ctx, clientID)
+	if err != nil {
+		logger.Warn(ctx, "get device context failed", map[string]any{
+			"clientID": clientID,
+			"error":    err.Error(),
+		})
+		return dev
+	}
+	dev.Vendor = info.VendorName
+	dev.DeviceType = info.DeviceType
+	dev.ProductModel = info.ProductModel
+	dev.FirmwareVersion = info.FirmwareVersion
+	return dev
+}
+
+// deviceIntents 按注册表处理命令类意图，指令经 MQTT 下发到设备
+type deviceIntents struct {
+	registry  *intent.Registry
+	commander intent.Commander // 下发指令到设备
+}
+
+// Handle 处理命令类意图
+// 未注册、置信度不足或缺少实体的意图不处理，由调用方回退到闲聊；
+// 设备未应答或拒绝指令时以语音提示代替处理器的确认
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - result: NLU 意图识别结果
+//
+// 返回值:
+//   - string: 需要播报的语音确认，可为空
+//   - bool: 是否已处理，false 时回退到闲聊
+//   - error: 处理失败时返回错误
+func (d *deviceIntents) Handle(ctx context.Context, clientID string, result *nlu.Intent) (string, bool, error) {
+	if result == nil {
+		return "", false, fmt.Errorf("intent is nil")
+	}
+	req := &intent.Request{
+		Text:       result.Text,
+		Intent:     result.Intent,
+		Confidence: result.Confidence,
+		Entities:   result.Entities,
+	}
+	if _, err := d.registry.Resolve(req); err != nil {
+		if !intent.Fallback(err) {
+			return "", false, err
+		}
+		logger.Info(ctx, "intent fallback to chit-chat", map[string]any{
+			"clientID": clientID,
+			"intent":   result.Intent,
+			"reason":   err.Error(),
+		})
+		return "", false, nil
+	}
+
+	req.Device = deviceContext(ctx, clientID)
+	res, err := d.registry.Dispatch(ctx, req, d.commander)
+	if err != nil {
+		reply := commandApology(err)
+		if reply == "" {
+			return "", true, err
+		}
+		logger.Warn(ctx, "intent command failed", map[string]any{
+			"clientID": clientID,
+			"intent":   req.Intent,
+			"error":    err.Error(),
+		})
+		res = &intent.Result{Reply: reply}
+	}
+	logger.Info(ctx, "intent handled", map[string]any{
+		"clientID": clientID,
+		"intent":   req.Intent,
+		"entities": req.Entities,
+		"reply":    res.Reply,
+	})
+	return res.Reply, true, nil
+}
+
+// commandApology 设备未应答或拒绝指令时的语音提示，其他错误返回空
+func commandApology(err error) string {
+	switch {
+	case errors.Is(err, control.ErrAckTimeout):
+		return "设备没有响应，请稍后再试"
+	case errors.Is(err, control.ErrRejected):
+		return "设备暂时无法执行这个操作"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	config "yunyez/internal/common/config"
+	llm "yunyez/internal/pkg/agent/llm"
+	memory "yunyez/internal/pkg/agent/memory"
+	logger "yunyez/internal/pkg/logger"
+	redis "yunyez/internal/pkg/redis"
+)
+
+// initMemory 初始化对话记忆，未启用或 Redis 不可用时返回 nil（单轮对话）
+// 启用摘要时超过阈值的较早轮次经 LLM 压缩为滚动摘要
+// 参数：
+//   - agent: 生成摘要的模型，不带记忆、设备提示词与工具
+//   - rec: 摘要请求的计费
+func initMemory(agent llm.Agent, rec Recorder) memory.Store {
+	if !config.GetBool("memory.enabled") {
+		return nil
+	}
+	client, err := redis.NewClient()
+	if err != nil {
+		logger.Error(context.Background(), "initMemory failed", map[string]any{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	store := memory.NewRedisStore(client.Client, memory.Options{
+		MaxTurns:  config.GetIntWithDefault("memory.max_turns", memory.DefaultMaxTurns),
+		TTL:       time.Duration(config.GetIntWithDefault("memory.ttl_s", int(memory.DefaultTTL/time.Second))) * time.Second,
+		MaxTokens: config.GetIntWithDefault("memory.max_tokens", memory.DefaultMaxTokens),
+	})
+	if !config.GetBool("memory.summary.enabled") {
+		return store
+	}
+	timeout := time.Duration(config.GetIntWithDefault("memory.summary.timeout_ms", 15000)) * time.Millisecond
+	return memory.NewCompressor(store, summarizeHistory(agent, rec, timeout),
+		config.GetIntWithDefault("memory.summary.threshold_tokens", memory.DefaultCompressThreshold),
+		config.GetIntWithDefault("memory.summary.keep_turns", memory.DefaultKeepTurns),
+	)
+}
+
+// summarizeHistory 经 LLM 将较早的对话轮次合并进滚动摘要，摘要请求与普通对话一样计费
+// 摘要使用不带记忆的模型，避免摘要请求本身被记入对话历史
+// 参数：
+//   - agent: 生成摘要的模型
+//   - rec: 摘要请求的计费
+//   - timeout: 单次摘要请求超时
+func summarizeHistory(agent llm.Agent, rec Recorder, timeout time.Duration) memory.SummarizeFunc {
+	return func(ctx context.Context, sn, previous string, turns []memory.Message) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		summary, usage, err := llm.Summarize(ctx, agent, sn, previous, turns)
+		if usage != nil {
+			recordUsage(ctx, rec, sn, usage)
+		}
+		if err != nil {
+			logger.Warn(ctx, "summarize conversation history failed", map[string]any{
+				"clientID": sn,
+				"turns":    len(turns),
+				"error":    err.Error(),
+			})
+			return "", err
+		}
+		logger.Info(ctx, "conversation history summarized", map[string]any{
+			"clientID": sn,
+			"turns":    len(turns),
+			"summary":  summary,
+		})
+		return summary, nil
+	}
+}
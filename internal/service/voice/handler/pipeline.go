@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	tools "yunyez/internal/common/tools"
+	conversationModel "yunyez/internal/model/conversation"
+	traceModel "yunyez/internal/model/trace"
+	asr "yunyez/internal/pkg/agent/asr"
+	llm "yunyez/internal/pkg/agent/llm"
+	memory "yunyez/internal/pkg/agent/memory"
+	metering "yunyez/internal/pkg/agent/metering"
+	nlu "yunyez/internal/pkg/agent/nlu"
+	resilience "yunyez/internal/pkg/agent/resilience"
+	tool "yunyez/internal/pkg/agent/tool"
+	tts "yunyez/internal/pkg/agent/tts"
+	logger "yunyez/internal/pkg/logger"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+	fragment "yunyez/internal/service/voice/fragment"
+	intent "yunyez/internal/service/voice/intent"
+	turn "yunyez/internal/service/voice/turn"
+	vad "yunyez/internal/service/voice/vad"
+)
+
+// 选项的默认值
+const (
+	defaultTTSConcurrency   = 2                 // 播放时提前合成的句子数
+	defaultASRStreamTimeout = 30 * time.Second  // 单个流式识别会话最长时间
+	defaultASRFinishTimeout = 3 * time.Second   // 说话结束后等待最终识别结果的时间
+	defaultConversationIdle = memory.DefaultTTL // 会话无对话的最长时间，与对话记忆的有效期一致
+)
+
+// Stage 语音处理流程的阶段
+type Stage string
+
+const (
+	StageUpload  Stage = "upload"  // 暂存上行音频
+	StageASR     Stage = "asr"     // 语音识别
+	StageNLU     Stage = "nlu"     // 意图识别
+	StageIntent  Stage = "intent"  // 命令类意图处理
+	StageLLM     Stage = "llm"     // 对话模型回复
+	StageTTS     Stage = "tts"     // 单句语音合成
+	StagePublish Stage = "publish" // 回复音频下发
+)
+
+// StageResult 阶段的结果，除公共字段外按阶段填写
+type StageResult struct {
+	Stage      Stage
+	ClientID   string
+	Start      time.Time       // 阶段开始时间；tts 为该句首个音频分块到达的时间
+	End        time.Time       // 阶段结束时间
+	FirstToken time.Time       // llm: 首个回复片段到达的时间
+	Audio      string          // upload: 音频存储位置
+	Text       string          // asr: 识别文本；nlu、intent、llm: 用户文本；tts: 句子
+	Intent     *nlu.Intent     // nlu、intent: 意图识别结果
+	Handled    bool            // intent: 是否已作为命令处理，false 时回退到闲聊
+	Reply      string          // intent: 语音确认；llm: 回复文本
+	Usage      *metering.Usage // llm: 本轮的用量
+	Err        error           // 阶段失败的错误
+}
+
+// Hook 阶段结束时的回调，在流程中同步调用，耗时的操作应另起 goroutine
+type Hook func(ctx context.Context, r StageResult)
+
+// NLU 意图识别
+type NLU interface {
+	Predict(ctx context.Context, input *nlu.Input) (*nlu.Intent, error)
+}
+
+// IntentHandler 命令类意图处理
+type IntentHandler interface {
+	// Handle 处理命令类意图
+	// 返回需要播报的语音确认与是否已处理，未处理时回退到闲聊
+	Handle(ctx context.Context, clientID string, result *nlu.Intent) (string, bool, error)
+}
+
+// Publisher 向设备下发回复音频与播放控制
+type Publisher interface {
+	// Open 开启一路下行音频流，一次回复的所有句子作为一路音频流下发
+	Open(ctx context.Context, clientID string) (AudioStream, error)
+	// Stop 通知设备停止播放已下发的音频
+	Stop(ctx context.Context, clientID string) error
+}
+
+// AudioStream 一路下行音频流
+type AudioStream interface {
+	// Write 下发 TTS 输出的音频分块，按分块的格式解码后转码为设备的音频格式
+	Write(ctx context.Context, chunk []byte, format tts.Format) error
+	// Close 结束音频流，设备据此停止等待
+	Close(ctx context.Context) error
+}
+
+// Recorder 模型用量计费
+type Recorder interface {
+	Record(ctx context.Context, clientID string, usage metering.Usage) error
+}
+
+// Storage 上行音频存储
+type Storage interface {
+	// Save 保存上行音频，返回存储位置
+	Save(ctx context.Context, clientID string, header *mqtt_voice.Header, audio []byte) (string, error)
+}
+
+// TurnStore 轮次记录存储
+type TurnStore interface {
+	SaveTurn(ctx context.Context, record *traceModel.TurnRecord) error
+	// RedactTurns 清除设备轮次记录中的识别文本与回复，返回清除的记录数
+	RedactTurns(ctx context.Context, sn string) (int64, error)
+}
+
+// ConversationStore 对话记录存储
+type ConversationStore interface {
+	// AppendTurn 追加一轮对话，续接设备在 idle 内有过对话的会话，否则新建会话
+	AppendTurn(ctx context.Context, turn *conversationModel.Turn, idle time.Duration) error
+	// ClearHistory 删除设备的全部对话记录，返回删除的对话轮数
+	ClearHistory(ctx context.Context, sn string) (int64, error)
+}
+
+// Dependencies 语音处理流程的依赖
+type Dependencies struct {
+	ASR           asr.Service         // 语音识别，实现 asr.StreamingService 时可边说边识别
+	NLU           NLU                 // 意图识别，nil 时直接对话
+	Intents       IntentHandler       // 命令类意图处理，nil 时所有意图回退到闲聊
+	Agent         llm.Agent           // 对话模型
+	TTS           tts.Service         // 语音合成
+	Publisher     Publisher           // 下发回复音频与播放控制
+	Metering      Recorder            // 用量计费，nil 时只记录日志
+	Storage       Storage             // 上行音频存储，nil 时不存储
+	Turns         TurnStore           // 轮次记录存储，nil 时只记录日志
+	Conversations ConversationStore   // 对话记录存储，nil 时不保存
+	Memory        memory.Store        // 对话记忆（Agent 的上下文），清空对话记录时一并清空
+	Acks          *control.AckManager // 控制指令应答跟踪，与 Publisher、Intents 共用，nil 时使用默认值
+}
+
+// Options 语音处理流程的选项，零值使用默认值
+type Options struct {
+	VAD              bool            // 是否启用服务端语音活动检测
+	VADConfig        vad.Config      // 语音活动检测配置
+	ASRStreaming     bool            // 是否边说边识别，需 ASR 支持流式识别
+	ASRStreamTimeout time.Duration   // 单个流式识别会话最长时间
+	ASRFinishTimeout time.Duration   // 说话结束后等待最终识别结果的时间
+	SkipNLU          bool            // 跳过 NLU，命令由 LLM 通过工具执行
+	BargeIn          bool            // 用户开始新的语句时是否打断正在进行的回复
+	TTSConcurrency   int             // 播放时提前合成的句子数
+	Fragment         fragment.Config // 分片帧重组配置
+	ConversationIdle time.Duration   // 会话无对话的最长时间，超过后新建会话
+}
+
+// VoicePipeline 语音处理流程：上行音频 → ASR → NLU → 意图处理或对话 → TTS → 下发
+// 依赖与选项在创建时给定，不读取全局配置；按配置创建见 BuildPipeline
+type VoicePipeline struct {
+	deps  Dependencies
+	opts  Options
+	hooks map[Stage][]Hook
+
+	turns      *turn.Registry            // 每台设备进行中的对话轮次
+	fragments  *fragment.FragmentManager // 分片帧重组管理器
+	endpoints  *vad.Tracker              // 分片语句的端点检测器
+	asrStreams *asrSessions              // 分片语句的流式识别会话
+	uplinks    *uplinkStreams            // 分片语句的上行转码
+	starts     *utteranceStarts          // 每台设备最近上传的语句，未启用端点检测时识别新语句
+
+	intents  *intent.Registry     // 命令类意图处理器，BuildPipeline 创建时可注册
+	tools    *tool.Registry       // LLM 可调用的工具，未启用工具调用时为 nil
+	monitors []resilience.Monitor // 各能力的提供方链，用于健康检查与状态查询
+	stop     context.CancelFunc   // 停止健康检查与提示词模板热更新
+}
+
+// NewVoicePipeline 创建语音处理流程
+// 参数：
+//   - deps: 依赖，ASR、Agent、TTS、Publisher 必填
+//   - opts: 选项
+//
+// 返回值:
+//   - *VoicePipeline: 语音处理流程
+//   - error: 缺少必填依赖时返回错误
+func NewVoicePipeline(deps Dependencies, opts Options) (*VoicePipeline, error) {
+	switch {
+	case deps.ASR == nil:
+		return nil, fmt.Errorf("voice pipeline: asr is required")
+	case deps.Agent == nil:
+		return nil, fmt.Errorf("voice pipeline: agent is required")
+	case deps.TTS == nil:
+		return nil, fmt.Errorf("voice pipeline: tts is required")
+	case deps.Publisher == nil:
+		return nil, fmt.Errorf("voice pipeline: publisher is required")
+	}
+	if deps.Acks == nil {
+		deps.Acks = control.NewAckManager(control.DefaultAckTimeout, control.DefaultRetries)
+	}
+	if opts.VADConfig.SampleRate == 0 {
+		opts.VADConfig = vad.DefaultConfig()
+	}
+	opts.VADConfig.SampleRate = pipelineSampleRate
+	if opts.ASRStreamTimeout <= 0 {
+		opts.ASRStreamTimeout = defaultASRStreamTimeout
+	}
+	if opts.ASRFinishTimeout <= 0 {
+		opts.ASRFinishTimeout = defaultASRFinishTimeout
+	}
+	if opts.TTSConcurrency <= 0 {
+		opts.TTSConcurrency = defaultTTSConcurrency
+	}
+	if opts.ConversationIdle <= 0 {
+		opts.ConversationIdle = defaultConversationIdle
+	}
+
+	p := &VoicePipeline{
+		deps:      deps,
+		opts:      opts,
+		hooks:     make(map[Stage][]Hook),
+		turns:     turn.NewRegistry(),
+		endpoints: vad.NewTracker(opts.VADConfig),
+		uplinks:   newUplinkStreams(),
+		starts:    newUtteranceStarts(),
+	}
+	var streaming asr.StreamingService
+	if opts.ASRStreaming {
+		streaming, _ = deps.ASR.(asr.StreamingService)
+	}
+	p.asrStreams = newASRSessions(streaming, opts.ASRStreamTimeout, opts.ASRFinishTimeout)
+
+	// 缺帧等待超时后带缺口合并的语句，脱离原请求上下文异步处理
+	p.fragments = fragment.NewFragmentManager(opts.Fragment)
+	p.fragments.OnComplete = func(u *fragment.Utterance) {
+		p.endpoints.Remove(utteranceKey(u.ClientID, u.SessionID))
+		ctx := tools.WithTraceID(context.Background(), tools.GetTraceID(context.Background()))
+		if err := p.processUtterance(ctx, u); err != nil {
+			logger.Error(ctx, "process gap-flushed utterance failed", map[string]any{
+				"error":     err.Error(),
+				"clientID":  u.ClientID,
+				"sessionID": u.SessionID,
+			})
+		}
+	}
+	return p, nil
+}
+
+// OnStage 注册阶段结束时的回调，须在处理请求之前注册
+// 参数：
+//   - stage: 阶段
+//   - hook: 回调
+func (p *VoicePipeline) OnStage(stage Stage, hook Hook) {
+	p.hooks[stage] = append(p.hooks[stage], hook)
+}
+
+// stage 阶段结束，写入轮次记录并调用注册的回调
+func (p *VoicePipeline) stage(ctx context.Context, r StageResult) {
+	if r.End.IsZero() {
+		r.End = time.Now()
+	}
+	if tr := traceFrom(ctx); tr != nil {
+		tr.observe(r)
+	}
+	for _, h := range p.hooks[r.Stage] {
+		h(ctx, r)
+	}
+}
+
+// RegisterIntent 注册命令类意图处理器
+// 参数：
+//   - h: 意图处理器
+//
+// 返回值:
+//   - error: 流程不是由 BuildPipeline 创建或注册失败时返回错误
+func (p *VoicePipeline) RegisterIntent(h intent.Handler) error {
+	if p.intents == nil {
+		return errors.New("voice pipeline has no intent registry")
+	}
+	return p.intents.Register(h)
+}
+
+// RegisterTool 注册 LLM 可调用的工具，未启用工具调用时不注册
+// 参数：
+//   - t: 工具
+//
+// 返回值:
+//   - error: 注册失败时返回错误
+func (p *VoicePipeline) RegisterTool(t tool.Tool) error {
+	if p.tools == nil {
+		return nil
+	}
+	return p.tools.Register(t)
+}
+
+// Status 各能力提供方链的健康与熔断状态
+func (p *VoicePipeline) Status() []resilience.ChainStatus {
+	status := make([]resilience.ChainStatus, 0, len(p.monitors))
+	for _, m := range p.monitors {
+		status = append(status, m.Status())
+	}
+	return status
+}
+
+// ClearHistory 清空设备的对话记录与对话记忆，并清除轮次记录中的识别文本与回复
+// 参数：
+//   - ctx: 上下文对象
+//   - sn: 设备序列号
+//
+// 返回值:
+//   - int64: 删除的对话轮数
+//   - error: 对话记录、对话记忆或轮次记录清除失败时返回错误
+func (p *VoicePipeline) ClearHistory(ctx context.Context, sn string) (int64, error) {
+	var deleted int64
+	var errs []error
+	if p.deps.Conversations != nil {
+		n, err := p.deps.Conversations.ClearHistory(ctx, sn)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("clear conversation records: %w", err))
+		}
+		deleted = n
+	}
+	if p.deps.Memory != nil {
+		if err := p.deps.Memory.Clear(ctx, sn); err != nil {
+			errs = append(errs, fmt.Errorf("clear conversation memory: %w", err))
+		}
+	}
+	var redacted int64
+	if p.deps.Turns != nil {
+		n, err := p.deps.Turns.RedactTurns(ctx, sn)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redact turn records: %w", err))
+		}
+		redacted = n
+	}
+	logger.Info(ctx, "conversation history cleared", map[string]any{
+		"clientID": sn,
+		"deleted":  deleted,
+		"redacted": redacted,
+	})
+	return deleted, errors.Join(errs...)
+}
+
+// Close 停止健康检查、提示词模板热更新与分片帧重组，并关闭 ASR、TTS 客户端
+func (p *VoicePipeline) Close() error {
+	if p.stop != nil {
+		p.stop()
+	}
+	p.fragments.Close()
+	return errors.Join(p.deps.ASR.Close(), p.deps.TTS.Close())
+}
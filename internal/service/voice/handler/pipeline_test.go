@@ -0,0 +1,618 @@
+// 测试语音处理流程：上行音频经 ASR、NLU、意图处理或对话、TTS 后下发，依赖均为替身
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	traceModel "yunyez/internal/model/trace"
+	llm "yunyez/internal/pkg/agent/llm"
+	metering "yunyez/internal/pkg/agent/metering"
+	nlu "yunyez/internal/pkg/agent/nlu"
+	resilience "yunyez/internal/pkg/agent/resilience"
+	tts "yunyez/internal/pkg/agent/tts"
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+	fragment "yunyez/internal/service/voice/fragment"
+)
+
+const testClient = "A0001"
+
+type fakeASR struct {
+	text  string
+	err   error
+	audio []byte
+}
+
+func (f *fakeASR) Transfer(ctx context.Context, data []byte) (string, error) {
+	f.audio = data
+	return f.text, f.err
+}
+
+func (f *fakeASR) Close() error { return nil }
+
+type fakeNLU struct {
+	intent *nlu.Intent
+	err    error
+	calls  int
+}
+
+func (f *fakeNLU) Predict(ctx context.Context, input *nlu.Input) (*nlu.Intent, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	intent := *f.intent
+	return &intent, nil
+}
+
+type fakeIntents struct {
+	reply   string
+	handled bool
+	err     error
+	got     *nlu.Intent
+}
+
+func (f *fakeIntents) Handle(ctx context.Context, clientID string, result *nlu.Intent) (string, bool, error) {
+	f.got = result
+	return f.reply, f.handled, f.err
+}
+
+// fakeAgent 按给定的事件回复
+type fakeAgent struct {
+	events []llm.Event
+	err    error
+	got    []string
+}
+
+func (f *fakeAgent) Chat(ctx context.Context, clientID, message string) (<-chan llm.Event, error) {
+	f.got = append(f.got, message)
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make(chan llm.Event, len(f.events))
+	for _, e := range f.events {
+		out <- e
+	}
+	close(out)
+	return out, nil
+}
+
+// fakeTTS 合成结果为 "audio:" + 句子
+type fakeTTS struct {
+	fail string // 合成失败的句子
+}
+
+func (f *fakeTTS) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	if text == f.fail {
+		return nil, errors.New("synthesize failed")
+	}
+	return []byte("audio:" + text), nil
+}
+
+func (f *fakeTTS) Close() error { return nil }
+
+// fakeStreamingTTS 流式合成，每句分为 "audio:" 与句子两个分块
+type fakeStreamingTTS struct {
+	fakeTTS
+}
+
+func (f *fakeStreamingTTS) SynthesizeStream(ctx context.Context, text string, onChunk func(chunk []byte, format tts.Format) error) error {
+	if err := onChunk([]byte("audio:"), tts.FormatPCM); err != nil {
+		return err
+	}
+	return onChunk([]byte(text), tts.FormatPCM)
+}
+
+type fakeStream struct {
+	chunks []string
+	closed bool
+}
+
+func (s *fakeStream) Write(ctx context.Context, chunk []byte, format tts.Format) error {
+	s.chunks = append(s.chunks, string(chunk))
+	return nil
+}
+
+func (s *fakeStream) Close(ctx context.Context) error {
+	s.closed = true
+	return nil
+}
+
+type fakePublisher struct {
+	mu      sync.Mutex
+	streams []*fakeStream
+	stops   int
+}
+
+func (f *fakePublisher) Open(ctx context.Context, clientID string) (AudioStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := &fakeStream{}
+	f.streams = append(f.streams, s)
+	return s, nil
+}
+
+func (f *fakePublisher) Stop(ctx context.Context, clientID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stops++
+	return nil
+}
+
+// spoken 所有音频流下发的句子
+func (f *fakePublisher) spoken() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, s := range f.streams {
+		for _, c := range s.chunks {
+			out = append(out, strings.TrimPrefix(c, "audio:"))
+		}
+	}
+	return out
+}
+
+type fakeRecorder struct {
+	mu     sync.Mutex
+	usages []metering.Usage
+}
+
+func (f *fakeRecorder) Record(ctx context.Context, clientID string, usage metering.Usage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.usages = append(f.usages, usage)
+	return nil
+}
+
+func (f *fakeRecorder) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.usages)
+}
+
+type fakeStorage struct {
+	saved []string
+}
+
+func (f *fakeStorage) Save(ctx context.Context, clientID string, header *mqtt_voice.Header, audio []byte) (string, error) {
+	path := fmt.Sprintf("%s/%d.pcm", clientID, header.SessionID)
+	f.saved = append(f.saved, path)
+	return path, nil
+}
+
+type fakeTurns struct {
+	mu      sync.Mutex
+	records []*traceModel.TurnRecord
+}
+
+func (f *fakeTurns) SaveTurn(ctx context.Context, record *traceModel.TurnRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, record)
+	return nil
+}
+
+func (f *fakeTurns) RedactTurns(ctx context.Context, sn string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int64
+	for _, r := range f.records {
+		if r.SN == sn && (r.Transcript != "" || r.Reply != "") {
+			r.Transcript, r.Reply = "", ""
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeTurns) saved() []*traceModel.TurnRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.records
+}
+
+// stageLog 按阶段记录回调
+type stageLog struct {
+	mu      sync.Mutex
+	results map[Stage][]StageResult
+}
+
+func (l *stageLog) hook(ctx context.Context, r StageResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.results[r.Stage] = append(l.results[r.Stage], r)
+}
+
+func (l *stageLog) get(stage Stage) []StageResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.results[stage]
+}
+
+// fakes 流程的全部替身
+type fakes struct {
+	asr       *fakeASR
+	nlu       *fakeNLU
+	intents   *fakeIntents
+	agent     *fakeAgent
+	tts       *fakeTTS
+	publisher *fakePublisher
+	recorder  *fakeRecorder
+	storage   *fakeStorage
+	turns     *fakeTurns
+	convs     *fakeConversations
+	memory    *fakeMemory
+	stages    *stageLog
+}
+
+func newFakes() *fakes {
+	return &fakes{
+		asr:       &fakeASR{text: "今天天气怎么样"},
+		nlu:       &fakeNLU{intent: &nlu.Intent{Intent: "chat", Confidence: 0.9}},
+		intents:   &fakeIntents{},
+		agent:     &fakeAgent{events: reply("今天晴天。", "适合出门。")},
+		tts:       &fakeTTS{},
+		publisher: &fakePublisher{},
+		recorder:  &fakeRecorder{},
+		storage:   &fakeStorage{},
+		turns:     &fakeTurns{},
+		convs:     &fakeConversations{},
+		memory:    &fakeMemory{},
+		stages:    &stageLog{results: make(map[Stage][]StageResult)},
+	}
+}
+
+// reply 一次成功回复的事件
+func reply(sentences ...string) []llm.Event {
+	var events []llm.Event
+	for _, s := range sentences {
+		events = append(events, llm.Event{Type: llm.EventText, Text: s})
+	}
+	return append(events,
+		llm.Event{Type: llm.EventUsage, Usage: &metering.Usage{Model: "test/m", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}},
+		llm.Event{Type: llm.EventFinish, Reason: llm.FinishStop},
+	)
+}
+
+func (f *fakes) pipeline(t *testing.T, opts Options) *VoicePipeline {
+	p, err := NewVoicePipeline(Dependencies{
+		ASR:           f.asr,
+		NLU:           f.nlu,
+		Intents:       f.intents,
+		Agent:         f.agent,
+		TTS:           f.tts,
+		Publisher:     f.publisher,
+		Metering:      f.recorder,
+		Storage:       f.storage,
+		Turns:         f.turns,
+		Conversations: f.convs,
+		Memory:        f.memory,
+	}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, p.Close()) })
+	for _, s := range []Stage{StageUpload, StageASR, StageNLU, StageIntent, StageLLM, StageTTS, StagePublish} {
+		p.OnStage(s, f.stages.hook)
+	}
+	return p
+}
+
+// pcmHeader 16kHz 单声道 PCM 完整帧
+func pcmHeader() *mqtt_voice.Header {
+	return &mqtt_voice.Header{
+		AudioFormat: mqttCommon.VoiceAudioFormatPcm,
+		SampleRate:  16000,
+		Ch:          1,
+		F:           mqttCommon.VoiceFrameFull,
+		SessionID:   7,
+	}
+}
+
+func TestNewVoicePipelineRequiresDependencies(t *testing.T) {
+	f := newFakes()
+	_, err := NewVoicePipeline(Dependencies{ASR: f.asr, TTS: f.tts, Publisher: f.publisher}, Options{})
+	assert.ErrorContains(t, err, "agent")
+
+	p, err := NewVoicePipeline(Dependencies{ASR: f.asr, Agent: f.agent, TTS: f.tts, Publisher: f.publisher}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultTTSConcurrency, p.opts.TTSConcurrency)
+	assert.Equal(t, pipelineSampleRate, p.opts.VADConfig.SampleRate)
+	assert.False(t, p.asrStreams.enabled())
+}
+
+func TestProcessFullChat(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+	audio := make([]byte, 640)
+
+	require.NoError(t, p.ProcessFull(context.Background(), testClient, pcmHeader(), audio))
+
+	assert.Equal(t, []string{"A0001/7.pcm"}, f.storage.saved)
+	assert.Len(t, f.asr.audio, len(audio))
+	assert.Equal(t, 1, f.nlu.calls)
+	assert.Equal(t, "今天天气怎么样", f.intents.got.Text, "the intent carries the user text")
+	assert.Equal(t, []string{"今天天气怎么样"}, f.agent.got)
+	assert.Equal(t, "今天晴天。适合出门。", strings.Join(f.publisher.spoken(), ""))
+	require.Len(t, f.publisher.streams, 1, "the reply is one audio stream")
+	assert.True(t, f.publisher.streams[0].closed)
+	assert.Eventually(t, func() bool { return f.recorder.count() == 1 }, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "A0001/7.pcm", f.stages.get(StageUpload)[0].Audio)
+	assert.Equal(t, "今天天气怎么样", f.stages.get(StageASR)[0].Text)
+	assert.Equal(t, "chat", f.stages.get(StageNLU)[0].Intent.Intent)
+	assert.False(t, f.stages.get(StageIntent)[0].Handled)
+	llmStage := f.stages.get(StageLLM)
+	require.Len(t, llmStage, 1)
+	assert.NoError(t, llmStage[0].Err)
+	assert.Equal(t, "今天晴天。适合出门。", llmStage[0].Reply)
+	assert.Equal(t, 15, llmStage[0].Usage.TotalTokens)
+	assert.NotEmpty(t, f.stages.get(StageTTS))
+	publish := f.stages.get(StagePublish)
+	require.Len(t, publish, 1)
+	assert.NoError(t, publish[0].Err)
+	assert.False(t, publish[0].End.Before(publish[0].Start))
+}
+
+func TestChatTextIntentHandled(t *testing.T) {
+	f := newFakes()
+	f.intents.handled, f.intents.reply = true, "好的，已调到26度"
+	p := f.pipeline(t, Options{})
+
+	require.NoError(t, p.ChatText(context.Background(), testClient, "空调调到26度"))
+	assert.Empty(t, f.agent.got, "a handled command skips the llm")
+	assert.Equal(t, []string{"好的，已调到26度"}, f.publisher.spoken())
+	assert.True(t, f.stages.get(StageIntent)[0].Handled)
+}
+
+func TestChatTextIntentError(t *testing.T) {
+	f := newFakes()
+	f.intents.handled, f.intents.err = true, errors.New("dispatch failed")
+	p := f.pipeline(t, Options{})
+
+	assert.ErrorContains(t, p.ChatText(context.Background(), testClient, "关灯"), "dispatch failed")
+	assert.Empty(t, f.agent.got)
+	assert.Empty(t, f.publisher.spoken())
+}
+
+func TestChatTextNLUUnavailable(t *testing.T) {
+	f := newFakes()
+	f.nlu.err = fmt.Errorf("%w: nlu: grpc: down", resilience.ErrUnavailable)
+	p := f.pipeline(t, Options{})
+
+	require.NoError(t, p.ChatText(context.Background(), testClient, "你好"))
+	assert.Equal(t, []string{"你好"}, f.agent.got, "the llm still answers")
+	assert.ErrorIs(t, f.stages.get(StageNLU)[0].Err, resilience.ErrUnavailable)
+}
+
+func TestChatTextNLUError(t *testing.T) {
+	f := newFakes()
+	f.nlu.err = errors.New("bad request")
+	p := f.pipeline(t, Options{})
+
+	assert.Error(t, p.ChatText(context.Background(), testClient, "你好"))
+	assert.Empty(t, f.agent.got)
+}
+
+func TestChatTextSkipNLU(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{SkipNLU: true})
+
+	require.NoError(t, p.ChatText(context.Background(), testClient, "你好"))
+	assert.Zero(t, f.nlu.calls)
+	assert.Equal(t, []string{"你好"}, f.agent.got)
+}
+
+func TestChatAgentError(t *testing.T) {
+	f := newFakes()
+	f.agent.err = errors.New("backend down")
+	p := f.pipeline(t, Options{})
+
+	assert.ErrorContains(t, p.ChatText(context.Background(), testClient, "你好"), "backend down")
+	assert.Equal(t, []string{chatApology}, f.publisher.spoken(), "the device is not left in silence")
+	assert.ErrorContains(t, f.stages.get(StageLLM)[0].Err, "backend down")
+}
+
+func TestChatReplyFailed(t *testing.T) {
+	t.Run("error event", func(t *testing.T) {
+		f := newFakes()
+		f.agent.events = []llm.Event{
+			{Type: llm.EventText, Text: "今天"},
+			{Type: llm.EventError, Err: errors.New("stream broken")},
+		}
+		p := f.pipeline(t, Options{})
+
+		require.NoError(t, p.ChatText(context.Background(), testClient, "你好"))
+		assert.Equal(t, "今天"+chatApology, strings.Join(f.publisher.spoken(), ""))
+		llmStage := f.stages.get(StageLLM)[0]
+		assert.ErrorContains(t, llmStage.Err, "stream broken")
+		assert.Equal(t, "今天", llmStage.Reply)
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		f := newFakes()
+		f.agent.events = []llm.Event{{Type: llm.EventText, Text: "今天"}}
+		p := f.pipeline(t, Options{})
+
+		require.NoError(t, p.ChatText(context.Background(), testClient, "你好"))
+		assert.Equal(t, "今天"+chatApology, strings.Join(f.publisher.spoken(), ""))
+		assert.ErrorIs(t, f.stages.get(StageLLM)[0].Err, errReplyIncomplete)
+	})
+}
+
+func TestSpeakSkipsFailedSentence(t *testing.T) {
+	f := newFakes()
+	f.tts.fail = "坏句子。"
+	p := f.pipeline(t, Options{})
+
+	sentences := make(chan string, 3)
+	sentences <- "第一句。"
+	sentences <- "坏句子。"
+	sentences <- "第三句。"
+	close(sentences)
+	require.NoError(t, p.Speak(context.Background(), testClient, sentences))
+	assert.Equal(t, []string{"第一句。", "第三句。"}, f.publisher.spoken())
+	assert.True(t, f.publisher.streams[0].closed)
+
+	tts := f.stages.get(StageTTS)
+	require.Len(t, tts, 3)
+	assert.Equal(t, "坏句子。", tts[1].Text)
+	assert.Error(t, tts[1].Err)
+}
+
+func TestSpeakStreamsThroughFailover(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+	// 提供方链包装后仍走流式合成，整句合成的提供方只用于降级
+	p.deps.TTS = &failoverTTS{chain: resilience.NewChain(capabilityTTS, resilience.BreakerConfig{},
+		resilience.NewProvider[tts.Service]("http", f.tts, 0, nil),
+		resilience.NewProvider[tts.Service]("grpc", &fakeStreamingTTS{}, 0, nil),
+	)}
+
+	sentences := make(chan string, 2)
+	sentences <- "第一句。"
+	sentences <- "第二句。"
+	close(sentences)
+	require.NoError(t, p.Speak(context.Background(), testClient, sentences))
+	require.Len(t, f.publisher.streams, 1)
+	assert.Equal(t, []string{"audio:", "第一句。", "audio:", "第二句。"}, f.publisher.streams[0].chunks)
+}
+
+// emptyTTS 没有合成出音频的提供方，如未实现的 ChatTTS
+type emptyTTS struct{}
+
+func (emptyTTS) Synthesize(ctx context.Context, text string) ([]byte, error) { return nil, nil }
+func (emptyTTS) Close() error                                                { return nil }
+
+func TestFailoverTTSEmptyAudio(t *testing.T) {
+	f := newFakes()
+	chain := &failoverTTS{chain: resilience.NewChain(capabilityTTS, resilience.BreakerConfig{},
+		resilience.NewProvider[tts.Service]("chat", emptyTTS{}, 0, nil),
+		resilience.NewProvider[tts.Service]("edge", f.tts, 0, nil),
+	)}
+	// 空音频计为失败，降级到下一个提供方
+	audio, err := chain.Synthesize(context.Background(), "你好")
+	require.NoError(t, err)
+	assert.Equal(t, "audio:你好", string(audio))
+	assert.Equal(t, 1, chain.chain.Providers()[0].Status().Failures)
+
+	// 所有提供方都没有音频时返回错误，由调用方处理
+	chain = &failoverTTS{chain: resilience.NewChain(capabilityTTS, resilience.BreakerConfig{},
+		resilience.NewProvider[tts.Service]("chat", emptyTTS{}, 0, nil),
+	)}
+	err = tts.Stream(context.Background(), chain, "你好", func([]byte, tts.Format) error { return nil })
+	assert.ErrorIs(t, err, resilience.ErrUnavailable)
+	assert.ErrorIs(t, err, errEmptyAudio)
+}
+
+func TestCancelTurnStopsPlayback(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+
+	ctx, turn := p.beginTurn(context.Background(), testClient, utteranceKey(testClient, 1))
+	require.NoError(t, p.CancelTurn(context.Background(), testClient))
+	assert.Error(t, ctx.Err(), "the turn is cancelled")
+	assert.NoError(t, p.endTurn(ctx, turn, ctx.Err()), "a cancelled turn is not a failure")
+	assert.Equal(t, 1, f.publisher.stops)
+}
+
+func TestInterruptTurnBargeIn(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+	ctx, _ := p.beginTurn(context.Background(), testClient, utteranceKey(testClient, 1))
+	p.interruptTurn(context.Background(), testClient)
+	assert.NoError(t, ctx.Err(), "barge-in disabled")
+
+	p = f.pipeline(t, Options{BargeIn: true})
+	ctx, _ = p.beginTurn(context.Background(), testClient, utteranceKey(testClient, 1))
+	p.interruptTurn(context.Background(), testClient)
+	assert.Error(t, ctx.Err())
+	assert.Equal(t, 1, f.publisher.stops)
+}
+
+func TestFragmentInterruptsOnNewUtterance(t *testing.T) {
+	f := newFakes()
+	cfg := fragment.DefaultConfig()
+	cfg.MaxConcurrentPerDev = 4
+	p := f.pipeline(t, Options{BargeIn: true, Fragment: cfg})
+	send := func(sessionID, seq uint32) {
+		h := pcmHeader()
+		h.F, h.SessionID, h.FrameSeq = mqttCommon.VoiceFrameFragment, sessionID, seq
+		require.NoError(t, p.ProcessFragment(context.Background(), testClient, h, make([]byte, 640)))
+	}
+
+	send(7, 0)
+	ctx, _ := p.beginTurn(context.Background(), testClient, utteranceKey(testClient, 1))
+	send(7, 1)
+	send(7, 2)
+	assert.NoError(t, ctx.Err(), "later fragments of the same utterance")
+
+	// 序号从 0 开始的分片为新语句
+	send(8, 0)
+	assert.Error(t, ctx.Err())
+
+	// 乱序时新语句的首个分片序号可能不为 0
+	ctx, _ = p.beginTurn(context.Background(), testClient, utteranceKey(testClient, 2))
+	send(8, 1)
+	assert.NoError(t, ctx.Err())
+	send(9, 3)
+	assert.Error(t, ctx.Err())
+}
+
+func TestCloseStopsFragmentTimers(t *testing.T) {
+	f := newFakes()
+	cfg := fragment.DefaultConfig()
+	cfg.GapTimeout = 20 * time.Millisecond
+	p := f.pipeline(t, Options{Fragment: cfg})
+
+	// 缺少 seq 1，最后一帧到达后等待缺失帧
+	for _, seq := range []uint32{0, 2} {
+		h := pcmHeader()
+		h.F, h.FrameSeq = mqttCommon.VoiceFrameFragment, seq
+		if seq == 2 {
+			h.F = mqttCommon.VoiceFrameLast
+		}
+		require.NoError(t, p.ProcessFragment(context.Background(), testClient, h, make([]byte, 640)))
+	}
+	require.NoError(t, p.Close())
+
+	// 关闭后不再带缺口合并
+	time.Sleep(5 * cfg.GapTimeout)
+	assert.Empty(t, f.stages.get(StageUpload))
+}
+
+func TestProcessCommandResolvesSharedAcks(t *testing.T) {
+	f := newFakes()
+	acks := control.NewAckManager(time.Second, 0)
+	p, err := NewVoicePipeline(Dependencies{ASR: f.asr, Agent: f.agent, TTS: f.tts, Publisher: f.publisher, Acks: acks}, Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, p.Close()) })
+
+	cmd, err := control.NewCommand(control.TypeStopPlayback).Build()
+	require.NoError(t, err)
+	sent := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := acks.Send(context.Background(), cmd, func(context.Context, []byte) error {
+			close(sent)
+			return nil
+		})
+		done <- err
+	}()
+	<-sent
+
+	// 设备上行的应答交给下发指令时使用的同一个应答跟踪
+	payload, err := control.Encode(control.NewAck(cmd, control.CodeOK, ""))
+	require.NoError(t, err)
+	require.NoError(t, p.ProcessCommand(context.Background(), testClient, payload))
+	assert.NoError(t, <-done)
+	assert.Zero(t, acks.Pending())
+}
@@ -3,20 +3,49 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"time"
 	config "yunyez/internal/common/config"
 	tools "yunyez/internal/common/tools"
 	logger "yunyez/internal/pkg/logger"
 	mqtt_constant "yunyez/internal/pkg/mqtt/common"
 	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+	"yunyez/internal/service/voice/fragment"
+	"yunyez/internal/service/voice/vad"
 )
 
-var (
-	audioStorage = config.GetString("audio.storage") // 音频临时存储目录                                                            // NLU 自然语言理解客户端 - 本地模型
-)
+// newVADConfig 根据 audio.vad 配置创建语音活动检测配置
+func newVADConfig() vad.Config {
+	def := vad.DefaultConfig()
+	ms := func(key string, d time.Duration) time.Duration {
+		return time.Duration(config.GetIntWithDefault(key, int(d/time.Millisecond))) * time.Millisecond
+	}
+	return vad.Config{
+		SampleRate:      pipelineSampleRate,
+		FrameDuration:   ms("audio.vad.frame_ms", def.FrameDuration),
+		EnergyThreshold: config.GetFloat64WithDefault("audio.vad.energy_threshold", def.EnergyThreshold),
+		ZCRThreshold:    config.GetFloat64WithDefault("audio.vad.zcr_threshold", def.ZCRThreshold),
+		MinSpeech:       ms("audio.vad.min_speech_ms", def.MinSpeech),
+		Hangover:        ms("audio.vad.hangover_ms", def.Hangover),
+		MaxUtterance:    ms("audio.vad.max_utterance_ms", def.MaxUtterance),
+		Padding:         ms("audio.vad.padding_ms", def.Padding),
+	}
+}
+
+// newFragmentConfig 根据 audio.fragment 配置创建分片帧重组配置
+func newFragmentConfig() fragment.Config {
+	return fragment.Config{
+		MaxUtteranceBytes:   config.GetIntWithDefault("audio.fragment.max_bytes", 0),
+		MaxUtteranceTime:    time.Duration(config.GetIntWithDefault("audio.fragment.max_duration_ms", 0)) * time.Millisecond,
+		MaxConcurrentPerDev: config.GetIntWithDefault("audio.fragment.max_concurrent", 0),
+		GapTimeout:          time.Duration(config.GetIntWithDefault("audio.fragment.gap_timeout_ms", 0)) * time.Millisecond,
+		IdleTimeout:         time.Duration(config.GetIntWithDefault("audio.fragment.idle_timeout_ms", 0)) * time.Millisecond,
+	}
+}
 
-// ProcessFull 处理完整帧
+// ProcessFull 处理完整帧，每次处理保存一条轮次记录
 // 参数：
 //   - ctx: 上下文对象
 //   - clientID: 客户端ID(设备序列号)
@@ -25,31 +54,25 @@ var (
 //
 // 返回值:
 //   - error: 处理过程中遇到的错误，若成功则为 nil
-func ProcessFull(ctx context.Context, clientID string, header *mqtt_voice.Header, payload []byte) error {
+func (p *VoicePipeline) ProcessFull(ctx context.Context, clientID string, header *mqtt_voice.Header, payload []byte) (err error) {
+	ctx, tr := p.beginTrace(ctx, clientID)
+	defer func() { p.finishTrace(ctx, tr, err) }()
 
 	logger.Info(ctx, "ProcessFull", map[string]any{
 		"clientID": clientID,
 		"header":   header,
 	})
+	// 下行回复沿用设备上行的协议版本与会话ID
+	ctx = mqtt_voice.WithHeader(ctx, header)
 
-	// 暂存完整帧
-	ext := mqtt_constant.AudioFormatString(header.AudioFormat)
-	// example: storage/tmp/audio/[device_sn]/1694567890_0.wav
-	audioPath := filepath.Join(audioStorage, clientID,
-		fmt.Sprintf("%d_%d.%s", header.Timestamp, header.FrameSeq, ext))
-	ok, err := tools.WriteFile(audioPath, payload)
+	audioPath, err := p.upload(ctx, clientID, header, payload)
 	if err != nil {
-		logger.Error(ctx, "write audio file failed", map[string]interface{}{
-			"error": err.Error(),
-			"path":  audioPath,
-		})
-		return fmt.Errorf("write audio file failed: %w", err)
-	} else if !ok {
-		return fmt.Errorf("write audio file failed: file exists")
+		return err
 	}
 
-	// 音频处理
-	err = ChatPipeline(ctx, clientID, payload)
+	// 音频处理：新的对话轮次，设备开始新语句或发送取消指令时中止
+	ctx, t := p.beginTurn(ctx, clientID, utteranceKey(clientID, header.SessionID))
+	err = p.endTurn(ctx, t, p.ChatPipeline(ctx, clientID, payload))
 	if err != nil {
 		logger.Error(ctx, "chat pipeline failed", map[string]any{
 			"error": err.Error(),
@@ -61,12 +84,190 @@ func ProcessFull(ctx context.Context, clientID string, header *mqtt_voice.Header
 	return nil
 }
 
-func ProcessFragment(ctx context.Context, clientID string, header *mqtt_voice.Header, payload []byte) error {
-	// 暂存分片帧
-	// 检查是否为最后一帧
-	// 合并分片帧
-	// 合并音频数据
-	// 处理完整帧
+// upload 暂存上行音频
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - header: 音频消息头信息
+//   - payload: 音频数据
+//
+// 返回值:
+//   - string: 音频存储位置，未配置存储时为空
+//   - error: 存储失败时返回错误
+func (p *VoicePipeline) upload(ctx context.Context, clientID string, header *mqtt_voice.Header, payload []byte) (string, error) {
+	if p.deps.Storage == nil {
+		return "", nil
+	}
+	start := time.Now()
+	audioPath, err := p.deps.Storage.Save(ctx, clientID, header, payload)
+	p.stage(ctx, StageResult{Stage: StageUpload, ClientID: clientID, Start: start, Audio: audioPath, Err: err})
+	return audioPath, err
+}
+
+// fileStorage 上行音频暂存到本地目录
+type fileStorage struct {
+	dir string // 存储根目录，按设备序列号分目录
+}
+
+// Save 按实际内容选择扩展名，裸 PCM/G.711 封装为 WAV 便于回放
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - header: 音频消息头信息
+//   - payload: 音频数据
+//
+// 返回值:
+//   - string: 音频文件路径
+//   - error: 写入失败时返回错误
+func (s fileStorage) Save(ctx context.Context, clientID string, header *mqtt_voice.Header, payload []byte) (string, error) {
+	ext, stored := storageAudio(payload, header.AudioFormat, int(header.SampleRate), channelCount(header.Ch))
+	// example: storage/tmp/audio/[device_sn]/1694567890_0_0.wav
+	audioPath := filepath.Join(s.dir, clientID,
+		fmt.Sprintf("%d_%d_%d.%s", header.SessionID, header.Timestamp, header.FrameSeq, ext))
+	ok, err := tools.WriteFile(audioPath, stored)
+	if err != nil {
+		logger.Error(ctx, "write audio file failed", map[string]interface{}{
+			"error": err.Error(),
+			"path":  audioPath,
+		})
+		return audioPath, fmt.Errorf("write audio file failed: %w", err)
+	} else if !ok {
+		return audioPath, fmt.Errorf("write audio file failed: file exists")
+	}
+	return audioPath, nil
+}
+
+// ProcessFragment 处理分片帧
+// 按 设备 + 语句ID 暂存分片帧，收到最后一帧且无缺帧时合并并进入对话流程；
+// 存在缺帧时等待乱序帧到达，超时后带缺口合并并异步处理
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - header: 音频消息头信息
+//   - payload: 音频消息 payload 字节切片
+//
+// 返回值:
+//   - error: 处理过程中遇到的错误，若成功则为 nil
+func (p *VoicePipeline) ProcessFragment(ctx context.Context, clientID string, header *mqtt_voice.Header, payload []byte) error {
+	key := utteranceKey(clientID, header.SessionID)
+	utterance, err := p.fragments.Add(clientID, header, payload)
+	if err != nil {
+		logger.Warn(ctx, "fragment add failed", map[string]any{
+			"error":     err.Error(),
+			"clientID":  clientID,
+			"sessionID": header.SessionID,
+			"frameSeq":  header.FrameSeq,
+		})
+		if !errors.Is(err, fragment.ErrUtteranceClosed) {
+			p.asrStreams.drop(key)
+			p.uplinks.drop(key)
+		}
+		return fmt.Errorf("fragment add failed: %w", err)
+	}
+
+	// 没有服务端端点检测时，设备开始上传新的语句即视为用户开始说话
+	if !p.opts.VAD && p.starts.first(clientID, header) {
+		p.interruptTurn(ctx, clientID)
+	}
+
+	streaming := p.asrStreams.enabled()
+	if p.opts.VAD || streaming {
+		// 分片按序转码为 PCM：边说边识别，并做服务端端点检测
+		_, err := p.uplinks.decode(key, header, payload, func(seq uint32, pcm []byte) {
+			if streaming {
+				p.asrStreams.feed(ctx, key, seq, pcm)
+			}
+			if utterance != nil || !p.opts.VAD {
+				return
+			}
+			event := p.endpoints.Feed(key, pcm)
+			if event == vad.EventSpeechStart { // 用户开始说话，打断正在进行的回复
+				p.interruptTurn(ctx, clientID)
+			}
+			// 检测到语音结束时不再等待设备的最后一帧
+			if event.Ended() {
+				utterance = p.fragments.Flush(clientID, header.SessionID)
+				if utterance != nil {
+					logger.Info(ctx, "vad endpoint detected", map[string]any{
+						"clientID":  clientID,
+						"sessionID": header.SessionID,
+						"event":     event.String(),
+						"frameSeq":  seq,
+					})
+				}
+			}
+		})
+		if err != nil {
+			logger.Warn(ctx, "decode fragment failed", map[string]any{
+				"error":    err.Error(),
+				"clientID": clientID,
+				"frameSeq": header.FrameSeq,
+			})
+		}
+	}
+	if utterance == nil { // 语句尚未完整
+		return nil
+	}
+	p.endpoints.Remove(key)
+	return p.processUtterance(ctx, utterance)
+}
 
+// utteranceKey 语句键 设备序列号/语句ID
+func utteranceKey(clientID string, sessionID uint32) string {
+	return fmt.Sprintf("%s/%d", clientID, sessionID)
+}
+
+// processUtterance 处理分片合并后的完整语句
+func (p *VoicePipeline) processUtterance(ctx context.Context, u *fragment.Utterance) (err error) {
+	logger.Info(ctx, "ProcessFragment utterance complete", map[string]any{
+		"clientID":   u.ClientID,
+		"sessionID":  u.SessionID,
+		"frames":     u.Frames,
+		"bytes":      len(u.Audio),
+		"duplicates": u.Duplicates,
+		"elapsed_ms": u.FinishedAt.Sub(u.StartedAt).Milliseconds(),
+	})
+	if !u.Complete() {
+		logger.Warn(ctx, "utterance merged with missing frames", map[string]any{
+			"clientID":  u.ClientID,
+			"sessionID": u.SessionID,
+			"missing":   u.MissingNum,
+			"seqs":      u.Missing,
+		})
+	}
+
+	// 以首个到达帧的协议头代表整句，帧类型修正为完整帧
+	header := *u.Header
+	header.F = mqtt_constant.VoiceFrameFull
+
+	// 流式识别已在说话过程中完成，直接进入识别之后的对话流程；失败时回退到整句识别
+	key := utteranceKey(u.ClientID, u.SessionID)
+	text, ok := p.asrStreams.finish(ctx, key, p.uplinks.finish(key))
+	if !ok {
+		return p.ProcessFull(ctx, u.ClientID, &header, u.Audio)
+	}
+	ctx, tr := p.beginTrace(ctx, u.ClientID)
+	defer func() { p.finishTrace(ctx, tr, err) }()
+	ctx = mqtt_voice.WithHeader(ctx, &header)
+	audioPath, err := p.upload(ctx, u.ClientID, &header, u.Audio)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		logger.Info(ctx, "asr stream recognized nothing, skip chat", map[string]any{
+			"clientID":  u.ClientID,
+			"sessionID": u.SessionID,
+			"path":      audioPath,
+		})
+		return nil
+	}
+	ctx, t := p.beginTurn(ctx, u.ClientID, utteranceKey(u.ClientID, u.SessionID))
+	if err := p.endTurn(ctx, t, p.ChatText(ctx, u.ClientID, text)); err != nil {
+		logger.Error(ctx, "chat pipeline failed", map[string]any{
+			"error": err.Error(),
+			"path":  audioPath,
+		})
+		return fmt.Errorf("chat pipeline failed: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	config "yunyez/internal/common/config"
+	tools "yunyez/internal/common/tools"
+	profileModel "yunyez/internal/model/profile"
+	llm "yunyez/internal/pkg/agent/llm"
+	prompt "yunyez/internal/pkg/agent/prompt"
+	logger "yunyez/internal/pkg/logger"
+	profileService "yunyez/internal/service/profile"
+	promptService "yunyez/internal/service/prompt"
+)
+
+// initSystemTemplate 初始化系统提示词模板
+// 配置了 prompt.system 时使用配置的模板，模板非法时使用内置模板
+func initSystemTemplate() *prompt.Template {
+	text := config.GetString("prompt.system")
+	if text == "" {
+		return prompt.Default
+	}
+	t, err := prompt.Parse("config", text)
+	if err != nil {
+		logger.Error(context.Background(), "parse system prompt template failed", map[string]any{
+			"error": err.Error(),
+		})
+		return prompt.Default
+	}
+	return t
+}
+
+// initPromptTemplates 加载厂商、设备类型、设备的覆盖模板，并定期检查修改以热更新
+// 参数：
+//   - ctx: 上下文对象，取消时停止热更新
+func initPromptTemplates(ctx context.Context) {
+	if err := promptService.ServiceInstance.Reload(ctx); err != nil {
+		logger.Error(ctx, "load prompt templates failed", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	reload := time.Duration(config.GetIntWithDefault("prompt.reload_interval_s", 30)) * time.Second
+	go promptService.ServiceInstance.Watch(ctx, reload)
+}
+
+// promptData 查询设备上下文、画像与事实，作为系统提示词的模板数据
+// 画像不存在或查询失败时只带设备上下文
+func promptData(ctx context.Context, clientID string) prompt.Data {
+	dev := deviceContext(ctx, clientID)
+	data := prompt.Data{
+		SN:           dev.SN,
+		Vendor:       dev.Vendor,
+		DeviceType:   dev.DeviceType,
+		ProductModel: dev.ProductModel,
+	}
+
+	p, err := profileService.ServiceInstance.GetProfile(ctx, clientID)
+	switch {
+	case err == nil:
+		data.UserName = p.UserName
+		data.DeviceName = p.DeviceName
+		data.Location = p.Location
+		data.Timezone = p.Timezone
+		data.Language = p.Language
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		logger.Warn(ctx, "get device profile failed", map[string]any{
+			"clientID": clientID,
+			"error":    err.Error(),
+		})
+	}
+
+	facts, err := profileService.ServiceInstance.ListFacts(ctx, clientID)
+	if err != nil {
+		logger.Warn(ctx, "list profile facts failed", map[string]any{
+			"clientID": clientID,
+			"error":    err.Error(),
+		})
+	}
+	data.Facts = profileService.PromptFacts(facts, prompt.MaxFactTokens)
+	return data
+}
+
+// systemPrompt 渲染设备的系统提示词
+// 按 设备 → 设备类型 → 厂商 的顺序使用最具体的覆盖模板，没有覆盖模板时使用默认模板；
+// 覆盖模板渲染失败时回退到默认模板，默认模板也失败时返回空，由模型使用配置的提示词
+// 参数：
+//   - systemTemplate: 默认系统提示词模板，没有覆盖模板时使用
+func systemPrompt(systemTemplate *prompt.Template) llm.PromptFunc {
+	return func(ctx context.Context, clientID string) string {
+		data := promptData(ctx, clientID)
+		if tmpl, ok := promptService.ServiceInstance.Resolve(data); ok {
+			text, err := tmpl.Render(data)
+			if err == nil {
+				return text
+			}
+			logger.Error(ctx, "render prompt template failed", map[string]any{
+				"clientID": clientID,
+				"template": tmpl.Name(),
+				"error":    err.Error(),
+			})
+		}
+
+		text, err := systemTemplate.Render(data)
+		if err != nil {
+			logger.Error(ctx, "render system prompt failed", map[string]any{
+				"clientID": clientID,
+				"template": systemTemplate.Name(),
+				"error":    err.Error(),
+			})
+			return ""
+		}
+		return text
+	}
+}
+
+// rememberFacts 对话回复后从用户的话中提取需要长期记住的事实并保存到设备画像
+// 只在文本可能包含事实时调用 LLM，提取请求与普通对话一样计费
+// 参数：
+//   - agent: 提取事实的模型，不带记忆、设备提示词与工具
+//   - rec: 提取请求的计费
+//   - timeout: 单次提取请求超时
+//
+// 返回值:
+//   - Hook: llm 阶段的回调，提取在脱离取消状态的后台进行
+func rememberFacts(agent llm.Agent, rec Recorder, timeout time.Duration) Hook {
+	return func(ctx context.Context, r StageResult) {
+		if r.Err != nil || !prompt.MayContainFacts(r.Text) {
+			return
+		}
+		clientID, text := r.ClientID, r.Text
+		bgCtx := context.Background()
+		if tid := tools.GetTraceID(ctx); tid != "" {
+			bgCtx = tools.WithTraceID(bgCtx, tid)
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(bgCtx, timeout)
+			defer cancel()
+
+			known, err := profileService.ServiceInstance.ListFacts(ctx, clientID)
+			if err != nil {
+				logger.Warn(ctx, "list profile facts failed", map[string]any{
+					"clientID": clientID,
+					"error":    err.Error(),
+				})
+				return
+			}
+			facts, usage, err := llm.ExtractFacts(ctx, agent, clientID, text, profileService.Facts(known))
+			if usage != nil {
+				recordUsage(bgCtx, rec, clientID, usage)
+			}
+			if err != nil {
+				logger.Warn(ctx, "extract profile facts failed", map[string]any{
+					"clientID": clientID,
+					"text":     text,
+					"error":    err.Error(),
+				})
+				return
+			}
+			if len(facts) == 0 {
+				return
+			}
+			if err := profileService.ServiceInstance.SaveFacts(ctx, clientID, facts, profileModel.SourceLLM); err != nil {
+				logger.Error(ctx, "save profile facts failed", map[string]any{
+					"clientID": clientID,
+					"facts":    facts,
+					"error":    err.Error(),
+				})
+				return
+			}
+			logger.Info(ctx, "profile facts remembered", map[string]any{
+				"clientID": clientID,
+				"facts":    facts,
+			})
+		}()
+	}
+}
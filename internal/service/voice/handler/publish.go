@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	config "yunyez/internal/common/config"
+	tts "yunyez/internal/pkg/agent/tts"
+	logger "yunyez/internal/pkg/logger"
+	mqttCore "yunyez/internal/pkg/mqtt/core"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+// newPublishConfig 根据 audio.publish 配置创建下行音频分帧与节流参数
+func newPublishConfig() mqttCore.PublishConfig {
+	return mqttCore.PublishConfig{
+		MTU:    config.GetIntWithDefault("audio.publish.mtu", mqtt_voice.DefaultMTU),
+		Pacing: config.GetBool("audio.publish.pacing"),
+		Lead:   time.Duration(config.GetIntWithDefault("audio.publish.lead_ms", int(mqttCore.DefaultPublishLead/time.Millisecond))) * time.Millisecond,
+	}
+}
+
+// mqttPublisher 通过设备的语音主题下发回复音频，通过控制指令主题控制播放
+type mqttPublisher struct {
+	acks    *control.AckManager    // 控制指令应答跟踪
+	publish mqttCore.PublishConfig // 下行音频分帧与节流参数
+}
+
+// Open 开启一路下行音频流，协议版本与会话ID沿用 ctx 中设备上行的协议头
+func (m mqttPublisher) Open(ctx context.Context, clientID string) (AudioStream, error) {
+	mqtt, topic, err := deviceClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return &mqttAudioStream{mqtt: mqtt, topic: topic, config: m.publish, encoder: newDownlinkStream(ctx)}, nil
+}
+
+// Stop 通知设备停止播放已下发的音频
+// 指令在后台等待设备应答，应答超时或被拒绝时只记录日志
+// 参数：
+//   - ctx: 上下文对象，已取消时脱离取消状态发送
+//   - clientID: 客户端ID(设备序列号)
+//
+// 返回值:
+//   - error: 指令构建失败时返回错误
+func (m mqttPublisher) Stop(ctx context.Context, clientID string) error {
+	msg, err := control.NewCommand(control.TypeStopPlayback).Build()
+	if err != nil {
+		return err
+	}
+	// 被打断的轮次上下文已取消，停止指令仍需送达
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		_, _ = sendControl(ctx, m.acks, clientID, msg)
+	}()
+	return nil
+}
+
+// mqttAudioStream 转码为设备音频格式后按 MTU 分帧下发的音频流
+type mqttAudioStream struct {
+	mqtt      mqttCore.Client
+	topic     mqttCore.Topic
+	config    mqttCore.PublishConfig
+	encoder   *downlinkStream
+	publisher *mqttCore.AudioPublisher // 首个分块确定音频配置后创建
+}
+
+// Write 转码并下发 TTS 输出的音频分块
+func (s *mqttAudioStream) Write(ctx context.Context, chunk []byte, format tts.Format) error {
+	data, err := s.encoder.Encode(chunk, format)
+	if err != nil {
+		return err
+	}
+	if s.publisher == nil { // the audio config is known after the first chunk
+		s.publisher = mqttCore.NewAudioPublisher(&s.mqtt, s.encoder.Config(), s.config)
+		logger.Info(ctx, "publish audio config", map[string]any{
+			"topic":        s.topic.String(),
+			"audio_config": s.encoder.Config(),
+		})
+	}
+	return s.publisher.Write(ctx, data)
+}
+
+// Close 下发重采样保留的尾部音频后发送最后一帧结束音频流，没有下发过音频时不发送
+func (s *mqttAudioStream) Close(ctx context.Context) error {
+	if s.publisher == nil {
+		return nil
+	}
+	err := s.flush(ctx)
+	if closeErr := s.publisher.Close(ctx); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Error(ctx, "close audio stream failed", map[string]any{
+			"topic":  s.topic.String(),
+			"frames": s.publisher.Frames(),
+			"error":  err.Error(),
+		})
+	}
+	return err
+}
+
+// flush 下发转码器保留的尾部音频
+func (s *mqttAudioStream) flush(ctx context.Context) error {
+	data, err := s.encoder.Flush()
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	return s.publisher.Write(ctx, data)
+}
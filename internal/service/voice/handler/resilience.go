@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	config "yunyez/internal/common/config"
+	asr "yunyez/internal/pkg/agent/asr"
+	llm "yunyez/internal/pkg/agent/llm"
+	nlu "yunyez/internal/pkg/agent/nlu"
+	resilience "yunyez/internal/pkg/agent/resilience"
+	tts "yunyez/internal/pkg/agent/tts"
+	logger "yunyez/internal/pkg/logger"
+)
+
+// 能力名称，即 resilience.<capability> 配置项
+const (
+	capabilityASR = "asr"
+	capabilityNLU = "nlu"
+	capabilityLLM = "llm"
+	capabilityTTS = "tts"
+)
+
+// 各能力单次调用的默认超时与慢调用阈值（毫秒）
+var (
+	defaultCallTimeout = map[string]int{capabilityASR: 10000, capabilityNLU: 3000, capabilityLLM: 60000, capabilityTTS: 10000}
+	defaultSlowCall    = map[string]int{capabilityASR: 3000, capabilityNLU: 1000, capabilityLLM: 5000, capabilityTTS: 3000}
+)
+
+// providerNames 能力的提供方顺序，未配置时只使用默认提供方
+func providerNames(capability, fallback string) []string {
+	names := config.GetList("resilience." + capability + ".providers")
+	if len(names) == 0 {
+		return []string{fallback}
+	}
+	return names
+}
+
+// callTimeout 能力的单次调用超时
+func callTimeout(capability string) time.Duration {
+	ms := config.GetIntWithDefault("resilience."+capability+".timeout_ms", defaultCallTimeout[capability])
+	return time.Duration(ms) * time.Millisecond
+}
+
+// breakerConfig 能力的熔断器配置，慢调用阈值按能力配置
+func breakerConfig(capability string) resilience.BreakerConfig {
+	return resilience.BreakerConfig{
+		Window:      config.GetInt("resilience.breaker.window"),
+		MinRequests: config.GetInt("resilience.breaker.min_requests"),
+		FailureRate: config.GetFloat64("resilience.breaker.failure_rate"),
+		SlowCall:    time.Duration(config.GetIntWithDefault("resilience."+capability+".slow_call_ms", defaultSlowCall[capability])) * time.Millisecond,
+		OpenTimeout: time.Duration(config.GetInt("resilience.breaker.open_s")) * time.Second,
+	}
+}
+
+// newChain 按配置的提供方顺序创建能力的提供方链，创建失败的提供方被跳过
+// 参数：
+//   - capability: 能力名称
+//   - fallback: 未配置提供方顺序时的默认提供方
+//   - build: 按名称创建客户端与健康检查
+//
+// 返回值:
+//   - *resilience.Chain[T]: 提供方链
+func newChain[T any](capability, fallback string, build func(name string) (T, resilience.ProbeFunc, error)) *resilience.Chain[T] {
+	var providers []*resilience.Provider[T]
+	for _, name := range providerNames(capability, fallback) {
+		client, probe, err := build(name)
+		if err != nil {
+			logger.Error(context.Background(), "init provider failed", map[string]any{
+				"capability": capability,
+				"provider":   name,
+				"error":      err.Error(),
+			})
+			continue
+		}
+		providers = append(providers, resilience.NewProvider(name, client, callTimeout(capability), probe))
+	}
+	if len(providers) == 0 {
+		logger.Error(context.Background(), "no provider available", map[string]any{
+			"capability": capability,
+		})
+	}
+	return resilience.NewChain(capability, breakerConfig(capability), providers...)
+}
+
+// initASRChain 初始化 ASR 提供方链，提供方为协议名：grpc、http
+func initASRChain() *failoverASR {
+	return &failoverASR{chain: newChain(capabilityASR, config.GetString("asr.protocol"), func(name string) (asr.Service, resilience.ProbeFunc, error) {
+		switch asr.Protocol(name) {
+		case asr.ProtocolGRPC:
+			c, err := asr.NewGRPCClient(config.GetString("asr.grpc_endpoint"))
+			if err != nil {
+				return nil, nil, err
+			}
+			return c, c.Health, nil
+		case asr.ProtocolHTTP, "":
+			c, err := asr.NewHTTPClient(config.GetString("asr.http_endpoint"), config.GetString("asr.model"))
+			return c, nil, err
+		default:
+			return nil, nil, fmt.Errorf("unknown asr provider: %s", name)
+		}
+	})}
+}
+
+// initNLUChain 初始化 NLU 提供方链，提供方为协议名：grpc、http
+func initNLUChain() *failoverNLU {
+	return &failoverNLU{chain: newChain(capabilityNLU, config.GetString("nlu.protocol"), func(name string) (*nlu.Client, resilience.ProbeFunc, error) {
+		c, err := nlu.New(nlu.Config{
+			Model:        config.GetString("nlu.model"),
+			Protocol:     nlu.Protocol(name),
+			HTTPEndpoint: config.GetString("nlu.http_endpoint"),
+			GRPCEndpoint: config.GetString("nlu.grpc_endpoint"),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, c.HealthContext, nil
+	})}
+}
+
+// initTTSChain 初始化 TTS 提供方链，提供方为 grpc 或 HTTP 模型名：edge、chat
+func initTTSChain() *failoverTTS {
+	fallback := config.GetString("tts.model")
+	if tts.Protocol(config.GetString("tts.protocol")) == tts.ProtocolGRPC {
+		fallback = string(tts.ProtocolGRPC)
+	}
+	return &failoverTTS{chain: newChain(capabilityTTS, fallback, func(name string) (tts.Service, resilience.ProbeFunc, error) {
+		if tts.Protocol(name) == tts.ProtocolGRPC {
+			c, err := tts.NewGRPCTTSClient(config.GetString("tts.grpc_endpoint"), config.GetString("tts.edge.params.voice"))
+			if err != nil {
+				return nil, nil, err
+			}
+			return c, c.Health, nil
+		}
+		c, err := tts.NewTTSClient(tts.Config{
+			Model:        name,
+			Protocol:     tts.ProtocolHTTP,
+			HTTPEndpoint: config.GetString("tts." + name + ".endpoint"),
+			Voice:        config.GetString("tts." + name + ".params.voice"),
+			Rate:         config.GetString("tts." + name + ".params.rate"),
+			Pitch:        config.GetString("tts." + name + ".params.pitch"),
+			Volume:       config.GetString("tts." + name + ".params.volume"),
+			Temperature:  config.GetString("tts." + name + ".params.temperature"),
+		})
+		return c, nil, err
+	})}
+}
+
+// initLLMChain 初始化 LLM 提供方链，提供方为模型名：qwen、local 或 llm.backends 中的后端名
+// 所有提供方共享对话记忆、提示词与工具
+// 参数：
+//   - strategy: 提供方共享的记忆、提示词、工具与后端
+//   - fallback: 未配置提供方顺序时的默认模型，即 agent.model
+func initLLMChain(strategy *llm.Strategy, fallback string) *llm.Failover {
+	return &llm.Failover{Chain: newChain(capabilityLLM, fallback, func(name string) (llm.Agent, resilience.ProbeFunc, error) {
+		s := *strategy
+		return s.SetAgent(name).Model, nil, nil
+	})}
+}
+
+// failoverASR 按提供方链降级的 ASR 客户端
+type failoverASR struct {
+	chain *resilience.Chain[asr.Service]
+}
+
+// Transfer 语音识别
+func (f *failoverASR) Transfer(ctx context.Context, data []byte) (string, error) {
+	var text string
+	err := f.chain.Do(ctx, func(ctx context.Context, c asr.Service) error {
+		var err error
+		text, err = c.Transfer(ctx, data)
+		return err
+	})
+	return text, err
+}
+
+// StartStream 在第一个可用的流式识别提供方上开启会话
+// 会话跨越多个请求，不使用单次调用超时，熔断只统计开启会话的结果
+func (f *failoverASR) StartStream(ctx context.Context, cfg asr.StreamConfig) (asr.Stream, error) {
+	var errs []error
+	for _, p := range f.chain.Providers() {
+		client, ok := p.Client.(asr.StreamingService)
+		if !ok {
+			continue
+		}
+		if err := p.Acquire(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		start := time.Now()
+		stream, err := client.StartStream(ctx, cfg)
+		p.Done(ctx, err, time.Since(start))
+		if err == nil {
+			return stream, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+	return nil, f.chain.Unavailable(errs...)
+}
+
+// Close 关闭所有提供方
+func (f *failoverASR) Close() error {
+	var errs []error
+	for _, p := range f.chain.Providers() {
+		errs = append(errs, p.Client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// failoverNLU 按提供方链降级的 NLU 客户端
+type failoverNLU struct {
+	chain *resilience.Chain[*nlu.Client]
+}
+
+// Predict 意图识别
+func (f *failoverNLU) Predict(ctx context.Context, input *nlu.Input) (*nlu.Intent, error) {
+	var intent *nlu.Intent
+	err := f.chain.Do(ctx, func(ctx context.Context, c *nlu.Client) error {
+		var err error
+		intent, err = c.PredictContext(ctx, input)
+		return err
+	})
+	return intent, err
+}
+
+// errEmptyAudio 提供方没有合成出音频，计为失败以便降级
+var errEmptyAudio = errors.New("tts returned empty audio")
+
+// failoverTTS 按提供方链降级的 TTS 客户端
+type failoverTTS struct {
+	chain *resilience.Chain[tts.Service]
+}
+
+// Synthesize 语音合成
+func (f *failoverTTS) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	audio, _, err := f.synthesize(ctx, text)
+	return audio, err
+}
+
+// synthesize 语音合成，返回音频与实际提供合成的提供方的输出格式
+func (f *failoverTTS) synthesize(ctx context.Context, text string) ([]byte, tts.Format, error) {
+	var audio []byte
+	var format tts.Format
+	err := f.chain.Do(ctx, func(ctx context.Context, c tts.Service) error {
+		var err error
+		audio, err = c.Synthesize(ctx, text)
+		if err == nil && len(audio) == 0 {
+			err = errEmptyAudio
+		}
+		format = tts.FormatOf(c)
+		return err
+	})
+	return audio, format, err
+}
+
+// SynthesizeStream 在第一个可用的流式合成提供方上流式合成
+// 播放期间读取分块会阻塞，不使用单次调用超时，熔断按首个音频分块的耗时统计；
+// 已下发音频后不再降级。没有可用的流式合成提供方时按提供方链整句合成
+func (f *failoverTTS) SynthesizeStream(ctx context.Context, text string, onChunk func(chunk []byte, format tts.Format) error) error {
+	var errs []error
+	for _, p := range f.chain.Providers() {
+		client, ok := p.Client.(tts.StreamingService)
+		if !ok {
+			continue
+		}
+		if err := p.Acquire(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		start := time.Now()
+		first := false
+		err := client.SynthesizeStream(ctx, text, func(chunk []byte, format tts.Format) error {
+			if !first {
+				first = true
+				p.Done(ctx, nil, time.Since(start))
+			}
+			return onChunk(chunk, format)
+		})
+		if first {
+			return err
+		}
+		if err == nil {
+			err = errEmptyAudio
+		}
+		p.Done(ctx, err, time.Since(start))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+
+	audio, format, err := f.synthesize(ctx, text)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	return onChunk(audio, format)
+}
+
+// Close 关闭所有提供方
+func (f *failoverTTS) Close() error {
+	var errs []error
+	for _, p := range f.chain.Providers() {
+		errs = append(errs, p.Client.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	config "yunyez/internal/common/config"
+	tool "yunyez/internal/pkg/agent/tool"
+	logger "yunyez/internal/pkg/logger"
+	deviceService "yunyez/internal/service/device"
+	intent "yunyez/internal/service/voice/intent"
+)
+
+// ToolDeviceStatus 查询设备状态的工具名
+const ToolDeviceStatus = "get_device_status"
+
+// initTools 初始化 LLM 可调用的工具
+// 设置温度、播放音乐经意图处理器执行，设置定时提醒直接下发指令，均等待设备应答
+// 参数：
+//   - intents: 命令类意图处理器
+//   - commander: 下发指令到设备
+//
+// 返回值:
+//   - *tool.Registry: 工具注册表，未启用工具调用时返回 nil
+func initTools(intents *intent.Registry, commander intent.Commander) *tool.Registry {
+	if !config.GetBool("agent.tools.enabled") {
+		return nil
+	}
+	tools := tool.NewRegistry()
+	err := intent.RegisterTools(tools, intents, commander, deviceContext)
+	if err == nil {
+		err = tools.Register(deviceStatusTool())
+	}
+	if err != nil {
+		logger.Error(context.Background(), "register llm tools failed", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	return tools
+}
+
+// deviceStatusTool 查询设备状态：型号、固件、激活状态与网络连接状态
+func deviceStatusTool() tool.Tool {
+	return tool.Tool{
+		Definition: tool.Definition{
+			Name:        ToolDeviceStatus,
+			Description: "查询当前设备的型号、固件版本、激活状态与网络连接状态",
+		},
+		Run: func(ctx context.Context, clientID string, args map[string]any) (string, error) {
+			info, err := deviceService.ServiceInstance.GetDeviceBySN(ctx, clientID)
+			if err != nil {
+				return "", err
+			}
+			status := map[string]any{
+				"deviceType":      info.DeviceType,
+				"productModel":    info.ProductModel,
+				"firmwareVersion": info.FirmwareVersion,
+				"status":          info.Status,
+			}
+			network, err := deviceService.ServiceInstance.GetDeviceNetworkBySN(ctx, clientID)
+			if err == nil {
+				status["networkType"] = network.NetworkType
+				status["connectStatus"] = network.ConnectStatus
+				status["signalStrength"] = network.SignalStrength
+			}
+			data, err := json.Marshal(status)
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		},
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tools "yunyez/internal/common/tools"
+	conversationModel "yunyez/internal/model/conversation"
+	traceModel "yunyez/internal/model/trace"
+	logger "yunyez/internal/pkg/logger"
+)
+
+// turnTrace 一次处理流程的轮次记录，各阶段结束时写入
+type turnTrace struct {
+	mu     sync.Mutex
+	record traceModel.TurnRecord
+	audio  string // 上行音频的存储位置，对话记录引用
+}
+
+// turnTraceKey 轮次记录在上下文中的键
+type turnTraceKey struct{}
+
+// beginTrace 开始记录一次处理流程，固定上下文的链路ID使各阶段的日志与记录一致
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//
+// 返回值:
+//   - context.Context: 带轮次记录的上下文
+//   - *turnTrace: 轮次记录，处理结束后调用 finishTrace
+func (p *VoicePipeline) beginTrace(ctx context.Context, clientID string) (context.Context, *turnTrace) {
+	traceID := tools.GetTraceID(ctx)
+	tr := &turnTrace{record: traceModel.TurnRecord{
+		TraceID:   traceID,
+		SN:        clientID,
+		StartTime: time.Now(),
+	}}
+	ctx = tools.WithTraceID(ctx, traceID)
+	return context.WithValue(ctx, turnTraceKey{}, tr), tr
+}
+
+// traceFrom 上下文中的轮次记录，不在处理流程中时为 nil
+func traceFrom(ctx context.Context) *turnTrace {
+	tr, _ := ctx.Value(turnTraceKey{}).(*turnTrace)
+	return tr
+}
+
+// observe 写入阶段的结果，记录首个出错的阶段
+func (tr *turnTrace) observe(r StageResult) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	rec := &tr.record
+	end := r.End
+	switch r.Stage {
+	case StageUpload:
+		rec.UploadTime = &end
+		tr.audio = r.Audio
+	case StageASR:
+		rec.ASRTime = &end
+		rec.Transcript = r.Text
+	case StageNLU:
+		rec.NLUTime = &end
+		if r.Intent != nil {
+			rec.Intent = r.Intent.Intent
+		}
+	case StageIntent:
+		rec.IntentTime = &end
+		rec.Handled = r.Handled
+		if r.Handled {
+			rec.Reply = r.Reply
+		}
+	case StageLLM:
+		rec.LLMTime = &end
+		if !r.FirstToken.IsZero() {
+			first := r.FirstToken
+			rec.LLMFirstTokenTime = &first
+		}
+		rec.Reply = r.Reply
+		if r.Usage != nil {
+			rec.ModelName = r.Usage.Model
+			rec.PromptTokens = r.Usage.PromptTokens
+			rec.CompletionTokens = r.Usage.CompletionTokens
+		}
+	case StageTTS:
+		if r.Err == nil && rec.TTSFirstAudioTime == nil {
+			first := r.Start
+			rec.TTSFirstAudioTime = &first
+		}
+	case StagePublish:
+		rec.PublishTime = &end
+	}
+	// 流式识别的文本不经过 asr 阶段
+	if rec.Transcript == "" && r.Stage != StageTTS {
+		rec.Transcript = r.Text
+	}
+	if r.Err != nil && rec.ErrorStage == "" {
+		rec.ErrorStage = string(r.Stage)
+		rec.ErrorMessage = r.Err.Error()
+	}
+}
+
+// finishTrace 结束处理流程，在后台保存轮次记录与对话记录
+// 参数：
+//   - ctx: 带轮次记录的上下文
+//   - tr: 轮次记录
+//   - err: 处理流程返回的错误，没有出错的阶段时记录该错误
+func (p *VoicePipeline) finishTrace(ctx context.Context, tr *turnTrace, err error) {
+	tr.mu.Lock()
+	record, audio := tr.record, tr.audio
+	tr.mu.Unlock()
+
+	record.EndTime = time.Now()
+	record.TotalMS = record.EndTime.Sub(record.StartTime).Milliseconds()
+	if record.TTSFirstAudioTime != nil {
+		record.FirstAudioMS = record.TTSFirstAudioTime.Sub(record.StartTime).Milliseconds()
+	}
+	if err != nil && record.ErrorMessage == "" {
+		record.ErrorMessage = err.Error()
+	}
+	logger.Info(ctx, "voice turn finished", map[string]any{
+		"clientID":       record.SN,
+		"total_ms":       record.TotalMS,
+		"first_audio_ms": record.FirstAudioMS,
+		"error_stage":    record.ErrorStage,
+	})
+
+	// 轮次被打断时上下文已取消，记录仍需保存
+	ctx = context.WithoutCancel(ctx)
+	if p.deps.Turns != nil {
+		go func() {
+			if err := p.deps.Turns.SaveTurn(ctx, &record); err != nil {
+				logger.Error(ctx, "save turn record failed", map[string]any{
+					"error":    err.Error(),
+					"clientID": record.SN,
+				})
+			}
+		}()
+	}
+	// 没有识别出文本的语句不计入对话
+	if p.deps.Conversations != nil && record.Transcript != "" {
+		turn := &conversationModel.Turn{
+			SN:         record.SN,
+			TraceID:    record.TraceID,
+			Transcript: record.Transcript,
+			Reply:      record.Reply,
+			Intent:     record.Intent,
+			AudioRef:   audio,
+			CreateTime: record.StartTime,
+		}
+		go func() {
+			if err := p.deps.Conversations.AppendTurn(ctx, turn, p.opts.ConversationIdle); err != nil {
+				logger.Error(ctx, "save conversation turn failed", map[string]any{
+					"error":    err.Error(),
+					"clientID": record.SN,
+				})
+			}
+		}()
+	}
+}
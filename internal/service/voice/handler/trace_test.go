@@ -0,0 +1,91 @@
+// 测试轮次记录：每次处理按阶段写入完成时间、识别文本、意图、回复与出错阶段
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tools "yunyez/internal/common/tools"
+	traceModel "yunyez/internal/model/trace"
+)
+
+// savedTurn 等待后台保存的轮次记录
+func savedTurn(t *testing.T, f *fakes) *traceModel.TurnRecord {
+	require.Eventually(t, func() bool { return len(f.turns.saved()) == 1 }, time.Second, 10*time.Millisecond)
+	return f.turns.saved()[0]
+}
+
+func TestProcessFullTurnRecord(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+	ctx := tools.WithTraceID(context.Background(), "trace-1")
+
+	require.NoError(t, p.ProcessFull(ctx, testClient, pcmHeader(), make([]byte, 640)))
+
+	r := savedTurn(t, f)
+	assert.Equal(t, "trace-1", r.TraceID)
+	assert.Equal(t, testClient, r.SN)
+	assert.Equal(t, "今天天气怎么样", r.Transcript)
+	assert.Equal(t, "chat", r.Intent)
+	assert.False(t, r.Handled)
+	assert.Equal(t, "今天晴天。适合出门。", r.Reply)
+	assert.Equal(t, "test/m", r.ModelName)
+	assert.Equal(t, 10, r.PromptTokens)
+	assert.Equal(t, 5, r.CompletionTokens)
+	assert.Empty(t, r.ErrorStage)
+
+	// 各阶段按处理顺序完成
+	stages := []*time.Time{r.UploadTime, r.ASRTime, r.NLUTime, r.IntentTime, r.LLMFirstTokenTime, r.TTSFirstAudioTime, r.PublishTime}
+	prev := r.StartTime
+	for i, at := range stages {
+		require.NotNil(t, at, "stage %d", i)
+		assert.False(t, at.Before(prev), "stage %d", i)
+		prev = *at
+	}
+	assert.False(t, r.EndTime.Before(*r.PublishTime))
+	assert.Equal(t, r.TTSFirstAudioTime.Sub(r.StartTime).Milliseconds(), r.FirstAudioMS)
+}
+
+func TestProcessFullTurnRecordErrorStage(t *testing.T) {
+	f := newFakes()
+	f.asr.err = errors.New("asr timeout")
+	p := f.pipeline(t, Options{})
+
+	assert.Error(t, p.ProcessFull(context.Background(), testClient, pcmHeader(), make([]byte, 640)))
+
+	r := savedTurn(t, f)
+	assert.NotEmpty(t, r.TraceID)
+	assert.Equal(t, string(StageASR), r.ErrorStage)
+	assert.Equal(t, "asr timeout", r.ErrorMessage)
+	assert.NotNil(t, r.UploadTime)
+	assert.Nil(t, r.LLMTime)
+	assert.Nil(t, r.TTSFirstAudioTime)
+	assert.Zero(t, r.FirstAudioMS)
+}
+
+func TestTurnRecordIntentHandled(t *testing.T) {
+	f := newFakes()
+	f.intents.handled, f.intents.reply = true, "好的，已关灯"
+	p := f.pipeline(t, Options{})
+
+	require.NoError(t, p.ProcessFull(context.Background(), testClient, pcmHeader(), make([]byte, 640)))
+
+	r := savedTurn(t, f)
+	assert.True(t, r.Handled)
+	assert.Equal(t, "好的，已关灯", r.Reply)
+	assert.Nil(t, r.LLMTime, "the command is not sent to the llm")
+	assert.NotNil(t, r.TTSFirstAudioTime)
+}
+
+func TestChatTextWithoutTurnRecord(t *testing.T) {
+	f := newFakes()
+	p := f.pipeline(t, Options{})
+
+	require.NoError(t, p.ChatText(context.Background(), testClient, "你好"))
+	assert.Never(t, func() bool { return len(f.turns.saved()) > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	tts "yunyez/internal/pkg/agent/tts"
+	audio "yunyez/internal/pkg/media/audio"
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	voice "yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+// pipelineSampleRate the sample rate of the asr input and the tts output (mono)
+const pipelineSampleRate = 16000
+
+// ttsAudioFormat the device audio format label of the tts output format
+// The format comes from the provider that synthesized the audio: grpc requests
+// AUDIO_16KHZ_16BIT_RAW_PCM, the http services return wav
+func ttsAudioFormat(format tts.Format) uint8 {
+	if format == tts.FormatPCM {
+		return mqttCommon.VoiceAudioFormatPcm
+	}
+	return mqttCommon.VoiceAudioFormatWav
+}
+
+// encodingOf map the device audio format to the sample encoding
+// Returns false for formats the codec can't convert (wav, mp3, opus...)
+func encodingOf(format uint8) (audio.Encoding, bool) {
+	switch format {
+	case mqttCommon.VoiceAudioFormatPcm:
+		return audio.EncodingPCM16, true
+	case mqttCommon.VoiceAudioFormatG711A:
+		return audio.EncodingALaw, true
+	case mqttCommon.VoiceAudioFormatG711U:
+		return audio.EncodingULaw, true
+	default:
+		return 0, false
+	}
+}
+
+// channelCount the channel count of the header Ch field
+// Returns 0 for multi-channel (3) whose layout is unknown
+func channelCount(ch uint8) int {
+	switch ch {
+	case 1, 2:
+		return int(ch)
+	default:
+		return 0
+	}
+}
+
+// pcmAudio 16-bit pcm with its sample rate and channel count
+type pcmAudio struct {
+	data       []byte
+	sampleRate int
+	channels   int
+}
+
+// decodePCM decode the audio to 16-bit pcm by its real content
+// A RIFF/WAVE container is parsed and its fmt chunk wins over the declared format,
+// other data is decoded according to the declared format
+// Returns false if the content can't be decoded (mp3, opus...)
+func decodePCM(data []byte, format uint8, sampleRate, channels int) (*pcmAudio, bool, error) {
+	if audio.IsWAV(data) {
+		wavFormat, body, err := audio.ParseWAV(data)
+		if err != nil {
+			return nil, false, err
+		}
+		enc, err := wavFormat.Encoding()
+		if err != nil {
+			return nil, false, err
+		}
+		body = body[:len(body)-len(body)%int(wavFormat.BlockAlign)] // drop a trailing partial sample
+		pcm, err := audio.Transcode(body, enc, audio.EncodingPCM16)
+		if err != nil {
+			return nil, false, err
+		}
+		return &pcmAudio{data: pcm, sampleRate: int(wavFormat.SampleRate), channels: int(wavFormat.Channels)}, true, nil
+	}
+
+	enc, ok := encodingOf(format)
+	if !ok {
+		return nil, false, nil
+	}
+	pcm, err := audio.Transcode(data, enc, audio.EncodingPCM16)
+	if err != nil {
+		return nil, false, err
+	}
+	return &pcmAudio{data: pcm, sampleRate: sampleRate, channels: channels}, true, nil
+}
+
+// convertPCM convert the sample rate and channel count of 16-bit pcm
+// Unknown source rate or channel count (0) is taken as the target, i.e. left untouched
+func convertPCM(pcm []byte, fromRate, fromCh, toRate, toCh int) ([]byte, error) {
+	if fromRate <= 0 {
+		fromRate = toRate
+	}
+	if fromCh <= 0 {
+		fromCh = toCh
+	}
+	if fromRate == toRate && fromCh == toCh {
+		return pcm, nil
+	}
+
+	samples := audio.Samples(pcm)
+	// mix down first so that resampling runs on fewer channels
+	if toCh < fromCh {
+		samples = audio.Remix(samples, fromCh, toCh)
+		fromCh = toCh
+	}
+	samples, err := audio.Resample(samples, fromCh, fromRate, toRate)
+	if err != nil {
+		return nil, err
+	}
+	samples = audio.Remix(samples, fromCh, toCh)
+	return audio.Bytes(samples), nil
+}
+
+// pcmStream convert the sample rate and channel count of a 16-bit pcm stream chunk by chunk
+// The resampler carries its filter history and phase across chunks, so the output is the same
+// as converting the whole stream at once: no edge artifacts and no rounding up per chunk
+type pcmStream struct {
+	fromRate, fromCh int
+	toRate, toCh     int
+	resampler        *audio.StreamResampler
+	rest             []byte // trailing partial sample of the previous chunk
+}
+
+// newPCMStream create the converter of one audio stream
+// Unknown source rate or channel count (0) is taken as the target, i.e. left untouched
+func newPCMStream(fromRate, fromCh, toRate, toCh int) (*pcmStream, error) {
+	if fromRate <= 0 {
+		fromRate = toRate
+	}
+	if fromCh <= 0 {
+		fromCh = toCh
+	}
+	resampler, err := audio.NewStreamResampler(fromRate, toRate, min(fromCh, toCh))
+	if err != nil {
+		return nil, err
+	}
+	return &pcmStream{fromRate: fromRate, fromCh: fromCh, toRate: toRate, toCh: toCh, resampler: resampler}, nil
+}
+
+// matches whether the stream converts from the given source rate and channel count
+func (s *pcmStream) matches(fromRate, fromCh int) bool {
+	if fromRate <= 0 {
+		fromRate = s.toRate
+	}
+	if fromCh <= 0 {
+		fromCh = s.toCh
+	}
+	return fromRate == s.fromRate && fromCh == s.fromCh
+}
+
+// Convert convert one chunk, the output lags the input by half the filter length
+func (s *pcmStream) Convert(pcm []byte) []byte {
+	data := append(s.rest, pcm...)
+	cut := len(data) - len(data)%(2*s.fromCh)
+	s.rest = append([]byte(nil), data[cut:]...)
+
+	samples := audio.Samples(data[:cut])
+	if s.toCh < s.fromCh { // mix down first so that resampling runs on fewer channels
+		samples = audio.Remix(samples, s.fromCh, s.toCh)
+	}
+	samples = s.resampler.Process(samples)
+	return audio.Bytes(audio.Remix(samples, min(s.fromCh, s.toCh), s.toCh))
+}
+
+// Flush return the samples held back by the resampler, the stream can be reused afterwards
+func (s *pcmStream) Flush() []byte {
+	s.rest = nil
+	samples := s.resampler.Flush()
+	return audio.Bytes(audio.Remix(samples, min(s.fromCh, s.toCh), s.toCh))
+}
+
+// decodeUplink transcode the device upload to the 16-bit pcm expected by asr
+// The audio is normalized to pipelineSampleRate mono from what the header says,
+// a wav upload is unwrapped and its own fmt chunk is used instead
+// Parameters:
+//   - ctx: the context carrying the device uplink header
+//   - payload: the audio uploaded by the device
+//
+// Returns:
+//   - []byte: the 16-bit pcm audio, or the payload as is if the format can't be converted
+//   - bool: whether the returned audio is pcm
+//   - error: the error object if the transcode failed
+func decodeUplink(ctx context.Context, payload []byte) ([]byte, bool, error) {
+	header, ok := voice.HeaderFromContext(ctx)
+	if !ok {
+		header = &voice.Header{AudioFormat: mqttCommon.VoiceAudioFormatPcm}
+	}
+	pcm, ok, err := decodeDevice(header, payload)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return payload, false, nil
+	}
+	data, err := convertPCM(pcm.data, pcm.sampleRate, pcm.channels, pipelineSampleRate, 1)
+	if err != nil {
+		return nil, false, fmt.Errorf("normalize %dHz/%dch upload: %w", pcm.sampleRate, pcm.channels, err)
+	}
+	return data, true, nil
+}
+
+// decodeDevice decode the device upload to 16-bit pcm at the rate and channels the header says
+// Returns false if the format can't be converted
+func decodeDevice(header *voice.Header, payload []byte) (*pcmAudio, bool, error) {
+	format := header.AudioFormat
+	if format == mqttCommon.VoiceAudioFormatWav && !audio.IsWAV(payload) {
+		format = mqttCommon.VoiceAudioFormatPcm // labelled wav but sent without the RIFF header
+	}
+
+	pcm, ok, err := decodePCM(payload, format, int(header.SampleRate), channelCount(header.Ch))
+	if err != nil {
+		return nil, false, fmt.Errorf("decode %s upload: %w", mqttCommon.AudioFormatString(header.AudioFormat), err)
+	}
+	return pcm, ok, nil
+}
+
+// downlinkTarget the format, sample rate and channel count to send to the device
+// Taken from the uplink header, raw pcm as synthesized without one
+func downlinkTarget(ctx context.Context, pcm *pcmAudio) (uint8, int, int) {
+	format := uint8(mqttCommon.VoiceAudioFormatPcm)
+	sampleRate, channels := pcm.sampleRate, pcm.channels
+	if header, ok := voice.HeaderFromContext(ctx); ok {
+		format = header.AudioFormat
+		if header.SampleRate > 0 {
+			sampleRate = int(header.SampleRate)
+		}
+		if n := channelCount(header.Ch); n > 0 {
+			channels = n
+		}
+	}
+	return format, sampleRate, channels
+}
+
+// encodeSamples encode the converted pcm samples to the device format
+// Returns the format actually produced: wav is left for the caller to wrap (pcm samples),
+// a compressed format we can't encode falls back to pcm
+func encodeSamples(out []byte, format uint8) ([]byte, uint8, error) {
+	var err error
+	switch format {
+	case mqttCommon.VoiceAudioFormatWav:
+	case mqttCommon.VoiceAudioFormatG711A, mqttCommon.VoiceAudioFormatG711U:
+		enc, _ := encodingOf(format)
+		if out, err = audio.Transcode(out, audio.EncodingPCM16, enc); err != nil {
+			return nil, format, fmt.Errorf("encode %s downlink: %w", mqttCommon.AudioFormatString(format), err)
+		}
+	default: // pcm, or a compressed format we can't encode: send pcm
+		format = mqttCommon.VoiceAudioFormatPcm
+	}
+	return out, format, nil
+}
+
+// downlinkStream encode the streamed tts output chunk by chunk to the device format
+// All chunks of one reply are sent as a single audio stream, so the format is fixed
+// by the first chunk; a wav device gets one RIFF header with an open-ended data chunk.
+// The chunks go through one streaming converter, Flush returns the samples it holds back
+type downlinkStream struct {
+	ctx       context.Context
+	config    voice.AudioConfig
+	ready     bool       // config fixed by the first chunk
+	raw       bool       // the tts output can't be decoded, forwarded as is
+	header    bool       // the wav header is sent
+	rest      []byte     // trailing partial sample of the previous chunk
+	converter *pcmStream // converts to the device rate and channels, created by the first chunk
+}
+
+// newDownlinkStream create the encoder for one reply
+// Parameters:
+//   - ctx: the context carrying the device uplink header
+//
+// Returns:
+//   - *downlinkStream: the chunk encoder
+func newDownlinkStream(ctx context.Context) *downlinkStream {
+	return &downlinkStream{ctx: ctx}
+}
+
+// Config the audio config describing the encoded audio, valid after the first Encode
+func (s *downlinkStream) Config() voice.AudioConfig {
+	return s.config
+}
+
+// Encode transcode one chunk of tts output
+// Parameters:
+//   - chunk: the audio chunk, raw pcm or a whole wav sentence
+//   - format: the format of the chunk, from the provider that synthesized it
+//
+// Returns:
+//   - []byte: the encoded audio, may be empty
+//   - error: the error object if the transcode failed
+func (s *downlinkStream) Encode(chunk []byte, format tts.Format) ([]byte, error) {
+	if s.raw {
+		return chunk, nil
+	}
+
+	data := chunk
+	if audio.IsWAV(chunk) {
+		s.rest = nil // a whole sentence, starts on a sample boundary
+	} else {
+		data = append(s.rest, chunk...)
+		cut := len(data) - len(data)%2
+		s.rest = append([]byte(nil), data[cut:]...)
+		data = data[:cut]
+	}
+	pcm, ok, err := decodePCM(data, ttsAudioFormat(format), pipelineSampleRate, 1)
+	if err != nil {
+		return nil, fmt.Errorf("decode tts output: %w", err)
+	}
+	if !ok {
+		if s.ready {
+			return nil, fmt.Errorf("decode tts output: undecodable chunk in a pcm stream")
+		}
+		s.raw, s.ready = true, true
+		s.config = voice.AudioConfig{AudioFormat: ttsAudioFormat(format), AudioSampleRate: pipelineSampleRate, AudioChannel: 1}
+		return chunk, nil
+	}
+
+	if !s.ready {
+		format, sampleRate, channels := downlinkTarget(s.ctx, pcm)
+		s.config = voice.AudioConfig{AudioFormat: format, AudioSampleRate: uint16(sampleRate), AudioChannel: uint8(channels)}
+		s.ready = true
+	}
+	sampleRate, channels := int(s.config.AudioSampleRate), int(s.config.AudioChannel)
+	var prev []byte
+	if s.converter == nil || !s.converter.matches(pcm.sampleRate, pcm.channels) {
+		if s.converter != nil { // a wav sentence in another format, finish the previous one
+			prev = s.converter.Flush()
+		}
+		if s.converter, err = newPCMStream(pcm.sampleRate, pcm.channels, sampleRate, channels); err != nil {
+			return nil, fmt.Errorf("convert downlink to %dHz/%dch: %w", sampleRate, channels, err)
+		}
+	}
+	return s.encode(append(prev, s.converter.Convert(pcm.data)...))
+}
+
+// Flush encode the samples held back by the converter, called once the tts output ends
+// Returns:
+//   - []byte: the encoded audio, may be empty
+//   - error: the error object if the transcode failed
+func (s *downlinkStream) Flush() ([]byte, error) {
+	if s.raw || s.converter == nil {
+		return nil, nil
+	}
+	return s.encode(s.converter.Flush())
+}
+
+// encode encode the converted samples, the first wav output carries the RIFF header
+func (s *downlinkStream) encode(pcm []byte) ([]byte, error) {
+	out, format, err := encodeSamples(pcm, s.config.AudioFormat)
+	if err != nil {
+		return nil, err
+	}
+	s.config.AudioFormat = format
+	if format == mqttCommon.VoiceAudioFormatWav && !s.header {
+		s.header = true
+		out = append(audio.WrapPCM(nil, int(s.config.AudioSampleRate), int(s.config.AudioChannel)), out...)
+	}
+	return out, nil
+}
+
+// storageAudio the file extension and content to store the audio with
+// Raw pcm and g711 are wrapped in a wav container so the file is playable,
+// a real wav is kept as is and other formats use the extension of their label
+func storageAudio(data []byte, format uint8, sampleRate, channels int) (string, []byte) {
+	if audio.IsWAV(data) {
+		return "wav", data
+	}
+	if sampleRate <= 0 {
+		sampleRate = pipelineSampleRate
+	}
+	if channels <= 0 {
+		channels = 1
+	}
+	switch format {
+	case mqttCommon.VoiceAudioFormatPcm, mqttCommon.VoiceAudioFormatWav: // wav without the RIFF header is pcm
+		return "wav", audio.WrapPCM(data, sampleRate, channels)
+	case mqttCommon.VoiceAudioFormatG711A, mqttCommon.VoiceAudioFormatG711U:
+		enc, _ := encodingOf(format)
+		return "wav", audio.EncodeWAV(audio.NewWAVFormat(enc, sampleRate, channels), data)
+	default:
+		return mqttCommon.AudioFormatString(format), data
+	}
+}
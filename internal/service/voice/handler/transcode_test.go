@@ -0,0 +1,117 @@
+// 测试下行转码：逐句合成的 TTS 输出经同一个流式重采样器转换，拼接后与整段转换一致
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tts "yunyez/internal/pkg/agent/tts"
+	audio "yunyez/internal/pkg/media/audio"
+	mqttCommon "yunyez/internal/pkg/mqtt/common"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+func TestDownlinkStreamChunksMatchWhole(t *testing.T) {
+	header := &mqtt_voice.Header{AudioFormat: mqttCommon.VoiceAudioFormatPcm, SampleRate: 8000, Ch: 1}
+	ctx := mqtt_voice.WithHeader(context.Background(), header)
+
+	samples := make([]int16, pipelineSampleRate) // 1 秒
+	for i := range samples {
+		samples[i] = int16((i * 37) % 2000)
+	}
+	pcm := audio.Bytes(samples)
+
+	s := newDownlinkStream(ctx)
+	var out []byte
+	for off := 0; off < len(pcm); off += 2002 { // 每句 1001 个采样
+		data, err := s.Encode(audio.WrapPCM(pcm[off:min(off+2002, len(pcm))], pipelineSampleRate, 1), tts.FormatWAV)
+		require.NoError(t, err)
+		out = append(out, data...)
+	}
+	tail, err := s.Flush()
+	require.NoError(t, err)
+	out = append(out, tail...)
+
+	whole, err := convertPCM(pcm, pipelineSampleRate, 1, 8000, 1)
+	require.NoError(t, err)
+	assert.Len(t, out, 2*8000)
+	assert.Equal(t, whole, out)
+	assert.Equal(t, uint16(8000), s.Config().AudioSampleRate)
+}
+
+func TestDownlinkStreamDecodesByProviderFormat(t *testing.T) {
+	header := &mqtt_voice.Header{AudioFormat: mqttCommon.VoiceAudioFormatPcm, SampleRate: pipelineSampleRate, Ch: 1}
+	ctx := mqtt_voice.WithHeader(context.Background(), header)
+	first := audio.Bytes([]int16{1, 2, 3, 4})
+	second := audio.Bytes([]int16{5, 6, 7, 8})
+
+	// 第一句由 HTTP 服务合成（wav），第二句降级到 gRPC（裸 PCM）
+	s := newDownlinkStream(ctx)
+	out, err := s.Encode(audio.WrapPCM(first, pipelineSampleRate, 1), tts.FormatWAV)
+	require.NoError(t, err)
+	data, err := s.Encode(second, tts.FormatPCM)
+	require.NoError(t, err)
+	out = append(out, data...)
+	tail, err := s.Flush()
+	require.NoError(t, err)
+	out = append(out, tail...)
+
+	assert.Equal(t, append(first, second...), out)
+	assert.Equal(t, uint8(mqttCommon.VoiceAudioFormatPcm), s.Config().AudioFormat)
+
+	// 裸 PCM 按 gRPC 的格式解码，不作为 wav 原样转发
+	s = newDownlinkStream(ctx)
+	out, err = s.Encode(second, tts.FormatPCM)
+	require.NoError(t, err)
+	tail, err = s.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, second, append(out, tail...))
+	assert.Equal(t, uint8(mqttCommon.VoiceAudioFormatPcm), s.Config().AudioFormat)
+}
+
+func TestUplinkStreamsReorderAndResample(t *testing.T) {
+	samples := make([]int16, 8000) // 8kHz 1 秒
+	for i := range samples {
+		samples[i] = int16((i * 53) % 3000)
+	}
+	pcm := audio.Bytes(samples)
+	header := &mqtt_voice.Header{AudioFormat: mqttCommon.VoiceAudioFormatPcm, SampleRate: 8000, Ch: 1}
+
+	// 每个分片 320 个采样，第 1、2 个分片乱序到达
+	var frames [][]byte
+	for off := 0; off < len(pcm); off += 640 {
+		frames = append(frames, pcm[off:min(off+640, len(pcm))])
+	}
+	order := []uint32{0, 2, 1}
+	for seq := uint32(3); seq < uint32(len(frames)); seq++ {
+		order = append(order, seq)
+	}
+
+	m := newUplinkStreams()
+	key := utteranceKey(testClient, 1)
+	var out []byte
+	var seqs []uint32
+	for _, seq := range order {
+		h := *header
+		h.FrameSeq = seq
+		ok, err := m.decode(key, &h, frames[seq], func(seq uint32, pcm []byte) {
+			seqs = append(seqs, seq)
+			out = append(out, pcm...)
+		})
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	out = append(out, m.finish(key)...)
+
+	whole, err := convertPCM(pcm, 8000, 1, pipelineSampleRate, 1)
+	require.NoError(t, err)
+	assert.Len(t, out, 2*pipelineSampleRate)
+	assert.Equal(t, whole, out)
+	for i, seq := range seqs {
+		assert.Equal(t, uint32(i), seq)
+	}
+	assert.Nil(t, m.finish(key), "the stream is removed once finished")
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"sync"
+
+	logger "yunyez/internal/pkg/logger"
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+	turn "yunyez/internal/service/voice/turn"
+)
+
+// beginTurn 开始设备的新对话轮次，中止该设备进行中的轮次并通知设备停止播放
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//   - key: 语句键
+//
+// 返回值:
+//   - context.Context: 轮次上下文，轮次被中止时取消
+//   - *turn.Turn: 新轮次，处理结束后调用 endTurn
+func (p *VoicePipeline) beginTurn(ctx context.Context, clientID, key string) (context.Context, *turn.Turn) {
+	ctx, t, prev := p.turns.Begin(ctx, clientID, key)
+	if prev != nil {
+		logger.Info(ctx, "turn interrupted by a new utterance", map[string]any{
+			"clientID": clientID,
+			"turn":     prev.ID,
+			"key":      prev.Key,
+		})
+		_ = p.deps.Publisher.Stop(ctx, clientID)
+	}
+	return ctx, t
+}
+
+// endTurn 结束对话轮次
+// 轮次被打断或取消引起的错误不视为失败
+// 参数：
+//   - ctx: 轮次上下文
+//   - t: 对话轮次
+//   - err: 轮次处理返回的错误
+//
+// 返回值:
+//   - error: 处理失败的错误，轮次被中止时为 nil
+func (p *VoicePipeline) endTurn(ctx context.Context, t *turn.Turn, err error) error {
+	p.turns.End(t)
+	if cause := turn.Aborted(ctx, err); cause != nil {
+		logger.Info(ctx, "turn aborted", map[string]any{
+			"clientID": t.ClientID,
+			"turn":     t.ID,
+			"key":      t.Key,
+			"cause":    cause.Error(),
+		})
+		return nil
+	}
+	return err
+}
+
+// interruptTurn 用户开始说话时打断设备正在进行的回复（barge-in）
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+func (p *VoicePipeline) interruptTurn(ctx context.Context, clientID string) {
+	if !p.opts.BargeIn {
+		return
+	}
+	if t := p.turns.Cancel(clientID, turn.ErrInterrupted); t != nil {
+		logger.Info(ctx, "turn interrupted by user speech", map[string]any{
+			"clientID": clientID,
+			"turn":     t.ID,
+			"key":      t.Key,
+		})
+		_ = p.deps.Publisher.Stop(ctx, clientID)
+	}
+}
+
+// CancelTurn 取消设备正在进行的回复并通知设备停止播放
+// 没有进行中的回复时仍通知设备停止播放已缓存的音频
+// 参数：
+//   - ctx: 上下文对象
+//   - clientID: 客户端ID(设备序列号)
+//
+// 返回值:
+//   - error: 停止播放指令发送失败时返回错误
+func (p *VoicePipeline) CancelTurn(ctx context.Context, clientID string) error {
+	if t := p.turns.Cancel(clientID, turn.ErrCancelled); t != nil {
+		logger.Info(ctx, "turn cancelled", map[string]any{
+			"clientID": clientID,
+			"turn":     t.ID,
+			"key":      t.Key,
+		})
+	}
+	return p.deps.Publisher.Stop(ctx, clientID)
+}
+
+// utteranceStarts 每台设备最近上传分片的语句ID，用于识别新语句的首个分片
+type utteranceStarts struct {
+	mu       sync.Mutex
+	sessions map[string]uint32
+}
+
+func newUtteranceStarts() *utteranceStarts {
+	return &utteranceStarts{sessions: make(map[string]uint32)}
+}
+
+// first 分片是否为新语句的首个分片：序号为 0，或设备开始上传另一语句（v2 每句的会话ID不同）
+// 参数：
+//   - clientID: 客户端ID(设备序列号)
+//   - header: 分片帧的协议头
+//
+// 返回值:
+//   - bool: 是新语句的首个分片
+func (s *utteranceStarts) first(clientID string, header *mqtt_voice.Header) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.sessions[clientID]
+	s.sessions[clientID] = header.SessionID
+	return header.FrameSeq == 0 || !ok || last != header.SessionID
+}
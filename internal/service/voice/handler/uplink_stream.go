@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	mqtt_voice "yunyez/internal/pkg/mqtt/protocol/voice"
+)
+
+const (
+	uplinkStreamIdleTimeout = 10 * time.Second // 未正常结束的语句空闲超时清理时间
+	uplinkReorderWindow     = 8                // 等待缺失分片时最多缓存的分片数，超过后跳过缺口
+)
+
+// uplinkStreams 按语句（设备 + 语句ID）转码分片上传的音频
+// 分片按帧序号排序后经同一个流式重采样器转换为 16kHz 单声道 PCM，相邻分片的衔接与整句转换一致
+type uplinkStreams struct {
+	mu      sync.Mutex
+	streams map[string]*uplinkStream
+}
+
+// newUplinkStreams 创建分片上行音频的转码管理
+func newUplinkStreams() *uplinkStreams {
+	return &uplinkStreams{streams: make(map[string]*uplinkStream)}
+}
+
+// uplinkStream 单句语音的上行转码
+type uplinkStream struct {
+	mu        sync.Mutex
+	converter *pcmStream           // 首个分片确定源采样率与声道数后创建
+	next      uint32               // 下一个待转换的帧序号
+	pending   map[uint32]*pcmAudio // 乱序到达、等待转换的分片
+	lastSeen  time.Time
+}
+
+// decode 转码一个分片，按帧序号顺序输出已连续到达的分片
+// 输出在语句的锁内回调，同一语句并发到达的分片也按顺序输出
+// 参数：
+//   - key: 语句键
+//   - header: 分片的协议头
+//   - payload: 分片的音频
+//   - emit: 按序输出的 16kHz 单声道 PCM 及其帧序号，转换延迟使输出可能为空
+//
+// 返回值:
+//   - bool: 分片是否可转码为 PCM
+//   - error: 转码失败时返回错误
+func (m *uplinkStreams) decode(key string, header *mqtt_voice.Header, payload []byte, emit func(seq uint32, pcm []byte)) (bool, error) {
+	pcm, ok, err := decodeDevice(header, payload)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	s := m.stream(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if header.FrameSeq < s.next {
+		return true, nil
+	}
+	s.pending[header.FrameSeq] = pcm
+	if len(s.pending) > uplinkReorderWindow { // 缺失的分片不再等待
+		s.next = s.firstPending()
+	}
+	for {
+		chunk, ok := s.pending[s.next]
+		if !ok {
+			return true, nil
+		}
+		delete(s.pending, s.next)
+		seq := s.next
+		s.next++
+		out, err := s.convert(chunk)
+		if err != nil {
+			return true, err
+		}
+		emit(seq, out)
+	}
+}
+
+// finish 语句结束，跳过缺口按序转换剩余分片，并输出重采样器保留的尾部采样
+// 参数：
+//   - key: 语句键
+//
+// 返回值:
+//   - []byte: 剩余的 16kHz 单声道 PCM，语句未经过转码时为空
+func (m *uplinkStreams) finish(key string) []byte {
+	m.mu.Lock()
+	s, ok := m.streams[key]
+	delete(m.streams, key)
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seqs := make([]uint32, 0, len(s.pending))
+	for seq := range s.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	var out []byte
+	for _, seq := range seqs {
+		data, err := s.convert(s.pending[seq])
+		if err != nil {
+			break
+		}
+		out = append(out, data...)
+	}
+	s.pending = nil
+	if s.converter != nil {
+		out = append(out, s.converter.Flush()...)
+	}
+	return out
+}
+
+// drop 丢弃语句的上行转码
+func (m *uplinkStreams) drop(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams, key)
+}
+
+// stream 获取或创建语句的上行转码，同时清理空闲语句
+func (m *uplinkStreams) stream(key string) *uplinkStream {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, s := range m.streams {
+		if now.Sub(s.lastSeen) > uplinkStreamIdleTimeout {
+			delete(m.streams, k)
+		}
+	}
+
+	s, ok := m.streams[key]
+	if !ok {
+		s = &uplinkStream{pending: make(map[uint32]*pcmAudio)}
+		m.streams[key] = s
+	}
+	s.lastSeen = now
+	return s
+}
+
+// convert 转换一个分片，源采样率或声道数变化时结束上一段并重新开始
+func (s *uplinkStream) convert(pcm *pcmAudio) ([]byte, error) {
+	var out []byte
+	if s.converter == nil || !s.converter.matches(pcm.sampleRate, pcm.channels) {
+		if s.converter != nil {
+			out = s.converter.Flush()
+		}
+		converter, err := newPCMStream(pcm.sampleRate, pcm.channels, pipelineSampleRate, 1)
+		if err != nil {
+			return out, fmt.Errorf("normalize %dHz/%dch upload: %w", pcm.sampleRate, pcm.channels, err)
+		}
+		s.converter = converter
+	}
+	return append(out, s.converter.Convert(pcm.data)...), nil
+}
+
+// firstPending 缓存中最小的帧序号
+func (s *uplinkStream) firstPending() uint32 {
+	first := true
+	var low uint32
+	for seq := range s.pending {
+		if first || seq < low {
+			low, first = seq, false
+		}
+	}
+	return low
+}
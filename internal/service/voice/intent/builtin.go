@@ -0,0 +1,135 @@
+package intent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	constant "yunyez/internal/common/constant"
+	control "yunyez/internal/pkg/mqtt/protocol/control"
+)
+
+// 下发给设备的指令类型，参数约束见 control 包
+const (
+	CommandStopPlayback   = control.TypeStopPlayback   // 停止播放
+	CommandPlayMusic      = control.TypePlayMusic      // 播放音乐
+	CommandSetTemperature = control.TypeSetTemperature // 设置温度
+	CommandSetLight       = control.TypeSetLight       // 开关灯
+	CommandSetTimer       = control.TypeSetTimer       // 设置定时提醒
+)
+
+// 内置意图使用的实体
+const (
+	EntitySong        = "song"        // 歌曲名
+	EntityTemperature = "temperature" // 温度（摄氏度）
+)
+
+// 可设置的温度范围（摄氏度）
+const (
+	minTemperature = 16
+	maxTemperature = 30
+)
+
+// regTemperature 匹配 "26度"、"26.5 ℃" 等温度表达
+var regTemperature = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(?:度|℃|°C|°)`)
+
+// RegisterBuiltins 注册内置意图处理器
+// 参数：
+//   - r: 意图处理器注册表
+//
+// 返回值:
+//   - error: 注册失败时返回错误
+func RegisterBuiltins(r *Registry) error {
+	handlers := []Handler{
+		{
+			Intent: constant.IntentDenyAction,
+			Handle: handleDeny,
+		},
+		{
+			Intent: constant.IntentPlayMusic,
+			Handle: handlePlayMusic,
+		},
+		{
+			Intent:   constant.IntentSetTemperature,
+			Required: []string{EntityTemperature},
+			Extract:  extractTemperature,
+			Handle:   handleSetTemperature,
+		},
+		{
+			Intent: constant.IntentTurnOnLight,
+			Handle: lightHandler(true),
+		},
+		{
+			Intent: constant.IntentTurnOffLight,
+			Handle: lightHandler(false),
+		},
+	}
+	for _, h := range handlers {
+		if err := r.Register(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleDeny 取消：进行中的回复在本句开始时已被中止，这里通知设备停止播放已缓存的音频，不播报
+func handleDeny(ctx context.Context, req *Request, cmd Commander) (*Result, error) {
+	if err := cmd.Send(ctx, req.Device, CommandStopPlayback, nil); err != nil {
+		return nil, err
+	}
+	return &Result{}, nil
+}
+
+// handlePlayMusic 播放音乐，未指定歌曲时由设备随机播放
+func handlePlayMusic(ctx context.Context, req *Request, cmd Commander) (*Result, error) {
+	song := req.Entities[EntitySong]
+	params := map[string]any{}
+	if song != "" {
+		params[EntitySong] = song
+	}
+	if err := cmd.Send(ctx, req.Device, CommandPlayMusic, params); err != nil {
+		return nil, err
+	}
+	if song == "" {
+		return &Result{Reply: "好的，为你播放音乐"}, nil
+	}
+	return &Result{Reply: fmt.Sprintf("好的，为你播放%s", song)}, nil
+}
+
+// handleSetTemperature 设置温度，超出范围时只播报提示
+func handleSetTemperature(ctx context.Context, req *Request, cmd Commander) (*Result, error) {
+	value, err := strconv.ParseFloat(req.Entities[EntityTemperature], 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse temperature %q: %w", req.Entities[EntityTemperature], err)
+	}
+	if value < minTemperature || value > maxTemperature {
+		return &Result{Reply: fmt.Sprintf("温度只能设置在%d到%d度之间", minTemperature, maxTemperature)}, nil
+	}
+	if err := cmd.Send(ctx, req.Device, CommandSetTemperature, map[string]any{EntityTemperature: value}); err != nil {
+		return nil, err
+	}
+	return &Result{Reply: fmt.Sprintf("好的，温度已设置为%s度", strconv.FormatFloat(value, 'f', -1, 64))}, nil
+}
+
+// lightHandler 开关灯
+func lightHandler(on bool) func(ctx context.Context, req *Request, cmd Commander) (*Result, error) {
+	return func(ctx context.Context, req *Request, cmd Commander) (*Result, error) {
+		if err := cmd.Send(ctx, req.Device, CommandSetLight, map[string]any{"on": on}); err != nil {
+			return nil, err
+		}
+		if on {
+			return &Result{Reply: "好的，灯已打开"}, nil
+		}
+		return &Result{Reply: "好的，灯已关闭"}, nil
+	}
+}
+
+// extractTemperature 从文本中提取温度
+func extractTemperature(text string) map[string]string {
+	m := regTemperature.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+	return map[string]string{EntityTemperature: m[1]}
+}
@@ -0,0 +1,184 @@
+// Package intent 意图处理器注册表
+// 命令类意图（播放音乐、设置温度、开关灯等）按意图名注册处理器，
+// 注册时声明置信度阈值与必需实体；未注册、置信度不足或缺少实体的意图回退到闲聊
+package intent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrUnknownIntent  = errors.New("intent has no handler")
+	ErrLowConfidence  = errors.New("intent confidence below threshold")
+	ErrMissingEntity  = errors.New("intent missing required entity")
+	ErrInvalidHandler = errors.New("invalid intent handler")
+	ErrDuplicate      = errors.New("intent handler already registered")
+)
+
+// DefaultConfidence 处理器未声明置信度阈值时使用的默认阈值
+const DefaultConfidence = 0.6
+
+// Device 设备上下文
+type Device struct {
+	SN              string // 设备序列号
+	Vendor          string // 厂商名称
+	DeviceType      string // 设备类型
+	ProductModel    string // 产品型号
+	FirmwareVersion string // 固件版本
+}
+
+// Request 意图处理请求
+type Request struct {
+	Text       string            // 识别文本
+	Intent     string            // 意图
+	Confidence float32           // 置信度
+	Entities   map[string]string // 实体，处理器的 Extract 会补全缺失的实体
+	Device     Device            // 设备上下文
+}
+
+// Result 意图处理结果
+type Result struct {
+	Reply string // 语音确认，经 TTS 播报；为空时不播报
+}
+
+// Commander 向设备下发控制指令
+type Commander interface {
+	// Send 下发指令
+	// 参数：
+	//   - ctx: 上下文
+	//   - device: 目标设备
+	//   - command: 指令类型
+	//   - params: 指令参数
+	//
+	// 返回值:
+	//   - error: 下发失败时返回错误
+	Send(ctx context.Context, device Device, command string, params map[string]any) error
+}
+
+// Handler 意图处理器
+type Handler struct {
+	Intent        string                                                                  // 意图名
+	MinConfidence float32                                                                 // 置信度阈值，<= 0 时使用注册表的默认阈值
+	Required      []string                                                                // 必需实体
+	Extract       func(text string) map[string]string                                     // 从文本补全 NLU 未返回的实体，可为空
+	Handle        func(ctx context.Context, req *Request, cmd Commander) (*Result, error) // 处理函数
+}
+
+// Registry 意图处理器注册表
+type Registry struct {
+	DefaultConfidence float32 // 默认置信度阈值
+
+	mu       sync.RWMutex
+	handlers map[string]*Handler
+}
+
+// NewRegistry 创建意图处理器注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		DefaultConfidence: DefaultConfidence,
+		handlers:          make(map[string]*Handler),
+	}
+}
+
+// Register 注册意图处理器
+// 参数：
+//   - h: 意图处理器
+//
+// 返回值:
+//   - error: 意图名或处理函数为空、意图已注册时返回错误
+func (r *Registry) Register(h Handler) error {
+	if h.Intent == "" || h.Handle == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidHandler, h.Intent)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[h.Intent]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, h.Intent)
+	}
+	r.handlers[h.Intent] = &h
+	return nil
+}
+
+// Resolve 查找意图的处理器并校验置信度与必需实体
+// 实体缺失时先调用处理器的 Extract 从文本补全，补全结果写回 req.Entities
+// 参数：
+//   - req: 意图处理请求
+//
+// 返回值:
+//   - *Handler: 意图处理器
+//   - error: ErrUnknownIntent / ErrLowConfidence / ErrMissingEntity
+func (r *Registry) Resolve(req *Request) (*Handler, error) {
+	r.mu.RLock()
+	h, ok := r.handlers[req.Intent]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownIntent, req.Intent)
+	}
+
+	threshold := h.MinConfidence
+	if threshold <= 0 {
+		threshold = r.DefaultConfidence
+	}
+	if req.Confidence < threshold {
+		return nil, fmt.Errorf("%w: %s %.2f < %.2f", ErrLowConfidence, req.Intent, req.Confidence, threshold)
+	}
+
+	if h.Extract != nil && len(missing(h.Required, req.Entities)) > 0 {
+		if req.Entities == nil {
+			req.Entities = make(map[string]string)
+		}
+		for k, v := range h.Extract(req.Text) {
+			if req.Entities[k] == "" {
+				req.Entities[k] = v
+			}
+		}
+	}
+	if names := missing(h.Required, req.Entities); len(names) > 0 {
+		return nil, fmt.Errorf("%w: %s %v", ErrMissingEntity, req.Intent, names)
+	}
+	return h, nil
+}
+
+// Dispatch 查找处理器并处理意图
+// 参数：
+//   - ctx: 上下文
+//   - req: 意图处理请求
+//   - cmd: 设备指令下发
+//
+// 返回值:
+//   - *Result: 处理结果
+//   - error: Resolve 的错误（可用 Fallback 判断是否回退闲聊）或处理函数的错误
+func (r *Registry) Dispatch(ctx context.Context, req *Request, cmd Commander) (*Result, error) {
+	h, err := r.Resolve(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.Handle(ctx, req, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("handle intent %s: %w", req.Intent, err)
+	}
+	if res == nil {
+		res = &Result{}
+	}
+	return res, nil
+}
+
+// Fallback 判断 Dispatch 的错误是否应回退到闲聊
+func Fallback(err error) bool {
+	return errors.Is(err, ErrUnknownIntent) || errors.Is(err, ErrLowConfidence) || errors.Is(err, ErrMissingEntity)
+}
+
+// missing 缺失的必需实体
+func missing(required []string, entities map[string]string) []string {
+	var names []string
+	for _, name := range required {
+		if entities[name] == "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
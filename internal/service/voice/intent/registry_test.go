@@ -0,0 +1,102 @@
+// 测试意图处理器的注册、校验与内置处理器
+package intent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	constant "yunyez/internal/common/constant"
+)
+
+// fakeCommander 记录下发的指令
+type fakeCommander struct {
+	commands []string
+	params   []map[string]any
+}
+
+func (f *fakeCommander) Send(ctx context.Context, device Device, command string, params map[string]any) error {
+	f.commands = append(f.commands, command)
+	f.params = append(f.params, params)
+	return nil
+}
+
+func newBuiltinRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	if err := RegisterBuiltins(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegister(t *testing.T) {
+	r := newBuiltinRegistry(t)
+	if err := r.Register(Handler{Intent: constant.IntentPlayMusic, Handle: handlePlayMusic}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("got error %v, want %v", err, ErrDuplicate)
+	}
+	if err := r.Register(Handler{Intent: "x"}); !errors.Is(err, ErrInvalidHandler) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidHandler)
+	}
+}
+
+func TestDispatchFallback(t *testing.T) {
+	r := newBuiltinRegistry(t)
+	cmd := &fakeCommander{}
+	cases := []struct {
+		req  Request
+		want error
+	}{
+		{Request{Intent: constant.IntentChitChat, Confidence: 0.99}, ErrUnknownIntent},
+		{Request{Intent: constant.IntentPlayMusic, Confidence: 0.3}, ErrLowConfidence},
+		{Request{Intent: constant.IntentSetTemperature, Confidence: 0.9, Text: "把温度调高一点"}, ErrMissingEntity},
+	}
+	for _, c := range cases {
+		_, err := r.Dispatch(context.Background(), &c.req, cmd)
+		if !errors.Is(err, c.want) || !Fallback(err) {
+			t.Errorf("%s: got error %v, want %v", c.req.Intent, err, c.want)
+		}
+	}
+	if len(cmd.commands) != 0 {
+		t.Errorf("commands sent on fallback: %v", cmd.commands)
+	}
+}
+
+func TestDispatchSetTemperature(t *testing.T) {
+	r := newBuiltinRegistry(t)
+	cmd := &fakeCommander{}
+
+	// 实体由文本补全
+	req := &Request{Intent: constant.IntentSetTemperature, Confidence: 0.9, Text: "空调调到26度"}
+	res, err := r.Dispatch(context.Background(), req, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Reply != "好的，温度已设置为26度" {
+		t.Errorf("reply = %q", res.Reply)
+	}
+	if len(cmd.commands) != 1 || cmd.commands[0] != CommandSetTemperature || cmd.params[0][EntityTemperature] != 26.0 {
+		t.Errorf("commands = %v %v", cmd.commands, cmd.params)
+	}
+
+	// NLU 返回的实体优先，超出范围不下发
+	req = &Request{Intent: constant.IntentSetTemperature, Confidence: 0.9, Text: "调到26度",
+		Entities: map[string]string{EntityTemperature: "40"}}
+	if res, err = r.Dispatch(context.Background(), req, cmd); err != nil || res.Reply == "" {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	if len(cmd.commands) != 1 {
+		t.Errorf("out of range temperature sent: %v", cmd.params)
+	}
+}
+
+func TestDispatchDeny(t *testing.T) {
+	r := newBuiltinRegistry(t)
+	cmd := &fakeCommander{}
+	res, err := r.Dispatch(context.Background(), &Request{Intent: constant.IntentDenyAction, Confidence: 0.8}, cmd)
+	if err != nil || res.Reply != "" {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	if len(cmd.commands) != 1 || cmd.commands[0] != CommandStopPlayback {
+		t.Errorf("commands = %v", cmd.commands)
+	}
+}
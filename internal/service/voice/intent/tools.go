@@ -0,0 +1,184 @@
+package intent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	constant "yunyez/internal/common/constant"
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+// 内置工具名
+const (
+	ToolSetTemperature = "set_temperature" // 设置温度
+	ToolPlayMusic      = "play_music"      // 播放音乐
+	ToolSetTimer       = "set_timer"       // 设置定时提醒
+)
+
+// 定时提醒的时长范围（秒）
+const (
+	minTimerSeconds = 1
+	maxTimerSeconds = 86400
+)
+
+// DeviceFunc 查询设备上下文
+type DeviceFunc func(ctx context.Context, sn string) Device
+
+// IntentTool 将命令类意图声明为 LLM 工具
+// 工具参数作为意图实体，由注册的意图处理器执行，处理器的语音确认作为执行结果交给模型
+// 参数：
+//   - def: 工具声明，参数名与意图实体名一致
+//   - name: 意图名
+//   - cmd: 设备指令下发
+//   - device: 查询设备上下文
+//
+// 返回值:
+//   - tool.Tool: 工具
+func (r *Registry) IntentTool(def tool.Definition, name string, cmd Commander, device DeviceFunc) tool.Tool {
+	return tool.Tool{
+		Definition: def,
+		Run: func(ctx context.Context, clientID string, args map[string]any) (string, error) {
+			req := &Request{
+				Intent:     name,
+				Confidence: 1, // 模型主动调用，不再校验置信度
+				Entities:   entities(args),
+				Device:     device(ctx, clientID),
+			}
+			res, err := r.Dispatch(ctx, req, cmd)
+			if err != nil {
+				return "", err
+			}
+			return res.Reply, nil
+		},
+	}
+}
+
+// RegisterTools 注册内置工具
+// 设置温度与播放音乐经意图处理器执行，与 NLU 识别出的意图行为一致；设置定时提醒直接下发指令
+// 参数：
+//   - tools: 工具注册表
+//   - r: 意图处理器注册表，需已注册内置意图
+//   - cmd: 设备指令下发
+//   - device: 查询设备上下文
+//
+// 返回值:
+//   - error: 注册失败时返回错误
+func RegisterTools(tools *tool.Registry, r *Registry, cmd Commander, device DeviceFunc) error {
+	list := []tool.Tool{
+		r.IntentTool(tool.Definition{
+			Name:        ToolSetTemperature,
+			Description: "设置空调或温控设备的目标温度",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					EntityTemperature: map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("目标温度，单位摄氏度，范围 %d 到 %d", minTemperature, maxTemperature),
+					},
+				},
+				"required": []string{EntityTemperature},
+			},
+		}, constant.IntentSetTemperature, cmd, device),
+		r.IntentTool(tool.Definition{
+			Name:        ToolPlayMusic,
+			Description: "在设备上播放音乐，未指定歌曲时随机播放",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					EntitySong: map[string]any{
+						"type":        "string",
+						"description": "歌曲名，可包含歌手",
+					},
+				},
+			},
+		}, constant.IntentPlayMusic, cmd, device),
+		timerTool(cmd, device),
+	}
+	for _, t := range list {
+		if err := tools.Register(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timerTool 设置定时提醒，设备到时播放提醒
+func timerTool(cmd Commander, device DeviceFunc) tool.Tool {
+	return tool.Tool{
+		Definition: tool.Definition{
+			Name:        ToolSetTimer,
+			Description: "设置倒计时提醒，到时设备会播放提醒",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"seconds": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("倒计时秒数，范围 %d 到 %d", minTimerSeconds, maxTimerSeconds),
+					},
+					"label": map[string]any{
+						"type":        "string",
+						"description": "提醒内容，如 关火、出门",
+					},
+				},
+				"required": []string{"seconds"},
+			},
+		},
+		Run: func(ctx context.Context, clientID string, args map[string]any) (string, error) {
+			seconds, ok := args["seconds"].(float64)
+			if !ok {
+				return "", fmt.Errorf("%w: seconds is required", tool.ErrInvalidInput)
+			}
+			if seconds < minTimerSeconds || seconds > maxTimerSeconds {
+				return fmt.Sprintf("定时只能设置在%d秒到%d小时之间", minTimerSeconds, maxTimerSeconds/3600), nil
+			}
+			params := map[string]any{"seconds": float64(int(seconds))}
+			label, _ := args["label"].(string)
+			if label != "" {
+				params["label"] = label
+			}
+			if err := cmd.Send(ctx, device(ctx, clientID), CommandSetTimer, params); err != nil {
+				return "", err
+			}
+			if label == "" {
+				return fmt.Sprintf("好的，%s后提醒你", duration(int(seconds))), nil
+			}
+			return fmt.Sprintf("好的，%s后提醒你%s", duration(int(seconds)), label), nil
+		},
+	}
+}
+
+// entities 将工具参数转换为意图实体
+func entities(args map[string]any) map[string]string {
+	e := make(map[string]string, len(args))
+	for k, v := range args {
+		switch v := v.(type) {
+		case string:
+			e[k] = v
+		case float64:
+			e[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			e[k] = strconv.FormatBool(v)
+		case nil:
+		default:
+			e[k] = fmt.Sprint(v)
+		}
+	}
+	return e
+}
+
+// duration 时长的中文表达，如 1小时30分钟
+func duration(seconds int) string {
+	var b strings.Builder
+	if h := seconds / 3600; h > 0 {
+		fmt.Fprintf(&b, "%d小时", h)
+	}
+	if m := seconds % 3600 / 60; m > 0 {
+		fmt.Fprintf(&b, "%d分钟", m)
+	}
+	if s := seconds % 60; s > 0 || b.Len() == 0 {
+		fmt.Fprintf(&b, "%d秒", s)
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+// 测试内置工具经意图处理器与指令下发执行
+package intent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	tool "yunyez/internal/pkg/agent/tool"
+)
+
+func newToolRegistry(t *testing.T, cmd Commander) *tool.Registry {
+	tools := tool.NewRegistry()
+	device := func(ctx context.Context, sn string) Device { return Device{SN: sn} }
+	if err := RegisterTools(tools, newBuiltinRegistry(t), cmd, device); err != nil {
+		t.Fatal(err)
+	}
+	return tools
+}
+
+func TestToolSetTemperature(t *testing.T) {
+	cmd := &fakeCommander{}
+	tools := newToolRegistry(t, cmd)
+
+	got, err := tools.Execute(context.Background(), "sn1", tool.Call{Name: ToolSetTemperature, Arguments: `{"temperature":26.5}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "好的，温度已设置为26.5度" {
+		t.Errorf("got reply %q", got)
+	}
+	if len(cmd.commands) != 1 || cmd.commands[0] != CommandSetTemperature || cmd.params[0][EntityTemperature] != 26.5 {
+		t.Errorf("got commands %v %v", cmd.commands, cmd.params)
+	}
+
+	// 缺少参数时把错误交给模型
+	_, err = tools.Execute(context.Background(), "sn1", tool.Call{Name: ToolSetTemperature, Arguments: `{}`})
+	if !errors.Is(err, ErrMissingEntity) {
+		t.Errorf("got error %v, want %v", err, ErrMissingEntity)
+	}
+}
+
+func TestToolPlayMusic(t *testing.T) {
+	cmd := &fakeCommander{}
+	tools := newToolRegistry(t, cmd)
+
+	got, err := tools.Execute(context.Background(), "sn1", tool.Call{Name: ToolPlayMusic, Arguments: `{"song":"晴天"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "好的，为你播放晴天" || cmd.params[0][EntitySong] != "晴天" {
+		t.Errorf("got reply %q params %v", got, cmd.params)
+	}
+}
+
+func TestToolSetTimer(t *testing.T) {
+	cmd := &fakeCommander{}
+	tools := newToolRegistry(t, cmd)
+
+	got, err := tools.Execute(context.Background(), "sn1", tool.Call{Name: ToolSetTimer, Arguments: `{"seconds":5400,"label":"关火"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "好的，1小时30分钟后提醒你关火" {
+		t.Errorf("got reply %q", got)
+	}
+	if cmd.commands[0] != CommandSetTimer || cmd.params[0]["seconds"] != float64(5400) || cmd.params[0]["label"] != "关火" {
+		t.Errorf("got commands %v %v", cmd.commands, cmd.params)
+	}
+
+	// 超出范围时只提示，不下发
+	got, err = tools.Execute(context.Background(), "sn1", tool.Call{Name: ToolSetTimer, Arguments: `{"seconds":0}`})
+	if err != nil || got == "" || len(cmd.commands) != 1 {
+		t.Errorf("got reply %q error %v commands %v", got, err, cmd.commands)
+	}
+	_, err = tools.Execute(context.Background(), "sn1", tool.Call{Name: ToolSetTimer, Arguments: `{"seconds":"ten"}`})
+	if !errors.Is(err, tool.ErrInvalidInput) {
+		t.Errorf("got error %v, want %v", err, tool.ErrInvalidInput)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	cases := map[int]string{0: "0秒", 45: "45秒", 60: "1分钟", 3661: "1小时1分钟1秒"}
+	for seconds, want := range cases {
+		if got := duration(seconds); got != want {
+			t.Errorf("duration(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
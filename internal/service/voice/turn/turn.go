@@ -0,0 +1,127 @@
+// Package turn 对话轮次管理
+// 每台设备同一时刻只有一个进行中的轮次（识别之后的 LLM、TTS 与下发），
+// 轮次持有可取消的上下文：设备发送取消指令或开始新的语句时中止当前轮次（打断 barge-in）
+package turn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInterrupted = errors.New("turn interrupted by a new utterance") // 用户开始新的语句
+	ErrCancelled   = errors.New("turn cancelled by the device")        // 设备发送取消指令
+)
+
+// Turn 一个对话轮次
+type Turn struct {
+	ID        uint64    // 轮次序号，单调递增
+	ClientID  string    // 设备序列号
+	Key       string    // 语句键 设备序列号/语句ID
+	StartedAt time.Time // 开始时间
+
+	cancel context.CancelCauseFunc
+}
+
+// Registry 按设备管理进行中的对话轮次
+type Registry struct {
+	mu    sync.Mutex
+	seq   uint64
+	turns map[string]*Turn
+}
+
+// NewRegistry 创建轮次管理器
+func NewRegistry() *Registry {
+	return &Registry{turns: make(map[string]*Turn)}
+}
+
+// Begin 开始设备的新轮次，并以 ErrInterrupted 中止该设备进行中的轮次
+// 参数：
+//   - ctx: 父上下文
+//   - clientID: 设备序列号
+//   - key: 语句键
+//
+// 返回值:
+//   - context.Context: 轮次上下文，轮次被中止时取消，context.Cause 为中止原因
+//   - *Turn: 新轮次，处理结束后调用 End
+//   - *Turn: 被中止的轮次，没有时为 nil
+func (r *Registry) Begin(ctx context.Context, clientID, key string) (context.Context, *Turn, *Turn) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	t := &Turn{ID: r.seq, ClientID: clientID, Key: key, StartedAt: time.Now(), cancel: cancel}
+	prev := r.turns[clientID]
+	if prev != nil {
+		prev.cancel(ErrInterrupted)
+	}
+	r.turns[clientID] = t
+	return ctx, t, prev
+}
+
+// End 结束轮次，释放其上下文
+// 设备已开始新的轮次时不影响新轮次
+func (r *Registry) End(t *Turn) {
+	if t == nil {
+		return
+	}
+	t.cancel(context.Canceled)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.turns[t.ClientID] == t {
+		delete(r.turns, t.ClientID)
+	}
+}
+
+// Cancel 中止设备进行中的轮次
+// 参数：
+//   - clientID: 设备序列号
+//   - cause: 中止原因，为 nil 时使用 ErrCancelled
+//
+// 返回值:
+//   - *Turn: 被中止的轮次，没有进行中的轮次时为 nil
+func (r *Registry) Cancel(clientID string, cause error) *Turn {
+	if cause == nil {
+		cause = ErrCancelled
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.turns[clientID]
+	if t == nil {
+		return nil
+	}
+	t.cancel(cause)
+	delete(r.turns, clientID)
+	return t
+}
+
+// Current 设备进行中的轮次，没有时为 nil
+func (r *Registry) Current(clientID string) *Turn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.turns[clientID]
+}
+
+// Aborted 判断错误是否由轮次中止引起
+// 参数：
+//   - ctx: 轮次上下文
+//   - err: 处理过程返回的错误
+//
+// 返回值:
+//   - error: 中止原因（ErrInterrupted / ErrCancelled），不是中止引起时为 nil
+func Aborted(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return nil
+	}
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrInterrupted) || errors.Is(cause, ErrCancelled) {
+		return cause
+	}
+	return nil
+}
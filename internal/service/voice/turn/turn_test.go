@@ -0,0 +1,64 @@
+// 测试对话轮次的开始、打断与取消
+package turn
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBeginInterruptsPrevious(t *testing.T) {
+	r := NewRegistry()
+
+	ctx1, t1, prev := r.Begin(context.Background(), "A0001", "A0001/1")
+	if prev != nil {
+		t.Fatal("first turn interrupted nothing")
+	}
+	// 其他设备互不影响
+	ctxOther, _, _ := r.Begin(context.Background(), "A0002", "A0002/1")
+
+	ctx2, t2, prev := r.Begin(context.Background(), "A0001", "A0001/2")
+	if prev != t1 {
+		t.Fatalf("interrupted %v, want %v", prev, t1)
+	}
+	if !errors.Is(context.Cause(ctx1), ErrInterrupted) {
+		t.Errorf("cause = %v, want %v", context.Cause(ctx1), ErrInterrupted)
+	}
+	if cause := Aborted(ctx1, ctx1.Err()); !errors.Is(cause, ErrInterrupted) {
+		t.Errorf("Aborted = %v", cause)
+	}
+	if ctx2.Err() != nil || ctxOther.Err() != nil {
+		t.Error("current turns cancelled")
+	}
+
+	// 旧轮次结束不影响新轮次
+	r.End(t1)
+	if r.Current("A0001") != t2 {
+		t.Error("ending a stale turn removed the current one")
+	}
+	r.End(t2)
+	if r.Current("A0001") != nil || ctx2.Err() == nil {
+		t.Error("ended turn still current")
+	}
+	// 正常结束不是中止
+	if cause := Aborted(ctx2, ctx2.Err()); cause != nil {
+		t.Errorf("Aborted = %v, want nil", cause)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	r := NewRegistry()
+	if r.Cancel("A0001", nil) != nil {
+		t.Fatal("cancelled a turn that doesn't exist")
+	}
+	ctx, tn, _ := r.Begin(context.Background(), "A0001", "A0001/1")
+	if got := r.Cancel("A0001", nil); got != tn {
+		t.Fatalf("cancelled %v, want %v", got, tn)
+	}
+	if !errors.Is(context.Cause(ctx), ErrCancelled) {
+		t.Errorf("cause = %v, want %v", context.Cause(ctx), ErrCancelled)
+	}
+	if r.Current("A0001") != nil {
+		t.Error("cancelled turn still current")
+	}
+}
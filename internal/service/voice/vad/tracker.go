@@ -0,0 +1,78 @@
+package vad
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker 按语句（设备 + 会话）管理端点检测器
+// 空闲超过 IdleTimeout 的检测器在下次 Feed 时被清理，避免未正常结束的语句泄漏
+type Tracker struct {
+	cfg         Config
+	IdleTimeout time.Duration
+
+	mu        sync.Mutex
+	detectors map[string]*trackedDetector
+}
+
+type trackedDetector struct {
+	detector *Detector
+	lastSeen time.Time
+}
+
+// NewTracker 创建检测器管理器
+func NewTracker(cfg Config) *Tracker {
+	return &Tracker{
+		cfg:         cfg,
+		IdleTimeout: 10 * time.Second,
+		detectors:   make(map[string]*trackedDetector),
+	}
+}
+
+// Feed 向语句对应的检测器输入 PCM
+// 检测到结束事件后自动移除该语句的检测器
+// 参数：
+//   - key: 语句键
+//   - pcm: 16 位小端单声道 PCM
+//
+// 返回值:
+//   - Event: 检测事件
+func (t *Tracker) Feed(key string, pcm []byte) Event {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for k, td := range t.detectors {
+		if now.Sub(td.lastSeen) > t.IdleTimeout {
+			delete(t.detectors, k)
+		}
+	}
+
+	td, ok := t.detectors[key]
+	if !ok {
+		td = &trackedDetector{detector: NewDetector(t.cfg)}
+		t.detectors[key] = td
+	}
+	td.lastSeen = now
+
+	event := td.detector.Write(pcm)
+	if event.Ended() {
+		delete(t.detectors, key)
+	}
+	return event
+}
+
+// Remove 移除语句的检测器（语句已由其他途径结束）
+func (t *Tracker) Remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.detectors, key)
+}
+
+// Len 当前跟踪的语句数
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.detectors)
+}
@@ -0,0 +1,280 @@
+// Package vad 语音活动检测（Voice Activity Detection）
+// 基于短时能量与过零率判断每个分析帧是否为语音，
+// 通过起始确认时间、静音拖尾（hangover）与最长语句限制完成端点检测，
+// 并提供去除首尾静音的工具函数，减少送入 ASR 的音频时长
+package vad
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Event 端点检测事件
+type Event int
+
+const (
+	EventNone        Event = iota // 无状态变化
+	EventSpeechStart              // 检测到语音开始
+	EventSpeechEnd                // 语音结束（静音超过拖尾时间）
+	EventMaxLength                // 语句超过最长时间，强制结束
+)
+
+// String 事件名称
+func (e Event) String() string {
+	switch e {
+	case EventSpeechStart:
+		return "speech_start"
+	case EventSpeechEnd:
+		return "speech_end"
+	case EventMaxLength:
+		return "max_length"
+	default:
+		return "none"
+	}
+}
+
+// Ended 是否为结束事件
+func (e Event) Ended() bool {
+	return e == EventSpeechEnd || e == EventMaxLength
+}
+
+// Config VAD 配置
+// 输入音频为 16 位小端单声道 PCM
+type Config struct {
+	SampleRate      int           // 采样率
+	FrameDuration   time.Duration // 分析帧时长
+	EnergyThreshold float64       // 语音帧的最小 RMS 幅度（0~32767）
+	ZCRThreshold    float64       // 语音帧的最大过零率（0~1），能量超过 3 倍阈值时不检查；<= 0 时不检查
+	MinSpeech       time.Duration // 连续语音帧达到该时长才确认语音开始，过滤短促噪声
+	Hangover        time.Duration // 语音开始后静音持续该时长判定为语音结束
+	MaxUtterance    time.Duration // 语音开始后的最长持续时间
+	Padding         time.Duration // Trim 时在语音首尾保留的静音时长
+}
+
+// DefaultConfig 默认配置
+// RMS 300 约为 -40 dBFS
+func DefaultConfig() Config {
+	return Config{
+		SampleRate:      16000,
+		FrameDuration:   20 * time.Millisecond,
+		EnergyThreshold: 300,
+		ZCRThreshold:    0.35,
+		MinSpeech:       60 * time.Millisecond,
+		Hangover:        700 * time.Millisecond,
+		MaxUtterance:    15 * time.Second,
+		Padding:         200 * time.Millisecond,
+	}
+}
+
+// normalize 填充未设置的配置项
+func (c Config) normalize() Config {
+	def := DefaultConfig()
+	if c.SampleRate <= 0 {
+		c.SampleRate = def.SampleRate
+	}
+	if c.FrameDuration <= 0 {
+		c.FrameDuration = def.FrameDuration
+	}
+	if c.EnergyThreshold <= 0 {
+		c.EnergyThreshold = def.EnergyThreshold
+	}
+	if c.MinSpeech <= 0 {
+		c.MinSpeech = c.FrameDuration
+	}
+	if c.Hangover <= 0 {
+		c.Hangover = def.Hangover
+	}
+	if c.MaxUtterance <= 0 {
+		c.MaxUtterance = def.MaxUtterance
+	}
+	return c
+}
+
+// frameBytes 单个分析帧的字节数
+func (c Config) frameBytes() int {
+	samples := int(int64(c.SampleRate) * int64(c.FrameDuration) / int64(time.Second))
+	if samples <= 0 {
+		samples = 1
+	}
+	return samples * 2
+}
+
+// Analyze 计算一帧 PCM 的 RMS 幅度与过零率
+// 参数：
+//   - frame: 16 位小端单声道 PCM
+//
+// 返回值:
+//   - float64: RMS 幅度
+//   - float64: 过零率（相邻采样符号变化的比例）
+func Analyze(frame []byte) (float64, float64) {
+	n := len(frame) / 2
+	if n == 0 {
+		return 0, 0
+	}
+	var sum float64
+	var crossings int
+	var prev int16
+	for i := 0; i < n; i++ {
+		s := int16(binary.LittleEndian.Uint16(frame[2*i:]))
+		sum += float64(s) * float64(s)
+		if i > 0 && (s >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = s
+	}
+	return math.Sqrt(sum / float64(n)), float64(crossings) / float64(n)
+}
+
+// IsSpeech 判断一帧 PCM 是否为语音
+// 能量低于阈值为静音；能量略高于阈值但过零率很高时视为噪声（如风噪、嘶声）
+func (c Config) IsSpeech(frame []byte) bool {
+	rms, zcr := Analyze(frame)
+	if rms < c.EnergyThreshold {
+		return false
+	}
+	if c.ZCRThreshold > 0 && zcr > c.ZCRThreshold && rms < 3*c.EnergyThreshold {
+		return false
+	}
+	return true
+}
+
+// Detector 流式端点检测器
+// 非并发安全，每句语音使用一个实例
+type Detector struct {
+	cfg       Config
+	frameSize int
+
+	pending  []byte        // 未满一帧的数据
+	speaking bool          // 是否已确认语音开始
+	ended    bool          // 是否已判定结束
+	voiced   time.Duration // 连续语音时长（确认开始前）
+	silence  time.Duration // 连续静音时长（确认开始后）
+	speech   time.Duration // 语音开始后的总时长
+}
+
+// NewDetector 创建端点检测器
+func NewDetector(cfg Config) *Detector {
+	cfg = cfg.normalize()
+	return &Detector{cfg: cfg, frameSize: cfg.frameBytes()}
+}
+
+// Write 输入一段 PCM 并返回本次输入中最重要的事件
+// 结束事件只返回一次，结束后的输入被忽略
+// 参数：
+//   - pcm: 16 位小端单声道 PCM，长度任意
+//
+// 返回值:
+//   - Event: 结束事件 > 开始事件 > 无事件
+func (d *Detector) Write(pcm []byte) Event {
+	if d.ended {
+		return EventNone
+	}
+	d.pending = append(d.pending, pcm...)
+
+	event := EventNone
+	offset := 0
+	for ; len(d.pending)-offset >= d.frameSize; offset += d.frameSize {
+		if e := d.process(d.pending[offset : offset+d.frameSize]); e != EventNone {
+			event = e
+		}
+		if d.ended {
+			offset += d.frameSize
+			break
+		}
+	}
+	d.pending = append(d.pending[:0], d.pending[offset:]...)
+	return event
+}
+
+// process 处理一个分析帧
+func (d *Detector) process(frame []byte) Event {
+	speech := d.cfg.IsSpeech(frame)
+	dur := d.cfg.FrameDuration
+
+	if !d.speaking {
+		if !speech {
+			d.voiced = 0
+			return EventNone
+		}
+		d.voiced += dur
+		if d.voiced < d.cfg.MinSpeech {
+			return EventNone
+		}
+		d.speaking = true
+		d.speech = d.voiced
+		return EventSpeechStart
+	}
+
+	d.speech += dur
+	if speech {
+		d.silence = 0
+	} else {
+		d.silence += dur
+	}
+	switch {
+	case d.silence >= d.cfg.Hangover:
+		d.ended = true
+		return EventSpeechEnd
+	case d.speech >= d.cfg.MaxUtterance:
+		d.ended = true
+		return EventMaxLength
+	}
+	return EventNone
+}
+
+// Speaking 是否已检测到语音
+func (d *Detector) Speaking() bool {
+	return d.speaking
+}
+
+// Ended 是否已判定结束
+func (d *Detector) Ended() bool {
+	return d.ended
+}
+
+// Reset 重置检测器状态
+func (d *Detector) Reset() {
+	*d = Detector{cfg: d.cfg, frameSize: d.frameSize}
+}
+
+// Trim 去除首尾静音
+// 以分析帧为单位查找首个与最后一个语音帧，并在两端保留 Padding 时长
+// 参数：
+//   - pcm: 16 位小端单声道 PCM
+//   - cfg: VAD 配置
+//
+// 返回值:
+//   - []byte: 去除首尾静音后的 PCM（与入参共享底层数组），无语音时返回 nil
+func Trim(pcm []byte, cfg Config) []byte {
+	cfg = cfg.normalize()
+	size := cfg.frameBytes()
+
+	first, last := -1, -1
+	for i := 0; i*size < len(pcm); i++ {
+		end := (i + 1) * size
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		if cfg.IsSpeech(pcm[i*size : end]) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+
+	padding := int(int64(cfg.SampleRate)*int64(cfg.Padding)/int64(time.Second)) * 2
+	start := first*size - padding
+	if start < 0 {
+		start = 0
+	}
+	end := (last+1)*size + padding
+	if end > len(pcm) {
+		end = len(pcm)
+	}
+	return pcm[start:end]
+}
@@ -0,0 +1,132 @@
+// 测试语音活动检测与端点检测
+package vad
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+const rate = 16000
+
+// tone 生成指定时长的正弦波 PCM（模拟浊音）
+func tone(d time.Duration, amp float64) []byte {
+	n := int(int64(rate) * int64(d) / int64(time.Second))
+	out := make([]byte, 2*n)
+	for i := 0; i < n; i++ {
+		s := int16(amp * math.Sin(2*math.Pi*200*float64(i)/rate))
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(s))
+	}
+	return out
+}
+
+// noise 生成指定时长的白噪声 PCM（过零率高）
+func noise(d time.Duration, amp float64) []byte {
+	n := int(int64(rate) * int64(d) / int64(time.Second))
+	out := make([]byte, 2*n)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < n; i++ {
+		s := int16((r.Float64()*2 - 1) * amp)
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(s))
+	}
+	return out
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestIsSpeech(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.IsSpeech(tone(20*time.Millisecond, 50)) {
+		t.Error("quiet tone classified as speech")
+	}
+	if !cfg.IsSpeech(tone(20*time.Millisecond, 3000)) {
+		t.Error("loud tone not classified as speech")
+	}
+	// 能量略高于阈值的白噪声被过零率过滤
+	if cfg.IsSpeech(noise(20*time.Millisecond, 800)) {
+		t.Error("hiss classified as speech")
+	}
+}
+
+func TestDetectorEndpoint(t *testing.T) {
+	cfg := DefaultConfig()
+	d := NewDetector(cfg)
+
+	// 短促噪声不触发语音开始
+	if e := d.Write(concat(tone(300*time.Millisecond, 0), tone(40*time.Millisecond, 3000), tone(100*time.Millisecond, 0))); e != EventNone {
+		t.Fatalf("blip triggered %v", e)
+	}
+
+	// 按 10ms 分块流式输入
+	audio := concat(tone(500*time.Millisecond, 3000), tone(time.Second, 0))
+	var events []Event
+	for off := 0; off < len(audio); off += 320 {
+		if e := d.Write(audio[off:min(off+320, len(audio))]); e != EventNone {
+			events = append(events, e)
+		}
+	}
+	if len(events) != 2 || events[0] != EventSpeechStart || events[1] != EventSpeechEnd {
+		t.Fatalf("events = %v", events)
+	}
+	if !d.Ended() || d.Write(tone(time.Second, 3000)) != EventNone {
+		t.Error("detector should ignore input after end")
+	}
+
+	d.Reset()
+	if d.Speaking() || d.Ended() {
+		t.Error("reset did not clear state")
+	}
+}
+
+func TestDetectorMaxUtterance(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxUtterance = 500 * time.Millisecond
+	d := NewDetector(cfg)
+	if e := d.Write(tone(time.Second, 3000)); e != EventMaxLength {
+		t.Errorf("event = %v, want %v", e, EventMaxLength)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	cfg := DefaultConfig()
+	speech := tone(400*time.Millisecond, 3000)
+	pcm := concat(tone(time.Second, 0), speech, tone(time.Second, 0))
+
+	trimmed := Trim(pcm, cfg)
+	want := len(speech) + 2*int(rate*cfg.Padding/time.Second)*2
+	if d := len(trimmed) - want; d < -640 || d > 640 {
+		t.Errorf("trimmed length %d, want ~%d", len(trimmed), want)
+	}
+	if Trim(tone(time.Second, 10), cfg) != nil {
+		t.Error("silence should trim to nil")
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(DefaultConfig())
+	if e := tracker.Feed("A0001/1", tone(200*time.Millisecond, 3000)); e != EventSpeechStart {
+		t.Fatalf("event = %v", e)
+	}
+	tracker.Feed("A0002/1", tone(20*time.Millisecond, 0))
+	if e := tracker.Feed("A0001/1", tone(time.Second, 0)); e != EventSpeechEnd {
+		t.Fatalf("event = %v", e)
+	}
+	if tracker.Len() != 1 {
+		t.Errorf("ended detector not removed, len = %d", tracker.Len())
+	}
+
+	tracker.IdleTimeout = 0
+	time.Sleep(time.Millisecond)
+	tracker.Feed("A0003/1", nil)
+	if tracker.Len() != 1 {
+		t.Errorf("idle detectors not removed, len = %d", tracker.Len())
+	}
+}
@@ -0,0 +1,37 @@
+// Package conversation 对话记录请求与响应类型
+package conversation
+
+import (
+	conversationModel "yunyez/internal/model/conversation"
+	types "yunyez/internal/types/common"
+)
+
+// ConversationListRequest 会话查询请求
+type ConversationListRequest struct {
+	Page types.Page `form:",inline"`
+}
+
+// ConversationListResponse 会话查询响应
+type ConversationListResponse struct {
+	Page  types.Page                        `json:"page,inline"`
+	Total int                               `json:"total"`
+	List  []*conversationModel.Conversation `json:"list"`
+}
+
+// TurnListRequest 对话查询请求
+type TurnListRequest struct {
+	Page  types.Page `form:",inline"`
+	Query string     `form:"q" binding:"max=128"` // 全文检索关键词，支持引号、OR、-
+}
+
+// TurnListResponse 对话查询响应
+type TurnListResponse struct {
+	Page  types.Page                `json:"page,inline"`
+	Total int                       `json:"total"`
+	List  []*conversationModel.Turn `json:"list"`
+}
+
+// ClearHistoryResponse 清空对话记录响应
+type ClearHistoryResponse struct {
+	Deleted int64 `json:"deleted"` // 删除的对话轮数
+}
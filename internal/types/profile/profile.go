@@ -0,0 +1,39 @@
+// Package profile 设备画像请求与响应类型
+package profile
+
+import "time"
+
+// ProfileUpdateRequest 设备画像更新请求，为空的字段不更新
+type ProfileUpdateRequest struct {
+	UserID     *int64  `json:"userId"`     // 绑定用户ID
+	UserName   *string `json:"userName"`   // 用户称呼
+	DeviceName *string `json:"deviceName"` // 设备名称，即助手的名字
+	Location   *string `json:"location"`   // 设备位置
+	Timezone   *string `json:"timezone"`   // 时区（IANA 名称，如 Asia/Shanghai）
+	Language   *string `json:"language"`   // 语言（如 zh-CN）
+}
+
+// FactItem 需要长期记住的事实
+type FactItem struct {
+	Key        string     `json:"key" binding:"required"`   // 事实键，小写字母、数字与下划线
+	Value      string     `json:"value" binding:"required"` // 事实内容
+	Source     string     `json:"source,omitempty"`         // 来源：admin / llm
+	UpdateTime *time.Time `json:"updateTime,omitempty"`     // 更新时间
+}
+
+// FactSaveRequest 事实保存请求
+type FactSaveRequest struct {
+	Facts []FactItem `json:"facts" binding:"required,min=1,dive"`
+}
+
+// ProfileInfo 设备画像
+type ProfileInfo struct {
+	SN         string     `json:"sn"`
+	UserID     *int64     `json:"userId,omitempty"`
+	UserName   string     `json:"userName,omitempty"`
+	DeviceName string     `json:"deviceName,omitempty"`
+	Location   string     `json:"location,omitempty"`
+	Timezone   string     `json:"timezone"`
+	Language   string     `json:"language"`
+	Facts      []FactItem `json:"facts"`
+}
@@ -0,0 +1,11 @@
+// Package prompt 系统提示词模板请求与响应类型
+package prompt
+
+// TemplateSaveRequest 覆盖模板保存请求，同一范围同一目标覆盖旧模板
+type TemplateSaveRequest struct {
+	Scope   string `json:"scope" binding:"required,oneof=vendor device_type device"` // 覆盖范围：vendor / device_type / device
+	Target  string `json:"target" binding:"required,max=64"`                         // 覆盖目标：厂商名称、设备类型或设备序列号
+	Content string `json:"content" binding:"required"`                               // 模板内容（text/template 语法）
+	Enabled *bool  `json:"enabled"`                                                  // 是否启用，默认启用
+	Remark  string `json:"remark" binding:"max=255"`                                 // 备注
+}
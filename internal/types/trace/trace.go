@@ -0,0 +1,26 @@
+// Package trace 语音处理流程轮次记录请求与响应类型
+package trace
+
+import (
+	"time"
+
+	traceModel "yunyez/internal/model/trace"
+	types "yunyez/internal/types/common"
+)
+
+// TurnListRequest 轮次记录查询请求，时间为 RFC3339 格式
+type TurnListRequest struct {
+	Page         types.Page `form:",inline"`
+	SN           string     `form:"sn"`                                            // 设备序列号
+	Start        time.Time  `form:"start" time_format:"2006-01-02T15:04:05Z07:00"` // 开始时间不早于
+	End          time.Time  `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`   // 开始时间早于
+	MinLatencyMS int64      `form:"minLatencyMs" binding:"min=0"`                  // 首个合成音频的最小毫秒数
+	ErrorOnly    bool       `form:"errorOnly"`                                     // 只查询出错的轮次
+}
+
+// TurnListResponse 轮次记录查询响应
+type TurnListResponse struct {
+	Page  types.Page               `json:"page,inline"`
+	Total int                      `json:"total"`
+	List  []*traceModel.TurnRecord `json:"list"`
+}
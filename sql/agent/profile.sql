@@ -0,0 +1,30 @@
+-- migration: 20261016_create_device_profile.up.sql
+-- 设备与绑定用户的长期画像
+CREATE TABLE IF NOT EXISTS device_profile (
+    id BIGSERIAL PRIMARY KEY,
+    device_sn VARCHAR(64) NOT NULL UNIQUE,
+    user_id BIGINT,
+    user_name VARCHAR(64),
+    device_name VARCHAR(64),
+    location VARCHAR(128),
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Shanghai',
+    language VARCHAR(16) NOT NULL DEFAULT 'zh-CN',
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_profile_user_id ON device_profile(user_id);
+CREATE INDEX IF NOT EXISTS idx_device_profile_deleted_at ON device_profile(deleted_at);
+
+-- 需要长期记住的事实（姓名、偏好、习惯），同一设备同一键只保留最新值
+CREATE TABLE IF NOT EXISTS device_profile_fact (
+    id BIGSERIAL PRIMARY KEY,
+    device_sn VARCHAR(64) NOT NULL,
+    fact_key VARCHAR(32) NOT NULL,
+    fact_value VARCHAR(255) NOT NULL,
+    source VARCHAR(16) NOT NULL DEFAULT 'admin',  -- admin: 管理后台录入 / llm: 对话中提取
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uk_profile_fact UNIQUE (device_sn, fact_key)
+);
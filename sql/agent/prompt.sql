@@ -0,0 +1,14 @@
+-- migration: 20261016_create_prompt_template.up.sql
+-- 系统提示词覆盖模板，按 厂商 → 设备类型 → 设备 逐级覆盖，修改后无需重启即可生效
+CREATE TABLE IF NOT EXISTS prompt_template (
+    id BIGSERIAL PRIMARY KEY,
+    scope VARCHAR(16) NOT NULL,  -- vendor: 厂商 / device_type: 设备类型 / device: 单台设备
+    target VARCHAR(64) NOT NULL, -- 厂商名称、设备类型或设备序列号
+    content TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    remark VARCHAR(255),
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uk_prompt_template UNIQUE (scope, target),
+    CONSTRAINT ck_prompt_template_scope CHECK (scope IN ('vendor', 'device_type', 'device'))
+);
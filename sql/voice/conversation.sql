@@ -0,0 +1,63 @@
+-- migration: 20261017_create_voice_conversation.up.sql
+-- 设备的对话会话：设备在对话记忆有效期内持续对话为同一会话
+CREATE TABLE IF NOT EXISTS voice_conversation (
+    id BIGSERIAL PRIMARY KEY,
+    device_sn VARCHAR(64) NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,      -- 首轮对话时间
+    last_time TIMESTAMPTZ NOT NULL,       -- 最近一轮对话时间
+    turn_count INTEGER NOT NULL DEFAULT 0,
+    create_time TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_voice_conversation_sn_last ON voice_conversation(device_sn, last_time);
+
+-- 对话检索的文本搜索配置 voice_search：安装了 zhparser 或 pg_jieba 时使用中文分词，
+-- 否则复制 simple（中文只按标点切分），检索时改用 pg_trgm 索引的子串匹配
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'voice_search') THEN
+        IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'zhparser') THEN
+            CREATE EXTENSION IF NOT EXISTS zhparser;
+            CREATE TEXT SEARCH CONFIGURATION voice_search (PARSER = zhparser);
+            ALTER TEXT SEARCH CONFIGURATION voice_search ADD MAPPING FOR n, v, a, i, e, l, j WITH simple;
+        ELSIF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'pg_jieba') THEN
+            CREATE EXTENSION IF NOT EXISTS pg_jieba;
+            CREATE TEXT SEARCH CONFIGURATION voice_search (COPY = jiebacfg);
+        ELSE
+            CREATE TEXT SEARCH CONFIGURATION voice_search (COPY = simple);
+        END IF;
+    END IF;
+END
+$$;
+
+-- 会话中的每轮对话：设备听到的内容与回复
+CREATE TABLE IF NOT EXISTS voice_conversation_turn (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id BIGINT NOT NULL REFERENCES voice_conversation(id) ON DELETE CASCADE,
+    device_sn VARCHAR(64) NOT NULL,
+    trace_id VARCHAR(64) NOT NULL DEFAULT '',
+    transcript TEXT NOT NULL DEFAULT '',     -- 用户语音的识别文本
+    reply TEXT NOT NULL DEFAULT '',          -- 助手的回复
+    intent VARCHAR(64) NOT NULL DEFAULT '',
+    audio_ref VARCHAR(255) NOT NULL DEFAULT '', -- 上行音频的存储位置
+    create_time TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('voice_search', transcript || ' ' || reply)
+    ) STORED
+);
+
+CREATE INDEX IF NOT EXISTS idx_voice_conversation_turn_conversation ON voice_conversation_turn(conversation_id, create_time);
+CREATE INDEX IF NOT EXISTS idx_voice_conversation_turn_sn ON voice_conversation_turn(device_sn, create_time);
+CREATE INDEX IF NOT EXISTS idx_voice_conversation_turn_search ON voice_conversation_turn USING GIN(search_vector);
+
+-- 没有中文分词时按识别文本与回复做子串匹配，表达式须与检索条件一致
+DO $$
+BEGIN
+    IF (SELECT p.prsname FROM pg_ts_config c JOIN pg_ts_parser p ON p.oid = c.cfgparser
+        WHERE c.cfgname = 'voice_search') = 'default' THEN
+        CREATE EXTENSION IF NOT EXISTS pg_trgm;
+        CREATE INDEX IF NOT EXISTS idx_voice_conversation_turn_trgm
+            ON voice_conversation_turn USING GIN ((transcript || ' ' || reply) gin_trgm_ops);
+    END IF;
+END
+$$;
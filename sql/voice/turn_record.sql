@@ -0,0 +1,33 @@
+-- migration: 20261017_create_voice_turn_record.up.sql
+-- 语音处理流程每轮的记录：各阶段完成时间、识别文本、意图、回复、模型用量与出错阶段
+CREATE TABLE IF NOT EXISTS voice_turn_record (
+    id BIGSERIAL PRIMARY KEY,
+    trace_id VARCHAR(64) NOT NULL,
+    device_sn VARCHAR(64) NOT NULL,
+    transcript TEXT NOT NULL DEFAULT '',
+    intent VARCHAR(64) NOT NULL DEFAULT '',
+    handled BOOLEAN NOT NULL DEFAULT FALSE,       -- 是否作为命令处理（未经对话模型）
+    reply TEXT NOT NULL DEFAULT '',
+    model_name VARCHAR(64) NOT NULL DEFAULT '',
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    error_stage VARCHAR(16) NOT NULL DEFAULT '',  -- 首个出错的阶段：upload / asr / nlu / intent / llm / tts / publish
+    error_message TEXT NOT NULL DEFAULT '',
+    start_time TIMESTAMPTZ NOT NULL,              -- 收到完整语句的时间
+    upload_time TIMESTAMPTZ NULL,                 -- 上行音频暂存完成
+    asr_time TIMESTAMPTZ NULL,                    -- 语音识别完成
+    nlu_time TIMESTAMPTZ NULL,                    -- 意图识别完成
+    intent_time TIMESTAMPTZ NULL,                 -- 命令类意图处理完成
+    llm_first_token_time TIMESTAMPTZ NULL,        -- 对话模型首个回复片段
+    llm_time TIMESTAMPTZ NULL,                    -- 对话模型回复完成
+    tts_first_audio_time TIMESTAMPTZ NULL,        -- 首个合成音频分块
+    publish_time TIMESTAMPTZ NULL,                -- 最后一次回复音频下发完成
+    end_time TIMESTAMPTZ NOT NULL,
+    first_audio_ms BIGINT NOT NULL DEFAULT 0,     -- 从收到语句到首个合成音频的毫秒数，0 表示没有音频
+    total_ms BIGINT NOT NULL DEFAULT 0,
+    create_time TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_voice_turn_record_trace_id ON voice_turn_record(trace_id);
+CREATE INDEX IF NOT EXISTS idx_voice_turn_record_sn_start ON voice_turn_record(device_sn, start_time);
+CREATE INDEX IF NOT EXISTS idx_voice_turn_record_start ON voice_turn_record(start_time);